@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"backend_test/model"
+	"backend_test/pkg/util/contextutil"
+	"backend_test/pkg/util/responseutil"
+	"backend_test/pkg/validator"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (h *Handler) Login(ctx echo.Context) error {
+	req := model.LoginRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	result, ce := h.authService.Login(ctx.Request().Context(), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) RefreshToken(ctx echo.Context) error {
+	req := model.RefreshTokenRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	result, ce := h.authService.Refresh(ctx.Request().Context(), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+// Logout revokes the session of the access token of the request
+func (h *Handler) Logout(ctx echo.Context) error {
+	req := model.LogoutRequest{}
+	if claims := contextutil.GetJwtClaims(ctx); claims != nil {
+		req.TokenID = claims.Jti
+		req.SessionID = claims.Sid
+		req.ExpiresAt = time.Unix(claims.Exp, 0)
+	}
+	ce := h.authService.Logout(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) AddUser(ctx echo.Context) error {
+	req := model.CreateUserRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	result, ce := h.credService.CreateUser(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) ForgotPassword(ctx echo.Context) error {
+	req := model.ForgotPasswordRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	req.ClientIP = ctx.RealIP()
+	ce := h.credService.ForgotPassword(ctx.Request().Context(), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) ResetPassword(ctx echo.Context) error {
+	req := model.ResetPasswordRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	req.ClientIP = ctx.RealIP()
+	ce := h.credService.ResetPassword(ctx.Request().Context(), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) VerifyEmail(ctx echo.Context) error {
+	req := model.VerifyEmailRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	req.ClientIP = ctx.RealIP()
+	ce := h.credService.VerifyEmail(ctx.Request().Context(), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) ResendEmailVerification(ctx echo.Context) error {
+	req := model.ResendEmailVerificationRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	req.ClientIP = ctx.RealIP()
+	ce := h.credService.ResendEmailVerification(ctx.Request().Context(), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
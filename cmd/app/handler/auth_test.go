@@ -0,0 +1,99 @@
+package handler
+
+import (
+	mocks "backend_test/mocks/service"
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/jsonutil"
+	pkgvalidator "backend_test/pkg/validator"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogin(t *testing.T) {
+	result := model.TokenResult{AccessToken: "access", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh"}
+	testCases := []struct {
+		Name             string
+		InitService      func(s *mocks.AuthService)
+		Json             string
+		ExpectedHttpCode int
+		ExpectedCode     string
+	}{
+		{
+			Name:             "InvalidParams",
+			InitService:      func(s *mocks.AuthService) {},
+			Json:             `{"email": "user"}`,
+			ExpectedHttpCode: http.StatusBadRequest,
+			ExpectedCode:     pkgerror.ErrInvalidParams.Code,
+		},
+		{
+			Name: "InvalidCredentials",
+			InitService: func(s *mocks.AuthService) {
+				s.On("Login", mock.Anything, mock.Anything).Return(nil, pkgerror.ErrInvalidCredentials)
+			},
+			Json:             `{"email": "user@gmail.com", "password": "wrong"}`,
+			ExpectedHttpCode: http.StatusUnauthorized,
+			ExpectedCode:     pkgerror.ErrInvalidCredentials.Code,
+		},
+		{
+			Name: "Success",
+			InitService: func(s *mocks.AuthService) {
+				s.On("Login", mock.Anything, model.LoginRequest{Email: "user@gmail.com", Password: "s3cret"}).Return(&result, pkgerror.NoError)
+			},
+			Json:             `{"email": "user@gmail.com", "password": "s3cret"}`,
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedCode:     "0000",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			e.Validator = pkgvalidator.New(validator.New())
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.Json))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath("/auth/login")
+			s := new(mocks.AuthService)
+			tc.InitService(s)
+			h := NewHandler(new(mocks.EmployeeService), new(mocks.RoleService), s, new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			if assert.NoError(t, h.Login(c)) {
+				assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+				jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+				assert.Nil(t, err)
+				assert.Equal(t, tc.ExpectedCode, jsonpath.GetString("code"))
+				if tc.ExpectedHttpCode == http.StatusOK {
+					assert.Equal(t, "access", jsonpath.GetString("data.access_token"))
+					assert.Equal(t, "refresh", jsonpath.GetString("data.refresh_token"))
+				}
+			}
+			s.AssertExpectations(t)
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	res := httptest.NewRecorder()
+	c := e.NewContext(req, res)
+	c.SetPath("/auth/logout")
+	exp := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	c.Set("jwt_claims", &model.JwtClaims{Jti: "token-1", Sid: "session-1", Exp: exp.Unix()})
+	s := new(mocks.AuthService)
+	s.On("Logout", mock.Anything, mock.Anything, mock.MatchedBy(func(req model.LogoutRequest) bool {
+		return req.TokenID == "token-1" && req.SessionID == "session-1" && req.ExpiresAt.Equal(exp)
+	})).Return(pkgerror.NoError)
+	h := NewHandler(new(mocks.EmployeeService), new(mocks.RoleService), s, new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+	if assert.NoError(t, h.Logout(c)) {
+		assert.Equal(t, http.StatusOK, res.Code)
+	}
+	s.AssertExpectations(t)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"backend_test/model"
+	"backend_test/pkg/middleware"
+	"backend_test/pkg/util/contextutil"
+	"backend_test/pkg/util/responseutil"
+	"backend_test/pkg/validator"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (h *Handler) GetClients(ctx echo.Context) error {
+	results, ce := h.clientService.GetClients(ctx.Request().Context(), contextutil.GetPrincipal(ctx))
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, results, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) AddClient(ctx echo.Context) error {
+	req := model.CreateClientRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	result, ce := h.clientService.CreateClient(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) DisableClient(ctx echo.Context) error {
+	req := model.DisableClientRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	ce := h.clientService.DisableClient(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) SetClientPublicKey(ctx echo.Context) error {
+	req := model.SetClientPublicKeyRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	ce := h.clientService.SetClientPublicKey(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) SetClientResponseMode(ctx echo.Context) error {
+	req := model.SetClientResponseModeRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	ce := h.clientService.SetClientResponseMode(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) SetClientResponseSigning(ctx echo.Context) error {
+	req := model.SetClientResponseSigningRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	ce := h.clientService.SetClientResponseSigning(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) B2BAccessToken(ctx echo.Context) error {
+	req := model.B2BTokenRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	header := ctx.Request().Header
+	req.ClientKey = header.Get(middleware.HeaderClientKey)
+	req.Timestamp = header.Get(middleware.HeaderTimestamp)
+	req.Signature = header.Get(middleware.HeaderSignature)
+	result, ce := h.clientService.IssueB2BToken(ctx.Request().Context(), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
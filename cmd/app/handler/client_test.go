@@ -0,0 +1,89 @@
+package handler
+
+import (
+	mocks "backend_test/mocks/service"
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/middleware"
+	"backend_test/pkg/util/jsonutil"
+	pkgvalidator "backend_test/pkg/validator"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestB2BAccessToken(t *testing.T) {
+	result := model.B2BTokenResult{AccessToken: "access", TokenType: "Bearer", ExpiresIn: "900"}
+	signed := model.B2BTokenRequest{
+		GrantType: "client_credentials",
+		ClientKey: "payroll-key",
+		Timestamp: "2026-10-18T19:00:00+07:00",
+		Signature: "signature",
+	}
+	testCases := []struct {
+		Name             string
+		InitService      func(s *mocks.ClientService)
+		Json             string
+		ExpectedHttpCode int
+		ExpectedCode     string
+	}{
+		{
+			Name:             "InvalidGrantType",
+			InitService:      func(s *mocks.ClientService) {},
+			Json:             `{"grantType": "password"}`,
+			ExpectedHttpCode: http.StatusBadRequest,
+			ExpectedCode:     pkgerror.ErrInvalidParams.Code,
+		},
+		{
+			Name: "InvalidSignature",
+			InitService: func(s *mocks.ClientService) {
+				s.On("IssueB2BToken", mock.Anything, signed).Return(nil, pkgerror.ErrInvalidSignature)
+			},
+			Json:             `{"grantType": "client_credentials"}`,
+			ExpectedHttpCode: http.StatusUnauthorized,
+			ExpectedCode:     pkgerror.ErrInvalidSignature.Code,
+		},
+		{
+			Name: "Success",
+			InitService: func(s *mocks.ClientService) {
+				s.On("IssueB2BToken", mock.Anything, signed).Return(&result, pkgerror.NoError)
+			},
+			Json:             `{"grantType": "client_credentials"}`,
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedCode:     "0000",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			e.Validator = pkgvalidator.New(validator.New())
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.Json))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(middleware.HeaderClientKey, "payroll-key")
+			req.Header.Set(middleware.HeaderTimestamp, "2026-10-18T19:00:00+07:00")
+			req.Header.Set(middleware.HeaderSignature, "signature")
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath("/v1.0/access-token/b2b")
+			s := new(mocks.ClientService)
+			tc.InitService(s)
+			h := NewHandler(new(mocks.EmployeeService), new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), s)
+			if assert.NoError(t, h.B2BAccessToken(c)) {
+				assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+				jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+				assert.Nil(t, err)
+				assert.Equal(t, tc.ExpectedCode, jsonpath.GetString("code"))
+				if tc.ExpectedHttpCode == http.StatusOK {
+					assert.Equal(t, "access", jsonpath.GetString("data.accessToken"))
+					assert.Equal(t, "900", jsonpath.GetString("data.expiresIn"))
+				}
+			}
+			s.AssertExpectations(t)
+		})
+	}
+}
@@ -2,21 +2,81 @@ package handler
 
 import (
 	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/contextutil"
+	"backend_test/pkg/util/etagutil"
+	"backend_test/pkg/util/patchutil"
 	"backend_test/pkg/util/responseutil"
 	"backend_test/pkg/validator"
+	"errors"
+	"io"
+	"net/http"
 
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	maxPatchSize = 64 << 10
+
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+func bindEmployeesFilter(ctx echo.Context, filter *model.GetEmployeesFilter) pkgerror.CustomError {
+	if err := validator.BindAndValidate(ctx, filter); !err.IsNoError() {
+		return err
+	}
+	sorts, err := model.ParseEmployeeSort(filter.Sort)
+	if err != nil {
+		return pkgerror.ErrInvalidParams.WithError(err)
+	}
+	filter.Sorts = sorts
+	filter.FilterExpr, err = model.ParseEmployeeFilterExpr(filter.Filter)
+	if err != nil {
+		return pkgerror.ErrInvalidParams.WithError(err)
+	}
+	defaultPageRequest(&filter.PageRequest)
+	return pkgerror.NoError
+}
+
 func (h *Handler) GetEmployees(ctx echo.Context) error {
 	var filter model.GetEmployeesFilter
-	if err := validator.BindAndValidate(ctx, &filter); !err.IsNoError() {
+	if err := bindEmployeesFilter(ctx, &filter); !err.IsNoError() {
 		return responseutil.SendErrorResponse(ctx, err)
 	}
-	defaultPageRequest(&filter.PageRequest)
-	results, err := h.employeeService.GetEmployees(ctx, filter)
+	defaultCursorRequest(&filter.CursorRequest)
+	results, pagination, err := h.employeeService.GetEmployees(ctx.Request().Context(), contextutil.GetPrincipal(ctx), filter)
 	if err.IsNoError() {
-		return responseutil.SendSuccessReponse(ctx, results, nil)
+		responseutil.SetPaginationHeaders(ctx, pagination)
+		return responseutil.SendSuccessReponse(ctx, results, pagination)
+	}
+	return responseutil.SendErrorResponse(ctx, err)
+}
+
+func (h *Handler) GetDeletedEmployees(ctx echo.Context) error {
+	var filter model.GetEmployeesFilter
+	if err := bindEmployeesFilter(ctx, &filter); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	results, pagination, err := h.employeeService.GetDeletedEmployees(ctx.Request().Context(), contextutil.GetPrincipal(ctx), filter)
+	if err.IsNoError() {
+		responseutil.SetPaginationHeaders(ctx, pagination)
+		return responseutil.SendSuccessReponse(ctx, results, pagination)
+	}
+	return responseutil.SendErrorResponse(ctx, err)
+}
+
+func (h *Handler) SearchEmployees(ctx echo.Context) error {
+	var req model.SearchEmployeesRequest
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	defaultPageRequest(&req.PageRequest)
+	results, pagination, err := h.employeeService.SearchEmployees(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if err.IsNoError() {
+		responseutil.SetPaginationHeaders(ctx, pagination)
+		return responseutil.SendSuccessReponse(ctx, results, pagination)
 	}
 	return responseutil.SendErrorResponse(ctx, err)
 }
@@ -26,8 +86,9 @@ func (h *Handler) AddEmployee(ctx echo.Context) error {
 	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
 		return responseutil.SendErrorResponse(ctx, err)
 	}
-	result, ce := h.employeeService.CreateEmployee(ctx, req)
+	result, ce := h.employeeService.CreateEmployee(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
 	if ce.IsNoError() {
+		ctx.Response().Header().Set(headerETag, etagutil.Version(result.Version))
 		return responseutil.SendSuccessReponse(ctx, result, nil)
 	}
 	return responseutil.SendErrorResponse(ctx, ce)
@@ -38,8 +99,13 @@ func (h *Handler) GetEmployeeByID(ctx echo.Context) error {
 	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
 		return responseutil.SendErrorResponse(ctx, err)
 	}
-	result, ce := h.employeeService.GetEmployeeByID(ctx, req)
+	result, ce := h.employeeService.GetEmployeeByID(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
 	if ce.IsNoError() {
+		etag := etagutil.Version(result.Version)
+		ctx.Response().Header().Set(headerETag, etag)
+		if etagutil.MatchWeak(ctx.Request().Header.Get(headerIfNoneMatch), etag) {
+			return ctx.NoContent(http.StatusNotModified)
+		}
 		return responseutil.SendSuccessReponse(ctx, result, nil)
 	}
 	return responseutil.SendErrorResponse(ctx, ce)
@@ -50,8 +116,42 @@ func (h *Handler) EditEmployee(ctx echo.Context) error {
 	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
 		return responseutil.SendErrorResponse(ctx, err)
 	}
-	result, ce := h.employeeService.EditEmployee(ctx, req)
+	req.IfMatch = ctx.Request().Header.Get(headerIfMatch)
+	result, ce := h.employeeService.EditEmployee(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		ctx.Response().Header().Set(headerETag, etagutil.Version(result.Version))
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) PatchEmployee(ctx echo.Context) error {
+	ctx.Response().Header().Set("Accept-Patch", patchutil.MIMEMergePatch+", "+patchutil.MIMEJsonPatch)
+	req := model.PatchEmployeeRequest{}
+	if err := (&echo.DefaultBinder{}).BindPathParams(ctx, &req); err != nil {
+		return responseutil.SendErrorResponse(ctx, pkgerror.ErrInvalidParams.WithError(err))
+	}
+	if err := ctx.Validate(&req); err != nil {
+		return responseutil.SendErrorResponse(ctx, pkgerror.ErrInvalidParams.WithError(err))
+	}
+	patchType, err := patchutil.ParsePatchType(ctx.Request().Header.Get(echo.HeaderContentType))
+	if err != nil {
+		return responseutil.SendErrorResponse(ctx, pkgerror.ErrUnsupportedMediaType.WithError(err))
+	}
+	patch, err := io.ReadAll(http.MaxBytesReader(ctx.Response(), ctx.Request().Body, maxPatchSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return responseutil.SendErrorResponse(ctx, pkgerror.ErrRequestTooLarge.WithError(err))
+		}
+		return responseutil.SendErrorResponse(ctx, pkgerror.ErrInvalidParams.WithError(err))
+	}
+	req.PatchType = patchType
+	req.Patch = patch
+	req.IfMatch = ctx.Request().Header.Get(headerIfMatch)
+	result, ce := h.employeeService.PatchEmployee(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
 	if ce.IsNoError() {
+		ctx.Response().Header().Set(headerETag, etagutil.Version(result.Version))
 		return responseutil.SendSuccessReponse(ctx, result, nil)
 	}
 	return responseutil.SendErrorResponse(ctx, ce)
@@ -62,9 +162,22 @@ func (h *Handler) DeleteEmployeeByID(ctx echo.Context) error {
 	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
 		return responseutil.SendErrorResponse(ctx, err)
 	}
-	ce := h.employeeService.DeleteEmployeeByID(ctx, req)
+	req.IfMatch = ctx.Request().Header.Get(headerIfMatch)
+	ce := h.employeeService.DeleteEmployeeByID(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
 	if ce.IsNoError() {
 		return responseutil.SendSuccessReponse(ctx, nil, nil)
 	}
 	return responseutil.SendErrorResponse(ctx, ce)
 }
+
+func (h *Handler) RestoreEmployee(ctx echo.Context) error {
+	req := model.RestoreEmployeeRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	result, ce := h.employeeService.RestoreEmployee(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
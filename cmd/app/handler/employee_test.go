@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"backend_test/constant"
 	mocks "backend_test/mocks/service"
 	"backend_test/model"
 	pkgerror "backend_test/pkg/error"
 	"backend_test/pkg/util/jsonutil"
+	"backend_test/pkg/util/patchutil"
 	"backend_test/pkg/util/responseutil"
 	pkgvalidator "backend_test/pkg/validator"
 	"github.com/go-playground/validator/v10"
@@ -15,6 +17,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 )
@@ -33,7 +36,7 @@ func TestGetEmployeeByID(t *testing.T) {
 		{
 			Name: "InvalidParams",
 			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
-				return NewHandler(s)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
 			},
 			ExpectedHttpCode:     http.StatusBadRequest,
 			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrInvalidParams),
@@ -41,8 +44,8 @@ func TestGetEmployeeByID(t *testing.T) {
 		{
 			Name: "ServiceError",
 			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
-				s.On("GetEmployeeByID", mock.Anything, mock.Anything).Return(nil, pkgerror.ErrSystemError)
-				return NewHandler(s)
+				s.On("GetEmployeeByID", mock.Anything, mock.Anything, mock.Anything).Return(nil, pkgerror.ErrSystemError)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
 			},
 			PathEmployeeID:       "1",
 			ExpectedHttpCode:     http.StatusInternalServerError,
@@ -51,8 +54,8 @@ func TestGetEmployeeByID(t *testing.T) {
 		{
 			Name: "Success",
 			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
-				s.On("GetEmployeeByID", mock.Anything, mock.Anything).Return(&result, pkgerror.NoError)
-				return NewHandler(s)
+				s.On("GetEmployeeByID", mock.Anything, mock.Anything, mock.Anything).Return(&result, pkgerror.NoError)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
 			},
 			PathEmployeeID:       "1",
 			ExpectedHttpCode:     http.StatusOK,
@@ -90,6 +93,87 @@ func TestGetEmployeeByID(t *testing.T) {
 	}
 }
 
+func TestGetEmployeeByIDConditional(t *testing.T) {
+	result := model.GetEmployeeByIDResult{
+		ID:      1,
+		Version: 3,
+	}
+	testCases := []struct {
+		Name             string
+		IfNoneMatch      string
+		ExpectedHttpCode int
+	}{
+		{
+			Name:             "NoHeader",
+			ExpectedHttpCode: http.StatusOK,
+		},
+		{
+			Name:             "Stale",
+			IfNoneMatch:      `"2"`,
+			ExpectedHttpCode: http.StatusOK,
+		},
+		{
+			Name:             "NotModified",
+			IfNoneMatch:      `"1", W/"3"`,
+			ExpectedHttpCode: http.StatusNotModified,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			e.Validator = pkgvalidator.New(validator.New())
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.IfNoneMatch != "" {
+				req.Header.Set(headerIfNoneMatch, tc.IfNoneMatch)
+			}
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath("/v1/employees/:id")
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+			s := new(mocks.EmployeeService)
+			s.On("GetEmployeeByID", mock.Anything, mock.Anything, mock.Anything).Return(&result, pkgerror.NoError)
+			h := NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			if assert.NoError(t, h.GetEmployeeByID(c)) {
+				assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+				assert.Equal(t, `"3"`, res.Header().Get(headerETag))
+				if tc.ExpectedHttpCode == http.StatusNotModified {
+					assert.Empty(t, res.Body.String())
+				}
+			}
+			s.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetEmployeeByIDPrincipal(t *testing.T) {
+	claims := model.JwtClaims{}
+	claims.User.ID = 7
+	claims.User.Email = "admin@email.com"
+	claims.User.Superadmin = true
+	e := echo.New()
+	e.Validator = pkgvalidator.New(validator.New())
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	res := httptest.NewRecorder()
+	c := e.NewContext(req, res)
+	c.SetPath("/v1/employees/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	c.Set("jwt_claims", &claims)
+	s := new(mocks.EmployeeService)
+	s.On("GetEmployeeByID", req.Context(), model.Principal{
+		UserID:     7,
+		Email:      "admin@email.com",
+		Superadmin: true,
+		AppIDs:     []int{},
+	}, model.GetEmployeeByIDRequest{EmployeeID: 1}).Return(&model.GetEmployeeByIDResult{ID: 1}, pkgerror.NoError)
+	h := NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+	if assert.NoError(t, h.GetEmployeeByID(c)) {
+		assert.Equal(t, http.StatusOK, res.Code)
+	}
+	s.AssertExpectations(t)
+}
+
 func TestAddEmployee(t *testing.T) {
 	validJson := `{
 		"first_name": "Ryo",
@@ -110,7 +194,7 @@ func TestAddEmployee(t *testing.T) {
 		{
 			Name: "InvalidParams",
 			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
-				return NewHandler(s)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
 			},
 			ExpectedHttpCode:     http.StatusBadRequest,
 			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrInvalidParams),
@@ -118,8 +202,8 @@ func TestAddEmployee(t *testing.T) {
 		{
 			Name: "ServiceError",
 			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
-				s.On("CreateEmployee", mock.Anything, mock.Anything).Return(nil, pkgerror.ErrSystemError)
-				return NewHandler(s)
+				s.On("CreateEmployee", mock.Anything, mock.Anything, mock.Anything).Return(nil, pkgerror.ErrSystemError)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
 			},
 			Json:                 validJson,
 			ExpectedHttpCode:     http.StatusInternalServerError,
@@ -128,8 +212,8 @@ func TestAddEmployee(t *testing.T) {
 		{
 			Name: "Success",
 			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
-				s.On("CreateEmployee", mock.Anything, mock.Anything).Return(&result, pkgerror.NoError)
-				return NewHandler(s)
+				s.On("CreateEmployee", mock.Anything, mock.Anything, mock.Anything).Return(&result, pkgerror.NoError)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
 			},
 			Json:                 validJson,
 			ExpectedHttpCode:     http.StatusOK,
@@ -167,3 +251,296 @@ func TestAddEmployee(t *testing.T) {
 		})
 	}
 }
+
+func TestGetEmployees(t *testing.T) {
+	results := []model.GetEmployeesResult{{ID: 1}}
+	testCases := []struct {
+		Name                 string
+		InitHandler          func(ctx echo.Context, s *mocks.EmployeeService) *Handler
+		Query                string
+		ExpectedHttpCode     int
+		ExpectedResponseBody model.ResponseBody
+		ExpectedTotalCount   string
+		ExpectedLink         string
+	}{
+		{
+			Name: "ServiceError",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				s.On("GetEmployees", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil, pkgerror.ErrSystemError)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			ExpectedHttpCode:     http.StatusInternalServerError,
+			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrSystemError),
+		},
+		{
+			Name: "InvalidSortColumn",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			Query:                "sort=hire_date,-password",
+			ExpectedHttpCode:     http.StatusBadRequest,
+			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrInvalidParams),
+		},
+		{
+			Name: "Sorted",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				s.On("GetEmployees", mock.Anything, mock.Anything, mock.MatchedBy(func(f model.GetEmployeesFilter) bool {
+					return assert.ObjectsAreEqual([]model.EmployeeSort{
+						{Column: constant.EmployeeColumnHireDate, Dir: "asc"},
+						{Column: constant.EmployeeColumnLastName, Dir: "desc"},
+					}, f.Sorts)
+				})).Return(&results, model.NewPagination(model.PageRequest{PageNum: 1, PageSize: 10}, 1), pkgerror.NoError)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			Query:                "sort=hire_date,-last_name",
+			ExpectedHttpCode:     http.StatusOK,
+			ExpectedResponseBody: responseutil.CreateSuccessResponse(&results, nil),
+			ExpectedTotalCount:   "1",
+			ExpectedLink:         `<http://example.com/employees?page_num=1&sort=hire_date%2C-last_name>; rel="first", <http://example.com/employees?page_num=1&sort=hire_date%2C-last_name>; rel="last"`,
+		},
+		{
+			Name: "InvalidFilterExpression",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			Query:                "filter=" + url.QueryEscape("hire_date ge 2020-01-01 and (last_name sw 'Sa'"),
+			ExpectedHttpCode:     http.StatusBadRequest,
+			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrInvalidParams),
+		},
+		{
+			Name: "InvalidDateFilter",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			Query:                "hire_date_from=01-01-2020",
+			ExpectedHttpCode:     http.StatusBadRequest,
+			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrInvalidParams),
+		},
+		{
+			Name: "Filtered",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				s.On("GetEmployees", mock.Anything, mock.Anything, mock.MatchedBy(func(f model.GetEmployeesFilter) bool {
+					return assert.ObjectsAreEqual([]int{1, 2}, f.IDs) &&
+						f.EmailPrefix == "ryo" &&
+						f.HireDateFrom != nil && f.HireDateFrom.DateOnly &&
+						f.HireDateFrom.Format(model.DateLayout) == "2020-01-01" &&
+						f.UpdatedSince != nil && !f.UpdatedSince.DateOnly
+				})).Return(&results, model.NewPagination(model.PageRequest{PageNum: 1, PageSize: 10}, 1), pkgerror.NoError)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			Query:                "id=1&id=2&email_prefix=ryo&hire_date_from=2020-01-01&updated_since=2023-01-01T10:00:00Z",
+			ExpectedHttpCode:     http.StatusOK,
+			ExpectedResponseBody: responseutil.CreateSuccessResponse(&results, nil),
+			ExpectedTotalCount:   "1",
+			ExpectedLink: `<http://example.com/employees?email_prefix=ryo&hire_date_from=2020-01-01&id=1&id=2&page_num=1&updated_since=2023-01-01T10%3A00%3A00Z>; rel="first", ` +
+				`<http://example.com/employees?email_prefix=ryo&hire_date_from=2020-01-01&id=1&id=2&page_num=1&updated_since=2023-01-01T10%3A00%3A00Z>; rel="last"`,
+		},
+		{
+			Name: "MaxPageSize",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				s.On("GetEmployees", mock.Anything, mock.Anything, mock.MatchedBy(func(f model.GetEmployeesFilter) bool {
+					return f.PageRequest.PageNum == 1 && f.PageRequest.PageSize == 100
+				})).Return(&results, model.NewPagination(model.PageRequest{PageNum: 1, PageSize: 100}, 1), pkgerror.NoError)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			Query:                "page_size=5000",
+			ExpectedHttpCode:     http.StatusOK,
+			ExpectedResponseBody: responseutil.CreateSuccessResponse(&results, nil),
+			ExpectedTotalCount:   "1",
+			ExpectedLink:         `<http://example.com/employees?page_num=1&page_size=100>; rel="first", <http://example.com/employees?page_num=1&page_size=100>; rel="last"`,
+		},
+		{
+			Name: "Success",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				s.On("GetEmployees", mock.Anything, mock.Anything, mock.Anything).Return(&results, model.NewPagination(model.PageRequest{PageNum: 2, PageSize: 10}, 35), pkgerror.NoError)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			Query:                "page_num=2",
+			ExpectedHttpCode:     http.StatusOK,
+			ExpectedResponseBody: responseutil.CreateSuccessResponse(&results, nil),
+			ExpectedTotalCount:   "35",
+			ExpectedLink: `<http://example.com/employees?page_num=1>; rel="first", ` +
+				`<http://example.com/employees?page_num=1>; rel="prev", ` +
+				`<http://example.com/employees?page_num=3>; rel="next", ` +
+				`<http://example.com/employees?page_num=4>; rel="last"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			e.Validator = pkgvalidator.New(validator.New())
+			req := httptest.NewRequest(http.MethodGet, "/employees?"+tc.Query, nil)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath("/employees")
+			s := new(mocks.EmployeeService)
+			h := tc.InitHandler(c, s)
+			if assert.NoError(t, h.GetEmployees(c)) {
+				assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+				expected := tc.ExpectedResponseBody
+				jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+				assert.Nil(t, err)
+				assert.Equal(t, expected.Status, jsonpath.GetString("status"))
+				assert.Equal(t, expected.Code, jsonpath.GetString("code"))
+				assert.Equal(t, expected.ErrorMessage, jsonpath.GetStringPtr("error_message"))
+				assert.Equal(t, tc.ExpectedTotalCount, res.Header().Get("X-Total-Count"))
+				assert.Equal(t, tc.ExpectedLink, res.Header().Get("Link"))
+				if expected.Data != nil {
+					assert.Equal(t, 1, jsonpath.GetInt("data[0].id"))
+					assert.NotNil(t, jsonpath.Get("pagination.total_page"))
+				}
+			}
+			s.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSearchEmployees(t *testing.T) {
+	results := []model.SearchEmployeesResult{{GetEmployeesResult: model.GetEmployeesResult{ID: 1}, MatchType: constant.SearchMatchTypeFullText}}
+	testCases := []struct {
+		Name                 string
+		InitHandler          func(ctx echo.Context, s *mocks.EmployeeService) *Handler
+		Query                string
+		ExpectedHttpCode     int
+		ExpectedResponseBody model.ResponseBody
+	}{
+		{
+			Name: "MissingQuery",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			ExpectedHttpCode:     http.StatusBadRequest,
+			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrInvalidParams),
+		},
+		{
+			Name: "Success",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				s.On("SearchEmployees", mock.Anything, mock.Anything, model.SearchEmployeesRequest{
+					Query:       "ryo",
+					PageRequest: model.PageRequest{PageNum: 1, PageSize: 10},
+				}).Return(&results, model.NewPagination(model.PageRequest{PageNum: 1, PageSize: 10}, 1), pkgerror.NoError)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			Query:                "q=ryo",
+			ExpectedHttpCode:     http.StatusOK,
+			ExpectedResponseBody: responseutil.CreateSuccessResponse(&results, nil),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			v := validator.New()
+			v.RegisterValidation("notblank", validators.NotBlank)
+			e := echo.New()
+			e.Validator = pkgvalidator.New(v)
+			req := httptest.NewRequest(http.MethodGet, "/employees/search?"+tc.Query, nil)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath("/employees/search")
+			s := new(mocks.EmployeeService)
+			h := tc.InitHandler(c, s)
+			if assert.NoError(t, h.SearchEmployees(c)) {
+				assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+				expected := tc.ExpectedResponseBody
+				jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+				assert.Nil(t, err)
+				assert.Equal(t, expected.Status, jsonpath.GetString("status"))
+				assert.Equal(t, expected.Code, jsonpath.GetString("code"))
+				if expected.Data != nil {
+					assert.Equal(t, 1, jsonpath.GetInt("data[0].id"))
+					assert.Equal(t, "fulltext", jsonpath.GetString("data[0].match_type"))
+				}
+			}
+			s.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPatchEmployee(t *testing.T) {
+	result := model.EditEmployeeResult{
+		ID: 1,
+	}
+	testCases := []struct {
+		Name                 string
+		InitHandler          func(ctx echo.Context, s *mocks.EmployeeService) *Handler
+		ContentType          string
+		Body                 string
+		ExpectedHttpCode     int
+		ExpectedResponseBody model.ResponseBody
+	}{
+		{
+			Name: "UnsupportedContentType",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			ContentType:          echo.MIMEApplicationJSON,
+			Body:                 `{"email": "new@email.com"}`,
+			ExpectedHttpCode:     http.StatusUnsupportedMediaType,
+			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrUnsupportedMediaType),
+		},
+		{
+			Name: "MergePatch",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				s.On("PatchEmployee", mock.Anything, mock.Anything, model.PatchEmployeeRequest{
+					EmployeeID: 1,
+					PatchType:  patchutil.MIMEMergePatch,
+					Patch:      []byte(`{"email": "new@email.com"}`),
+					IfMatch:    `"1"`,
+				}).Return(&result, pkgerror.NoError)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			ContentType:          patchutil.MIMEMergePatch + "; charset=utf-8",
+			Body:                 `{"email": "new@email.com"}`,
+			ExpectedHttpCode:     http.StatusOK,
+			ExpectedResponseBody: responseutil.CreateSuccessResponse(&result, nil),
+		},
+		{
+			Name: "JsonPatch",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				s.On("PatchEmployee", mock.Anything, mock.Anything, mock.MatchedBy(func(req model.PatchEmployeeRequest) bool {
+					return req.PatchType == patchutil.MIMEJsonPatch
+				})).Return(nil, pkgerror.ErrInvalidParams)
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			ContentType:          patchutil.MIMEJsonPatch,
+			Body:                 `[{"op": "remove", "path": "/email"}]`,
+			ExpectedHttpCode:     http.StatusBadRequest,
+			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrInvalidParams),
+		},
+		{
+			Name: "TooLarge",
+			InitHandler: func(ctx echo.Context, s *mocks.EmployeeService) *Handler {
+				return NewHandler(s, new(mocks.RoleService), new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			ContentType:          patchutil.MIMEMergePatch,
+			Body:                 "{" + strings.Repeat(" ", maxPatchSize) + "}",
+			ExpectedHttpCode:     http.StatusRequestEntityTooLarge,
+			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrRequestTooLarge),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			e.Validator = pkgvalidator.New(validator.New())
+			req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(tc.Body))
+			req.Header.Set(echo.HeaderContentType, tc.ContentType)
+			req.Header.Set(headerIfMatch, `"1"`)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath("/employees/:id")
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+			s := new(mocks.EmployeeService)
+			h := tc.InitHandler(c, s)
+			if assert.NoError(t, h.PatchEmployee(c)) {
+				assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+				assert.Contains(t, res.Header().Get("Accept-Patch"), patchutil.MIMEMergePatch)
+				expected := tc.ExpectedResponseBody
+				jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+				assert.Nil(t, err)
+				assert.Equal(t, expected.Status, jsonpath.GetString("status"))
+				assert.Equal(t, expected.Code, jsonpath.GetString("code"))
+			}
+			s.AssertExpectations(t)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"backend_test/model"
+	"backend_test/pkg/config"
 	"backend_test/service"
 
 	"github.com/labstack/echo/v4"
@@ -9,13 +10,28 @@ import (
 
 type Handler struct {
 	employeeService service.EmployeeService
+	roleService     service.RoleService
+	authService     service.AuthService
+	mfaService      service.MfaService
+	credService     service.CredentialService
+	clientService   service.ClientService
 }
 
 func NewHandler(
 	employeeService service.EmployeeService,
+	roleService service.RoleService,
+	authService service.AuthService,
+	mfaService service.MfaService,
+	credService service.CredentialService,
+	clientService service.ClientService,
 ) *Handler {
 	return &Handler{
 		employeeService: employeeService,
+		roleService:     roleService,
+		authService:     authService,
+		mfaService:      mfaService,
+		credService:     credService,
+		clientService:   clientService,
 	}
 }
 
@@ -24,16 +40,67 @@ func defaultPageRequest(pr *model.PageRequest) {
 		pr.PageNum = 1
 	}
 	if pr.PageSize == 0 {
+		pr.PageSize = config.Data.Pagination.DefaultPageSize
+	}
+	if pr.PageSize <= 0 {
 		pr.PageSize = 10
 	}
+	if max := config.Data.Pagination.MaxPageSize; max > 0 && pr.PageSize > max {
+		pr.PageSize = max
+	}
+}
+
+func defaultCursorRequest(cr *model.CursorRequest) {
+	if !cr.IsCursorMode() {
+		return
+	}
+	pr := model.PageRequest{PageSize: cr.Limit}
+	defaultPageRequest(&pr)
+	cr.Limit = pr.PageSize
 }
 
 func RegisterHandlers(e *echo.Echo, h *Handler) {
 
 	e.GET("/employees", h.GetEmployees)
+	e.GET("/employees/search", h.SearchEmployees)
+	e.GET("/employees/trash", h.GetDeletedEmployees)
 	e.GET("/employees/:id", h.GetEmployeeByID)
 	e.POST("/employees", h.AddEmployee)
 	e.PUT("/employees/:id", h.EditEmployee)
+	e.PATCH("/employees/:id", h.PatchEmployee)
 	e.DELETE("/employees/:id", h.DeleteEmployeeByID)
+	e.POST("/employees/:id/restore", h.RestoreEmployee)
+
+	e.GET("/roles", h.GetRoles)
+	e.GET("/roles/:id", h.GetRoleByID)
+	e.POST("/roles", h.AddRole)
+	e.PUT("/roles/:id", h.EditRole)
+	e.DELETE("/roles/:id", h.DeleteRole)
+	e.GET("/permissions", h.GetPermissions)
+	e.POST("/permissions", h.AddPermission)
+	e.DELETE("/permissions/:id", h.DeletePermission)
+	e.GET("/users/:userId/roles", h.GetUserRoles)
+	e.PUT("/users/:userId/roles/:roleId", h.AssignUserRole)
+	e.DELETE("/users/:userId/roles/:roleId", h.RevokeUserRole)
+
+	e.POST("/auth/login", h.Login)
+	e.POST("/auth/refresh", h.RefreshToken)
+	e.POST("/auth/logout", h.Logout)
+	e.POST("/users", h.AddUser)
+	e.POST("/auth/mfa/enroll", h.EnrollMfa)
+	e.POST("/auth/mfa/confirm", h.ConfirmMfa)
+	e.POST("/auth/mfa/verify", h.VerifyMfa)
+	e.DELETE("/users/:userId/mfa", h.ResetMfa)
+	e.POST("/auth/password/forgot", h.ForgotPassword)
+	e.POST("/auth/password/reset", h.ResetPassword)
+	e.POST("/auth/email/verify", h.VerifyEmail)
+	e.POST("/auth/email/resend", h.ResendEmailVerification)
+	e.GET("/clients", h.GetClients)
+	e.POST("/clients", h.AddClient)
+	e.DELETE("/clients/:id", h.DisableClient)
+	e.PUT("/clients/:id/public-key", h.SetClientPublicKey)
+	e.PUT("/clients/:id/response-mode", h.SetClientResponseMode)
+	e.PUT("/clients/:id/response-signing", h.SetClientResponseSigning)
+	e.POST("/v1.0/access-token/b2b", h.B2BAccessToken)
 
 }
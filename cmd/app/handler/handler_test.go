@@ -3,7 +3,9 @@ package handler
 import (
 	mocks "backend_test/mocks/service"
 	"backend_test/pkg/config"
+	"backend_test/pkg/middleware"
 	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
 	"log"
 	"os"
 	"testing"
@@ -21,6 +23,18 @@ func TestMain(m *testing.M) {
 func TestRegisterHandlers(t *testing.T) {
 	h := NewHandler(
 		&mocks.EmployeeService{},
+		&mocks.RoleService{},
+		&mocks.AuthService{},
+		&mocks.MfaService{},
+		&mocks.CredentialService{},
+		&mocks.ClientService{},
 	)
-	RegisterHandlers(echo.New(), h)
+	e := echo.New()
+	RegisterHandlers(e, h)
+	permissions, err := middleware.NewPermissionMap(config.Data.Permissions)
+	assert.Nil(t, err)
+	assert.Nil(t, permissions.Validate(e.Routes()))
+	idempotentRoutes, err := middleware.NewIdempotencyRouteMap(config.Data.Idempotency.Routes)
+	assert.Nil(t, err)
+	assert.Nil(t, idempotentRoutes.Validate(e.Routes()))
 }
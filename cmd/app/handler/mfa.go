@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"backend_test/model"
+	"backend_test/pkg/util/contextutil"
+	"backend_test/pkg/util/responseutil"
+	"backend_test/pkg/validator"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (h *Handler) EnrollMfa(ctx echo.Context) error {
+	result, ce := h.mfaService.Enroll(ctx.Request().Context(), contextutil.GetPrincipal(ctx))
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) ConfirmMfa(ctx echo.Context) error {
+	req := model.ConfirmMfaRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	req.SessionKey = contextutil.GetSessionKey(ctx)
+	result, ce := h.mfaService.Confirm(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) VerifyMfa(ctx echo.Context) error {
+	req := model.VerifyMfaRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	req.SessionKey = contextutil.GetSessionKey(ctx)
+	ce := h.mfaService.Verify(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) ResetMfa(ctx echo.Context) error {
+	req := model.ResetMfaRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	req.Issuer = ctx.QueryParam(queryIssuer)
+	ce := h.mfaService.Reset(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"backend_test/model"
+	"backend_test/pkg/util/contextutil"
+	"backend_test/pkg/util/responseutil"
+	"backend_test/pkg/validator"
+
+	"github.com/labstack/echo/v4"
+)
+
+// queryIssuer names the issuer of the user of a /users route, the users of
+// each token issuer are distinct
+const queryIssuer = "issuer"
+
+func (h *Handler) GetRoles(ctx echo.Context) error {
+	results, ce := h.roleService.GetRoles(ctx.Request().Context(), contextutil.GetPrincipal(ctx))
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, results, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) GetRoleByID(ctx echo.Context) error {
+	req := model.GetRoleByIDRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	result, ce := h.roleService.GetRoleByID(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) AddRole(ctx echo.Context) error {
+	req := model.CreateRoleRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	result, ce := h.roleService.CreateRole(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) EditRole(ctx echo.Context) error {
+	req := model.EditRoleRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	result, ce := h.roleService.EditRole(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) DeleteRole(ctx echo.Context) error {
+	req := model.DeleteRoleRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	ce := h.roleService.DeleteRole(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) GetPermissions(ctx echo.Context) error {
+	results, ce := h.roleService.GetPermissions(ctx.Request().Context(), contextutil.GetPrincipal(ctx))
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, results, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) AddPermission(ctx echo.Context) error {
+	req := model.CreatePermissionRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	result, ce := h.roleService.CreatePermission(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, result, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) DeletePermission(ctx echo.Context) error {
+	req := model.DeletePermissionRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	ce := h.roleService.DeletePermission(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) GetUserRoles(ctx echo.Context) error {
+	req := model.GetUserRolesRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	req.Issuer = ctx.QueryParam(queryIssuer)
+	results, ce := h.roleService.GetUserRoles(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, results, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) AssignUserRole(ctx echo.Context) error {
+	req := model.UserRoleRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	req.Issuer = ctx.QueryParam(queryIssuer)
+	ce := h.roleService.AssignUserRole(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
+
+func (h *Handler) RevokeUserRole(ctx echo.Context) error {
+	req := model.UserRoleRequest{}
+	if err := validator.BindAndValidate(ctx, &req); !err.IsNoError() {
+		return responseutil.SendErrorResponse(ctx, err)
+	}
+	req.Issuer = ctx.QueryParam(queryIssuer)
+	ce := h.roleService.RevokeUserRole(ctx.Request().Context(), contextutil.GetPrincipal(ctx), req)
+	if ce.IsNoError() {
+		return responseutil.SendSuccessReponse(ctx, nil, nil)
+	}
+	return responseutil.SendErrorResponse(ctx, ce)
+}
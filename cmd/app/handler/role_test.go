@@ -0,0 +1,168 @@
+package handler
+
+import (
+	mocks "backend_test/mocks/service"
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/jsonutil"
+	"backend_test/pkg/util/responseutil"
+	pkgvalidator "backend_test/pkg/validator"
+	"github.com/go-playground/validator/v10"
+	"github.com/go-playground/validator/v10/non-standard/validators"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAddRole(t *testing.T) {
+	validJson := `{
+		"code": "hr_staff",
+		"name": "HR Staff",
+		"permissions": ["read_employees", "update_employees"]
+	}`
+	result := model.RoleResult{
+		ID:          1,
+		Code:        "hr_staff",
+		Permissions: []string{"read_employees", "update_employees"},
+	}
+	testCases := []struct {
+		Name                 string
+		InitHandler          func(ctx echo.Context, s *mocks.RoleService) *Handler
+		Json                 string
+		ExpectedHttpCode     int
+		ExpectedResponseBody model.ResponseBody
+	}{
+		{
+			Name: "InvalidParams",
+			InitHandler: func(ctx echo.Context, s *mocks.RoleService) *Handler {
+				return NewHandler(new(mocks.EmployeeService), s, new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			Json:                 `{"code": "hr_staff", "name": " "}`,
+			ExpectedHttpCode:     http.StatusBadRequest,
+			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrInvalidParams),
+		},
+		{
+			Name: "PermissionNotFound",
+			InitHandler: func(ctx echo.Context, s *mocks.RoleService) *Handler {
+				s.On("CreateRole", mock.Anything, mock.Anything, mock.Anything).Return(nil, pkgerror.ErrPermissionNotFound)
+				return NewHandler(new(mocks.EmployeeService), s, new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			Json:                 validJson,
+			ExpectedHttpCode:     http.StatusNotFound,
+			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrPermissionNotFound),
+		},
+		{
+			Name: "Success",
+			InitHandler: func(ctx echo.Context, s *mocks.RoleService) *Handler {
+				s.On("CreateRole", mock.Anything, mock.Anything, model.CreateRoleRequest{
+					Code:        "hr_staff",
+					Name:        "HR Staff",
+					Permissions: []string{"read_employees", "update_employees"},
+				}).Return(&result, pkgerror.NoError)
+				return NewHandler(new(mocks.EmployeeService), s, new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			Json:                 validJson,
+			ExpectedHttpCode:     http.StatusOK,
+			ExpectedResponseBody: responseutil.CreateSuccessResponse(&result, nil),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			v := validator.New()
+			v.RegisterValidation("notblank", validators.NotBlank)
+			e := echo.New()
+			e.Validator = pkgvalidator.New(v)
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.Json))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath("/roles")
+			s := new(mocks.RoleService)
+			h := tc.InitHandler(c, s)
+			if assert.NoError(t, h.AddRole(c)) {
+				assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+				expected := tc.ExpectedResponseBody
+				jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+				assert.Nil(t, err)
+				assert.Equal(t, expected.Status, jsonpath.GetString("status"))
+				assert.Equal(t, expected.Code, jsonpath.GetString("code"))
+				if expected.Data != nil {
+					data := expected.Data.(*model.RoleResult)
+					assert.Equal(t, data.ID, jsonpath.GetInt("data.id"))
+					assert.Equal(t, data.Code, jsonpath.GetString("data.code"))
+				}
+			}
+			s.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAssignUserRole(t *testing.T) {
+	testCases := []struct {
+		Name                 string
+		InitHandler          func(ctx echo.Context, s *mocks.RoleService) *Handler
+		PathUserID           string
+		PathRoleID           string
+		ExpectedHttpCode     int
+		ExpectedResponseBody model.ResponseBody
+	}{
+		{
+			Name: "InvalidParams",
+			InitHandler: func(ctx echo.Context, s *mocks.RoleService) *Handler {
+				return NewHandler(new(mocks.EmployeeService), s, new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			PathUserID:           "7",
+			PathRoleID:           "x",
+			ExpectedHttpCode:     http.StatusBadRequest,
+			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrInvalidParams),
+		},
+		{
+			Name: "RoleNotFound",
+			InitHandler: func(ctx echo.Context, s *mocks.RoleService) *Handler {
+				s.On("AssignUserRole", mock.Anything, mock.Anything, model.UserRoleRequest{UserID: 7, RoleID: 3}).Return(pkgerror.ErrRoleNotFound)
+				return NewHandler(new(mocks.EmployeeService), s, new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			PathUserID:           "7",
+			PathRoleID:           "3",
+			ExpectedHttpCode:     http.StatusNotFound,
+			ExpectedResponseBody: responseutil.CreateErrorResponse(pkgerror.ErrRoleNotFound),
+		},
+		{
+			Name: "Success",
+			InitHandler: func(ctx echo.Context, s *mocks.RoleService) *Handler {
+				s.On("AssignUserRole", mock.Anything, mock.Anything, model.UserRoleRequest{UserID: 7, RoleID: 3}).Return(pkgerror.NoError)
+				return NewHandler(new(mocks.EmployeeService), s, new(mocks.AuthService), new(mocks.MfaService), new(mocks.CredentialService), new(mocks.ClientService))
+			},
+			PathUserID:           "7",
+			PathRoleID:           "3",
+			ExpectedHttpCode:     http.StatusOK,
+			ExpectedResponseBody: responseutil.CreateSuccessResponse(nil, nil),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			e.Validator = pkgvalidator.New(validator.New())
+			req := httptest.NewRequest(http.MethodPut, "/", nil)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath("/users/:userId/roles/:roleId")
+			c.SetParamNames("userId", "roleId")
+			c.SetParamValues(tc.PathUserID, tc.PathRoleID)
+			s := new(mocks.RoleService)
+			h := tc.InitHandler(c, s)
+			if assert.NoError(t, h.AssignUserRole(c)) {
+				assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+				jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+				assert.Nil(t, err)
+				assert.Equal(t, tc.ExpectedResponseBody.Status, jsonpath.GetString("status"))
+				assert.Equal(t, tc.ExpectedResponseBody.Code, jsonpath.GetString("code"))
+			}
+			s.AssertExpectations(t)
+		})
+	}
+}
@@ -4,15 +4,23 @@ import (
 	"backend_test/cmd/app/handler"
 	"backend_test/pkg/config"
 	"backend_test/pkg/db"
+	"backend_test/pkg/jwtauth"
+	"backend_test/pkg/mailer"
+	pkgmiddleware "backend_test/pkg/middleware"
+	"backend_test/pkg/policy"
 	pkgvalidator "backend_test/pkg/validator"
 	"backend_test/repository"
 	"backend_test/service"
+	"context"
+	"crypto/rsa"
 	"github.com/go-playground/validator/v10"
 	"github.com/go-playground/validator/v10/non-standard/validators"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
 	"github.com/shopspring/decimal"
+	"time"
 )
 
 func main() {
@@ -20,6 +28,9 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to load config: ", err)
 	}
+	if err := config.Data.Validate(); err != nil {
+		log.Fatal("Invalid config: ", err)
+	}
 	if !config.Data.IsEnvProduction() {
 		log.SetLevel(log.DEBUG)
 	}
@@ -28,22 +39,141 @@ func main() {
 	db.Migrate(dbh)
 
 	repo := repository.Default(dbh)
-
-	employeeService := service.NewEmployeeService(repo)
-
-	h := handler.NewHandler(employeeService)
+	assigned, err := repo.AssignEmployeesWithoutApp(context.Background(), config.Data.Auth.AppID)
+	if err != nil {
+		log.Fatal("Failed to assign the employees without app: ", err)
+	}
+	if assigned > 0 {
+		log.Infof("Assigned %d employees without app to app %d", assigned, config.Data.Auth.AppID)
+	}
 
 	v := validator.New()
 	v.RegisterCustomTypeFunc(pkgvalidator.DecimalValidator, decimal.Decimal{})
 	v.RegisterValidation("notblank", validators.NotBlank)
+	requestValidator := pkgvalidator.New(v)
+
+	policies, err := policy.NewEngine(config.Data.Policies, service.EmployeePolicyResource)
+	if err != nil {
+		log.Fatal("Failed to load policies: ", err)
+	}
+	employeeService := service.NewEmployeeService(repo, requestValidator, policies)
+
+	permissionCache := service.NewPermissionCache(time.Duration(config.Data.Rbac.CacheTTL) * time.Second)
+	roleService := service.NewRoleService(repo, permissionCache)
+
+	jwtKeys, err := jwtauth.ParseKeys(config.Data.Jwt.HmacSecret, config.Data.Jwt.RsaPublicKey, config.Data.Jwt.EcdsaPublicKey)
+	if err != nil {
+		log.Fatal("Failed to parse JWT keys: ", err)
+	}
+	if config.Data.Jwt.Jwks.Source != "" {
+		jwks := jwtauth.NewJWKS(config.Data.Jwt.Jwks.Source,
+			time.Duration(config.Data.Jwt.Jwks.RefreshInterval)*time.Second,
+			time.Duration(config.Data.Jwt.Jwks.GracePeriod)*time.Second)
+		if err := jwks.Refresh(context.Background()); err != nil {
+			log.Fatal("Failed to load JWKS: ", err)
+		}
+		go jwks.Run(context.Background())
+		jwtKeys.JWKS = jwks
+	}
+	jwtVerifier := jwtauth.NewVerifier(jwtKeys, config.Data.AppCode, time.Duration(config.Data.Jwt.Leeway)*time.Second)
+
+	jwtSigner := jwtauth.NewSigner([]byte(config.Data.Jwt.HmacSecret), config.Data.AppCode,
+		time.Duration(config.Data.Auth.AccessTokenTTL)*time.Second)
+	authService := service.NewAuthService(repo, jwtSigner, service.AuthOptions{
+		RefreshTokenTTL:      time.Duration(config.Data.Auth.RefreshTokenTTL) * time.Second,
+		AppID:                config.Data.Auth.AppID,
+		AppCode:              config.Data.AppCode,
+		RequireVerifiedEmail: config.Data.Auth.RequireVerifiedEmail,
+		PasswordHash:         config.Data.Auth.PasswordHash,
+	})
+
+	var mail mailer.Mailer = mailer.NewMemoryMailer()
+	if config.Data.Mail.Driver == "smtp" {
+		mail = mailer.NewSMTPMailer(config.Data.Mail.Smtp.Host, config.Data.Mail.Smtp.Port,
+			config.Data.Mail.Smtp.Username, config.Data.Mail.Smtp.Password, config.Data.Mail.From)
+	}
+	credentialService := service.NewCredentialService(repo, mail, service.CredentialOptions{
+		PasswordHash:         config.Data.Auth.PasswordHash,
+		PasswordResetTTL:     time.Duration(config.Data.Auth.PasswordResetTTL) * time.Second,
+		EmailVerificationTTL: time.Duration(config.Data.Auth.EmailVerificationTTL) * time.Second,
+		PasswordResetURL:     config.Data.Auth.PasswordResetURL,
+		EmailVerificationURL: config.Data.Auth.EmailVerificationURL,
+		RateLimitPerAccount:  config.Data.Auth.RateLimit.PerAccount,
+		RateLimitPerIP:       config.Data.Auth.RateLimit.PerIP,
+		RateLimitWindow:      time.Duration(config.Data.Auth.RateLimit.Window) * time.Second,
+	})
+
+	mfaService := service.NewMfaService(repo, service.MfaOptions{
+		Issuer:           config.Data.Auth.Mfa.Issuer,
+		VerificationTTL:  time.Duration(config.Data.Auth.Mfa.VerificationTTL) * time.Second,
+		RequireEnrolment: config.Data.Auth.Mfa.RequireEnrolment,
+		MaxAttempts:      config.Data.Auth.Mfa.MaxAttempts,
+		AttemptWindow:    time.Duration(config.Data.Auth.Mfa.AttemptWindow) * time.Second,
+	})
+
+	var responseSigningKey *rsa.PrivateKey
+	if config.Data.ClientAuth.ResponseSigningKey != "" {
+		responseSigningKey, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(config.Data.ClientAuth.ResponseSigningKey))
+		if err != nil {
+			log.Fatal("Failed to parse response signing key: ", err)
+		}
+	}
+	b2bSigner := jwtauth.NewSigner([]byte(config.Data.Jwt.HmacSecret), config.Data.AppCode,
+		time.Duration(config.Data.ClientAuth.B2BTokenTTL)*time.Second)
+	clientService := service.NewClientService(repo, b2bSigner, service.ClientOptions{
+		AppCode:            config.Data.AppCode,
+		MaxClockSkew:       time.Duration(config.Data.ClientAuth.MaxClockSkew) * time.Second,
+		NonceTTL:           time.Duration(config.Data.ClientAuth.NonceTTL) * time.Second,
+		ResponseSigningKey: responseSigningKey,
+	})
+
+	idempotencyService := service.NewIdempotencyService(repo, time.Duration(config.Data.Idempotency.TTL)*time.Second,
+		time.Duration(config.Data.Idempotency.Lease)*time.Second)
+
+	h := handler.NewHandler(employeeService, roleService, authService, mfaService, credentialService, clientService)
+
+	permissions, err := pkgmiddleware.NewPermissionMap(config.Data.Permissions)
+	if err != nil {
+		log.Fatal("Failed to load permission mapping: ", err)
+	}
+
+	snapRoutes, err := pkgmiddleware.NewSnapRouteMap(config.Data.Snap.DefaultServiceCode, config.Data.Snap.Routes)
+	if err != nil {
+		log.Fatal("Failed to load SNAP routes: ", err)
+	}
+
+	idempotentRoutes, err := pkgmiddleware.NewIdempotencyRouteMap(config.Data.Idempotency.Routes)
+	if err != nil {
+		log.Fatal("Failed to load idempotency routes: ", err)
+	}
+
+	ipExtractor, err := pkgmiddleware.NewIPExtractor(config.Data.TrustedProxies)
+	if err != nil {
+		log.Fatal("Failed to load trusted proxies: ", err)
+	}
 
 	e := echo.New()
-	e.Validator = pkgvalidator.New(v)
+	e.Validator = requestValidator
+	e.IPExtractor = ipExtractor
+	e.HTTPErrorHandler = pkgmiddleware.SnapHTTPErrorHandler(e.DefaultHTTPErrorHandler)
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
+	e.Use(pkgmiddleware.SnapEnvelope(snapRoutes, clientService))
+	e.Use(pkgmiddleware.ResponseSignature(clientService))
+	e.Use(pkgmiddleware.ClientSignature(clientService, permissions.IsPublic))
+	e.Use(pkgmiddleware.JwtAuth(jwtVerifier, authService, permissions.IsPublic))
+	e.Use(pkgmiddleware.PermissionCheck(permissions, roleService, mfaService))
+	e.Use(pkgmiddleware.TenantScope())
+	e.Use(pkgmiddleware.Idempotency(idempotentRoutes, idempotencyService))
 
 	handler.RegisterHandlers(e, h)
+	if err := permissions.Validate(e.Routes()); err != nil {
+		log.Fatal("Invalid permission mapping: ", err)
+	}
+	if err := idempotentRoutes.Validate(e.Routes()); err != nil {
+		log.Fatal("Invalid idempotency routes: ", err)
+	}
 	err = e.Start(config.Data.Port)
 	if err != nil {
 		log.Fatal("Failed to start server: ", err)
@@ -5,17 +5,23 @@ import "errors"
 type EmployeeColumn string
 
 const (
+	EmployeeColumnID        EmployeeColumn = "id"
 	EmployeeColumnFirstName EmployeeColumn = "first_name"
 	EmployeeColumnLastName  EmployeeColumn = "last_name"
 	EmployeeColumnEmail     EmployeeColumn = "email"
 	EmployeeColumnHireDate  EmployeeColumn = "hire_date"
+	EmployeeColumnCreatedAt EmployeeColumn = "created_at"
+	EmployeeColumnUpdatedAt EmployeeColumn = "updated_at"
 )
 
 var EmployeeColumns = []EmployeeColumn{
+	EmployeeColumnID,
 	EmployeeColumnFirstName,
 	EmployeeColumnLastName,
 	EmployeeColumnEmail,
 	EmployeeColumnHireDate,
+	EmployeeColumnCreatedAt,
+	EmployeeColumnUpdatedAt,
 }
 
 func ParseEmployeeColumnName(str string) (EmployeeColumn, error) {
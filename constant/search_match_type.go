@@ -0,0 +1,8 @@
+package constant
+
+type SearchMatchType string
+
+const (
+	SearchMatchTypeFullText SearchMatchType = "fulltext"
+	SearchMatchTypeFuzzy    SearchMatchType = "fuzzy"
+)
@@ -0,0 +1,46 @@
+package entity
+
+import "time"
+
+// ApiClient is a service calling the API with requests signed with its
+// secret or with the B2B access tokens it requests with its PublicKey, it
+// acts with the permissions of Role on the employees of AppID
+type ApiClient struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ClientKey string
+	Name      string
+	Secret    string
+	PublicKey string // PEM, empty until registered
+	// ResponseMode is the envelope of the responses to the client, see
+	// model.ResponseModeSnap
+	ResponseMode string
+	// ResponseSigning is the signature of the responses to the client,
+	// see model.ResponseSigningHmac
+	ResponseSigning string
+	AppID           int
+	RoleID          uint
+	Role            Role
+	DisabledAt      *time.Time
+}
+
+func (ApiClient) TableName() string {
+	return "api_clients"
+}
+
+func (c ApiClient) IsDisabled() bool {
+	return c.DisabledAt != nil
+}
+
+// ClientNonce is the X-EXTERNAL-ID of a signed request, a request reusing
+// it before ExpiresAt is a replay
+type ClientNonce struct {
+	ClientID   uint   `gorm:"primaryKey;autoIncrement:false"`
+	ExternalID string `gorm:"primaryKey"`
+	ExpiresAt  time.Time
+}
+
+func (ClientNonce) TableName() string {
+	return "client_nonces"
+}
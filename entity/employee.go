@@ -2,18 +2,31 @@ package entity
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Employee struct {
-	ID        uint `gorm:"primary_key"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	FirstName string
-	LastName  string
-	Email     string
-	HireDate  time.Time
+	ID           uint `gorm:"primary_key"`
+	AppID        int  // Tenant the employee belongs to
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	FirstName    string
+	LastName     string
+	Email        string
+	HireDate     time.Time
+	ManagerEmail string         // Email of the team lead the employee reports to
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	Version      int            `gorm:"not null;default:1"`
 }
 
 func (Employee) TableName() string {
 	return "employees"
 }
+
+// EmployeeSearchHit is an employee matched by a search with its relevance
+type EmployeeSearchHit struct {
+	Employee  `gorm:"embedded"`
+	Rank      float64
+	Highlight string
+}
@@ -0,0 +1,27 @@
+package entity
+
+import "time"
+
+// IdempotencyKey is the Idempotency-Key of a mutation of an owner, the
+// caller, with the fingerprint of the request and its first response. The
+// response is empty and StatusCode nil while the request is in progress,
+// its request holds the key until LockedUntil.
+type IdempotencyKey struct {
+	Owner          string `gorm:"primaryKey"`
+	Key            string `gorm:"primaryKey"`
+	Fingerprint    string
+	StatusCode     *int
+	ResponseHeader string // JSON http.Header
+	ResponseBody   []byte
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	LockedUntil    *time.Time
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+func (k IdempotencyKey) IsCompleted() bool {
+	return k.StatusCode != nil
+}
@@ -0,0 +1,48 @@
+package entity
+
+import "time"
+
+// MfaEnrolment is the TOTP secret of the user with the iss and id of the
+// JWT claims, it is pending until a first code confirms it
+type MfaEnrolment struct {
+	Issuer       string `gorm:"primaryKey"`
+	UserID       int    `gorm:"primaryKey;autoIncrement:false"`
+	Email        string
+	Secret       string
+	EnabledAt    *time.Time
+	LastUsedStep int64 // Time step of the last accepted code, codes cannot be replayed
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (MfaEnrolment) TableName() string {
+	return "mfa_enrolments"
+}
+
+func (e MfaEnrolment) IsEnabled() bool {
+	return e.EnabledAt != nil
+}
+
+type MfaRecoveryCode struct {
+	ID       uint `gorm:"primary_key"`
+	Issuer   string
+	UserID   int
+	CodeHash string
+	UsedAt   *time.Time
+}
+
+func (MfaRecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// MfaVerification records the second factor passed in a session
+type MfaVerification struct {
+	SessionKey string `gorm:"primaryKey"`
+	Issuer     string
+	UserID     int
+	ExpiresAt  time.Time
+}
+
+func (MfaVerification) TableName() string {
+	return "mfa_verifications"
+}
@@ -0,0 +1,41 @@
+package entity
+
+import "time"
+
+type Role struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Code        string
+	Name        string
+	Permissions []Permission `gorm:"many2many:role_permissions"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+type Permission struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Code        string
+	Description string
+}
+
+func (Permission) TableName() string {
+	return "permissions"
+}
+
+// UserRole assigns a role to the user with the iss and id of the JWT
+// claims
+type UserRole struct {
+	Issuer    string `gorm:"primaryKey"`
+	UserID    int    `gorm:"primaryKey;autoIncrement:false"`
+	RoleID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time
+}
+
+func (UserRole) TableName() string {
+	return "user_roles"
+}
@@ -0,0 +1,77 @@
+package entity
+
+import "time"
+
+// User is a local account logging in with a password, its ID is the user
+// id of the access tokens it is issued
+type User struct {
+	ID              uint `gorm:"primary_key"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	Name            string
+	PasswordHash    string
+	Superadmin      bool
+	EmailVerifiedAt *time.Time
+}
+
+func (User) TableName() string {
+	return "users"
+}
+
+type Session struct {
+	ID        string `gorm:"primaryKey"`
+	UserID    uint
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// RefreshToken is a single use token of a session, using it a second time
+// revokes the session
+type RefreshToken struct {
+	ID        uint `gorm:"primary_key"`
+	SessionID string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+)
+
+// UserToken is a single use token mailed to a user for a purpose
+type UserToken struct {
+	ID        uint `gorm:"primary_key"`
+	UserID    uint
+	Purpose   string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+func (UserToken) TableName() string {
+	return "user_tokens"
+}
+
+// DeniedToken is an access token revoked before its expiry
+type DeniedToken struct {
+	Jti       string `gorm:"primaryKey"`
+	ExpiresAt time.Time
+}
+
+func (DeniedToken) TableName() string {
+	return "denied_tokens"
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS "employees_search_trgm_idx";
+DROP INDEX IF EXISTS "employees_search_vector_idx";
+ALTER TABLE "employees" DROP COLUMN IF EXISTS "search_vector";
@@ -0,0 +1,10 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE "employees" ADD COLUMN "search_vector" tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce("first_name", '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce("last_name", '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce("email", '')), 'B')
+) STORED;
+
+CREATE INDEX "employees_search_vector_idx" ON "employees" USING GIN ("search_vector");
+CREATE INDEX "employees_search_trgm_idx" ON "employees" USING GIN (("first_name" || ' ' || "last_name" || ' ' || "email") gin_trgm_ops);
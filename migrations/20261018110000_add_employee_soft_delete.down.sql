@@ -0,0 +1,5 @@
+DELETE FROM "employees" WHERE "deleted_at" IS NOT NULL;
+DROP INDEX IF EXISTS "employees_email_active_key";
+ALTER TABLE "employees" ADD CONSTRAINT "employees_email_key" UNIQUE ("email");
+DROP INDEX IF EXISTS "idx_employees_deleted_at";
+ALTER TABLE "employees" DROP COLUMN IF EXISTS "deleted_at";
@@ -0,0 +1,6 @@
+ALTER TABLE "employees" ADD COLUMN "deleted_at" timestamptz;
+CREATE INDEX "idx_employees_deleted_at" ON "employees" ("deleted_at");
+
+-- Soft deleted employees must not block reusing their email
+ALTER TABLE "employees" DROP CONSTRAINT IF EXISTS "employees_email_key";
+CREATE UNIQUE INDEX "employees_email_active_key" ON "employees" ("email") WHERE "deleted_at" IS NULL;
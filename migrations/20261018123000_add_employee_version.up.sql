@@ -0,0 +1 @@
+ALTER TABLE "employees" ADD COLUMN "version" integer NOT NULL DEFAULT 1;
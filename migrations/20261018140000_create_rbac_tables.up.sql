@@ -0,0 +1,31 @@
+CREATE TABLE "roles" (
+     "id" serial primary key,
+     "code" varchar unique not null,
+     "name" varchar not null,
+     "created_at" timestamptz not null default current_timestamp,
+     "updated_at" timestamptz not null default current_timestamp
+);
+
+CREATE TABLE "permissions" (
+     "id" serial primary key,
+     "code" varchar unique not null,
+     "description" varchar not null default '',
+     "created_at" timestamptz not null default current_timestamp,
+     "updated_at" timestamptz not null default current_timestamp
+);
+
+CREATE TABLE "role_permissions" (
+     "role_id" integer not null references "roles" ("id") on delete cascade,
+     "permission_id" integer not null references "permissions" ("id") on delete cascade,
+     primary key ("role_id", "permission_id")
+);
+
+-- user_id is the id of the user in the JWT claims
+CREATE TABLE "user_roles" (
+     "user_id" integer not null,
+     "role_id" integer not null references "roles" ("id") on delete cascade,
+     "created_at" timestamptz not null default current_timestamp,
+     primary key ("user_id", "role_id")
+);
+
+CREATE INDEX "user_roles_role_id_idx" ON "user_roles" ("role_id");
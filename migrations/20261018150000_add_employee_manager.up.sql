@@ -0,0 +1,3 @@
+-- Email of the team lead the employee reports to, used by the access policies
+ALTER TABLE "employees" ADD COLUMN "manager_email" varchar NOT NULL DEFAULT '';
+CREATE INDEX "employees_manager_email_idx" ON "employees" ("manager_email");
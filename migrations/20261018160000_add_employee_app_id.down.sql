@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS "employees_app_id_email_active_key";
+CREATE UNIQUE INDEX "employees_email_active_key" ON "employees" ("email") WHERE "deleted_at" IS NULL;
+DROP INDEX IF EXISTS "employees_app_id_idx";
+ALTER TABLE "employees" DROP COLUMN IF EXISTS "app_id";
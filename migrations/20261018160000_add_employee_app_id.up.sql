@@ -0,0 +1,10 @@
+-- Employees belong to the app (tenant) of the JWT that created them, the
+-- existing rows are given app 0 and the app assigns them to auth.app_id
+-- at startup
+ALTER TABLE "employees" ADD COLUMN "app_id" integer NOT NULL DEFAULT 0;
+ALTER TABLE "employees" ALTER COLUMN "app_id" DROP DEFAULT;
+CREATE INDEX "employees_app_id_idx" ON "employees" ("app_id");
+
+-- The email is unique per app
+DROP INDEX IF EXISTS "employees_email_active_key";
+CREATE UNIQUE INDEX "employees_app_id_email_active_key" ON "employees" ("app_id", "email") WHERE "deleted_at" IS NULL;
@@ -0,0 +1,39 @@
+CREATE TABLE "users" (
+     "id" serial primary key,
+     "email" varchar unique not null,
+     "name" varchar not null,
+     "password_hash" varchar not null,
+     "superadmin" boolean not null default false,
+     "created_at" timestamptz not null default current_timestamp,
+     "updated_at" timestamptz not null default current_timestamp
+);
+
+-- a session is started by a login and lasts until it expires or is revoked
+-- by a logout or the reuse of one of its refresh tokens
+CREATE TABLE "sessions" (
+     "id" varchar primary key,
+     "user_id" integer not null references "users" ("id") on delete cascade,
+     "created_at" timestamptz not null default current_timestamp,
+     "expires_at" timestamptz not null,
+     "revoked_at" timestamptz
+);
+
+CREATE INDEX "sessions_user_id_idx" ON "sessions" ("user_id");
+
+-- refresh tokens are stored as their SHA-256 and can be used once
+CREATE TABLE "refresh_tokens" (
+     "id" serial primary key,
+     "session_id" varchar not null references "sessions" ("id") on delete cascade,
+     "token_hash" varchar unique not null,
+     "created_at" timestamptz not null default current_timestamp,
+     "expires_at" timestamptz not null,
+     "used_at" timestamptz
+);
+
+CREATE INDEX "refresh_tokens_session_id_idx" ON "refresh_tokens" ("session_id");
+
+-- access tokens revoked before their expiry, by jti
+CREATE TABLE "denied_tokens" (
+     "jti" varchar primary key,
+     "expires_at" timestamptz not null
+);
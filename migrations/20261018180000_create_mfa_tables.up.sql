@@ -0,0 +1,26 @@
+-- user_id is the id of the user in the JWT claims, local or not
+CREATE TABLE "mfa_enrolments" (
+     "user_id" integer primary key,
+     "email" varchar not null,
+     "secret" varchar not null,
+     "enabled_at" timestamptz,
+     "last_used_step" bigint not null default 0,
+     "created_at" timestamptz not null default current_timestamp,
+     "updated_at" timestamptz not null default current_timestamp
+);
+
+CREATE TABLE "mfa_recovery_codes" (
+     "id" serial primary key,
+     "user_id" integer not null references "mfa_enrolments" ("user_id") on delete cascade,
+     "code_hash" varchar not null,
+     "used_at" timestamptz
+);
+
+CREATE INDEX "mfa_recovery_codes_user_id_idx" ON "mfa_recovery_codes" ("user_id");
+
+-- session_key is the session of a local token or the hash of another token
+CREATE TABLE "mfa_verifications" (
+     "session_key" varchar primary key,
+     "user_id" integer not null references "mfa_enrolments" ("user_id") on delete cascade,
+     "expires_at" timestamptz not null
+);
@@ -0,0 +1,14 @@
+ALTER TABLE "users" ADD COLUMN "email_verified_at" timestamptz;
+
+-- single use tokens mailed to the users, stored as their SHA-256
+CREATE TABLE "user_tokens" (
+     "id" serial primary key,
+     "user_id" integer not null references "users" ("id") on delete cascade,
+     "purpose" varchar not null,
+     "token_hash" varchar unique not null,
+     "created_at" timestamptz not null default current_timestamp,
+     "expires_at" timestamptz not null,
+     "used_at" timestamptz
+);
+
+CREATE INDEX "user_tokens_user_id_purpose_idx" ON "user_tokens" ("user_id", "purpose");
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS client_nonces;
+DROP TABLE IF EXISTS api_clients;
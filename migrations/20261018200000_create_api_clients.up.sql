@@ -0,0 +1,21 @@
+-- machine-to-machine callers signing their requests with the secret, they
+-- act with the permissions of the role on the employees of the app
+CREATE TABLE "api_clients" (
+     "id" serial primary key,
+     "client_key" varchar unique not null,
+     "name" varchar not null,
+     "secret" varchar not null,
+     "app_id" integer not null,
+     "role_id" integer not null references "roles" ("id"),
+     "disabled_at" timestamptz,
+     "created_at" timestamptz not null default current_timestamp,
+     "updated_at" timestamptz not null default current_timestamp
+);
+
+-- X-EXTERNAL-ID of the signed requests, reusable once expired
+CREATE TABLE "client_nonces" (
+     "client_id" integer not null references "api_clients" ("id") on delete cascade,
+     "external_id" varchar not null,
+     "expires_at" timestamptz not null,
+     primary key ("client_id", "external_id")
+);
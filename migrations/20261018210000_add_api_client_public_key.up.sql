@@ -0,0 +1,2 @@
+-- PEM encoded RSA public key verifying the B2B access token requests
+ALTER TABLE "api_clients" ADD COLUMN "public_key" varchar not null default '';
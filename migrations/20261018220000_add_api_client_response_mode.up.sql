@@ -0,0 +1,2 @@
+-- envelope of the responses to the client, default or snap
+ALTER TABLE "api_clients" ADD COLUMN "response_mode" varchar not null default 'default';
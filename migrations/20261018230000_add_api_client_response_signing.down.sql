@@ -0,0 +1 @@
+ALTER TABLE api_clients DROP COLUMN IF EXISTS response_signing;
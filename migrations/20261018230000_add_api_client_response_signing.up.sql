@@ -0,0 +1,2 @@
+-- signature of the responses to the client, none, hmac or rsa
+ALTER TABLE "api_clients" ADD COLUMN "response_signing" varchar not null default 'none';
@@ -0,0 +1,14 @@
+-- Idempotency-Key of the mutations of a caller, the owner, with the
+-- fingerprint of the request and its first response. status_code is null
+-- while the request is in progress, a key is reusable once expired.
+CREATE TABLE "idempotency_keys" (
+     "owner" varchar not null,
+     "key" varchar not null,
+     "fingerprint" varchar not null,
+     "status_code" integer,
+     "response_header" text not null default '',
+     "response_body" bytea,
+     "created_at" timestamptz not null default current_timestamp,
+     "expires_at" timestamptz not null,
+     primary key ("owner", "key")
+);
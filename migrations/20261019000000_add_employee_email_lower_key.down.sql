@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "employees_app_id_lower_email_active_key";
+CREATE UNIQUE INDEX "employees_app_id_email_active_key" ON "employees" ("app_id", "email") WHERE "deleted_at" IS NULL;
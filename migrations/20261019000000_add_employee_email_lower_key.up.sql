@@ -0,0 +1,6 @@
+-- Emails are compared in any case and stored in lower case, so that an
+-- email is unique per app whatever its case. Active employees of an app
+-- whose emails only differ by case must be merged first.
+UPDATE "employees" SET "email" = lower("email"), "manager_email" = lower("manager_email");
+DROP INDEX IF EXISTS "employees_app_id_email_active_key";
+CREATE UNIQUE INDEX "employees_app_id_lower_email_active_key" ON "employees" ("app_id", lower("email")) WHERE "deleted_at" IS NULL;
@@ -0,0 +1,2 @@
+-- The expired keys are purged by expires_at
+CREATE INDEX "idempotency_keys_expires_at_idx" ON "idempotency_keys" ("expires_at");
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS "client_nonces_expires_at_idx";
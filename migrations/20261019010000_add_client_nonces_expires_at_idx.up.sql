@@ -0,0 +1,2 @@
+-- The expired nonces are purged by expires_at
+CREATE INDEX "client_nonces_expires_at_idx" ON "client_nonces" ("expires_at");
@@ -0,0 +1,4 @@
+DELETE FROM "user_roles" WHERE "issuer" <> '';
+ALTER TABLE "user_roles" DROP CONSTRAINT "user_roles_pkey";
+ALTER TABLE "user_roles" ADD PRIMARY KEY ("user_id", "role_id");
+ALTER TABLE "user_roles" DROP COLUMN "issuer";
@@ -0,0 +1,8 @@
+-- A user is the iss and id of its token claims, the ids of the local users
+-- and of an identity provider overlap. The existing assignments are kept
+-- for the tokens without iss, the ones of the local users must be granted
+-- again with the local issuer.
+ALTER TABLE "user_roles" ADD COLUMN "issuer" varchar not null default '';
+ALTER TABLE "user_roles" ALTER COLUMN "issuer" DROP DEFAULT;
+ALTER TABLE "user_roles" DROP CONSTRAINT "user_roles_pkey";
+ALTER TABLE "user_roles" ADD PRIMARY KEY ("issuer", "user_id", "role_id");
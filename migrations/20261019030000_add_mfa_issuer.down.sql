@@ -0,0 +1,23 @@
+-- A user id enrolled with several issuers keeps the local enrolment
+DELETE FROM "mfa_verifications";
+ALTER TABLE "mfa_verifications" DROP CONSTRAINT "mfa_verifications_issuer_user_id_fkey";
+ALTER TABLE "mfa_verifications" DROP COLUMN "issuer";
+
+ALTER TABLE "mfa_recovery_codes" DROP CONSTRAINT "mfa_recovery_codes_issuer_user_id_fkey";
+DELETE FROM "mfa_enrolments" e USING "mfa_enrolments" o
+WHERE o."user_id" = e."user_id" AND o."issuer" <> e."issuer"
+  AND (o."issuer" = 'local' OR (e."issuer" <> 'local' AND o."issuer" < e."issuer"));
+DELETE FROM "mfa_recovery_codes" c WHERE NOT EXISTS (
+    SELECT 1 FROM "mfa_enrolments" e WHERE e."issuer" = c."issuer" AND e."user_id" = c."user_id");
+DROP INDEX "mfa_recovery_codes_issuer_user_id_idx";
+ALTER TABLE "mfa_recovery_codes" DROP COLUMN "issuer";
+CREATE INDEX "mfa_recovery_codes_user_id_idx" ON "mfa_recovery_codes" ("user_id");
+
+ALTER TABLE "mfa_enrolments" DROP CONSTRAINT "mfa_enrolments_pkey";
+ALTER TABLE "mfa_enrolments" ADD PRIMARY KEY ("user_id");
+ALTER TABLE "mfa_enrolments" DROP COLUMN "issuer";
+
+ALTER TABLE "mfa_recovery_codes" ADD CONSTRAINT "mfa_recovery_codes_user_id_fkey"
+    FOREIGN KEY ("user_id") REFERENCES "mfa_enrolments" ("user_id") ON DELETE CASCADE;
+ALTER TABLE "mfa_verifications" ADD CONSTRAINT "mfa_verifications_user_id_fkey"
+    FOREIGN KEY ("user_id") REFERENCES "mfa_enrolments" ("user_id") ON DELETE CASCADE;
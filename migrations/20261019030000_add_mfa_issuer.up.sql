@@ -0,0 +1,28 @@
+-- A user is the iss and id of its token claims, the ids of the local users
+-- and of an identity provider overlap. An existing enrolment is the local
+-- user's when its email is the one of the local user with its id, the
+-- others are kept for the tokens without iss. The verified sessions are
+-- dropped, they verify again.
+ALTER TABLE "mfa_recovery_codes" DROP CONSTRAINT "mfa_recovery_codes_user_id_fkey";
+ALTER TABLE "mfa_verifications" DROP CONSTRAINT "mfa_verifications_user_id_fkey";
+DELETE FROM "mfa_verifications";
+
+ALTER TABLE "mfa_enrolments" ADD COLUMN "issuer" varchar not null default '';
+UPDATE "mfa_enrolments" e SET "issuer" = 'local'
+FROM "users" u WHERE u."id" = e."user_id" AND lower(u."email") = lower(e."email");
+ALTER TABLE "mfa_enrolments" ALTER COLUMN "issuer" DROP DEFAULT;
+ALTER TABLE "mfa_enrolments" DROP CONSTRAINT "mfa_enrolments_pkey";
+ALTER TABLE "mfa_enrolments" ADD PRIMARY KEY ("issuer", "user_id");
+
+ALTER TABLE "mfa_recovery_codes" ADD COLUMN "issuer" varchar not null default '';
+UPDATE "mfa_recovery_codes" c SET "issuer" = e."issuer"
+FROM "mfa_enrolments" e WHERE e."user_id" = c."user_id";
+ALTER TABLE "mfa_recovery_codes" ALTER COLUMN "issuer" DROP DEFAULT;
+ALTER TABLE "mfa_recovery_codes" ADD CONSTRAINT "mfa_recovery_codes_issuer_user_id_fkey"
+    FOREIGN KEY ("issuer", "user_id") REFERENCES "mfa_enrolments" ("issuer", "user_id") ON DELETE CASCADE;
+DROP INDEX "mfa_recovery_codes_user_id_idx";
+CREATE INDEX "mfa_recovery_codes_issuer_user_id_idx" ON "mfa_recovery_codes" ("issuer", "user_id");
+
+ALTER TABLE "mfa_verifications" ADD COLUMN "issuer" varchar not null;
+ALTER TABLE "mfa_verifications" ADD CONSTRAINT "mfa_verifications_issuer_user_id_fkey"
+    FOREIGN KEY ("issuer", "user_id") REFERENCES "mfa_enrolments" ("issuer", "user_id") ON DELETE CASCADE;
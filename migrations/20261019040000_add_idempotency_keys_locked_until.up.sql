@@ -0,0 +1,4 @@
+-- A key in progress is leased until locked_until, a retry takes over the
+-- key of a request that died before completing it once the lease is over
+ALTER TABLE "idempotency_keys" ADD COLUMN "locked_until" timestamptz;
+UPDATE "idempotency_keys" SET "locked_until" = "created_at" WHERE "status_code" IS NULL;
@@ -1,25 +1,124 @@
 package model
 
+import "strconv"
+
 type JwtClaims struct {
 	Aud  []string `json:"aud"`
-	User struct {
-		ID         int    `json:"id"`
-		Name       string `json:"name"`
-		Email      string `json:"email"`
-		Superadmin bool   `json:"superadmin"`
-		Roles      []struct {
-			ID          int      `json:"id"`
-			Name        string   `json:"name"`
-			Code        string   `json:"code"`
-			Permissions []string `json:"permissions"`
-			App         struct {
-				ID      int    `json:"id"`
-				Name    string `json:"name"`
-				Code    string `json:"code"`
-				BaseURL string `json:"base_url"`
-			} `json:"app"`
-		} `json:"roles"`
-	} `json:"user"`
-	Exp int64 `json:"exp"`
-	Iat int64 `json:"iat"`
+	User JwtUser  `json:"user"`
+	Exp  int64    `json:"exp"`
+	Iat  int64    `json:"iat"`
+	// Jti and Sid are set on the tokens issued by /auth/login, they
+	// identify the token and its session for the revocation checks
+	Jti string `json:"jti,omitempty"`
+	Sid string `json:"sid,omitempty"`
+	// Client is the key of the API client of a signed request, its User
+	// carries the role of the client and has no ID
+	Client string `json:"client,omitempty"`
+	// Typ is TokenTypeB2B on the claims of the API clients, it tells their
+	// access tokens from the user tokens signed with the same key
+	Typ string `json:"typ,omitempty"`
+	// Iss is LocalIssuer on the tokens issued by this service, the user ids
+	// of each issuer are distinct
+	Iss string `json:"iss,omitempty"`
+}
+
+// LocalIssuer is the iss claim of the tokens signed by this service
+const LocalIssuer = "local"
+
+// TokenTypeB2B is the typ claim of the access tokens of the API clients
+const TokenTypeB2B = "b2b"
+
+// IsClient reports whether the claims are the ones of an API client, a
+// client key is only trusted on a b2b token
+func (c JwtClaims) IsClient() bool {
+	return c.Client != "" && c.Typ == TokenTypeB2B
+}
+
+// UserRef returns the reference of the user of the claims
+func (c JwtClaims) UserRef() UserRef {
+	return UserRef{Issuer: c.Iss, ID: c.User.ID}
+}
+
+// UserRef identifies a user by the issuer of its tokens and its id there,
+// the same id from two issuers is two users
+type UserRef struct {
+	Issuer string
+	ID     int
+}
+
+// String formats the user as id@issuer, such as 7@local
+func (u UserRef) String() string {
+	return strconv.Itoa(u.ID) + "@" + u.Issuer
+}
+
+type JwtUser struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	Superadmin bool      `json:"superadmin"`
+	Roles      []JwtRole `json:"roles"`
+}
+
+type JwtRole struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Code        string   `json:"code"`
+	Permissions []string `json:"permissions"`
+	App         JwtApp   `json:"app"`
+}
+
+type JwtApp struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Code    string `json:"code"`
+	BaseURL string `json:"base_url"`
+}
+
+// UserGrants are the codes of the roles assigned to a user in the database
+// and of the permissions they grant
+type UserGrants struct {
+	Roles       []string
+	Permissions []string
+}
+
+// Principal is the caller a service call is made on behalf of, with the
+// roles and permissions of its token and of its UserGrants
+type Principal struct {
+	Issuer      string // iss of the token, see UserRef
+	UserID      int
+	Email       string
+	Superadmin  bool
+	AppIDs      []int
+	Roles       []string // Role codes
+	Permissions []string // Permissions on this app, without the app code prefix
+}
+
+func (p Principal) UserRef() UserRef {
+	return UserRef{Issuer: p.Issuer, ID: p.UserID}
+}
+
+// PolicyScope restricts a query to the rows the policies allow, SQL is a
+// condition with its Args, empty when every row is allowed
+type PolicyScope struct {
+	SQL  string
+	Args []interface{}
+}
+
+// TenantScope limits the employees a request can see and change to the ones
+// of its apps, All is only set for a superadmin crossing tenants
+type TenantScope struct {
+	AppIDs []int
+	All    bool
+}
+
+func (s TenantScope) Contains(appID int) bool {
+	if s.All {
+		return true
+	}
+	for _, id := range s.AppIDs {
+		if id == appID {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,82 @@
+package model
+
+import "time"
+
+type ClientResult struct {
+	ID              int        `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	ClientKey       string     `json:"client_key"`
+	Name            string     `json:"name"`
+	AppID           int        `json:"app_id"`
+	Role            string     `json:"role"`             // Role code
+	PublicKey       string     `json:"public_key"`       // PEM, empty until registered
+	ResponseMode    string     `json:"response_mode"`    // Envelope of the responses, default or snap
+	ResponseSigning string     `json:"response_signing"` // Signature of the responses, none, hmac or rsa
+	DisabledAt      *time.Time `json:"disabled_at"`
+}
+
+type CreateClientRequest struct {
+	Name            string `json:"name" validate:"required,notblank,max=60"`
+	AppID           int    `json:"app_id" validate:"required,gt=0"`
+	Role            string `json:"role" validate:"required,notblank"`                         // Role code
+	ResponseMode    string `json:"response_mode" validate:"omitempty,oneof=default snap"`     // Envelope of the responses, default when empty
+	ResponseSigning string `json:"response_signing" validate:"omitempty,oneof=none hmac rsa"` // Signature of the responses, none when empty
+}
+
+type CreateClientResult struct {
+	ClientResult
+	Secret string `json:"secret"` // Shown once, signs the requests of the client
+}
+
+type DisableClientRequest struct {
+	ClientID int `param:"id" validate:"required"`
+}
+
+// SetClientPublicKeyRequest registers the RSA public key verifying the B2B
+// access token requests of the client
+type SetClientPublicKeyRequest struct {
+	ClientID int `param:"id" validate:"required"` // Path variable
+
+	PublicKey string `json:"public_key" validate:"required,notblank"` // PEM
+}
+
+type SetClientResponseModeRequest struct {
+	ClientID int `param:"id" validate:"required"` // Path variable
+
+	ResponseMode string `json:"response_mode" validate:"required,oneof=default snap"`
+}
+
+type SetClientResponseSigningRequest struct {
+	ClientID int `param:"id" validate:"required"` // Path variable
+
+	ResponseSigning string `json:"response_signing" validate:"required,oneof=none hmac rsa"`
+}
+
+// B2BTokenRequest is a SNAP access token request, the client fields are
+// filled from its X-CLIENT-KEY, X-TIMESTAMP and X-SIGNATURE headers
+type B2BTokenRequest struct {
+	GrantType string `json:"grantType" validate:"required,eq=client_credentials"`
+	ClientKey string `json:"-"`
+	Timestamp string `json:"-"`
+	Signature string `json:"-"`
+}
+
+type B2BTokenResult struct {
+	AccessToken string `json:"accessToken"`
+	TokenType   string `json:"tokenType"`
+	ExpiresIn   string `json:"expiresIn"` // Seconds, a string in SNAP
+}
+
+// ClientSignatureRequest is a request signed by an API client, Token is the
+// bearer token of the request if any
+type ClientSignatureRequest struct {
+	ClientKey  string
+	Timestamp  string
+	Signature  string
+	ExternalID string
+	Method     string
+	Path       string
+	Token      string
+	Body       string
+}
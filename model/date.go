@@ -0,0 +1,28 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+const DateLayout = "2006-01-02"
+
+// DateParam is a query param accepting either a plain date (2006-01-02) or
+// a RFC3339 timestamp
+type DateParam struct {
+	time.Time
+	DateOnly bool
+}
+
+func (d *DateParam) UnmarshalParam(param string) error {
+	if t, err := time.Parse(DateLayout, param); err == nil {
+		d.Time, d.DateOnly = t, true
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		return fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC3339", param)
+	}
+	d.Time, d.DateOnly = t, false
+	return nil
+}
@@ -1,16 +1,34 @@
 package model
 
-import "time"
+import (
+	"backend_test/constant"
+	"backend_test/pkg/filterexpr"
+	"time"
+)
 
 type GetEmployeesFilter struct {
-	FirstName   string `query:"first_name"`
-	LastName    string `query:"last_name"`
-	ID          *int   `query:"id"`
-	PageRequest PageRequest
+	FirstName     string     `query:"first_name"`
+	LastName      string     `query:"last_name"`
+	Email         string     `query:"email"`
+	EmailPrefix   string     `query:"email_prefix"`
+	IDs           []int      `query:"id"`
+	HireDateFrom  *DateParam `query:"hire_date_from"`
+	HireDateTo    *DateParam `query:"hire_date_to"`
+	CreatedFrom   *DateParam `query:"created_from"`
+	CreatedTo     *DateParam `query:"created_to"`
+	UpdatedSince  *DateParam `query:"updated_since"`
+	Filter        string     `query:"filter"`
+	FilterExpr    filterexpr.Node
+	Sort          string `query:"sort"`
+	Sorts         []EmployeeSort
+	PageRequest   PageRequest
+	CursorRequest CursorRequest
+	PolicyScope   PolicyScope
 }
 
 type GetEmployeesResult struct {
 	ID        int       `json:"id"`
+	AppID     int       `json:"app_id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	HireDate  time.Time `json:"hire_date"`
@@ -20,20 +38,25 @@ type GetEmployeesResult struct {
 }
 
 type CreateEmployeeRequest struct {
-	FirstName string `json:"first_name" validate:"required,notblank,min=3,max=60"`
-	LastName  string `json:"last_name" validate:"required,notblank,min=3,max=60"`
-	Email     string `json:"email" validate:"required,notblank,email,min=3,max=60"`
-	HireDate  string `json:"hire_date" validate:"required,notblank"`
+	AppID        int    `json:"app_id" validate:"omitempty,min=1"` // Required when the caller has several apps
+	FirstName    string `json:"first_name" validate:"required,notblank,min=3,max=60"`
+	LastName     string `json:"last_name" validate:"required,notblank,min=3,max=60"`
+	Email        string `json:"email" validate:"required,notblank,email,min=3,max=60"`
+	HireDate     string `json:"hire_date" validate:"required,notblank"`
+	ManagerEmail string `json:"manager_email" validate:"omitempty,email,max=60"`
 }
 
 type CreateEmployeeResult struct {
-	ID        int       `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Email     string    `json:"email"`
-	HireDate  time.Time `json:"hire_date"`
+	ID           int       `json:"id"`
+	AppID        int       `json:"app_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	FirstName    string    `json:"first_name"`
+	LastName     string    `json:"last_name"`
+	Email        string    `json:"email"`
+	HireDate     time.Time `json:"hire_date"`
+	ManagerEmail string    `json:"manager_email"`
+	Version      int       `json:"version"`
 }
 
 type GetEmployeeByIDRequest struct {
@@ -41,34 +64,91 @@ type GetEmployeeByIDRequest struct {
 }
 
 type DeleteEmployeeByIDRequest struct {
+	EmployeeID int    `param:"id" validate:"required"`
+	Purge      bool   `query:"purge"` // Permanently remove the employee, superadmin only
+	IfMatch    string // ETag the client last read
+}
+
+type RestoreEmployeeRequest struct {
 	EmployeeID int `param:"id" validate:"required"`
 }
 
-type GetEmployeeByIDResult struct {
+type GetDeletedEmployeesResult struct {
 	ID        int       `json:"id"`
+	AppID     int       `json:"app_id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt time.Time `json:"deleted_at"`
+	HireDate  time.Time `json:"hire_date"`
 	FirstName string    `json:"first_name"`
 	LastName  string    `json:"last_name"`
 	Email     string    `json:"email"`
-	HireDate  time.Time `json:"hire_date"`
+}
+
+type GetEmployeeByIDResult struct {
+	ID           int       `json:"id"`
+	AppID        int       `json:"app_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	FirstName    string    `json:"first_name"`
+	LastName     string    `json:"last_name"`
+	Email        string    `json:"email"`
+	HireDate     time.Time `json:"hire_date"`
+	ManagerEmail string    `json:"manager_email"`
+	Version      int       `json:"version"`
 }
 
 type EditEmployeeRequest struct {
 	EmployeeID int `param:"id" validate:"required"` // Path variable
 
-	FirstName string `json:"first_name" validate:"required,notblank,min=3,max=60"`
-	LastName  string `json:"last_name" validate:"required,notblank,min=3,max=60"`
-	Email     string `json:"email" validate:"required,notblank,email,min=3,max=60"`
-	HireDate  string `json:"hire_date" validate:"required,notblank"`
+	FirstName    string `json:"first_name" validate:"required,notblank,min=3,max=60"`
+	LastName     string `json:"last_name" validate:"required,notblank,min=3,max=60"`
+	Email        string `json:"email" validate:"required,notblank,email,min=3,max=60"`
+	HireDate     string `json:"hire_date" validate:"required,notblank"`
+	ManagerEmail string `json:"manager_email" validate:"omitempty,email,max=60"`
+	IfMatch      string `json:"-"` // ETag the client last read
+}
+
+type PatchEmployeeRequest struct {
+	EmployeeID int `param:"id" validate:"required"` // Path variable
+
+	PatchType string // Media type of the patch, merge patch or JSON patch
+	Patch     []byte
+	IfMatch   string // ETag the client last read
+}
+
+// EmployeePatchDocument is the document a PatchEmployeeRequest applies to,
+// only the editable fields of the employee can be patched
+type EmployeePatchDocument struct {
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Email        string `json:"email"`
+	HireDate     string `json:"hire_date"`
+	ManagerEmail string `json:"manager_email"`
 }
 
 type EditEmployeeResult struct {
-	ID        int       `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Email     string    `json:"email"`
-	HireDate  time.Time `json:"hire_date"`
+	ID           int       `json:"id"`
+	AppID        int       `json:"app_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	FirstName    string    `json:"first_name"`
+	LastName     string    `json:"last_name"`
+	Email        string    `json:"email"`
+	HireDate     time.Time `json:"hire_date"`
+	ManagerEmail string    `json:"manager_email"`
+	Version      int       `json:"version"`
+}
+
+type SearchEmployeesRequest struct {
+	Query       string `query:"q" validate:"required,notblank,max=200"`
+	PageRequest PageRequest
+	PolicyScope PolicyScope
+}
+
+type SearchEmployeesResult struct {
+	GetEmployeesResult
+	Rank      float64                  `json:"rank"`
+	MatchType constant.SearchMatchType `json:"match_type"`
+	Highlight *string                  `json:"highlight,omitempty"`
 }
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"backend_test/constant"
+	"backend_test/pkg/filterexpr"
+)
+
+// ParseEmployeeFilterExpr parses a filter expression restricted to the
+// employee columns, e.g. "hire_date ge 2020-01-01 and last_name sw 'Sa'"
+func ParseEmployeeFilterExpr(expr string) (filterexpr.Node, error) {
+	fields := map[string]filterexpr.FieldType{}
+	for _, c := range constant.EmployeeColumns {
+		switch c {
+		case constant.EmployeeColumnID:
+			fields[string(c)] = filterexpr.FieldNumber
+		case constant.EmployeeColumnHireDate, constant.EmployeeColumnCreatedAt, constant.EmployeeColumnUpdatedAt:
+			fields[string(c)] = filterexpr.FieldTime
+		default:
+			fields[string(c)] = filterexpr.FieldString
+		}
+	}
+	return filterexpr.Parse(expr, fields)
+}
@@ -0,0 +1,19 @@
+package model
+
+import "net/http"
+
+// IdempotentRequest is a mutation sent with an Idempotency-Key by its
+// owner, the caller, Fingerprint identifies its method, path and body
+type IdempotentRequest struct {
+	Owner       string
+	Key         string
+	Fingerprint string
+}
+
+// IdempotentResponse is the first response of an IdempotentRequest, sent
+// again to its repeats
+type IdempotentResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
@@ -0,0 +1,31 @@
+package model
+
+type MfaEnrolmentResult struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"` // Payload of the QR code scanned by authenticator apps
+}
+
+// ConfirmMfaRequest enables a pending enrolment with a first code,
+// SessionKey is filled from the token and not bound from the request
+type ConfirmMfaRequest struct {
+	Code       string `json:"code" validate:"required,numeric,len=6"`
+	SessionKey string `json:"-"`
+}
+
+// VerifyMfaRequest passes the second factor for the session of the token
+// with either a code or a recovery code
+type VerifyMfaRequest struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+	SessionKey   string `json:"-"`
+}
+
+type MfaRecoveryCodesResult struct {
+	RecoveryCodes []string `json:"recovery_codes"` // Shown once, only their hashes are stored
+}
+
+// ResetMfaRequest names the user like UserRoleRequest
+type ResetMfaRequest struct {
+	UserID int    `param:"userId" validate:"required"`
+	Issuer string `json:"-"`
+}
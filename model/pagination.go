@@ -9,4 +9,37 @@ type Pagination struct {
 	PageNum   *int `json:"page_num,omitempty"`
 	PageSize  *int `json:"page_size,omitempty"`
 	TotalData *int `json:"total_data,omitempty"`
+	TotalPage *int `json:"total_page,omitempty"`
+
+	NextCursor *string `json:"next_cursor,omitempty"`
+	PrevCursor *string `json:"prev_cursor,omitempty"`
+}
+
+func NewPagination(pr PageRequest, totalData int) *Pagination {
+	totalPage := 0
+	if pr.PageSize > 0 {
+		totalPage = (totalData + pr.PageSize - 1) / pr.PageSize
+	}
+	return &Pagination{
+		PageNum:   &pr.PageNum,
+		PageSize:  &pr.PageSize,
+		TotalData: &totalData,
+		TotalPage: &totalPage,
+	}
+}
+
+type CursorRequest struct {
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit"`
+}
+
+func (c CursorRequest) IsCursorMode() bool {
+	return c.Cursor != "" || c.Limit > 0
+}
+
+// Keyset is the position of a row in a listing, the values are given in
+// the same order as the sort keys of that listing
+type Keyset struct {
+	Values   []interface{}
+	Backward bool
 }
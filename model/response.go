@@ -1,5 +1,10 @@
 package model
 
+import (
+	"bytes"
+	"encoding/json"
+)
+
 type ResponseBody struct {
 	Status       string      `json:"status"`
 	Code         string      `json:"code"`
@@ -14,3 +19,62 @@ type ResponseBodyMutation struct {
 	Code   string      `json:"code"`
 	Data   interface{} `json:"mutasi"`
 }
+
+// Response modes of the API clients
+const (
+	ResponseModeDefault = "default"
+	ResponseModeSnap    = "snap"
+)
+
+// Response signing of the API clients, see package responsesign
+const (
+	ResponseSigningNone = "none"
+	ResponseSigningHmac = "hmac" // HMAC-SHA512 with the client secret
+	ResponseSigningRsa  = "rsa"  // SHA256withRSA with the server key
+)
+
+// ResponseSignature is the X-SIGNATURE of a response and the X-TIMESTAMP
+// it covers
+type ResponseSignature struct {
+	Signature string
+	Timestamp string
+}
+
+// ResponseEnvelope is the format of the responses of a request, the zero
+// value is ResponseBody
+type ResponseEnvelope struct {
+	Snap bool
+	// ServiceCode is the two digit SNAP service code of the route
+	ServiceCode string
+}
+
+// SnapResponseBody is the SNAP envelope, the fields of an object Data are
+// inlined next to responseCode and responseMessage, other values are set
+// as data
+type SnapResponseBody struct {
+	ResponseCode    string      `json:"responseCode"`
+	ResponseMessage string      `json:"responseMessage"`
+	Data            interface{} `json:"-"`
+	Pagination      *Pagination `json:"pagination,omitempty"`
+	ErrorRemark     *string     `json:"remark,omitempty"`
+}
+
+func (b SnapResponseBody) MarshalJSON() ([]byte, error) {
+	type envelope SnapResponseBody
+	head, err := json.Marshal(envelope(b))
+	if err != nil || b.Data == nil {
+		return head, err
+	}
+	data, err := json.Marshal(b.Data)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("{")) {
+		if bytes.Equal(data, []byte("{}")) {
+			return head, nil
+		}
+		// splice the fields of data into the envelope object
+		return append(append(head[:len(head)-1], ','), data[1:]...), nil
+	}
+	return append(append(head[:len(head)-1], []byte(`,"data":`)...), append(data, '}')...), nil
+}
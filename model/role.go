@@ -0,0 +1,64 @@
+package model
+
+import "time"
+
+type RoleResult struct {
+	ID          int       `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Code        string    `json:"code"`
+	Name        string    `json:"name"`
+	Permissions []string  `json:"permissions"`
+}
+
+type GetRoleByIDRequest struct {
+	RoleID int `param:"id" validate:"required"`
+}
+
+type CreateRoleRequest struct {
+	Code        string   `json:"code" validate:"required,notblank,max=60"`
+	Name        string   `json:"name" validate:"required,notblank,max=60"`
+	Permissions []string `json:"permissions" validate:"dive,required,notblank"` // Permission codes
+}
+
+type EditRoleRequest struct {
+	RoleID int `param:"id" validate:"required"` // Path variable
+
+	Name        string   `json:"name" validate:"required,notblank,max=60"`
+	Permissions []string `json:"permissions" validate:"dive,required,notblank"` // Permission codes
+}
+
+type DeleteRoleRequest struct {
+	RoleID int `param:"id" validate:"required"`
+}
+
+type PermissionResult struct {
+	ID          int       `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Code        string    `json:"code"`
+	Description string    `json:"description"`
+}
+
+type CreatePermissionRequest struct {
+	Code        string `json:"code" validate:"required,notblank,max=60"`
+	Description string `json:"description" validate:"max=255"`
+}
+
+type DeletePermissionRequest struct {
+	PermissionID int `param:"id" validate:"required"`
+}
+
+// GetUserRolesRequest and UserRoleRequest name the user by the iss of its
+// tokens and its id there, Issuer is the issuer query param and is empty
+// for the tokens without iss
+type GetUserRolesRequest struct {
+	UserID int    `param:"userId" validate:"required"`
+	Issuer string `json:"-"`
+}
+
+type UserRoleRequest struct {
+	UserID int    `param:"userId" validate:"required"`
+	RoleID int    `param:"roleId" validate:"required"`
+	Issuer string `json:"-"`
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"backend_test/constant"
+	"fmt"
+	"strings"
+)
+
+type EmployeeSort struct {
+	Column constant.EmployeeColumn
+	Dir    string
+}
+
+func (s EmployeeSort) String() string {
+	if s.Dir == "desc" {
+		return "-" + string(s.Column)
+	}
+	return string(s.Column)
+}
+
+// DefaultEmployeeSorts is the listing order used when no sort is requested
+var DefaultEmployeeSorts = []EmployeeSort{{Column: constant.EmployeeColumnCreatedAt, Dir: "desc"}}
+
+// ParseEmployeeSort parses a comma separated sort expression such as
+// "hire_date,-last_name" where a leading '-' sorts the column descending.
+func ParseEmployeeSort(sort string) ([]EmployeeSort, error) {
+	sorts := []EmployeeSort{}
+	if strings.TrimSpace(sort) == "" {
+		return sorts, nil
+	}
+	for _, s := range strings.Split(sort, ",") {
+		s = strings.TrimSpace(s)
+		dir := "asc"
+		if strings.HasPrefix(s, "-") {
+			dir = "desc"
+			s = s[1:]
+		} else {
+			s = strings.TrimPrefix(s, "+")
+		}
+		column, err := constant.ParseEmployeeColumnName(s)
+		if err != nil {
+			return nil, fmt.Errorf("unknown sort column: %q", s)
+		}
+		sorts = append(sorts, EmployeeSort{Column: column, Dir: dir})
+	}
+	return sorts, nil
+}
+
+// FormatEmployeeSort is the inverse of ParseEmployeeSort
+func FormatEmployeeSort(sorts []EmployeeSort) string {
+	strs := []string{}
+	for _, s := range sorts {
+		strs = append(strs, s.String())
+	}
+	return strings.Join(strs, ",")
+}
+
+// EmployeeSortKeys returns the complete ordering applied to an employee
+// listing: the requested sorts (or the default one) followed by the id as
+// tiebreaker, so that every row has a unique position.
+func EmployeeSortKeys(sorts []EmployeeSort) []EmployeeSort {
+	if len(sorts) == 0 {
+		sorts = DefaultEmployeeSorts
+	}
+	keys := []EmployeeSort{}
+	for _, s := range sorts {
+		keys = append(keys, s)
+		if s.Column == constant.EmployeeColumnID {
+			return keys
+		}
+	}
+	return append(keys, EmployeeSort{Column: constant.EmployeeColumnID, Dir: sorts[len(sorts)-1].Dir})
+}
+
+// ReverseEmployeeSortKeys flips the direction of every key, used to walk a
+// keyset backwards
+func ReverseEmployeeSortKeys(keys []EmployeeSort) []EmployeeSort {
+	reversed := []EmployeeSort{}
+	for _, k := range keys {
+		dir := "desc"
+		if k.Dir == "desc" {
+			dir = "asc"
+		}
+		reversed = append(reversed, EmployeeSort{Column: k.Column, Dir: dir})
+	}
+	return reversed
+}
@@ -0,0 +1,67 @@
+package model
+
+import "time"
+
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// LogoutRequest identifies the access token of the caller, it is filled
+// from the verified claims and not bound from the request
+type LogoutRequest struct {
+	TokenID   string
+	SessionID string
+	ExpiresAt time.Time
+}
+
+type TokenResult struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // Seconds
+	RefreshToken string `json:"refresh_token"`
+}
+
+type CreateUserRequest struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Name     string `json:"name" validate:"required,notblank,max=120"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+type UserResult struct {
+	ID              int        `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	Email           string     `json:"email"`
+	Name            string     `json:"name"`
+	Superadmin      bool       `json:"superadmin"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+// ClientIP of the requests below is filled from the request and used to
+// rate limit them, it is not bound from the body
+
+type ForgotPasswordRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	ClientIP string `json:"-"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+	ClientIP string `json:"-"`
+}
+
+type VerifyEmailRequest struct {
+	Token    string `json:"token" validate:"required"`
+	ClientIP string `json:"-"`
+}
+
+type ResendEmailVerificationRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	ClientIP string `json:"-"`
+}
@@ -1,29 +1,208 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"strings"
 
 	"github.com/labstack/gommon/log"
 	"gopkg.in/yaml.v3"
 )
 
+// placeholderSecrets are the sample values of the secrets, a config still
+// holding one of them is refused
+var placeholderSecrets = []string{"change-me", "changeme", "secret"}
+
 type ConfigData struct {
 	Port    string `yaml:"port"`
 	Env     string `yaml:"env"`
 	AppCode string `yaml:"app_code"`
-	Db      struct {
+	// TrustedProxies are the CIDR ranges of the proxies whose
+	// X-Forwarded-For gives the client IP, none trusts the peer address
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	Db             struct {
 		Name     string `yaml:"name"`
 		Host     string `yaml:"host"`
 		Port     int64  `yaml:"port"`
 		Username string `yaml:"username"`
 		Password string `yaml:"password"`
 	} `yaml:"db"`
+	Pagination struct {
+		DefaultPageSize int `yaml:"default_page_size"`
+		MaxPageSize     int `yaml:"max_page_size"`
+		// CursorSecret signs the listing cursors, it is required
+		CursorSecret string `yaml:"cursor_secret"`
+	} `yaml:"pagination"`
+	Jwt struct {
+		// HmacSecret signs the local access tokens, it is required
+		HmacSecret     string `yaml:"hmac_secret"`
+		RsaPublicKey   string `yaml:"rsa_public_key"`
+		EcdsaPublicKey string `yaml:"ecdsa_public_key"`
+		// Leeway is the clock skew in seconds tolerated on exp and iat
+		Leeway int `yaml:"leeway"`
+		Jwks   struct {
+			// Source is a file path or an http(s) URL of the JWKS document
+			Source string `yaml:"source"`
+			// RefreshInterval is in seconds, 3600 when not set
+			RefreshInterval int `yaml:"refresh_interval"`
+			GracePeriod     int `yaml:"grace_period"`
+		} `yaml:"jwks"`
+	} `yaml:"jwt"`
+	Rbac struct {
+		// CacheTTL is how long in seconds the permissions of a user are cached
+		CacheTTL int `yaml:"cache_ttl"`
+	} `yaml:"rbac"`
+	Auth struct {
+		// AccessTokenTTL and RefreshTokenTTL are the lifetimes in seconds
+		// of the tokens issued by /auth/login, a login session ends when
+		// its refresh token expires
+		AccessTokenTTL  int `yaml:"access_token_ttl"`
+		RefreshTokenTTL int `yaml:"refresh_token_ttl"`
+		// AppID is the app of the roles in the issued tokens, the employees
+		// created before the tenants are assigned to it at startup
+		AppID int `yaml:"app_id"`
+		// PasswordHash is bcrypt (default) or argon2id
+		PasswordHash string `yaml:"password_hash"`
+		// The TTLs are in seconds, the tokens are appended to the urls of
+		// the mailed links
+		PasswordResetTTL     int    `yaml:"password_reset_ttl"`
+		PasswordResetURL     string `yaml:"password_reset_url"`
+		EmailVerificationTTL int    `yaml:"email_verification_ttl"`
+		EmailVerificationURL string `yaml:"email_verification_url"`
+		RequireVerifiedEmail bool   `yaml:"require_verified_email"`
+		RateLimit            struct {
+			PerAccount int `yaml:"per_account"`
+			PerIP      int `yaml:"per_ip"`
+			// Window is in seconds
+			Window int `yaml:"window"`
+		} `yaml:"rate_limit"`
+		Mfa struct {
+			// Issuer is the account issuer shown by authenticator apps
+			Issuer string `yaml:"issuer"`
+			// VerificationTTL is how long in seconds a verified session
+			// may reach the mfa routes
+			VerificationTTL  int  `yaml:"verification_ttl"`
+			RequireEnrolment bool `yaml:"require_enrolment"`
+			// MaxAttempts is the number of codes a user may try per
+			// AttemptWindow seconds until one is accepted
+			MaxAttempts   int `yaml:"max_attempts"`
+			AttemptWindow int `yaml:"attempt_window"`
+		} `yaml:"mfa"`
+	} `yaml:"auth"`
+	ClientAuth struct {
+		// MaxClockSkew is how far in seconds the X-TIMESTAMP of a signed
+		// request may be from the server clock, NonceTTL how long in
+		// seconds its X-EXTERNAL-ID cannot be reused
+		MaxClockSkew int `yaml:"max_clock_skew"`
+		NonceTTL     int `yaml:"nonce_ttl"`
+		// B2BTokenTTL is the lifetime in seconds of the access tokens
+		// issued by /v1.0/access-token/b2b
+		B2BTokenTTL int `yaml:"b2b_token_ttl"`
+		// ResponseSigningKey is the PEM RSA private key signing the
+		// responses of the clients in rsa response signing
+		ResponseSigningKey string `yaml:"response_signing_key"`
+	} `yaml:"client_auth"`
+	Snap struct {
+		// DefaultServiceCode is the SNAP service code of the routes
+		// missing in Routes, for the clients in snap response mode
+		DefaultServiceCode string      `yaml:"default_service_code"`
+		Routes             []SnapRoute `yaml:"routes"`
+	} `yaml:"snap"`
+	Idempotency struct {
+		// TTL is how long in seconds an Idempotency-Key is kept, the
+		// repeats of its request are replayed until then
+		TTL int `yaml:"ttl"`
+		// Lease is how long in seconds a request holds its key in
+		// progress, a retry takes over the key of a request that died
+		// before completing it once the lease is over (60 when not set)
+		Lease  int                `yaml:"lease"`
+		Routes []IdempotencyRoute `yaml:"routes"`
+	} `yaml:"idempotency"`
+	Mail struct {
+		// Driver is smtp or memory
+		Driver string `yaml:"driver"`
+		From   string `yaml:"from"`
+		Smtp   struct {
+			Host     string `yaml:"host"`
+			Port     int    `yaml:"port"`
+			Username string `yaml:"username"`
+			Password string `yaml:"password"`
+		} `yaml:"smtp"`
+	} `yaml:"mail"`
+	Permissions []RoutePermission `yaml:"permissions"`
+	Policies    []Policy          `yaml:"policies"`
+}
+
+// RoutePermission lists the permissions required by a registered route
+type RoutePermission struct {
+	Method      string   `yaml:"method"`
+	Path        string   `yaml:"path"`
+	Permissions []string `yaml:"permissions"`
+	// Match is "any" (default) when one of the permissions is enough or
+	// "all" when every permission is required
+	Match string `yaml:"match"`
+	// Public routes need neither a token nor a permission
+	Public bool `yaml:"public"`
+	// Authenticated routes need a token but no permission
+	Authenticated bool `yaml:"authenticated"`
+	// Mfa routes need the second factor of the users enrolled in MFA to
+	// be verified for the session of the token
+	Mfa bool `yaml:"mfa"`
+}
+
+// SnapRoute renders the responses of a route in the SNAP envelope, with
+// its two digit SNAP service code
+type SnapRoute struct {
+	Method      string `yaml:"method"`
+	Path        string `yaml:"path"`
+	ServiceCode string `yaml:"service_code"`
+}
+
+// IdempotencyRoute accepts an Idempotency-Key on a registered route
+type IdempotencyRoute struct {
+	Method string `yaml:"method"`
+	Path   string `yaml:"path"`
+}
+
+// Policy is an attribute based rule checked on the resource of an action,
+// see package policy for the condition syntax
+type Policy struct {
+	Name      string   `yaml:"name"`
+	Actions   []string `yaml:"actions"`
+	Condition string   `yaml:"condition"`
 }
 
 func (c ConfigData) IsEnvProduction() bool {
 	return c.Env == "production"
 }
 
+// Validate reports the settings the app cannot safely start without
+func (c ConfigData) Validate() error {
+	if c.Auth.AppID <= 0 {
+		return errors.New("auth.app_id is required to assign the employees created before the tenants")
+	}
+	if !isSecretSet(c.Pagination.CursorSecret) {
+		return errors.New("pagination.cursor_secret is required to sign the cursors")
+	}
+	if !isSecretSet(c.Jwt.HmacSecret) {
+		return errors.New("jwt.hmac_secret is required to sign the access tokens")
+	}
+	return nil
+}
+
+func isSecretSet(secret string) bool {
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return false
+	}
+	for _, placeholder := range placeholderSecrets {
+		if strings.EqualFold(secret, placeholder) {
+			return false
+		}
+	}
+	return true
+}
+
 var Data *ConfigData
 
 func Load() error {
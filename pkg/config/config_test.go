@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	c := ConfigData{}
+	c.Auth.AppID = 1
+	c.Pagination.CursorSecret = "cursor-secret"
+	c.Jwt.HmacSecret = "hmac-secret"
+	assert.Nil(t, c.Validate())
+
+	c.Jwt.HmacSecret = "change-me"
+	assert.EqualError(t, c.Validate(), "jwt.hmac_secret is required to sign the access tokens")
+
+	c.Jwt.HmacSecret = ""
+	assert.EqualError(t, c.Validate(), "jwt.hmac_secret is required to sign the access tokens")
+
+	c.Pagination.CursorSecret = "Change-Me"
+	assert.EqualError(t, c.Validate(), "pagination.cursor_secret is required to sign the cursors")
+
+	c.Pagination.CursorSecret = ""
+	assert.EqualError(t, c.Validate(), "pagination.cursor_secret is required to sign the cursors")
+
+	c.Auth.AppID = 0
+	assert.EqualError(t, c.Validate(), "auth.app_id is required to assign the employees created before the tenants")
+}
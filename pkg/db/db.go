@@ -20,7 +20,6 @@ import (
 
 type Handler struct {
 	DB *gorm.DB
-	Tx *gorm.DB
 }
 
 func Init() *Handler {
@@ -46,7 +45,7 @@ func InitWithPort(port int) *Handler {
 	if err != nil {
 		log.Fatal("Failed to open database connection: ", err)
 	}
-	return &Handler{DB: conn, Tx: conn}
+	return &Handler{DB: conn}
 }
 
 func Migrate(handler *Handler) {
@@ -2,6 +2,7 @@ package pkgerror
 
 import (
 	"net/http"
+	"strconv"
 )
 
 type CustomError struct {
@@ -31,4 +32,76 @@ var (
 	ErrForbiddenRequest        CustomError = CustomError{Code: "0004", Msg: "Request forbidden. Operation not allowed", HttpCode: http.StatusForbidden}
 	ErrEmployeeNotFound        CustomError = CustomError{Code: "0005", Msg: "Employee not found", HttpCode: http.StatusNotFound}
 	ErrEmployeeIsExist         CustomError = CustomError{Code: "0006", Msg: "Employee is already exist", HttpCode: http.StatusBadRequest}
+	ErrUnsupportedMediaType    CustomError = CustomError{Code: "0007", Msg: "Unsupported request content type", HttpCode: http.StatusUnsupportedMediaType}
+	ErrPreconditionFailed      CustomError = CustomError{Code: "0008", Msg: "Resource has been modified by another request, reload it and retry", HttpCode: http.StatusPreconditionFailed}
+	ErrPreconditionRequired    CustomError = CustomError{Code: "0009", Msg: "Missing If-Match header, reload the resource to get its ETag", HttpCode: http.StatusPreconditionRequired}
+	ErrRoleNotFound            CustomError = CustomError{Code: "0010", Msg: "Role not found", HttpCode: http.StatusNotFound}
+	ErrRoleIsExist             CustomError = CustomError{Code: "0011", Msg: "Role is already exist", HttpCode: http.StatusBadRequest}
+	ErrPermissionNotFound      CustomError = CustomError{Code: "0012", Msg: "Permission not found", HttpCode: http.StatusNotFound}
+	ErrPermissionIsExist       CustomError = CustomError{Code: "0013", Msg: "Permission is already exist", HttpCode: http.StatusBadRequest}
+	ErrInvalidCredentials      CustomError = CustomError{Code: "0014", Msg: "Invalid email or password", HttpCode: http.StatusUnauthorized}
+	ErrUserIsExist             CustomError = CustomError{Code: "0015", Msg: "User is already exist", HttpCode: http.StatusBadRequest}
+	ErrInvalidRefreshToken     CustomError = CustomError{Code: "0016", Msg: "Refresh token is invalid, expired or revoked, please login again", HttpCode: http.StatusUnauthorized}
+	ErrMfaRequired             CustomError = CustomError{Code: "0017", Msg: "Multi-factor authentication required, verify a code first", HttpCode: http.StatusForbidden}
+	ErrInvalidMfaCode          CustomError = CustomError{Code: "0018", Msg: "Verification code is invalid or already used", HttpCode: http.StatusUnauthorized}
+	ErrMfaNotEnrolled          CustomError = CustomError{Code: "0019", Msg: "Multi-factor authentication is not enrolled", HttpCode: http.StatusBadRequest}
+	ErrMfaIsEnrolled           CustomError = CustomError{Code: "0020", Msg: "Multi-factor authentication is already enrolled", HttpCode: http.StatusBadRequest}
+	ErrTooManyRequests         CustomError = CustomError{Code: "0021", Msg: "Too many requests, please try again later", HttpCode: http.StatusTooManyRequests}
+	ErrInvalidToken            CustomError = CustomError{Code: "0022", Msg: "Token is invalid, expired or already used", HttpCode: http.StatusBadRequest}
+	ErrEmailNotVerified        CustomError = CustomError{Code: "0023", Msg: "Email is not verified, follow the link mailed to verify it", HttpCode: http.StatusForbidden}
+	ErrInvalidSignature        CustomError = CustomError{Code: "0024", Msg: "Request signature is invalid or its timestamp is out of range", HttpCode: http.StatusUnauthorized}
+	ErrDuplicateExternalID     CustomError = CustomError{Code: "0025", Msg: "X-EXTERNAL-ID was already used, send a new one", HttpCode: http.StatusConflict}
+	ErrClientNotFound          CustomError = CustomError{Code: "0026", Msg: "API client not found", HttpCode: http.StatusNotFound}
+	ErrIdempotencyKeyReused    CustomError = CustomError{Code: "0027", Msg: "Idempotency-Key was already used with a different request", HttpCode: http.StatusConflict}
+	ErrIdempotencyInProgress   CustomError = CustomError{Code: "0028", Msg: "A request with the same Idempotency-Key is in progress, retry later", HttpCode: http.StatusConflict}
+	ErrRequestTooLarge         CustomError = CustomError{Code: "0029", Msg: "Request body is too large", HttpCode: http.StatusRequestEntityTooLarge}
 )
+
+// snapCaseCodes maps the codes to their SNAP case codes, 00 is the general
+// case of the HTTP status of the error
+var snapCaseCodes = map[string]string{
+	ErrSystemError.Code:             "01", // Internal Server Error
+	ErrUnauthorizedRequest.Code:     "01", // Invalid Token
+	ErrInvalidParams.Code:           "01", // Invalid Field Format
+	ErrUndefinedPathPermission.Code: "00",
+	ErrForbiddenRequest.Code:        "01", // Feature Not Allowed
+	ErrEmployeeNotFound.Code:        "01", // Not Found
+	ErrEmployeeIsExist.Code:         "00",
+	ErrUnsupportedMediaType.Code:    "00",
+	ErrPreconditionFailed.Code:      "00",
+	ErrPreconditionRequired.Code:    "00",
+	ErrRoleNotFound.Code:            "01",
+	ErrRoleIsExist.Code:             "00",
+	ErrPermissionNotFound.Code:      "01",
+	ErrPermissionIsExist.Code:       "00",
+	ErrInvalidCredentials.Code:      "00",
+	ErrUserIsExist.Code:             "00",
+	ErrInvalidRefreshToken.Code:     "01",
+	ErrMfaRequired.Code:             "01",
+	ErrInvalidMfaCode.Code:          "00",
+	ErrMfaNotEnrolled.Code:          "00",
+	ErrMfaIsEnrolled.Code:           "00",
+	ErrTooManyRequests.Code:         "00",
+	ErrInvalidToken.Code:            "01",
+	ErrEmailNotVerified.Code:        "01",
+	ErrInvalidSignature.Code:        "00", // Unauthorized. Signature
+	ErrDuplicateExternalID.Code:     "00", // Conflict
+	ErrClientNotFound.Code:          "01",
+	ErrIdempotencyKeyReused.Code:    "01", // Duplicate partnerReferenceNo
+	ErrIdempotencyInProgress.Code:   "00",
+	ErrRequestTooLarge.Code:         "00",
+}
+
+// SnapResponseCode returns the SNAP responseCode of the error for the two
+// digit service code of an API: HTTP status, service code and case code,
+// such as 4040101
+func (e CustomError) SnapResponseCode(serviceCode string) string {
+	if e.IsNoError() {
+		return strconv.Itoa(http.StatusOK) + serviceCode + "00"
+	}
+	caseCode, ok := snapCaseCodes[e.Code]
+	if !ok {
+		caseCode = "00"
+	}
+	return strconv.Itoa(e.HttpCode) + serviceCode + caseCode
+}
@@ -0,0 +1,32 @@
+package pkgerror
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapResponseCode(t *testing.T) {
+	errs := []CustomError{
+		ErrSystemError, ErrUnauthorizedRequest, ErrInvalidParams, ErrUndefinedPathPermission,
+		ErrForbiddenRequest, ErrEmployeeNotFound, ErrEmployeeIsExist, ErrUnsupportedMediaType,
+		ErrPreconditionFailed, ErrPreconditionRequired, ErrRoleNotFound, ErrRoleIsExist,
+		ErrPermissionNotFound, ErrPermissionIsExist, ErrInvalidCredentials, ErrUserIsExist,
+		ErrInvalidRefreshToken, ErrMfaRequired, ErrInvalidMfaCode, ErrMfaNotEnrolled,
+		ErrMfaIsEnrolled, ErrTooManyRequests, ErrInvalidToken, ErrEmailNotVerified,
+		ErrInvalidSignature, ErrDuplicateExternalID, ErrClientNotFound, ErrIdempotencyKeyReused,
+		ErrIdempotencyInProgress, ErrRequestTooLarge,
+	}
+	for _, e := range errs {
+		_, ok := snapCaseCodes[e.Code]
+		assert.True(t, ok, "no SNAP case code for %s", e.Code)
+		code := e.SnapResponseCode("01")
+		assert.Len(t, code, 7, e.Code)
+	}
+	assert.Equal(t, "4040101", ErrEmployeeNotFound.SnapResponseCode("01"))
+	assert.Equal(t, "4017300", ErrInvalidSignature.SnapResponseCode("73"))
+	assert.Equal(t, "5000001", ErrSystemError.WithError(nil).SnapResponseCode("00"))
+	assert.Equal(t, "2007300", NoError.SnapResponseCode("73"))
+	assert.Equal(t, "4180100", CustomError{Code: "unknown", HttpCode: http.StatusTeapot}.SnapResponseCode("01"))
+}
@@ -0,0 +1,274 @@
+// Package filterexpr parses filter expressions such as
+//
+//	hire_date ge 2020-01-01 and (last_name sw 'Sa' or email ew '@corp.id')
+//
+// into a typed syntax tree. Only the declared fields are accepted and every
+// value is converted to the type of its field, so the tree can safely be
+// rendered into a parameterized query.
+package filterexpr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxLength = 2000
+	maxDepth  = 20
+)
+
+type FieldType int
+
+const (
+	FieldString FieldType = iota
+	FieldNumber
+	FieldTime
+)
+
+type Operator string
+
+const (
+	OpEq       Operator = "eq"
+	OpNe       Operator = "ne"
+	OpGt       Operator = "gt"
+	OpGe       Operator = "ge"
+	OpLt       Operator = "lt"
+	OpLe       Operator = "le"
+	OpIn       Operator = "in"
+	OpContains Operator = "contains"
+	OpSw       Operator = "sw"
+	OpEw       Operator = "ew"
+)
+
+var operators = []Operator{OpEq, OpNe, OpGt, OpGe, OpLt, OpLe, OpIn, OpContains, OpSw, OpEw}
+
+func parseOperator(str string) (Operator, bool) {
+	for _, op := range operators {
+		if strings.EqualFold(str, string(op)) {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// IsTextOperator reports whether the operator does substring matching and
+// thus only applies to string fields
+func (o Operator) IsTextOperator() bool {
+	return o == OpContains || o == OpSw || o == OpEw
+}
+
+type Node interface {
+	node()
+}
+
+// Logical joins two expressions with "and" or "or"
+type Logical struct {
+	Op    string
+	Left  Node
+	Right Node
+}
+
+type Not struct {
+	Expr Node
+}
+
+// Comparison compares a field to one value, or to several for OpIn. Values
+// are string, int64 or time.Time depending on the field type.
+type Comparison struct {
+	Field  string
+	Op     Operator
+	Values []interface{}
+}
+
+func (*Logical) node()    {}
+func (*Not) node()        {}
+func (*Comparison) node() {}
+
+// Parse parses the expression, fields declares the allowed field names and
+// their types. An empty expression returns a nil node.
+func Parse(expr string, fields map[string]FieldType) (Node, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	if len(expr) > maxLength {
+		return nil, fmt.Errorf("filter is longer than %d characters", maxLength)
+	}
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, fields: fields}
+	node, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d, expected 'and', 'or' or end of filter", t, t.pos)
+	}
+	return node, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	fields map[string]FieldType
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) peekKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (p *parser) parseOr(depth int) (Node, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.next()
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd(depth int) (Node, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.next()
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary(depth int) (Node, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("filter is nested deeper than %d levels", maxDepth)
+	}
+	if p.peekKeyword("not") {
+		p.next()
+		expr, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: expr}, nil
+	}
+	if t := p.peek(); t.kind == tokenLParen {
+		p.next()
+		expr, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenRParen {
+			return nil, fmt.Errorf("unexpected %s at position %d, expected ')'", t, t.pos)
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Node, error) {
+	t := p.next()
+	if t.kind != tokenWord {
+		return nil, fmt.Errorf("unexpected %s at position %d, expected a field name", t, t.pos)
+	}
+	field := strings.ToLower(t.text)
+	fieldType, ok := p.fields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q at position %d", t.text, t.pos)
+	}
+
+	t = p.next()
+	op, ok := parseOperator(t.text)
+	if t.kind != tokenWord || !ok {
+		return nil, fmt.Errorf("unexpected %s at position %d, expected an operator (%s)", t, t.pos, operatorList())
+	}
+	if op.IsTextOperator() && fieldType != FieldString {
+		return nil, fmt.Errorf("operator %s at position %d only applies to text fields, %s is not one", op, t.pos, field)
+	}
+
+	cmp := &Comparison{Field: field, Op: op}
+	if op != OpIn {
+		value, err := p.parseValue(field, fieldType)
+		if err != nil {
+			return nil, err
+		}
+		cmp.Values = []interface{}{value}
+		return cmp, nil
+	}
+
+	if t := p.next(); t.kind != tokenLParen {
+		return nil, fmt.Errorf("unexpected %s at position %d, expected '(' after in", t, t.pos)
+	}
+	for {
+		value, err := p.parseValue(field, fieldType)
+		if err != nil {
+			return nil, err
+		}
+		cmp.Values = append(cmp.Values, value)
+		t := p.next()
+		if t.kind == tokenRParen {
+			return cmp, nil
+		}
+		if t.kind != tokenComma {
+			return nil, fmt.Errorf("unexpected %s at position %d, expected ',' or ')'", t, t.pos)
+		}
+	}
+}
+
+func (p *parser) parseValue(field string, fieldType FieldType) (interface{}, error) {
+	t := p.next()
+	if t.kind != tokenWord && t.kind != tokenString {
+		return nil, fmt.Errorf("unexpected %s at position %d, expected a value for %s", t, t.pos, field)
+	}
+	switch fieldType {
+	case FieldNumber:
+		n, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %s at position %d, %s expects a whole number", t, t.pos, field)
+		}
+		return n, nil
+	case FieldTime:
+		if d, err := time.Parse("2006-01-02", t.text); err == nil {
+			return d, nil
+		}
+		d, err := time.Parse(time.RFC3339, t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %s at position %d, %s expects YYYY-MM-DD or RFC3339", t, t.pos, field)
+		}
+		return d, nil
+	}
+	return t.text, nil
+}
+
+func operatorList() string {
+	strs := []string{}
+	for _, op := range operators {
+		strs = append(strs, string(op))
+	}
+	return strings.Join(strs, ", ")
+}
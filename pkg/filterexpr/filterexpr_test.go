@@ -0,0 +1,82 @@
+package filterexpr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fields = map[string]FieldType{
+	"id":        FieldNumber,
+	"last_name": FieldString,
+	"email":     FieldString,
+	"hire_date": FieldTime,
+}
+
+func TestParse(t *testing.T) {
+	node, err := Parse("hire_date ge 2020-01-01 and (last_name sw 'Sa' or email ew '@corp.id')", fields)
+	assert.Nil(t, err)
+	assert.Equal(t, &Logical{
+		Op:   "and",
+		Left: &Comparison{Field: "hire_date", Op: OpGe, Values: []interface{}{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		Right: &Logical{
+			Op:    "or",
+			Left:  &Comparison{Field: "last_name", Op: OpSw, Values: []interface{}{"Sa"}},
+			Right: &Comparison{Field: "email", Op: OpEw, Values: []interface{}{"@corp.id"}},
+		},
+	}, node)
+}
+
+func TestParsePrecedence(t *testing.T) {
+	node, err := Parse("id eq 1 or id eq 2 and not last_name eq 'O''Neil'", fields)
+	assert.Nil(t, err)
+	assert.Equal(t, &Logical{
+		Op:   "or",
+		Left: &Comparison{Field: "id", Op: OpEq, Values: []interface{}{int64(1)}},
+		Right: &Logical{
+			Op:    "and",
+			Left:  &Comparison{Field: "id", Op: OpEq, Values: []interface{}{int64(2)}},
+			Right: &Not{Expr: &Comparison{Field: "last_name", Op: OpEq, Values: []interface{}{"O'Neil"}}},
+		},
+	}, node)
+}
+
+func TestParseIn(t *testing.T) {
+	node, err := Parse("ID IN (1, 2,3)", fields)
+	assert.Nil(t, err)
+	assert.Equal(t, &Comparison{Field: "id", Op: OpIn, Values: []interface{}{int64(1), int64(2), int64(3)}}, node)
+}
+
+func TestParseEmpty(t *testing.T) {
+	node, err := Parse("  ", fields)
+	assert.Nil(t, err)
+	assert.Nil(t, node)
+}
+
+func TestParseError(t *testing.T) {
+	testCases := []struct {
+		Expr          string
+		ExpectedError string
+	}{
+		{"password eq 'x'", `unknown field "password" at position 1`},
+		{"email like 'x'", `unexpected "like" at position 7, expected an operator (eq, ne, gt, ge, lt, le, in, contains, sw, ew)`},
+		{"id sw 1", "operator sw at position 4 only applies to text fields, id is not one"},
+		{"id eq abc", `invalid value "abc" at position 7, id expects a whole number`},
+		{"hire_date gt 01/01/2020", `invalid value "01/01/2020" at position 14, hire_date expects YYYY-MM-DD or RFC3339`},
+		{"email eq 'x", "unterminated string starting at position 10"},
+		{"(email eq 'x'", "unexpected end of filter at position 14, expected ')'"},
+		{"email eq 'x')", `unexpected ")" at position 13, expected 'and', 'or' or end of filter`},
+		{"email eq", "unexpected end of filter at position 9, expected a value for email"},
+		{"id in (1 2)", `unexpected "2" at position 10, expected ',' or ')'`},
+		{"email eq 'x' and", "unexpected end of filter at position 17, expected a field name"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Expr, func(t *testing.T) {
+			_, err := Parse(tc.Expr, fields)
+			if assert.Error(t, err) {
+				assert.Equal(t, tc.ExpectedError, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+var ErrUnknownKid = errors.New("no key found for kid")
+
+// minRefreshInterval limits how often an unknown kid triggers a refresh
+const minRefreshInterval = 10 * time.Second
+
+// defaultRefreshInterval is the refresh interval of a set when none is
+// configured
+const defaultRefreshInterval = time.Hour
+
+// JWKS is a JSON Web Key Set loaded from a file or an HTTP URL. The keys
+// are cached and refreshed periodically, a key removed from the set is
+// still accepted during the grace period so tokens signed right before a
+// rotation stay valid.
+type JWKS struct {
+	source          string
+	refreshInterval time.Duration
+	gracePeriod     time.Duration
+	client          *http.Client
+	now             func() time.Time
+
+	mu      sync.RWMutex
+	keys    map[string]interface{}
+	retired map[string]retiredKey
+
+	// refreshMu runs one refresh at a time, attemptedAt is the start of
+	// the last one whatever its outcome
+	refreshMu   sync.Mutex
+	attemptedAt time.Time
+}
+
+type retiredKey struct {
+	key       interface{}
+	retiredAt time.Time
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func NewJWKS(source string, refreshInterval, gracePeriod time.Duration) *JWKS {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultRefreshInterval
+	}
+	return &JWKS{
+		source:          source,
+		refreshInterval: refreshInterval,
+		gracePeriod:     gracePeriod,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		now:             time.Now,
+		keys:            map[string]interface{}{},
+		retired:         map[string]retiredKey{},
+	}
+}
+
+// Key returns the public key of kid, refreshing the set once when the kid
+// is unknown as it may have been added since the last refresh. The
+// refreshes of unknown kids are throttled, failed ones too, and the
+// concurrent ones wait for the refresh in progress instead of fetching
+// the set again.
+func (j *JWKS) Key(ctx context.Context, kid string) (interface{}, error) {
+	if key, ok := j.lookup(kid); ok {
+		return key, nil
+	}
+	j.refreshMu.Lock()
+	if j.now().Sub(j.attemptedAt) >= minRefreshInterval {
+		if err := j.refresh(ctx); err != nil {
+			log.Error("Refresh JWKS error: ", err)
+		}
+	}
+	j.refreshMu.Unlock()
+	if key, ok := j.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownKid, kid)
+}
+
+func (j *JWKS) lookup(kid string) (interface{}, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if key, ok := j.keys[kid]; ok {
+		return key, true
+	}
+	if r, ok := j.retired[kid]; ok && j.now().Sub(r.retiredAt) < j.gracePeriod {
+		return r.key, true
+	}
+	return nil, false
+}
+
+// Refresh reloads the key set, on error the cached keys are kept
+func (j *JWKS) Refresh(ctx context.Context) error {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+	return j.refresh(ctx)
+}
+
+// refresh reloads the key set, refreshMu must be held
+func (j *JWKS) refresh(ctx context.Context) error {
+	j.attemptedAt = j.now()
+	data, err := j.load(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := j.now()
+	for kid, key := range j.keys {
+		if _, ok := keys[kid]; !ok {
+			j.retired[kid] = retiredKey{key: key, retiredAt: now}
+		}
+	}
+	for kid, r := range j.retired {
+		if _, ok := keys[kid]; ok || now.Sub(r.retiredAt) >= j.gracePeriod {
+			delete(j.retired, kid)
+		}
+	}
+	j.keys = keys
+	return nil
+}
+
+// Run refreshes the key set every refresh interval until ctx is done
+func (j *JWKS) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := j.Refresh(ctx); err != nil {
+				log.Error("Refresh JWKS error: ", err)
+			}
+		}
+	}
+}
+
+func (j *JWKS) load(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(j.source, "file://"))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS: unexpected status %d", res.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	doc := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("decode JWKS: %w", err)
+	}
+	keys := map[string]interface{}{}
+	for _, k := range doc.Keys {
+		if k.Kid == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("parse JWK %s: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve P-256")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func decodeBigInt(val string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(val)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
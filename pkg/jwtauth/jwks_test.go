@@ -0,0 +1,252 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// jwksServer is a local stand-in for the identity provider JWKS endpoint
+type jwksServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	keys     []map[string]string
+	requests int
+}
+
+func newJwksServer() *jwksServer {
+	s := &jwksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+		if s.keys == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+	}))
+	return s
+}
+
+func (s *jwksServer) setKeys(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *jwksServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func rsaJwk(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJwk(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func signWithKid(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	token := jwt.NewWithClaims(method, validClaims())
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	assert.Nil(t, err)
+	return signed
+}
+
+func newTestJWKS(source string, clock *time.Time) *JWKS {
+	jwks := NewJWKS(source, time.Hour, 24*time.Hour)
+	jwks.now = func() time.Time { return *clock }
+	return jwks
+}
+
+func TestJWKSSelectsKeyByKid(t *testing.T) {
+	server := newJwksServer()
+	defer server.Close()
+	otherRsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server.setKeys(rsaJwk("rsa-1", &rsaKey.PublicKey), rsaJwk("rsa-2", &otherRsaKey.PublicKey), ecJwk("ec-1", &ecdsaKey.PublicKey))
+	clock := now
+	jwks := newTestJWKS(server.URL, &clock)
+	assert.Nil(t, jwks.Refresh(context.Background()))
+	v := newTestVerifier(Keys{JWKS: jwks})
+
+	_, err := v.Verify(context.Background(), signWithKid(t, jwt.SigningMethodRS256, "rsa-1", rsaKey))
+	assert.Nil(t, err)
+	_, err = v.Verify(context.Background(), signWithKid(t, jwt.SigningMethodES256, "ec-1", ecdsaKey))
+	assert.Nil(t, err)
+	// signed by rsa-1 but claims to be rsa-2
+	_, err = v.Verify(context.Background(), signWithKid(t, jwt.SigningMethodRS256, "rsa-2", rsaKey))
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+	_, err = v.Verify(context.Background(), signWithKid(t, jwt.SigningMethodRS256, "unknown", rsaKey))
+	assert.ErrorIs(t, err, ErrUnknownKid)
+}
+
+func TestJWKSRotation(t *testing.T) {
+	server := newJwksServer()
+	defer server.Close()
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server.setKeys(rsaJwk("old", &rsaKey.PublicKey))
+	clock := now
+	jwks := newTestJWKS(server.URL, &clock)
+	assert.Nil(t, jwks.Refresh(context.Background()))
+	v := newTestVerifier(Keys{JWKS: jwks})
+	oldToken := signWithKid(t, jwt.SigningMethodRS256, "old", rsaKey)
+	newToken := signWithKid(t, jwt.SigningMethodRS256, "new", newKey)
+
+	// the new key is fetched on its first use
+	server.setKeys(rsaJwk("new", &newKey.PublicKey))
+	clock = clock.Add(time.Minute)
+	_, err := v.Verify(context.Background(), newToken)
+	assert.Nil(t, err)
+
+	// the old key is still accepted during the grace period
+	clock = clock.Add(23 * time.Hour)
+	_, err = v.Verify(context.Background(), oldToken)
+	assert.Nil(t, err)
+
+	clock = clock.Add(2 * time.Hour)
+	assert.Nil(t, jwks.Refresh(context.Background()))
+	_, err = v.Verify(context.Background(), oldToken)
+	assert.ErrorIs(t, err, ErrUnknownKid)
+}
+
+func TestJWKSRefreshFailureKeepsKeys(t *testing.T) {
+	server := newJwksServer()
+	defer server.Close()
+	server.setKeys(rsaJwk("rsa-1", &rsaKey.PublicKey))
+	clock := now
+	jwks := newTestJWKS(server.URL, &clock)
+	assert.Nil(t, jwks.Refresh(context.Background()))
+
+	// no keys makes the server unavailable
+	server.setKeys()
+	assert.NotNil(t, jwks.Refresh(context.Background()))
+	_, err := jwks.Key(context.Background(), "rsa-1")
+	assert.Nil(t, err)
+}
+
+func TestJWKSUnknownKidRefreshIsThrottled(t *testing.T) {
+	server := newJwksServer()
+	defer server.Close()
+	server.setKeys(rsaJwk("rsa-1", &rsaKey.PublicKey))
+	clock := now
+	jwks := newTestJWKS(server.URL, &clock)
+	assert.Nil(t, jwks.Refresh(context.Background()))
+	for i := 0; i < 5; i++ {
+		_, err := jwks.Key(context.Background(), "unknown")
+		assert.ErrorIs(t, err, ErrUnknownKid)
+	}
+	assert.Equal(t, 1, server.requestCount())
+
+	clock = clock.Add(minRefreshInterval)
+	_, _ = jwks.Key(context.Background(), "unknown")
+	assert.Equal(t, 2, server.requestCount())
+}
+
+func TestJWKSFailedRefreshIsThrottled(t *testing.T) {
+	server := newJwksServer()
+	defer server.Close()
+	server.setKeys(rsaJwk("rsa-1", &rsaKey.PublicKey))
+	clock := now
+	jwks := newTestJWKS(server.URL, &clock)
+	assert.Nil(t, jwks.Refresh(context.Background()))
+
+	// no keys makes the server unavailable
+	server.setKeys()
+	clock = clock.Add(minRefreshInterval)
+	for i := 0; i < 5; i++ {
+		_, err := jwks.Key(context.Background(), "unknown")
+		assert.ErrorIs(t, err, ErrUnknownKid)
+	}
+	assert.Equal(t, 2, server.requestCount())
+}
+
+func TestJWKSConcurrentRefreshesAreCollapsed(t *testing.T) {
+	server := newJwksServer()
+	defer server.Close()
+	server.setKeys(rsaJwk("rsa-1", &rsaKey.PublicKey))
+	clock := now
+	jwks := newTestJWKS(server.URL, &clock)
+	assert.Nil(t, jwks.Refresh(context.Background()))
+
+	clock = clock.Add(minRefreshInterval)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := jwks.Key(context.Background(), "unknown")
+			assert.ErrorIs(t, err, ErrUnknownKid)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 2, server.requestCount())
+}
+
+func TestJWKSDefaultRefreshInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		jwks := NewJWKS("jwks.json", interval, time.Hour)
+		assert.Equal(t, defaultRefreshInterval, jwks.refreshInterval)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// does not panic on a missing interval
+	NewJWKS("jwks.json", 0, time.Hour).Run(ctx)
+}
+
+func TestJWKSFromFile(t *testing.T) {
+	data, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		ecJwk("ec-1", &ecdsaKey.PublicKey),
+		{"kty": "RSA", "kid": "enc-1", "use": "enc"},
+	}})
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.Nil(t, os.WriteFile(path, data, 0o600))
+	clock := now
+	jwks := newTestJWKS(path, &clock)
+	assert.Nil(t, jwks.Refresh(context.Background()))
+	key, err := jwks.Key(context.Background(), "ec-1")
+	assert.Nil(t, err)
+	assert.True(t, ecdsaKey.PublicKey.Equal(key))
+	_, err = jwks.Key(context.Background(), "enc-1")
+	assert.ErrorIs(t, err, ErrUnknownKid)
+}
+
+func TestParseJWKSInvalidKey(t *testing.T) {
+	other, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	jwk := ecJwk("ec-1", &ecdsaKey.PublicKey)
+	jwk["y"] = base64.RawURLEncoding.EncodeToString(other.Y.Bytes())
+	data, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{jwk}})
+	_, err := parseJWKS(data)
+	assert.NotNil(t, err)
+}
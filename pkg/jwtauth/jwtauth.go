@@ -0,0 +1,187 @@
+package jwtauth
+
+import (
+	"backend_test/model"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	ErrMissingToken    = errors.New("missing bearer token")
+	ErrUnsupportedAlg  = errors.New("signing algorithm is not configured")
+	ErrMissingExpiry   = errors.New("token has no exp claim")
+	ErrTokenExpired    = errors.New("token is expired")
+	ErrTokenNotYetIat  = errors.New("token is issued in the future")
+	ErrInvalidAudience = errors.New("token audience does not contain the app code")
+	ErrInvalidType     = errors.New("client claim and b2b token type must go together")
+	ErrInvalidIssuer   = errors.New("local issuer is only accepted on tokens signed with the hmac secret")
+)
+
+// Keys are the keys a Verifier accepts, an algorithm is only accepted when
+// its key is set. Tokens with a kid header are verified with the key of
+// the JWKS, the others with the static keys.
+type Keys struct {
+	HmacSecret     []byte
+	RsaPublicKey   *rsa.PublicKey
+	EcdsaPublicKey *ecdsa.PublicKey
+	JWKS           *JWKS
+}
+
+type Verifier struct {
+	keys     Keys
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+func NewVerifier(keys Keys, audience string, leeway time.Duration) *Verifier {
+	return &Verifier{
+		keys:     keys,
+		audience: audience,
+		leeway:   leeway,
+		now:      time.Now,
+	}
+}
+
+// tokenClaims decodes model.JwtClaims, the registered claims shadow the
+// ones of model.JwtClaims so that a single string aud is accepted too
+type tokenClaims struct {
+	model.JwtClaims
+	Audience  jwt.ClaimStrings `json:"aud"`
+	ExpiresAt *jwt.NumericDate `json:"exp"`
+	IssuedAt  *jwt.NumericDate `json:"iat"`
+}
+
+// Valid is a no-op, the claims are validated by Verifier.validate
+func (c tokenClaims) Valid() error {
+	return nil
+}
+
+// Verify checks the signature and the iss, exp, iat, aud and typ claims of
+// the token
+func (v *Verifier) Verify(ctx context.Context, token string) (*model.JwtClaims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	claims := tokenClaims{}
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(v.methods()),
+		jwt.WithoutClaimsValidation())
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		return v.key(ctx, token)
+	}
+	parsed, err := parser.ParseWithClaims(token, &claims, keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	// the users of the local issuer are only the ones of this service, an
+	// identity provider cannot claim them
+	if claims.Iss == model.LocalIssuer && parsed.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+		return nil, ErrInvalidIssuer
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	result := claims.JwtClaims
+	result.Aud = claims.Audience
+	result.Exp = claims.ExpiresAt.Unix()
+	if claims.IssuedAt != nil {
+		result.Iat = claims.IssuedAt.Unix()
+	}
+	return &result, nil
+}
+
+func (v *Verifier) validate(claims tokenClaims) error {
+	now := v.now()
+	if claims.ExpiresAt == nil {
+		return ErrMissingExpiry
+	}
+	if now.After(claims.ExpiresAt.Add(v.leeway)) {
+		return ErrTokenExpired
+	}
+	if claims.IssuedAt != nil && claims.IssuedAt.After(now.Add(v.leeway)) {
+		return ErrTokenNotYetIat
+	}
+	if !slices.Contains(claims.Audience, v.audience) {
+		return ErrInvalidAudience
+	}
+	// a user token claiming a client, or the reverse, is forged by an
+	// issuer sharing the key
+	if (claims.Client != "") != (claims.Typ == model.TokenTypeB2B) {
+		return ErrInvalidType
+	}
+	return nil
+}
+
+func (v *Verifier) methods() []string {
+	methods := []string{}
+	if len(v.keys.HmacSecret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if v.keys.RsaPublicKey != nil {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if v.keys.EcdsaPublicKey != nil {
+		methods = append(methods, jwt.SigningMethodES256.Alg())
+	}
+	if v.keys.JWKS != nil {
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+	return methods
+}
+
+func (v *Verifier) key(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok && v.keys.JWKS != nil {
+		return v.keys.JWKS.Key(ctx, kid)
+	}
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return v.keys.HmacSecret, nil
+	case jwt.SigningMethodRS256.Alg():
+		if v.keys.RsaPublicKey != nil {
+			return v.keys.RsaPublicKey, nil
+		}
+	case jwt.SigningMethodES256.Alg():
+		if v.keys.EcdsaPublicKey != nil {
+			return v.keys.EcdsaPublicKey, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, token.Method.Alg())
+}
+
+// BearerToken returns the token of an `Authorization: Bearer <token>` header
+func BearerToken(header string) string {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// ParseKeys parses the PEM encoded public keys of the config
+func ParseKeys(hmacSecret, rsaPublicKey, ecdsaPublicKey string) (Keys, error) {
+	keys := Keys{HmacSecret: []byte(hmacSecret)}
+	if rsaPublicKey != "" {
+		key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(rsaPublicKey))
+		if err != nil {
+			return keys, fmt.Errorf("parse rsa public key: %w", err)
+		}
+		keys.RsaPublicKey = key
+	}
+	if ecdsaPublicKey != "" {
+		key, err := jwt.ParseECPublicKeyFromPEM([]byte(ecdsaPublicKey))
+		if err != nil {
+			return keys, fmt.Errorf("parse ecdsa public key: %w", err)
+		}
+		keys.EcdsaPublicKey = key
+	}
+	return keys, nil
+}
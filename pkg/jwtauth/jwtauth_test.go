@@ -0,0 +1,229 @@
+package jwtauth
+
+import (
+	"backend_test/model"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const audience = "backend_testing_t"
+
+var (
+	now         = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	hmacSecret  = []byte("jwt-secret-test")
+	rsaKey, _   = rsa.GenerateKey(rand.Reader, 2048)
+	ecdsaKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+func newTestVerifier(keys Keys) *Verifier {
+	v := NewVerifier(keys, audience, 30*time.Second)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"aud": []string{audience},
+		"exp": now.Add(time.Hour).Unix(),
+		"iat": now.Unix(),
+		"user": map[string]interface{}{
+			"id":         1,
+			"email":      "user@gmail.com",
+			"superadmin": true,
+		},
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	assert.Nil(t, err)
+	return token
+}
+
+func TestVerify(t *testing.T) {
+	keys := Keys{
+		HmacSecret:     hmacSecret,
+		RsaPublicKey:   &rsaKey.PublicKey,
+		EcdsaPublicKey: &ecdsaKey.PublicKey,
+	}
+	withClaim := func(name string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	testCases := []struct {
+		Name          string
+		Keys          Keys
+		Token         string
+		ExpectedError error
+	}{
+		{
+			Name:  "HS256",
+			Keys:  keys,
+			Token: sign(t, jwt.SigningMethodHS256, hmacSecret, validClaims()),
+		},
+		{
+			Name:  "RS256",
+			Keys:  keys,
+			Token: sign(t, jwt.SigningMethodRS256, rsaKey, validClaims()),
+		},
+		{
+			Name:  "ES256",
+			Keys:  keys,
+			Token: sign(t, jwt.SigningMethodES256, ecdsaKey, validClaims()),
+		},
+		{
+			Name:  "StringAudience",
+			Keys:  keys,
+			Token: sign(t, jwt.SigningMethodHS256, hmacSecret, withClaim("aud", audience)),
+		},
+		{
+			Name:          "MissingToken",
+			Keys:          keys,
+			ExpectedError: ErrMissingToken,
+		},
+		{
+			Name:          "AlgNotConfigured",
+			Keys:          Keys{HmacSecret: hmacSecret},
+			Token:         sign(t, jwt.SigningMethodRS256, rsaKey, validClaims()),
+			ExpectedError: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			Name:          "WrongSecret",
+			Keys:          keys,
+			Token:         sign(t, jwt.SigningMethodHS256, []byte("other"), validClaims()),
+			ExpectedError: jwt.ErrSignatureInvalid,
+		},
+		{
+			Name:          "MissingExpiry",
+			Keys:          keys,
+			Token:         sign(t, jwt.SigningMethodHS256, hmacSecret, withClaim("exp", nil)),
+			ExpectedError: ErrMissingExpiry,
+		},
+		{
+			Name:          "Expired",
+			Keys:          keys,
+			Token:         sign(t, jwt.SigningMethodHS256, hmacSecret, withClaim("exp", now.Add(-time.Minute).Unix())),
+			ExpectedError: ErrTokenExpired,
+		},
+		{
+			Name:  "ExpiredWithinLeeway",
+			Keys:  keys,
+			Token: sign(t, jwt.SigningMethodHS256, hmacSecret, withClaim("exp", now.Add(-10*time.Second).Unix())),
+		},
+		{
+			Name:          "IssuedInFuture",
+			Keys:          keys,
+			Token:         sign(t, jwt.SigningMethodHS256, hmacSecret, withClaim("iat", now.Add(time.Minute).Unix())),
+			ExpectedError: ErrTokenNotYetIat,
+		},
+		{
+			Name:          "WrongAudience",
+			Keys:          keys,
+			Token:         sign(t, jwt.SigningMethodHS256, hmacSecret, withClaim("aud", []string{"other_app"})),
+			ExpectedError: ErrInvalidAudience,
+		},
+		{
+			Name:          "ClientWithoutB2BType",
+			Keys:          keys,
+			Token:         sign(t, jwt.SigningMethodHS256, hmacSecret, withClaim("client", "payroll-key")),
+			ExpectedError: ErrInvalidType,
+		},
+		{
+			Name:          "B2BTypeWithoutClient",
+			Keys:          keys,
+			Token:         sign(t, jwt.SigningMethodHS256, hmacSecret, withClaim("typ", model.TokenTypeB2B)),
+			ExpectedError: ErrInvalidType,
+		},
+		{
+			Name:  "LocalIssuer",
+			Keys:  keys,
+			Token: sign(t, jwt.SigningMethodHS256, hmacSecret, withClaim("iss", model.LocalIssuer)),
+		},
+		{
+			Name:          "LocalIssuerFromIdentityProvider",
+			Keys:          keys,
+			Token:         sign(t, jwt.SigningMethodRS256, rsaKey, withClaim("iss", model.LocalIssuer)),
+			ExpectedError: ErrInvalidIssuer,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			claims, err := newTestVerifier(tc.Keys).Verify(context.Background(), tc.Token)
+			if tc.ExpectedError != nil {
+				assert.ErrorIs(t, err, tc.ExpectedError)
+				assert.Nil(t, claims)
+				return
+			}
+			if assert.Nil(t, err) {
+				assert.Equal(t, []string{audience}, claims.Aud)
+				assert.Equal(t, 1, claims.User.ID)
+				assert.Equal(t, "user@gmail.com", claims.User.Email)
+				assert.True(t, claims.User.Superadmin)
+				assert.Equal(t, now.Unix(), claims.Iat)
+			}
+		})
+	}
+}
+
+func TestVerifyAlgNone(t *testing.T) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	assert.Nil(t, err)
+	_, err = newTestVerifier(Keys{HmacSecret: hmacSecret}).Verify(context.Background(), token)
+	assert.NotNil(t, err)
+}
+
+func TestBearerToken(t *testing.T) {
+	assert.Equal(t, "abc", BearerToken("Bearer abc"))
+	assert.Equal(t, "abc", BearerToken("bearer  abc "))
+	assert.Equal(t, "", BearerToken("Basic abc"))
+	assert.Equal(t, "", BearerToken(""))
+}
+
+func TestParseKeys(t *testing.T) {
+	rsaDer, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	assert.Nil(t, err)
+	ecdsaDer, err := x509.MarshalPKIXPublicKey(&ecdsaKey.PublicKey)
+	assert.Nil(t, err)
+	keys, err := ParseKeys("secret",
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaDer})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: ecdsaDer})))
+	assert.Nil(t, err)
+	assert.True(t, rsaKey.PublicKey.Equal(keys.RsaPublicKey))
+	assert.True(t, ecdsaKey.PublicKey.Equal(keys.EcdsaPublicKey))
+
+	_, err = ParseKeys("", "not a key", "")
+	assert.NotNil(t, err)
+}
+
+func TestSigner(t *testing.T) {
+	signer := NewSigner(hmacSecret, audience, 15*time.Minute)
+	signer.now = func() time.Time { return now }
+	claims := model.JwtClaims{Jti: "token-1", Sid: "session-1"}
+	claims.User.ID = 7
+	token, err := signer.Sign(&claims)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(15*time.Minute).Unix(), claims.Exp)
+	assert.Equal(t, model.LocalIssuer, claims.Iss)
+
+	verified, err := newTestVerifier(Keys{HmacSecret: hmacSecret}).Verify(context.Background(), token)
+	assert.Nil(t, err)
+	assert.Equal(t, claims, *verified)
+
+	_, err = NewSigner(nil, audience, time.Minute).Sign(&model.JwtClaims{})
+	assert.ErrorIs(t, err, ErrMissingSecret)
+}
@@ -0,0 +1,57 @@
+package jwtauth
+
+import (
+	"backend_test/model"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var ErrMissingSecret = errors.New("no hmac secret to sign tokens with")
+
+// Signer issues the HS256 access tokens of the local users, they are
+// accepted by a Verifier with the same HmacSecret
+type Signer struct {
+	secret   []byte
+	audience string
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+func NewSigner(secret []byte, audience string, ttl time.Duration) *Signer {
+	return &Signer{
+		secret:   secret,
+		audience: audience,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// TTL is the lifetime of the issued tokens
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+// Sign sets the iss, aud, iat and exp of the claims and returns them signed
+func (s *Signer) Sign(claims *model.JwtClaims) (string, error) {
+	if len(s.secret) == 0 {
+		return "", ErrMissingSecret
+	}
+	now := s.now()
+	claims.Iss = model.LocalIssuer
+	claims.Aud = []string{s.audience}
+	claims.Iat = now.Unix()
+	claims.Exp = now.Add(s.ttl).Unix()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, signedClaims{*claims}).SignedString(s.secret)
+}
+
+// signedClaims makes model.JwtClaims a jwt.Claims, they are valid by
+// construction
+type signedClaims struct {
+	model.JwtClaims
+}
+
+func (c signedClaims) Valid() error {
+	return nil
+}
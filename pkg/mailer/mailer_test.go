@@ -0,0 +1,104 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMTPServer accepts the mails of a single session and keeps them
+type fakeSMTPServer struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+	from     string
+	rcpts    []string
+	data     string
+}
+
+func startFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &fakeSMTPServer{listener: listener}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer s.wg.Done()
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost fake SMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.from = strings.Trim(strings.TrimSpace(line)[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.rcpts = append(s.rcpts, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			data := strings.Builder{}
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.data = data.String()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := startFakeSMTPServer(t)
+	defer server.listener.Close()
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	m := NewSMTPMailer(host, portNum, "", "", "noreply@example.com")
+	err := m.Send(context.Background(), Message{
+		To:      []string{"user@gmail.com"},
+		Subject: "Reset your password",
+		Body:    "Use the token abc\nwithin an hour",
+	})
+	assert.Nil(t, err)
+	server.wg.Wait()
+	assert.Equal(t, "noreply@example.com", server.from)
+	assert.Equal(t, []string{"user@gmail.com"}, server.rcpts)
+	assert.Contains(t, server.data, "Subject: Reset your password\r\n")
+	assert.Contains(t, server.data, "\r\n\r\nUse the token abc\r\nwithin an hour")
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+	assert.Nil(t, m.Send(context.Background(), Message{To: []string{"user@gmail.com"}, Subject: "Hello"}))
+	if assert.Len(t, m.Messages(), 1) {
+		assert.Equal(t, "Hello", m.Messages()[0].Subject)
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/jwtauth"
+	"backend_test/pkg/util/responseutil"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	HeaderClientKey  = "X-CLIENT-KEY"
+	HeaderTimestamp  = "X-TIMESTAMP"
+	HeaderSignature  = "X-SIGNATURE"
+	HeaderExternalID = "X-EXTERNAL-ID"
+)
+
+// maxBodySize is the largest request body read by the middlewares, it is
+// read before the authentication
+const maxBodySize = 1 << 20
+
+// ClientAuthenticator verifies the signature of a request of an API client
+// and returns the claims it is authorized with
+type ClientAuthenticator interface {
+	AuthenticateClient(ctx context.Context, req model.ClientSignatureRequest) (*model.JwtClaims, pkgerror.CustomError)
+}
+
+// ClientSignature authenticates the requests carrying an X-CLIENT-KEY
+// header with their X-SIGNATURE and sets the claims of the client as
+// jwt_claims, JwtAuth lets them through. Other requests and the ones for
+// which skipper returns true, such as the B2B token requests signing
+// other data, are left to JwtAuth.
+func ClientSignature(auth ClientAuthenticator, skipper middleware.Skipper) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			header := ctx.Request().Header
+			if header.Get(HeaderClientKey) == "" || (skipper != nil && skipper(ctx)) {
+				return next(ctx)
+			}
+			body, ce := readBody(ctx)
+			if !ce.IsNoError() {
+				return responseutil.SendErrorResponse(ctx, ce)
+			}
+			claims, ce := auth.AuthenticateClient(ctx.Request().Context(), model.ClientSignatureRequest{
+				ClientKey:  header.Get(HeaderClientKey),
+				Timestamp:  header.Get(HeaderTimestamp),
+				Signature:  header.Get(HeaderSignature),
+				ExternalID: header.Get(HeaderExternalID),
+				Method:     ctx.Request().Method,
+				Path:       ctx.Request().URL.RequestURI(),
+				Token:      jwtauth.BearerToken(header.Get(echo.HeaderAuthorization)),
+				Body:       string(body),
+			})
+			if !ce.IsNoError() {
+				return responseutil.SendErrorResponse(ctx, ce)
+			}
+			ctx.Set("jwt_claims", claims)
+			return next(ctx)
+		}
+	}
+}
+
+// readBody reads the request body up to maxBodySize and puts it back for
+// the handler
+func readBody(ctx echo.Context) ([]byte, pkgerror.CustomError) {
+	req := ctx.Request()
+	if req.Body == nil {
+		return nil, pkgerror.NoError
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Response(), req.Body, maxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, pkgerror.ErrRequestTooLarge.WithError(err)
+		}
+		return nil, pkgerror.ErrInvalidParams.WithError(err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, pkgerror.NoError
+}
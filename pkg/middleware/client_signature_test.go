@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/jsonutil"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClientAuthenticator accepts the requests signed "valid" and records
+// the last one
+type fakeClientAuthenticator struct {
+	req model.ClientSignatureRequest
+}
+
+func (f *fakeClientAuthenticator) AuthenticateClient(ctx context.Context, req model.ClientSignatureRequest) (*model.JwtClaims, pkgerror.CustomError) {
+	f.req = req
+	if req.Signature != "valid" {
+		return nil, pkgerror.ErrInvalidSignature
+	}
+	return &model.JwtClaims{Client: req.ClientKey}, pkgerror.NoError
+}
+
+func TestClientSignature(t *testing.T) {
+	body := `{"first_name": "John"}`
+	testCases := []struct {
+		Name             string
+		ClientKey        string
+		Signature        string
+		ExpectedHttpCode int
+		ExpectedClient   string
+	}{
+		{
+			Name:             "NotSigned",
+			ExpectedHttpCode: http.StatusOK,
+		},
+		{
+			Name:             "InvalidSignature",
+			ClientKey:        "payroll-key",
+			Signature:        "invalid",
+			ExpectedHttpCode: http.StatusUnauthorized,
+		},
+		{
+			Name:             "Success",
+			ClientKey:        "payroll-key",
+			Signature:        "valid",
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedClient:   "payroll-key",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/employees?dry_run=true", strings.NewReader(body))
+			req.Header.Set(echo.HeaderAuthorization, "Bearer token-1")
+			req.Header.Set(HeaderClientKey, tc.ClientKey)
+			req.Header.Set(HeaderTimestamp, "2026-10-18T19:00:00+07:00")
+			req.Header.Set(HeaderSignature, tc.Signature)
+			req.Header.Set(HeaderExternalID, "external-1")
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			auth := &fakeClientAuthenticator{}
+			next := func(ctx echo.Context) error {
+				read, err := io.ReadAll(ctx.Request().Body)
+				assert.Nil(t, err)
+				assert.Equal(t, body, string(read))
+				if tc.ExpectedClient != "" {
+					assert.Equal(t, tc.ExpectedClient, ctx.Get("jwt_claims").(*model.JwtClaims).Client)
+				}
+				return ctx.NoContent(http.StatusOK)
+			}
+			assert.NoError(t, ClientSignature(auth, nil)(next)(c))
+			assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+			if tc.ClientKey == "" {
+				assert.Equal(t, model.ClientSignatureRequest{}, auth.req)
+				return
+			}
+			assert.Equal(t, model.ClientSignatureRequest{
+				ClientKey:  tc.ClientKey,
+				Timestamp:  "2026-10-18T19:00:00+07:00",
+				Signature:  tc.Signature,
+				ExternalID: "external-1",
+				Method:     http.MethodPost,
+				Path:       "/employees?dry_run=true",
+				Token:      "token-1",
+				Body:       body,
+			}, auth.req)
+			if tc.ExpectedHttpCode == http.StatusUnauthorized {
+				jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+				assert.Nil(t, err)
+				assert.Equal(t, pkgerror.ErrInvalidSignature.Code, jsonpath.GetString("code"))
+			}
+		})
+	}
+}
+
+func TestClientSignatureBodyTooLarge(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/employees", strings.NewReader(strings.Repeat("a", maxBodySize+1)))
+	req.Header.Set(HeaderClientKey, "payroll-key")
+	req.Header.Set(HeaderSignature, "valid")
+	res := httptest.NewRecorder()
+	c := e.NewContext(req, res)
+	auth := &fakeClientAuthenticator{}
+	next := func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusOK)
+	}
+
+	assert.NoError(t, ClientSignature(auth, nil)(next)(c))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+	assert.Nil(t, err)
+	assert.Equal(t, pkgerror.ErrRequestTooLarge.Code, jsonpath.GetString("code"))
+	// rejected before the signature is checked
+	assert.Equal(t, model.ClientSignatureRequest{}, auth.req)
+}
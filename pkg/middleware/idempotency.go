@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"backend_test/model"
+	"backend_test/pkg/config"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/contextutil"
+	"backend_test/pkg/util/responseutil"
+	"backend_test/pkg/util/tokenutil"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed marks a response replayed to a repeat
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyRouteMap is the set of the routes accepting an Idempotency-Key
+type IdempotencyRouteMap map[string]bool
+
+// NewIdempotencyRouteMap builds the map from the idempotency config
+func NewIdempotencyRouteMap(routes []config.IdempotencyRoute) (IdempotencyRouteMap, error) {
+	m := IdempotencyRouteMap{}
+	for _, r := range routes {
+		key := permissionKey(r.Method, r.Path)
+		if r.Method == "" || r.Path == "" {
+			return m, fmt.Errorf("idempotency route needs a method and a path: %+v", r)
+		}
+		if m[key] {
+			return m, fmt.Errorf("duplicated idempotency route %s", key)
+		}
+		m[key] = true
+	}
+	return m, nil
+}
+
+// Validate checks that every route of the map is registered
+func (m IdempotencyRouteMap) Validate(routes []*echo.Route) error {
+	registered := map[string]bool{}
+	for _, r := range routes {
+		registered[permissionKey(r.Method, r.Path)] = true
+	}
+	unknown := []string{}
+	for key := range m {
+		if !registered[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("idempotency routes not registered: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// IdempotencyStore keeps the Idempotency-Key of the requests with their
+// first response
+type IdempotencyStore interface {
+	BeginRequest(ctx context.Context, req model.IdempotentRequest) (*model.IdempotentResponse, pkgerror.CustomError)
+	CompleteRequest(ctx context.Context, req model.IdempotentRequest, res model.IdempotentResponse) pkgerror.CustomError
+	ReleaseRequest(ctx context.Context, req model.IdempotentRequest) pkgerror.CustomError
+}
+
+// Idempotency runs the requests of the routes of the map sent with an
+// Idempotency-Key once per caller and key. The first response is stored
+// and replayed to the repeats with the same method, path and body, the key
+// reused with another request is a conflict. A request failing without a
+// response or with a server error releases its key to be retried. It must
+// run after the authentication middlewares to know the caller.
+func Idempotency(m IdempotencyRouteMap, store IdempotencyStore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			key := ctx.Request().Header.Get(HeaderIdempotencyKey)
+			owner := idempotencyOwner(contextutil.GetJwtClaims(ctx))
+			if key == "" || owner == "" || !m[permissionKey(ctx.Request().Method, ctx.Path())] {
+				return next(ctx)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return responseutil.SendErrorResponse(ctx, pkgerror.ErrInvalidParams.WithError(
+					fmt.Errorf("%s must be at most %d characters", HeaderIdempotencyKey, maxIdempotencyKeyLength)))
+			}
+			body, ce := readBody(ctx)
+			if !ce.IsNoError() {
+				return responseutil.SendErrorResponse(ctx, ce)
+			}
+			req := model.IdempotentRequest{
+				Owner:       owner,
+				Key:         key,
+				Fingerprint: tokenutil.Hash(ctx.Request().Method + " " + ctx.Request().URL.RequestURI() + "\n" + string(body)),
+			}
+			replay, ce := store.BeginRequest(ctx.Request().Context(), req)
+			if !ce.IsNoError() {
+				return responseutil.SendErrorResponse(ctx, ce)
+			}
+			res := ctx.Response()
+			if replay != nil {
+				for name, values := range replay.Header {
+					res.Header()[name] = values
+				}
+				res.Header().Set(HeaderIdempotentReplayed, "true")
+				res.WriteHeader(replay.StatusCode)
+				_, err := res.Write(replay.Body)
+				return err
+			}
+
+			writer := res.Writer
+			recorder := &recordingWriter{ResponseWriter: writer}
+			res.Writer = recorder
+			defer func() {
+				if r := recover(); r != nil {
+					res.Writer = writer
+					if ce := store.ReleaseRequest(ctx.Request().Context(), req); !ce.IsNoError() {
+						log.Error("Release idempotency key error: ", ce.Err)
+					}
+					panic(r)
+				}
+			}()
+			err := next(ctx)
+			res.Writer = writer
+			if !res.Committed || res.Status >= http.StatusInternalServerError {
+				if ce := store.ReleaseRequest(ctx.Request().Context(), req); !ce.IsNoError() {
+					log.Error("Release idempotency key error: ", ce.Err)
+				}
+				return err
+			}
+			ce = store.CompleteRequest(ctx.Request().Context(), req, model.IdempotentResponse{
+				StatusCode: res.Status,
+				Header:     res.Header().Clone(),
+				Body:       recorder.body.Bytes(),
+			})
+			if !ce.IsNoError() {
+				log.Error("Complete idempotency key error: ", ce.Err)
+			}
+			return err
+		}
+	}
+}
+
+// idempotencyOwner returns the caller the keys belong to, empty for an
+// anonymous request. A user is named with the issuer of its token, the
+// users of two issuers may share an id or an email.
+func idempotencyOwner(claims *model.JwtClaims) string {
+	switch {
+	case claims == nil:
+		return ""
+	case claims.IsClient():
+		return "client:" + claims.Client
+	case claims.User.ID != 0:
+		return "user:" + claims.UserRef().String()
+	case claims.User.Email != "":
+		return "email:" + claims.User.Email + "@" + claims.Iss
+	}
+	return ""
+}
+
+// recordingWriter writes a response and keeps a copy of its body
+type recordingWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"backend_test/model"
+	"backend_test/pkg/config"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/responseutil"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeIdempotentKey struct {
+	fingerprint string
+	res         *model.IdempotentResponse
+}
+
+// fakeIdempotencyStore keeps the keys in memory
+type fakeIdempotencyStore map[string]*fakeIdempotentKey
+
+func (f fakeIdempotencyStore) BeginRequest(ctx context.Context, req model.IdempotentRequest) (*model.IdempotentResponse, pkgerror.CustomError) {
+	key, ok := f[req.Owner+" "+req.Key]
+	if !ok {
+		f[req.Owner+" "+req.Key] = &fakeIdempotentKey{fingerprint: req.Fingerprint}
+		return nil, pkgerror.NoError
+	}
+	if key.fingerprint != req.Fingerprint {
+		return nil, pkgerror.ErrIdempotencyKeyReused
+	}
+	if key.res == nil {
+		return nil, pkgerror.ErrIdempotencyInProgress
+	}
+	return key.res, pkgerror.NoError
+}
+
+func (f fakeIdempotencyStore) CompleteRequest(ctx context.Context, req model.IdempotentRequest, res model.IdempotentResponse) pkgerror.CustomError {
+	f[req.Owner+" "+req.Key].res = &res
+	return pkgerror.NoError
+}
+
+func (f fakeIdempotencyStore) ReleaseRequest(ctx context.Context, req model.IdempotentRequest) pkgerror.CustomError {
+	delete(f, req.Owner+" "+req.Key)
+	return pkgerror.NoError
+}
+
+func TestNewIdempotencyRouteMap(t *testing.T) {
+	m, err := NewIdempotencyRouteMap([]config.IdempotencyRoute{{Method: "post", Path: "/employees"}})
+	assert.Nil(t, err)
+	assert.True(t, m["POST /employees"])
+	_, err = NewIdempotencyRouteMap([]config.IdempotencyRoute{{Method: http.MethodPost}})
+	assert.NotNil(t, err)
+	_, err = NewIdempotencyRouteMap([]config.IdempotencyRoute{
+		{Method: http.MethodPost, Path: "/employees"},
+		{Method: "post", Path: "/employees"},
+	})
+	assert.NotNil(t, err)
+
+	e := echo.New()
+	e.POST("/employees", func(ctx echo.Context) error { return nil })
+	assert.Nil(t, m.Validate(e.Routes()))
+	m["PUT /employees/:id"] = true
+	assert.EqualError(t, m.Validate(e.Routes()), "idempotency routes not registered: PUT /employees/:id")
+}
+
+func TestIdempotency(t *testing.T) {
+	m, err := NewIdempotencyRouteMap([]config.IdempotencyRoute{{Method: http.MethodPost, Path: "/employees"}})
+	assert.Nil(t, err)
+	store := fakeIdempotencyStore{}
+	created := 0
+	failing := true
+	handlers := map[string]echo.HandlerFunc{
+		"/employees": func(ctx echo.Context) error {
+			body, _ := io.ReadAll(ctx.Request().Body)
+			if strings.Contains(string(body), "fail") && failing {
+				failing = false
+				return responseutil.SendErrorResponse(ctx, pkgerror.ErrSystemError)
+			}
+			created++
+			ctx.Response().Header().Set(echo.HeaderLocation, "/employees/1")
+			return responseutil.SendSuccessReponse(ctx, map[string]int{"created": created}, nil)
+		},
+		"/roles": func(ctx echo.Context) error {
+			created++
+			return responseutil.SendSuccessReponse(ctx, map[string]int{"created": created}, nil)
+		},
+	}
+	user := &model.JwtClaims{User: model.JwtUser{ID: 1}}
+	testCases := []struct {
+		Name             string
+		Path             string
+		Key              string
+		Claims           *model.JwtClaims
+		Body             string
+		ExpectedHttpCode int
+		ExpectedCreated  int
+		ExpectedReplayed bool
+	}{
+		{Name: "First", Path: "/employees", Key: "key-1", Claims: user, Body: `{"email":"john@example.com"}`, ExpectedHttpCode: http.StatusOK, ExpectedCreated: 1},
+		{Name: "Repeat", Path: "/employees", Key: "key-1", Claims: user, Body: `{"email":"john@example.com"}`, ExpectedHttpCode: http.StatusOK, ExpectedCreated: 1, ExpectedReplayed: true},
+		{Name: "KeyReused", Path: "/employees", Key: "key-1", Claims: user, Body: `{"email":"John@example.com"}`, ExpectedHttpCode: http.StatusConflict},
+		{Name: "OtherOwner", Path: "/employees", Key: "key-1", Claims: &model.JwtClaims{Client: "payroll-key", Typ: model.TokenTypeB2B}, Body: `{"email":"john@example.com"}`, ExpectedHttpCode: http.StatusOK, ExpectedCreated: 2},
+		{Name: "OtherIssuer", Path: "/employees", Key: "key-1", Claims: &model.JwtClaims{Iss: model.LocalIssuer, User: model.JwtUser{ID: 1}}, Body: `{"email":"john@example.com"}`, ExpectedHttpCode: http.StatusOK, ExpectedCreated: 3},
+		{Name: "NoKey", Path: "/employees", Claims: user, Body: `{"email":"john@example.com"}`, ExpectedHttpCode: http.StatusOK, ExpectedCreated: 4},
+		{Name: "Anonymous", Path: "/employees", Key: "key-1", Body: `{"email":"john@example.com"}`, ExpectedHttpCode: http.StatusOK, ExpectedCreated: 5},
+		{Name: "RouteNotListed", Path: "/roles", Key: "key-2", Claims: user, ExpectedHttpCode: http.StatusOK, ExpectedCreated: 6},
+		{Name: "RouteNotListedRepeat", Path: "/roles", Key: "key-2", Claims: user, ExpectedHttpCode: http.StatusOK, ExpectedCreated: 7},
+		{Name: "KeyTooLong", Path: "/employees", Key: strings.Repeat("k", 256), Claims: user, ExpectedHttpCode: http.StatusBadRequest},
+		{Name: "BodyTooLarge", Path: "/employees", Key: "key-4", Claims: user, Body: strings.Repeat("a", maxBodySize+1), ExpectedHttpCode: http.StatusRequestEntityTooLarge},
+		{Name: "ServerError", Path: "/employees", Key: "key-3", Claims: user, Body: `{"email":"fail"}`, ExpectedHttpCode: http.StatusInternalServerError},
+		{Name: "RetryAfterServerError", Path: "/employees", Key: "key-3", Claims: user, Body: `{"email":"fail"}`, ExpectedHttpCode: http.StatusOK, ExpectedCreated: 8},
+	}
+	first := ""
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, tc.Path, strings.NewReader(tc.Body))
+			req.Header.Set(HeaderIdempotencyKey, tc.Key)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath(tc.Path)
+			if tc.Claims != nil {
+				c.Set("jwt_claims", tc.Claims)
+			}
+
+			assert.NoError(t, Idempotency(m, store)(handlers[tc.Path])(c))
+			assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+			if tc.ExpectedCreated != 0 {
+				assert.Contains(t, res.Body.String(), fmt.Sprintf(`"created":%d`, tc.ExpectedCreated))
+			}
+			if tc.Path == "/employees" && tc.ExpectedHttpCode == http.StatusOK {
+				assert.Equal(t, "/employees/1", res.Header().Get(echo.HeaderLocation))
+			}
+			assert.Equal(t, tc.ExpectedReplayed, res.Header().Get(HeaderIdempotentReplayed) == "true")
+			if tc.Name == "First" {
+				first = res.Body.String()
+			}
+			if tc.ExpectedReplayed {
+				assert.Equal(t, first, res.Body.String())
+			}
+		})
+	}
+	assert.Equal(t, 8, created)
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewIPExtractor(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		TrustedProxies []string
+		RemoteAddr     string
+		ForwardedFor   string
+		ExpectedIP     string
+	}{
+		{Name: "DirectIgnoresHeader", RemoteAddr: "203.0.113.7:4000", ForwardedFor: "198.51.100.1", ExpectedIP: "203.0.113.7"},
+		{Name: "TrustedProxy", TrustedProxies: []string{"10.0.0.0/8"}, RemoteAddr: "10.0.0.2:4000", ForwardedFor: "198.51.100.1", ExpectedIP: "198.51.100.1"},
+		{Name: "SpoofedBehindProxy", TrustedProxies: []string{"10.0.0.0/8"}, RemoteAddr: "10.0.0.2:4000", ForwardedFor: "192.0.2.9, 198.51.100.1", ExpectedIP: "198.51.100.1"},
+		{Name: "UntrustedPeer", TrustedProxies: []string{"10.0.0.0/8"}, RemoteAddr: "203.0.113.7:4000", ForwardedFor: "198.51.100.1", ExpectedIP: "203.0.113.7"},
+		{Name: "PrivateNetNotTrusted", TrustedProxies: []string{"10.0.0.0/8"}, RemoteAddr: "192.168.1.2:4000", ForwardedFor: "198.51.100.1", ExpectedIP: "192.168.1.2"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			extractor, err := NewIPExtractor(tc.TrustedProxies)
+			assert.Nil(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+			req.RemoteAddr = tc.RemoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, tc.ForwardedFor)
+			assert.Equal(t, tc.ExpectedIP, extractor(req))
+		})
+	}
+
+	_, err := NewIPExtractor([]string{"10.0.0.1"})
+	assert.NotNil(t, err)
+}
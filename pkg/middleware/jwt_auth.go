@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/jwtauth"
+	"backend_test/pkg/util/responseutil"
+	"context"
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/labstack/gommon/log"
+)
+
+var ErrTokenRevoked = errors.New("token is revoked")
+
+// TokenDenylist reports the access tokens revoked before their expiry
+type TokenDenylist interface {
+	IsTokenRevoked(ctx context.Context, claims *model.JwtClaims) (bool, pkgerror.CustomError)
+}
+
+// JwtAuth verifies the `Authorization: Bearer` token of the request and
+// sets its claims as jwt_claims, tokens revoked in the denylist are
+// rejected when it is not nil. Requests for which skipper returns true and
+// the ones already authenticated by ClientSignature are let through
+// without a token.
+func JwtAuth(verifier *jwtauth.Verifier, denylist TokenDenylist, skipper middleware.Skipper) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if (skipper != nil && skipper(ctx)) || ctx.Get("jwt_claims") != nil {
+				return next(ctx)
+			}
+			token := jwtauth.BearerToken(ctx.Request().Header.Get(echo.HeaderAuthorization))
+			claims, err := verifier.Verify(ctx.Request().Context(), token)
+			if err != nil {
+				log.Error("Verify JWT error: ", err)
+				return responseutil.SendErrorResponse(ctx, pkgerror.ErrUnauthorizedRequest.WithError(err))
+			}
+			if denylist != nil {
+				revoked, ce := denylist.IsTokenRevoked(ctx.Request().Context(), claims)
+				if !ce.IsNoError() {
+					return responseutil.SendErrorResponse(ctx, ce)
+				}
+				if revoked {
+					return responseutil.SendErrorResponse(ctx, pkgerror.ErrUnauthorizedRequest.WithError(ErrTokenRevoked))
+				}
+			}
+			ctx.Set("jwt_claims", claims)
+			return next(ctx)
+		}
+	}
+}
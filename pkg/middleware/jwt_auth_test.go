@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"backend_test/model"
+	"backend_test/pkg/config"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/jwtauth"
+	"backend_test/pkg/util/jsonutil"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJwtAuth(t *testing.T) {
+	secret := []byte(config.Data.Jwt.HmacSecret)
+	valid, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"aud":  []string{config.Data.AppCode},
+		"exp":  time.Now().Add(time.Hour).Unix(),
+		"user": map[string]interface{}{"id": 1},
+	}).SignedString(secret)
+	assert.Nil(t, err)
+	verifier := jwtauth.NewVerifier(jwtauth.Keys{HmacSecret: secret}, config.Data.AppCode, 0)
+	testCases := []struct {
+		Name             string
+		Authorization    string
+		ExpectedHttpCode int
+	}{
+		{
+			Name:             "MissingHeader",
+			ExpectedHttpCode: http.StatusUnauthorized,
+		},
+		{
+			Name:             "InvalidToken",
+			Authorization:    "Bearer " + valid + "x",
+			ExpectedHttpCode: http.StatusUnauthorized,
+		},
+		{
+			Name:             "Success",
+			Authorization:    "Bearer " + valid,
+			ExpectedHttpCode: http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, tc.Authorization)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			next := func(ctx echo.Context) error {
+				claims := ctx.Get("jwt_claims").(*model.JwtClaims)
+				assert.Equal(t, 1, claims.User.ID)
+				return ctx.NoContent(http.StatusOK)
+			}
+			assert.NoError(t, JwtAuth(verifier, nil, nil)(next)(c))
+			assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+			if tc.ExpectedHttpCode == http.StatusUnauthorized {
+				jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+				assert.Nil(t, err)
+				assert.Equal(t, pkgerror.ErrUnauthorizedRequest.Code, jsonpath.GetString("code"))
+			}
+		})
+	}
+}
+
+type fakeDenylist map[string]bool
+
+func (d fakeDenylist) IsTokenRevoked(ctx context.Context, claims *model.JwtClaims) (bool, pkgerror.CustomError) {
+	return d[claims.Jti], pkgerror.NoError
+}
+
+func TestJwtAuthDenylist(t *testing.T) {
+	secret := []byte(config.Data.Jwt.HmacSecret)
+	signer := jwtauth.NewSigner(secret, config.Data.AppCode, time.Hour)
+	verifier := jwtauth.NewVerifier(jwtauth.Keys{HmacSecret: secret}, config.Data.AppCode, 0)
+	denylist := fakeDenylist{"revoked": true}
+	testCases := []struct {
+		Name             string
+		Jti              string
+		ExpectedHttpCode int
+	}{
+		{
+			Name:             "Revoked",
+			Jti:              "revoked",
+			ExpectedHttpCode: http.StatusUnauthorized,
+		},
+		{
+			Name:             "NotRevoked",
+			Jti:              "active",
+			ExpectedHttpCode: http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			token, err := signer.Sign(&model.JwtClaims{Jti: tc.Jti})
+			assert.Nil(t, err)
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			res := httptest.NewRecorder()
+			next := func(ctx echo.Context) error {
+				return ctx.NoContent(http.StatusOK)
+			}
+			assert.NoError(t, JwtAuth(verifier, denylist, nil)(next)(e.NewContext(req, res)))
+			assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+		})
+	}
+}
+
+func TestJwtAuthSignedClient(t *testing.T) {
+	verifier := jwtauth.NewVerifier(jwtauth.Keys{HmacSecret: []byte(config.Data.Jwt.HmacSecret)}, config.Data.AppCode, 0)
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	res := httptest.NewRecorder()
+	c := e.NewContext(req, res)
+	c.Set("jwt_claims", &model.JwtClaims{Client: "payroll-key", Typ: model.TokenTypeB2B})
+	next := func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusOK)
+	}
+	assert.NoError(t, JwtAuth(verifier, nil, nil)(next)(c))
+	assert.Equal(t, http.StatusOK, res.Code)
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"backend_test/pkg/config"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	err := config.LoadWithPath("./../../configs/config-test.yml")
+	if err != nil {
+		log.Fatal("Load config error: ", err)
+	}
+	code := m.Run()
+	os.Exit(code)
+}
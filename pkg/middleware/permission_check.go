@@ -4,42 +4,91 @@ import (
 	"backend_test/model"
 	"backend_test/pkg/config"
 	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/contextutil"
 	"backend_test/pkg/util/responseutil"
+	"context"
 	"fmt"
-	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 	"golang.org/x/exp/slices"
 )
 
-// Path and permissions mapping
-var mapping = map[string][]string{
-	http.MethodGet + "/merchants":             {"read_merchants", "create_promotions"},
-	http.MethodGet + "/merchants/:merchantId": {"read_merchants"},
-	http.MethodPut + "/merchants/:merchantId": {"update_merchants"},
-	http.MethodPost + "/merchants":            {"create_merchants"},
-	http.MethodGet + "/products":              {"read_products", "create_promotions"},
-	http.MethodGet + "/products/:productId":   {"read_products"},
-	http.MethodPost + "/products":             {"create_products"},
-	http.MethodPut + "/products/:productId":   {"update_products"},
-	http.MethodPost + "/upload-image": {
-		"create_merchants",
-		"update_merchants",
-		"create_products",
-		"update_products",
-	},
-	http.MethodGet + "/campaigns":                {"read_campaigns"},
-	http.MethodGet + "/campaigns/:campaignId":    {"read_campaigns"},
-	http.MethodPost + "/campaigns":               {"create_campaigns"},
-	http.MethodPut + "/campaigns/:campaignId":    {"update_campaigns"},
-	http.MethodDelete + "/campaigns/:campaignId": {"delete_campaigns"},
-	http.MethodGet + "/orders":                   {"read_orders"},
-	http.MethodGet + "/orders/:orderId":          {"read_orders"},
-	http.MethodGet + "/promotions":               {"read_promotions"},
-	http.MethodGet + "/promotions/:promotionId":  {"read_promotions"},
-	http.MethodPost + "/promotions":              {"create_promotions"},
-	http.MethodPut + "/promotions/:promotionId":  {"update_promotions"},
+const (
+	MatchAny = "any"
+	MatchAll = "all"
+)
+
+// PermissionMap maps a method and route path to its required permissions
+type PermissionMap map[string]config.RoutePermission
+
+func permissionKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+// NewPermissionMap builds the map from the permissions config
+func NewPermissionMap(routes []config.RoutePermission) (PermissionMap, error) {
+	m := PermissionMap{}
+	for _, r := range routes {
+		if r.Method == "" || r.Path == "" {
+			return nil, fmt.Errorf("permission mapping needs a method and a path: %+v", r)
+		}
+		key := permissionKey(r.Method, r.Path)
+		if _, exists := m[key]; exists {
+			return nil, fmt.Errorf("duplicated permission mapping for %s", key)
+		}
+		if r.Match == "" {
+			r.Match = MatchAny
+		}
+		if r.Match != MatchAny && r.Match != MatchAll {
+			return nil, fmt.Errorf("invalid match %q for %s, expected %s or %s", r.Match, key, MatchAny, MatchAll)
+		}
+		if r.Public && r.Authenticated {
+			return nil, fmt.Errorf("%s cannot be both public and authenticated", key)
+		}
+		if !r.Public && !r.Authenticated && len(r.Permissions) == 0 {
+			return nil, fmt.Errorf("%s has no permissions and is neither public nor authenticated", key)
+		}
+		m[key] = r
+	}
+	return m, nil
+}
+
+// Validate returns an error listing the registered routes that have no
+// mapping, so that a new route cannot be exposed without permissions
+func (m PermissionMap) Validate(routes []*echo.Route) error {
+	unmapped := []string{}
+	for _, r := range routes {
+		if _, ok := m[permissionKey(r.Method, r.Path)]; !ok {
+			unmapped = append(unmapped, permissionKey(r.Method, r.Path))
+		}
+	}
+	if len(unmapped) > 0 {
+		sort.Strings(unmapped)
+		return fmt.Errorf("routes without permission mapping: %s", strings.Join(unmapped, ", "))
+	}
+	return nil
+}
+
+// IsPublic is a middleware.Skipper for the routes marked public and the
+// requests matching no route, which the router answers 404 or 405
+func (m PermissionMap) IsPublic(ctx echo.Context) bool {
+	route, ok := m[permissionKey(ctx.Request().Method, ctx.Path())]
+	return route.Public || (!ok && !isRouted(ctx))
+}
+
+// isRouted tells if the method and path of the request match a registered
+// route, the router sets the path of the closest route on a 405
+func isRouted(ctx echo.Context) bool {
+	key := permissionKey(ctx.Request().Method, ctx.Path())
+	for _, r := range ctx.Echo().Routes() {
+		if permissionKey(r.Method, r.Path) == key {
+			return true
+		}
+	}
+	return false
 }
 
 func withAppName(names ...string) []string {
@@ -50,39 +99,109 @@ func withAppName(names ...string) []string {
 	return permissions
 }
 
-func validateUserPermission(method, path string, claims *model.JwtClaims) pkgerror.CustomError {
-	key := method + path
-	permissions, keyExists := mapping[key]
-	if !keyExists || len(permissions) == 0 {
-		// If the mapping does not contain path or the permissions is empty,
-		// the request does not need any specific permission
-		return pkgerror.NoError
+// PermissionResolver returns the roles and permissions assigned to a user
+// in the database, on top of the ones carried by its token
+type PermissionResolver interface {
+	GetUserGrants(ctx context.Context, user model.UserRef) (model.UserGrants, pkgerror.CustomError)
+}
+
+// MfaChecker reports whether the second factor of the user was verified
+// for the session of the token
+type MfaChecker interface {
+	IsMfaVerified(ctx context.Context, user model.UserRef, sessionKey string) (bool, pkgerror.CustomError)
+}
+
+func missingPermissions(route config.RoutePermission, granted []string) []string {
+	missing := []string{}
+	for i, p := range withAppName(route.Permissions...) {
+		if !slices.Contains(granted, p) {
+			missing = append(missing, route.Permissions[i])
+		} else if route.Match == MatchAny {
+			return nil
+		}
 	}
-	prefixedPermissions := withAppName(permissions...)
+	return missing
+}
+
+func validateUserPermission(route config.RoutePermission, claims *model.JwtClaims, grants model.UserGrants) pkgerror.CustomError {
+	granted := []string{}
 	for _, role := range claims.User.Roles {
-		for _, p := range prefixedPermissions {
-			if slices.Contains(role.Permissions, p) {
-				return pkgerror.NoError
-			}
-		}
+		granted = append(granted, role.Permissions...)
+	}
+	// the token may predate a role assignment, the database grants count too
+	missing := missingPermissions(route, append(granted, withAppName(grants.Permissions...)...))
+	if len(missing) == 0 {
+		return pkgerror.NoError
 	}
-	log.Errorf("None of the required permissions %v found in the JWT", permissions)
-	return pkgerror.ErrForbiddenRequest.WithError(fmt.Errorf("missing permissions: %v", permissions))
+	log.Errorf("Required permissions %v (%s) not granted to the user", route.Permissions, route.Match)
+	return pkgerror.ErrForbiddenRequest.WithError(fmt.Errorf("missing %s of permissions: %v", route.Match, missing))
 }
 
-func PermissionCheck(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(ctx echo.Context) error {
-		c := ctx.Get("jwt_claims")
-		if c == nil {
-			return next(ctx)
-		}
-		claims := c.(*model.JwtClaims)
-		if claims.User.Superadmin {
+// PermissionCheck enforces the permission map with the permissions of the
+// token and, when resolver is not nil, the ones assigned to the user in the
+// database. The grants of the database are set as user_grants for the
+// principal of the request, so that the policies see them too. The checks
+// run in this order:
+//   - a request matching no route is left to the router (404 or 405), a
+//     registered route without mapping is denied
+//   - public routes are let through, other routes need claims
+//   - API clients skip mfa and the resolver: they have no user in the
+//     database and sign every request, their role in the claims is all
+//     they are granted. Their claims must have the b2b typ, a client
+//     claimed by another token is denied
+//   - users need mfa verified on the routes marked mfa, superadmins
+//     included since they hold every permission
+//   - superadmins and the authenticated routes are let through, other
+//     routes resolve the grants of the user and need their permissions
+func PermissionCheck(m PermissionMap, resolver PermissionResolver, mfa MfaChecker) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			route, ok := m[permissionKey(ctx.Request().Method, ctx.Path())]
+			if !ok {
+				if !isRouted(ctx) {
+					return next(ctx)
+				}
+				return responseutil.SendErrorResponse(ctx, pkgerror.ErrUndefinedPathPermission.WithError(
+					fmt.Errorf("no permission mapping for %s %s", ctx.Request().Method, ctx.Path())))
+			}
+			if route.Public {
+				return next(ctx)
+			}
+			c := ctx.Get("jwt_claims")
+			if c == nil {
+				return responseutil.SendErrorResponse(ctx, pkgerror.ErrUnauthorizedRequest)
+			}
+			claims := c.(*model.JwtClaims)
+			userResolver := resolver
+			if claims.IsClient() {
+				userResolver = nil
+			} else if claims.Client != "" {
+				return responseutil.SendErrorResponse(ctx, pkgerror.ErrUnauthorizedRequest.WithError(
+					fmt.Errorf("client %s claimed without a %s token", claims.Client, model.TokenTypeB2B)))
+			} else if route.Mfa && mfa != nil {
+				verified, err := mfa.IsMfaVerified(ctx.Request().Context(), claims.UserRef(), contextutil.GetSessionKey(ctx))
+				if !err.IsNoError() {
+					return responseutil.SendErrorResponse(ctx, err)
+				}
+				if !verified {
+					return responseutil.SendErrorResponse(ctx, pkgerror.ErrMfaRequired)
+				}
+			}
+			if claims.User.Superadmin || route.Authenticated {
+				return next(ctx)
+			}
+			grants := model.UserGrants{}
+			if userResolver != nil {
+				var err pkgerror.CustomError
+				if grants, err = userResolver.GetUserGrants(ctx.Request().Context(), claims.UserRef()); !err.IsNoError() {
+					return responseutil.SendErrorResponse(ctx, err)
+				}
+				ctx.Set("user_grants", grants)
+			}
+			if err := validateUserPermission(route, claims, grants); !err.IsNoError() {
+				return responseutil.SendErrorResponse(ctx, err)
+			}
 			return next(ctx)
 		}
-		if err := validateUserPermission(ctx.Request().Method, ctx.Path(), claims); !err.IsNoError() {
-			return responseutil.SendErrorResponse(ctx, err)
-		}
-		return next(ctx)
 	}
 }
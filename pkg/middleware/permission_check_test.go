@@ -0,0 +1,404 @@
+package middleware
+
+import (
+	"backend_test/model"
+	"backend_test/pkg/config"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/contextutil"
+	"backend_test/pkg/util/jsonutil"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeResolver grants the permissions of a user through the hr_staff role
+type fakeResolver struct {
+	permissions map[model.UserRef][]string
+	err         pkgerror.CustomError
+	calls       int
+}
+
+func (r *fakeResolver) GetUserGrants(ctx context.Context, user model.UserRef) (model.UserGrants, pkgerror.CustomError) {
+	r.calls++
+	if len(r.permissions[user]) == 0 {
+		return model.UserGrants{}, r.err
+	}
+	return model.UserGrants{Roles: []string{"hr_staff"}, Permissions: r.permissions[user]}, r.err
+}
+
+func createClaims(superadmin bool, permissions ...string) *model.JwtClaims {
+	claims := model.JwtClaims{}
+	data, _ := json.Marshal(map[string]interface{}{
+		"user": map[string]interface{}{
+			"superadmin": superadmin,
+			"roles": []map[string]interface{}{
+				{"permissions": withAppName(permissions...)},
+			},
+		},
+	})
+	_ = json.Unmarshal(data, &claims)
+	return &claims
+}
+
+func TestNewPermissionMap(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		Routes      []config.RoutePermission
+		ExpectError bool
+	}{
+		{
+			Name: "Valid",
+			Routes: []config.RoutePermission{
+				{Method: http.MethodGet, Path: "/employees", Permissions: []string{"read_employees"}},
+				{Method: http.MethodGet, Path: "/health", Public: true},
+				{Method: http.MethodPost, Path: "/auth/logout", Authenticated: true},
+			},
+		},
+		{
+			Name: "PublicAndAuthenticated",
+			Routes: []config.RoutePermission{
+				{Method: http.MethodPost, Path: "/auth/logout", Public: true, Authenticated: true},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "Duplicated",
+			Routes: []config.RoutePermission{
+				{Method: http.MethodGet, Path: "/employees", Permissions: []string{"read_employees"}},
+				{Method: "get", Path: "/employees", Permissions: []string{"read_employees"}},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "InvalidMatch",
+			Routes: []config.RoutePermission{
+				{Method: http.MethodGet, Path: "/employees", Permissions: []string{"read_employees"}, Match: "some"},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "NoPermissions",
+			Routes: []config.RoutePermission{
+				{Method: http.MethodGet, Path: "/employees"},
+			},
+			ExpectError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := NewPermissionMap(tc.Routes)
+			assert.Equal(t, tc.ExpectError, err != nil)
+		})
+	}
+}
+
+func TestPermissionMapValidate(t *testing.T) {
+	m, err := NewPermissionMap([]config.RoutePermission{
+		{Method: http.MethodGet, Path: "/employees", Permissions: []string{"read_employees"}},
+		{Method: http.MethodGet, Path: "/health", Public: true},
+	})
+	assert.Nil(t, err)
+	handler := func(ctx echo.Context) error { return nil }
+	e := echo.New()
+	e.GET("/employees", handler)
+	e.GET("/health", handler)
+	assert.Nil(t, m.Validate(e.Routes()))
+
+	e.DELETE("/employees/:id", handler)
+	err = m.Validate(e.Routes())
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "DELETE /employees/:id")
+	}
+}
+
+func TestPermissionCheck(t *testing.T) {
+	m, err := NewPermissionMap([]config.RoutePermission{
+		{Method: http.MethodGet, Path: "/employees/:id", Permissions: []string{"read_employees", "update_employees"}},
+		{Method: http.MethodGet, Path: "/employees/trash", Permissions: []string{"read_employees", "delete_employees"}, Match: MatchAll},
+		{Method: http.MethodGet, Path: "/health", Public: true},
+		{Method: http.MethodGet, Path: "/me", Authenticated: true},
+	})
+	assert.Nil(t, err)
+	testCases := []struct {
+		Name             string
+		Path             string
+		Claims           *model.JwtClaims
+		ExpectedHttpCode int
+		ExpectedCode     string
+	}{
+		{
+			Name:             "Public",
+			Path:             "/health",
+			ExpectedHttpCode: http.StatusOK,
+		},
+		{
+			Name:             "AuthenticatedAnonymous",
+			Path:             "/me",
+			ExpectedHttpCode: http.StatusUnauthorized,
+			ExpectedCode:     pkgerror.ErrUnauthorizedRequest.Code,
+		},
+		{
+			Name:             "Authenticated",
+			Path:             "/me",
+			Claims:           createClaims(false),
+			ExpectedHttpCode: http.StatusOK,
+		},
+		{
+			Name:             "RegisteredUnmapped",
+			Path:             "/employees",
+			Claims:           createClaims(true),
+			ExpectedHttpCode: http.StatusNotFound,
+			ExpectedCode:     pkgerror.ErrUndefinedPathPermission.Code,
+		},
+		{
+			Name:             "Anonymous",
+			Path:             "/employees/:id",
+			ExpectedHttpCode: http.StatusUnauthorized,
+			ExpectedCode:     pkgerror.ErrUnauthorizedRequest.Code,
+		},
+		{
+			Name:             "Superadmin",
+			Path:             "/employees/trash",
+			Claims:           createClaims(true),
+			ExpectedHttpCode: http.StatusOK,
+		},
+		{
+			Name:             "AnyGranted",
+			Path:             "/employees/:id",
+			Claims:           createClaims(false, "update_employees"),
+			ExpectedHttpCode: http.StatusOK,
+		},
+		{
+			Name:             "AnyMissing",
+			Path:             "/employees/:id",
+			Claims:           createClaims(false, "delete_employees"),
+			ExpectedHttpCode: http.StatusForbidden,
+			ExpectedCode:     pkgerror.ErrForbiddenRequest.Code,
+		},
+		{
+			Name:             "AllGranted",
+			Path:             "/employees/trash",
+			Claims:           createClaims(false, "read_employees", "delete_employees"),
+			ExpectedHttpCode: http.StatusOK,
+		},
+		{
+			Name:             "AllPartial",
+			Path:             "/employees/trash",
+			Claims:           createClaims(false, "read_employees"),
+			ExpectedHttpCode: http.StatusForbidden,
+			ExpectedCode:     pkgerror.ErrForbiddenRequest.Code,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			next := func(ctx echo.Context) error {
+				return ctx.NoContent(http.StatusOK)
+			}
+			for _, path := range []string{"/employees", "/employees/:id", "/employees/trash", "/health", "/me"} {
+				e.GET(path, next)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath(tc.Path)
+			if tc.Claims != nil {
+				c.Set("jwt_claims", tc.Claims)
+			}
+			assert.NoError(t, PermissionCheck(m, nil, nil)(next)(c))
+			assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+			if tc.ExpectedCode != "" {
+				jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+				assert.Nil(t, err)
+				assert.Equal(t, tc.ExpectedCode, jsonpath.GetString("code"))
+			}
+		})
+	}
+}
+
+func TestPermissionCheckResolver(t *testing.T) {
+	m, err := NewPermissionMap([]config.RoutePermission{
+		{Method: http.MethodGet, Path: "/employees/trash", Permissions: []string{"read_employees", "delete_employees"}, Match: MatchAll},
+	})
+	assert.Nil(t, err)
+	testCases := []struct {
+		Name             string
+		Claims           *model.JwtClaims
+		Resolver         *fakeResolver
+		ExpectedHttpCode int
+		ExpectedCalls    int
+		ExpectedRoles    []string
+	}{
+		{
+			Name:             "GrantedByToken",
+			Claims:           createClaims(false, "read_employees", "delete_employees"),
+			Resolver:         &fakeResolver{},
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedCalls:    1,
+			ExpectedRoles:    []string{""},
+		},
+		{
+			Name:             "CombinedWithToken",
+			Claims:           createClaims(false, "read_employees"),
+			Resolver:         &fakeResolver{permissions: map[model.UserRef][]string{{}: {"delete_employees"}}},
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedCalls:    1,
+			ExpectedRoles:    []string{"", "hr_staff"},
+		},
+		{
+			Name:             "GrantedToOtherIssuer",
+			Claims:           createClaims(false, "read_employees"),
+			Resolver:         &fakeResolver{permissions: map[model.UserRef][]string{{Issuer: model.LocalIssuer}: {"delete_employees"}}},
+			ExpectedHttpCode: http.StatusForbidden,
+			ExpectedCalls:    1,
+		},
+		{
+			Name:             "Missing",
+			Claims:           createClaims(false, "read_employees"),
+			Resolver:         &fakeResolver{permissions: map[model.UserRef][]string{{}: {"create_employees"}}},
+			ExpectedHttpCode: http.StatusForbidden,
+			ExpectedCalls:    1,
+		},
+		{
+			Name:             "ApiClientSkipsResolver",
+			Claims:           &model.JwtClaims{Client: "payroll-key", Typ: model.TokenTypeB2B},
+			Resolver:         &fakeResolver{permissions: map[model.UserRef][]string{{}: {"read_employees", "delete_employees"}}},
+			ExpectedHttpCode: http.StatusForbidden,
+		},
+		{
+			Name:             "ApiClientWithoutB2BType",
+			Claims:           &model.JwtClaims{Client: "payroll-key"},
+			Resolver:         &fakeResolver{permissions: map[model.UserRef][]string{{}: {"read_employees", "delete_employees"}}},
+			ExpectedHttpCode: http.StatusUnauthorized,
+		},
+		{
+			Name:             "ResolverError",
+			Claims:           createClaims(false),
+			Resolver:         &fakeResolver{err: pkgerror.ErrSystemError},
+			ExpectedHttpCode: http.StatusInternalServerError,
+			ExpectedCalls:    1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath("/employees/trash")
+			c.Set("jwt_claims", tc.Claims)
+			next := func(ctx echo.Context) error {
+				// the policies see the roles and permissions of the database
+				principal := contextutil.GetPrincipal(ctx)
+				assert.Equal(t, tc.ExpectedRoles, principal.Roles)
+				assert.ElementsMatch(t, []string{"read_employees", "delete_employees"}, principal.Permissions)
+				return ctx.NoContent(http.StatusOK)
+			}
+			assert.NoError(t, PermissionCheck(m, tc.Resolver, nil)(next)(c))
+			assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+			assert.Equal(t, tc.ExpectedCalls, tc.Resolver.calls)
+		})
+	}
+}
+
+func TestPermissionCheckUnmatchedRoute(t *testing.T) {
+	m, err := NewPermissionMap([]config.RoutePermission{
+		{Method: http.MethodGet, Path: "/employees", Permissions: []string{"read_employees"}},
+	})
+	assert.Nil(t, err)
+	e := echo.New()
+	e.Use(JwtAuth(nil, nil, m.IsPublic))
+	e.Use(PermissionCheck(m, nil, nil))
+	e.GET("/employees", func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusOK)
+	})
+	testCases := []struct {
+		Name             string
+		Method           string
+		Path             string
+		ExpectedHttpCode int
+	}{
+		{Name: "NotFound", Method: http.MethodGet, Path: "/unknown", ExpectedHttpCode: http.StatusNotFound},
+		{Name: "MethodNotAllowed", Method: http.MethodDelete, Path: "/employees", ExpectedHttpCode: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			e.ServeHTTP(res, httptest.NewRequest(tc.Method, tc.Path, nil))
+			assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+		})
+	}
+}
+
+// fakeMfaChecker reports the session keys verified
+type fakeMfaChecker map[string]bool
+
+func (f fakeMfaChecker) IsMfaVerified(ctx context.Context, user model.UserRef, sessionKey string) (bool, pkgerror.CustomError) {
+	return f[sessionKey], pkgerror.NoError
+}
+
+func TestPermissionCheckMfa(t *testing.T) {
+	m, err := NewPermissionMap([]config.RoutePermission{
+		{Method: http.MethodPost, Path: "/employees", Permissions: []string{"create_employees"}, Mfa: true},
+	})
+	assert.Nil(t, err)
+	verifiedClaims := createClaims(false, "create_employees")
+	verifiedClaims.Sid = "session-1"
+	clientClaims := createClaims(false, "create_employees")
+	clientClaims.Client = "payroll-key"
+	clientClaims.Typ = model.TokenTypeB2B
+	testCases := []struct {
+		Name             string
+		Claims           *model.JwtClaims
+		ExpectedHttpCode int
+		ExpectedCode     string
+	}{
+		{
+			Name:             "NotVerified",
+			Claims:           createClaims(false, "create_employees"),
+			ExpectedHttpCode: http.StatusForbidden,
+			ExpectedCode:     pkgerror.ErrMfaRequired.Code,
+		},
+		{
+			Name:             "SuperadminNotVerified",
+			Claims:           createClaims(true),
+			ExpectedHttpCode: http.StatusForbidden,
+			ExpectedCode:     pkgerror.ErrMfaRequired.Code,
+		},
+		{
+			Name:             "Verified",
+			Claims:           verifiedClaims,
+			ExpectedHttpCode: http.StatusOK,
+		},
+		{
+			Name:             "ApiClient",
+			Claims:           clientClaims,
+			ExpectedHttpCode: http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath("/employees")
+			c.Set("jwt_claims", tc.Claims)
+			next := func(ctx echo.Context) error {
+				return ctx.NoContent(http.StatusOK)
+			}
+			assert.NoError(t, PermissionCheck(m, nil, fakeMfaChecker{"session-1": true})(next)(c))
+			assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+			if tc.ExpectedCode != "" {
+				jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+				assert.Nil(t, err)
+				assert.Equal(t, tc.ExpectedCode, jsonpath.GetString("code"))
+			}
+		})
+	}
+}
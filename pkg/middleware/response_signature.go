@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/contextutil"
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// ResponseSigner signs the response bodies to the API clients in hmac or
+// rsa response signing
+type ResponseSigner interface {
+	GetResponseSigning(ctx context.Context, clientKey string) (string, pkgerror.CustomError)
+	SignResponse(ctx context.Context, clientKey string, body []byte) (*model.ResponseSignature, pkgerror.CustomError)
+}
+
+// ResponseSignature sends the responses to the API clients, identified by
+// their claims or X-CLIENT-KEY as in SnapEnvelope, with the X-SIGNATURE and
+// X-TIMESTAMP headers of their response signing. The client is resolved when
+// the response is committed, only the responses to be signed are buffered.
+// It must run before the middlewares authenticating the clients to also
+// sign their error responses.
+func ResponseSignature(signer ResponseSigner) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			res := ctx.Response()
+			writer := res.Writer
+			buffer := &signingWriter{ResponseWriter: writer, ctx: ctx, signer: signer}
+			res.Writer = buffer
+			sent := false
+			defer func() {
+				res.Writer = writer
+				if sent || !buffer.buffering {
+					return
+				}
+				// the handler panicked, drop its partial response so that
+				// the 500 of Recover is sent instead of an empty one
+				res.Committed = false
+				res.Status = 0
+				res.Size = 0
+			}()
+			err := next(ctx)
+			sent = true
+			if !buffer.buffering {
+				// not committed or sent unsigned as written
+				return err
+			}
+
+			signature, ce := signer.SignResponse(ctx.Request().Context(), buffer.clientKey, buffer.body.Bytes())
+			if !ce.IsNoError() {
+				log.Error("Sign response error: ", ce.Err)
+			} else if signature != nil {
+				writer.Header().Set(HeaderSignature, signature.Signature)
+				writer.Header().Set(HeaderTimestamp, signature.Timestamp)
+			}
+			writer.WriteHeader(buffer.status)
+			if _, werr := writer.Write(buffer.body.Bytes()); werr != nil && err == nil {
+				err = werr
+			}
+			return err
+		}
+	}
+}
+
+// signingWriter resolves the response signing of the client when the
+// response is committed and holds the status and the body of a response to
+// be signed, other responses are written through. Its headers are the ones
+// of the response.
+type signingWriter struct {
+	http.ResponseWriter
+	ctx       echo.Context
+	signer    ResponseSigner
+	clientKey string
+	buffering bool
+	status    int
+	body      bytes.Buffer
+}
+
+func (w *signingWriter) WriteHeader(status int) {
+	w.clientKey = w.ctx.Request().Header.Get(HeaderClientKey)
+	if claims := contextutil.GetJwtClaims(w.ctx); claims != nil {
+		w.clientKey = claims.Client
+	}
+	if w.clientKey != "" {
+		signing, err := w.signer.GetResponseSigning(w.ctx.Request().Context(), w.clientKey)
+		if !err.IsNoError() {
+			log.Error("Get client response signing error: ", err.Err)
+		}
+		w.buffering = signing == model.ResponseSigningHmac || signing == model.ResponseSigningRsa
+	}
+	if w.buffering {
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *signingWriter) Write(b []byte) (int, error) {
+	if w.buffering {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
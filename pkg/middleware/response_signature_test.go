@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/responsesign"
+	"backend_test/pkg/util/responseutil"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeResponseSigner signs the responses of payroll-key with its secret
+type fakeResponseSigner struct{}
+
+func (fakeResponseSigner) GetResponseSigning(ctx context.Context, clientKey string) (string, pkgerror.CustomError) {
+	if clientKey != "payroll-key" {
+		return model.ResponseSigningNone, pkgerror.NoError
+	}
+	return model.ResponseSigningHmac, pkgerror.NoError
+}
+
+func (fakeResponseSigner) SignResponse(ctx context.Context, clientKey string, body []byte) (*model.ResponseSignature, pkgerror.CustomError) {
+	if clientKey != "payroll-key" {
+		return nil, pkgerror.NoError
+	}
+	timestamp := "2026-10-18T19:00:00+07:00"
+	return &model.ResponseSignature{Signature: responsesign.SignHmac("payroll-secret", body, timestamp), Timestamp: timestamp}, pkgerror.NoError
+}
+
+func TestResponseSignature(t *testing.T) {
+	testCases := []struct {
+		Name             string
+		ClientKey        string
+		Authorization    string
+		Handler          echo.HandlerFunc
+		ExpectedHttpCode int
+		ExpectedSigned   bool
+	}{
+		{
+			Name: "NoClient",
+			Handler: func(ctx echo.Context) error {
+				return responseutil.SendSuccessReponse(ctx, []int{1}, nil)
+			},
+			ExpectedHttpCode: http.StatusOK,
+		},
+		{
+			Name:      "SignedClient",
+			ClientKey: "payroll-key",
+			Handler: func(ctx echo.Context) error {
+				return responseutil.SendSuccessReponse(ctx, []int{1}, nil)
+			},
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedSigned:   true,
+		},
+		{
+			Name:      "SignedError",
+			ClientKey: "payroll-key",
+			Handler: func(ctx echo.Context) error {
+				return responseutil.SendErrorResponse(ctx, pkgerror.ErrInvalidSignature)
+			},
+			ExpectedHttpCode: http.StatusUnauthorized,
+			ExpectedSigned:   true,
+		},
+		{
+			Name:          "AccessTokenClaims",
+			Authorization: "Bearer b2b-token",
+			Handler: func(ctx echo.Context) error {
+				ctx.Set("jwt_claims", &model.JwtClaims{Client: "payroll-key", Typ: model.TokenTypeB2B})
+				return responseutil.SendSuccessReponse(ctx, nil, nil)
+			},
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedSigned:   true,
+		},
+		{
+			Name:      "UnsignedClient",
+			ClientKey: "attendance-key",
+			Handler: func(ctx echo.Context) error {
+				return responseutil.SendSuccessReponse(ctx, nil, nil)
+			},
+			ExpectedHttpCode: http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+			req.Header.Set(HeaderClientKey, tc.ClientKey)
+			req.Header.Set(echo.HeaderAuthorization, tc.Authorization)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+
+			assert.NoError(t, ResponseSignature(fakeResponseSigner{})(tc.Handler)(c))
+			assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+			assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, res.Header().Get(echo.HeaderContentType))
+			assert.NotEmpty(t, res.Body.String())
+			err := responsesign.Verify(responsesign.HmacVerifier("payroll-secret"), res.Header(), res.Body.Bytes())
+			if tc.ExpectedSigned {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorIs(t, err, responsesign.ErrMissingSignature)
+			}
+		})
+	}
+}
+
+func TestResponseSignatureNothingSent(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+	req.Header.Set(HeaderClientKey, "payroll-key")
+	res := httptest.NewRecorder()
+	c := e.NewContext(req, res)
+
+	err := ResponseSignature(fakeResponseSigner{})(func(ctx echo.Context) error {
+		return echo.ErrNotFound
+	})(c)
+	assert.Equal(t, echo.ErrNotFound, err)
+	assert.False(t, c.Response().Committed)
+	assert.Empty(t, res.Header().Get(HeaderSignature))
+}
+
+func TestResponseSignatureUnsignedNotBuffered(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+	req.Header.Set(HeaderClientKey, "attendance-key")
+	res := httptest.NewRecorder()
+	c := e.NewContext(req, res)
+
+	err := ResponseSignature(fakeResponseSigner{})(func(ctx echo.Context) error {
+		err := responseutil.SendSuccessReponse(ctx, nil, nil)
+		// written through before the handler returns
+		assert.NotEmpty(t, res.Body.String())
+		return err
+	})(c)
+	assert.NoError(t, err)
+	assert.Empty(t, res.Header().Get(HeaderSignature))
+}
+
+func TestResponseSignaturePanic(t *testing.T) {
+	testCases := []struct {
+		Name      string
+		ClientKey string
+		Handler   echo.HandlerFunc
+	}{
+		{
+			Name:      "SignedPartialResponse",
+			ClientKey: "payroll-key",
+			Handler: func(ctx echo.Context) error {
+				ctx.Response().WriteHeader(http.StatusOK)
+				ctx.Response().Write([]byte(`{"data": [`))
+				panic("handler failed")
+			},
+		},
+		{
+			Name:      "NothingSent",
+			ClientKey: "payroll-key",
+			Handler: func(ctx echo.Context) error {
+				panic("handler failed")
+			},
+		},
+		{
+			Name: "NoClient",
+			Handler: func(ctx echo.Context) error {
+				panic("handler failed")
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			e.Use(middleware.Recover(), ResponseSignature(fakeResponseSigner{}))
+			e.GET("/employees", tc.Handler)
+			req := httptest.NewRequest(http.MethodGet, "/employees", nil)
+			req.Header.Set(HeaderClientKey, tc.ClientKey)
+			res := httptest.NewRecorder()
+
+			e.ServeHTTP(res, req)
+			assert.Equal(t, http.StatusInternalServerError, res.Code)
+			assert.Contains(t, res.Body.String(), "Internal Server Error")
+			assert.NotContains(t, res.Body.String(), "data")
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"backend_test/model"
+	"backend_test/pkg/config"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/contextutil"
+	"backend_test/pkg/util/responseutil"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+var serviceCodePattern = regexp.MustCompile(`^[0-9]{2}$`)
+
+// SnapRouteMap maps a method and route path to its SNAP service code
+type SnapRouteMap struct {
+	defaultServiceCode string
+	routes             map[string]string
+}
+
+// NewSnapRouteMap builds the map from the snap config, the service codes
+// are two digits
+func NewSnapRouteMap(defaultServiceCode string, routes []config.SnapRoute) (SnapRouteMap, error) {
+	if defaultServiceCode == "" {
+		defaultServiceCode = "00"
+	}
+	m := SnapRouteMap{defaultServiceCode: defaultServiceCode, routes: map[string]string{}}
+	if !serviceCodePattern.MatchString(defaultServiceCode) {
+		return m, fmt.Errorf("invalid default SNAP service code %q, expected two digits", defaultServiceCode)
+	}
+	for _, r := range routes {
+		key := permissionKey(r.Method, r.Path)
+		if r.Method == "" || r.Path == "" {
+			return m, fmt.Errorf("SNAP route needs a method and a path: %+v", r)
+		}
+		if !serviceCodePattern.MatchString(r.ServiceCode) {
+			return m, fmt.Errorf("invalid SNAP service code %q for %s, expected two digits", r.ServiceCode, key)
+		}
+		if _, exists := m.routes[key]; exists {
+			return m, fmt.Errorf("duplicated SNAP route %s", key)
+		}
+		m.routes[key] = r.ServiceCode
+	}
+	return m, nil
+}
+
+// ClientResponseModes returns the response mode of an API client
+type ClientResponseModes interface {
+	GetResponseMode(ctx context.Context, clientKey string) (string, pkgerror.CustomError)
+}
+
+// SnapEnvelope renders the responses in the SNAP envelope for the routes
+// of the map and for the API clients in snap response mode, identified by
+// their claims or, before they are authenticated, their X-CLIENT-KEY. The
+// handlers are unchanged, responseutil picks the envelope when sending.
+func SnapEnvelope(m SnapRouteMap, clients ClientResponseModes) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			responseutil.SetEnvelopeSelector(ctx, func(ctx echo.Context) model.ResponseEnvelope {
+				if serviceCode, ok := m.routes[permissionKey(ctx.Request().Method, ctx.Path())]; ok {
+					return model.ResponseEnvelope{Snap: true, ServiceCode: serviceCode}
+				}
+				clientKey := ctx.Request().Header.Get(HeaderClientKey)
+				if claims := contextutil.GetJwtClaims(ctx); claims != nil {
+					clientKey = claims.Client
+				}
+				if clientKey == "" || clients == nil {
+					return model.ResponseEnvelope{}
+				}
+				mode, err := clients.GetResponseMode(ctx.Request().Context(), clientKey)
+				if !err.IsNoError() {
+					log.Error("Get client response mode error: ", err.Err)
+				}
+				return model.ResponseEnvelope{Snap: mode == model.ResponseModeSnap, ServiceCode: m.defaultServiceCode}
+			})
+			return next(ctx)
+		}
+	}
+}
+
+// httpErrors maps the statuses of the echo.HTTPError of the router, the
+// binder and the middlewares to their errors
+var httpErrors = map[int]pkgerror.CustomError{
+	http.StatusBadRequest:           pkgerror.ErrInvalidParams,
+	http.StatusUnauthorized:         pkgerror.ErrUnauthorizedRequest,
+	http.StatusForbidden:            pkgerror.ErrForbiddenRequest,
+	http.StatusNotFound:             pkgerror.ErrUndefinedPathPermission,
+	http.StatusUnsupportedMediaType: pkgerror.ErrUnsupportedMediaType,
+	http.StatusTooManyRequests:      pkgerror.ErrTooManyRequests,
+	http.StatusInternalServerError:  pkgerror.ErrSystemError,
+}
+
+// SnapHTTPErrorHandler sends the errors returned to echo, such as the
+// 404 and 405 of the router, the bind errors and the 500 of Recover, in
+// the SNAP envelope when the request has one and leaves the others to
+// next
+func SnapHTTPErrorHandler(next echo.HTTPErrorHandler) echo.HTTPErrorHandler {
+	return func(err error, ctx echo.Context) {
+		if ctx.Response().Committed || !responseutil.GetEnvelope(ctx).Snap {
+			next(err, ctx)
+			return
+		}
+		customErr := pkgerror.ErrSystemError.WithError(err)
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			var ok bool
+			if customErr, ok = httpErrors[he.Code]; !ok {
+				customErr = pkgerror.CustomError{Msg: http.StatusText(he.Code), HttpCode: he.Code}
+			}
+			customErr = customErr.WithError(he.Internal)
+		}
+		if err := responseutil.SendErrorResponse(ctx, customErr); err != nil {
+			log.Error("Send error response error: ", err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"backend_test/model"
+	"backend_test/pkg/config"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/responseutil"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeResponseModes maps the client keys to their response mode
+type fakeResponseModes map[string]string
+
+func (f fakeResponseModes) GetResponseMode(ctx context.Context, clientKey string) (string, pkgerror.CustomError) {
+	return f[clientKey], pkgerror.NoError
+}
+
+func TestNewSnapRouteMap(t *testing.T) {
+	_, err := NewSnapRouteMap("", []config.SnapRoute{{Method: http.MethodPost, Path: "/v1.0/access-token/b2b", ServiceCode: "73"}})
+	assert.Nil(t, err)
+	_, err = NewSnapRouteMap("1", nil)
+	assert.NotNil(t, err)
+	_, err = NewSnapRouteMap("00", []config.SnapRoute{{Method: http.MethodGet, Path: "/employees", ServiceCode: "7a"}})
+	assert.NotNil(t, err)
+	_, err = NewSnapRouteMap("00", []config.SnapRoute{
+		{Method: http.MethodGet, Path: "/employees", ServiceCode: "01"},
+		{Method: "get", Path: "/employees", ServiceCode: "02"},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestSnapEnvelope(t *testing.T) {
+	m, err := NewSnapRouteMap("00", []config.SnapRoute{
+		{Method: http.MethodPost, Path: "/v1.0/access-token/b2b", ServiceCode: "73"},
+		{Method: http.MethodGet, Path: "/employees/:id", ServiceCode: "01"},
+	})
+	assert.Nil(t, err)
+	modes := fakeResponseModes{"snap-key": model.ResponseModeSnap, "default-key": model.ResponseModeDefault}
+	testCases := []struct {
+		Name             string
+		Method           string
+		Path             string
+		ClientKey        string
+		Claims           *model.JwtClaims
+		Handler          echo.HandlerFunc
+		ExpectedHttpCode int
+		ExpectedBody     string
+	}{
+		{
+			Name:   "DefaultEnvelope",
+			Method: http.MethodGet,
+			Path:   "/employees",
+			Handler: func(ctx echo.Context) error {
+				return responseutil.SendSuccessReponse(ctx, []int{1}, nil)
+			},
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedBody:     `{"status":"SUCCESS","code":"0000","data":[1],"pagination":null,"error_message":null}`,
+		},
+		{
+			Name:   "SnapRoute",
+			Method: http.MethodPost,
+			Path:   "/v1.0/access-token/b2b",
+			Handler: func(ctx echo.Context) error {
+				return responseutil.SendSuccessReponse(ctx, model.B2BTokenResult{AccessToken: "access", TokenType: "Bearer", ExpiresIn: "900"}, nil)
+			},
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedBody:     `{"responseCode":"2007300","responseMessage":"Successful","accessToken":"access","tokenType":"Bearer","expiresIn":"900"}`,
+		},
+		{
+			Name:   "SnapRouteError",
+			Method: http.MethodGet,
+			Path:   "/employees/:id",
+			Handler: func(ctx echo.Context) error {
+				return responseutil.SendErrorResponse(ctx, pkgerror.ErrEmployeeNotFound)
+			},
+			ExpectedHttpCode: http.StatusNotFound,
+			ExpectedBody:     `{"responseCode":"4040101","responseMessage":"Employee not found"}`,
+		},
+		{
+			Name:      "SnapClientHeader",
+			Method:    http.MethodGet,
+			Path:      "/employees",
+			ClientKey: "snap-key",
+			Handler: func(ctx echo.Context) error {
+				return responseutil.SendErrorResponse(ctx, pkgerror.ErrInvalidSignature)
+			},
+			ExpectedHttpCode: http.StatusUnauthorized,
+			ExpectedBody:     `{"responseCode":"4010000","responseMessage":"Request signature is invalid or its timestamp is out of range"}`,
+		},
+		{
+			Name:   "SnapClientClaims",
+			Method: http.MethodGet,
+			Path:   "/employees",
+			Claims: &model.JwtClaims{Client: "snap-key", Typ: model.TokenTypeB2B},
+			Handler: func(ctx echo.Context) error {
+				return responseutil.SendSuccessReponse(ctx, []int{1}, nil)
+			},
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedBody:     `{"responseCode":"2000000","responseMessage":"Successful","data":[1]}`,
+		},
+		{
+			Name:   "DefaultClient",
+			Method: http.MethodGet,
+			Path:   "/employees",
+			Claims: &model.JwtClaims{Client: "default-key", Typ: model.TokenTypeB2B},
+			Handler: func(ctx echo.Context) error {
+				return responseutil.SendErrorResponse(ctx, pkgerror.ErrForbiddenRequest)
+			},
+			ExpectedHttpCode: http.StatusForbidden,
+			ExpectedBody:     `{"status":"ERROR","code":"0004","data":null,"pagination":null,"error_message":"Request forbidden. Operation not allowed"}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(tc.Method, "/", nil)
+			req.Header.Set(HeaderClientKey, tc.ClientKey)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath(tc.Path)
+			if tc.Claims != nil {
+				c.Set("jwt_claims", tc.Claims)
+			}
+			assert.NoError(t, SnapEnvelope(m, modes)(tc.Handler)(c))
+			assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+			assert.JSONEq(t, tc.ExpectedBody, res.Body.String())
+		})
+	}
+}
+
+func TestSnapHTTPErrorHandler(t *testing.T) {
+	m, err := NewSnapRouteMap("00", []config.SnapRoute{
+		{Method: http.MethodPost, Path: "/v1.0/access-token/b2b", ServiceCode: "73"},
+	})
+	assert.Nil(t, err)
+	modes := fakeResponseModes{"snap-key": model.ResponseModeSnap}
+	testCases := []struct {
+		Name             string
+		Method           string
+		Path             string
+		ClientKey        string
+		ExpectedHttpCode int
+		ExpectedBody     string
+	}{
+		{
+			Name:             "NotFound",
+			Method:           http.MethodGet,
+			Path:             "/unknown",
+			ClientKey:        "snap-key",
+			ExpectedHttpCode: http.StatusNotFound,
+			ExpectedBody:     `{"responseCode":"4040000","responseMessage":"Undefined request path and/or permission mapping"}`,
+		},
+		{
+			Name:             "MethodNotAllowed",
+			Method:           http.MethodDelete,
+			Path:             "/panic",
+			ClientKey:        "snap-key",
+			ExpectedHttpCode: http.StatusMethodNotAllowed,
+			ExpectedBody:     `{"responseCode":"4050000","responseMessage":"Method Not Allowed"}`,
+		},
+		{
+			Name:             "BindError",
+			Method:           http.MethodPost,
+			Path:             "/v1.0/access-token/b2b",
+			ExpectedHttpCode: http.StatusBadRequest,
+			ExpectedBody:     `{"responseCode":"4007301","responseMessage":"Missing or invalid request params, headers, or body","remark":"unexpected EOF"}`,
+		},
+		{
+			Name:             "Panic",
+			Method:           http.MethodGet,
+			Path:             "/panic",
+			ClientKey:        "snap-key",
+			ExpectedHttpCode: http.StatusInternalServerError,
+			ExpectedBody:     `{"responseCode":"5000001","responseMessage":"Unexpected error occured, please try again later","remark":"boom"}`,
+		},
+		{
+			Name:             "DefaultClient",
+			Method:           http.MethodGet,
+			Path:             "/unknown",
+			ExpectedHttpCode: http.StatusNotFound,
+			ExpectedBody:     `{"message":"Not Found"}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			e.HTTPErrorHandler = SnapHTTPErrorHandler(e.DefaultHTTPErrorHandler)
+			e.Use(middleware.Recover(), SnapEnvelope(m, modes))
+			e.GET("/panic", func(ctx echo.Context) error {
+				panic("boom")
+			})
+			e.POST("/v1.0/access-token/b2b", func(ctx echo.Context) error {
+				var request model.B2BTokenRequest
+				return ctx.Bind(&request)
+			})
+			req := httptest.NewRequest(tc.Method, tc.Path, strings.NewReader("{"))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(HeaderClientKey, tc.ClientKey)
+			res := httptest.NewRecorder()
+			e.ServeHTTP(res, req)
+			assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+			assert.JSONEq(t, tc.ExpectedBody, res.Body.String())
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/contextutil"
+	"backend_test/pkg/util/responseutil"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderAppID lets a superadmin choose the tenants of a request, either a
+// comma separated list of app IDs or * for every tenant
+const HeaderAppID = "X-App-ID"
+
+// TenantScope scopes the request context to the apps of the JWT roles, so
+// that every employee query of the request only sees those tenants. A
+// superadmin may cross tenants explicitly with the X-App-ID header.
+func TenantScope() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			claims := contextutil.GetJwtClaims(ctx)
+			if claims == nil {
+				return next(ctx)
+			}
+			scope := model.TenantScope{AppIDs: *contextutil.GetAppIDsFromJwt(ctx)}
+			if header := ctx.Request().Header.Get(HeaderAppID); header != "" {
+				if !claims.User.Superadmin {
+					return responseutil.SendErrorResponse(ctx, pkgerror.ErrForbiddenRequest.WithError(
+						fmt.Errorf("only superadmin can set %s", HeaderAppID)))
+				}
+				var err error
+				if scope, err = parseTenantScope(header); err != nil {
+					return responseutil.SendErrorResponse(ctx, pkgerror.ErrInvalidParams.WithError(err))
+				}
+			}
+			req := ctx.Request()
+			ctx.SetRequest(req.WithContext(contextutil.WithTenantScope(req.Context(), scope)))
+			return next(ctx)
+		}
+	}
+}
+
+func parseTenantScope(header string) (model.TenantScope, error) {
+	if strings.TrimSpace(header) == "*" {
+		return model.TenantScope{All: true}, nil
+	}
+	scope := model.TenantScope{}
+	for _, part := range strings.Split(header, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || id <= 0 {
+			return scope, errors.New(HeaderAppID + " must be * or a list of app IDs")
+		}
+		if !scope.Contains(id) {
+			scope.AppIDs = append(scope.AppIDs, id)
+		}
+	}
+	return scope, nil
+}
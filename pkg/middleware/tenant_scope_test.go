@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/contextutil"
+	"backend_test/pkg/util/jsonutil"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func createAppClaims(superadmin bool, appIDs ...int) *model.JwtClaims {
+	roles := []map[string]interface{}{}
+	for _, id := range appIDs {
+		roles = append(roles, map[string]interface{}{"app": map[string]interface{}{"id": id}})
+	}
+	claims := model.JwtClaims{}
+	data, _ := json.Marshal(map[string]interface{}{
+		"user": map[string]interface{}{"superadmin": superadmin, "roles": roles},
+	})
+	_ = json.Unmarshal(data, &claims)
+	return &claims
+}
+
+func TestTenantScope(t *testing.T) {
+	testCases := []struct {
+		Name             string
+		Claims           *model.JwtClaims
+		Header           string
+		ExpectedHttpCode int
+		ExpectedCode     string
+		ExpectedScope    *model.TenantScope
+	}{
+		{
+			Name:             "Anonymous",
+			ExpectedHttpCode: http.StatusOK,
+		},
+		{
+			Name:             "JwtApps",
+			Claims:           createAppClaims(false, 1, 2),
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedScope:    &model.TenantScope{AppIDs: []int{1, 2}},
+		},
+		{
+			Name:             "TwoRolesInOneApp",
+			Claims:           createAppClaims(false, 1, 1),
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedScope:    &model.TenantScope{AppIDs: []int{1}},
+		},
+		{
+			Name:             "SuperadminWithoutHeader",
+			Claims:           createAppClaims(true, 1),
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedScope:    &model.TenantScope{AppIDs: []int{1}},
+		},
+		{
+			Name:             "SuperadminAllTenants",
+			Claims:           createAppClaims(true, 1),
+			Header:           "*",
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedScope:    &model.TenantScope{All: true},
+		},
+		{
+			Name:             "SuperadminOtherTenants",
+			Claims:           createAppClaims(true, 1),
+			Header:           "2, 3, 2",
+			ExpectedHttpCode: http.StatusOK,
+			ExpectedScope:    &model.TenantScope{AppIDs: []int{2, 3}},
+		},
+		{
+			Name:             "SuperadminInvalidHeader",
+			Claims:           createAppClaims(true, 1),
+			Header:           "two",
+			ExpectedHttpCode: http.StatusBadRequest,
+			ExpectedCode:     pkgerror.ErrInvalidParams.Code,
+		},
+		{
+			Name:             "UserCannotCrossTenants",
+			Claims:           createAppClaims(false, 1),
+			Header:           "2",
+			ExpectedHttpCode: http.StatusForbidden,
+			ExpectedCode:     pkgerror.ErrForbiddenRequest.Code,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.Header != "" {
+				req.Header.Set(HeaderAppID, tc.Header)
+			}
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			if tc.Claims != nil {
+				c.Set("jwt_claims", tc.Claims)
+			}
+			next := func(ctx echo.Context) error {
+				scope, ok := contextutil.GetTenantScope(ctx.Request().Context())
+				assert.Equal(t, tc.ExpectedScope != nil, ok)
+				if tc.ExpectedScope != nil {
+					assert.Equal(t, *tc.ExpectedScope, scope)
+				}
+				return ctx.NoContent(http.StatusOK)
+			}
+			assert.NoError(t, TenantScope()(next)(c))
+			assert.Equal(t, tc.ExpectedHttpCode, res.Code)
+			if tc.ExpectedCode != "" {
+				jsonpath, err := jsonutil.NewJsonPath(res.Body.String())
+				assert.Nil(t, err)
+				assert.Equal(t, tc.ExpectedCode, jsonpath.GetString("code"))
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	for _, algorithm := range []string{"", Bcrypt, Argon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			hash, err := Hash("s3cret-password", algorithm)
+			assert.Nil(t, err)
+			assert.NotContains(t, hash, "s3cret-password")
+
+			ok, err := Verify(hash, "s3cret-password")
+			assert.Nil(t, err)
+			assert.True(t, ok)
+
+			ok, err = Verify(hash, "wrong-password")
+			assert.Nil(t, err)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestHashUnsupportedAlgorithm(t *testing.T) {
+	_, err := Hash("s3cret-password", "md5")
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+}
+
+func TestVerifyMalformedHash(t *testing.T) {
+	_, err := Verify("$argon2id$v=19$m=65536$salt$key", "s3cret-password")
+	assert.ErrorIs(t, err, ErrMalformedHash)
+	_, err = Verify("not-a-hash", "s3cret-password")
+	assert.NotNil(t, err)
+}
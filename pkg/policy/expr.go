@@ -0,0 +1,323 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const maxDepth = 20
+
+// Kind is the type of an attribute
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindNumber
+	KindBool
+	KindList // list of strings, only valid on the right of "in"
+)
+
+func (k Kind) String() string {
+	return [...]string{"string", "number", "bool", "list"}[k]
+}
+
+// Schema declares the attributes a condition may use and their kinds
+type Schema map[string]Kind
+
+// Attributes are the values of the attributes of a schema, strings, int64,
+// bool or []string depending on their kind. An attribute left unset never
+// compares equal, nor unequal, to anything.
+type Attributes map[string]interface{}
+
+type node interface {
+	eval(attrs Attributes) bool
+}
+
+type logical struct {
+	op          string
+	left, right node
+}
+
+type not struct {
+	expr node
+}
+
+type comparison struct {
+	op          string
+	left, right operand
+}
+
+// operand is either an attribute reference or a literal value
+type operand struct {
+	attr  string
+	value interface{}
+	kind  Kind
+}
+
+func (o operand) resolve(attrs Attributes) interface{} {
+	if o.attr == "" {
+		return o.value
+	}
+	return attrs[o.attr]
+}
+
+func (l *logical) eval(attrs Attributes) bool {
+	if l.op == "and" {
+		return l.left.eval(attrs) && l.right.eval(attrs)
+	}
+	return l.left.eval(attrs) || l.right.eval(attrs)
+}
+
+func (n *not) eval(attrs Attributes) bool {
+	return !n.expr.eval(attrs)
+}
+
+func (c *comparison) eval(attrs Attributes) bool {
+	left, right := c.left.resolve(attrs), c.right.resolve(attrs)
+	switch c.op {
+	case "eq":
+		return left != nil && left == right
+	case "ne":
+		return left != nil && right != nil && left != right
+	}
+	list, _ := right.([]string)
+	for _, v := range list {
+		if v == left {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // 1-based character position in the condition
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of condition"
+	case tokenString:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// tokenize splits the condition into words, quoted strings and parentheses,
+// inside a quoted string a doubled quote ('') is a literal quote
+func tokenize(expr string) ([]token, error) {
+	runes := []rune(expr)
+	tokens := []token{}
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i + 1})
+			i++
+		case r == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated string starting at position %d", start+1)
+				}
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						sb.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: start + 1})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("()'", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: string(runes[start:i]), pos: start + 1})
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(runes) + 1}), nil
+}
+
+// parse parses a condition such as
+//
+//	subject.email eq resource.manager_email or 'hr_admin' in subject.roles
+//
+// checking every attribute against the schema and the kinds of the operands
+// of each comparison
+func parse(expr string, schema Schema) (node, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, schema: schema}
+	n, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d, expected 'and', 'or' or end of condition", t, t.pos)
+	}
+	return n, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	schema Schema
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) peekKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (p *parser) parseOr(depth int) (node, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.next()
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd(depth int) (node, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.next()
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary(depth int) (node, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("condition is nested deeper than %d levels", maxDepth)
+	}
+	if p.peekKeyword("not") {
+		p.next()
+		expr, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &not{expr: expr}, nil
+	}
+	if t := p.peek(); t.kind == tokenLParen {
+		p.next()
+		expr, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenRParen {
+			return nil, fmt.Errorf("unexpected %s at position %d, expected ')'", t, t.pos)
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.next()
+	op := strings.ToLower(t.text)
+	if t.kind != tokenWord || (op != "eq" && op != "ne" && op != "in") {
+		return nil, fmt.Errorf("unexpected %s at position %d, expected an operator (eq, ne, in)", t, t.pos)
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if left.kind == KindList {
+		return nil, fmt.Errorf("operator %s at position %d cannot compare a list on its left", op, t.pos)
+	}
+	if op == "in" && right.kind != KindList {
+		return nil, fmt.Errorf("operator in at position %d expects a list on its right, got a %s", t.pos, right.kind)
+	}
+	if op == "in" && left.kind != KindString {
+		return nil, fmt.Errorf("operator in at position %d expects a string on its left, got a %s", t.pos, left.kind)
+	}
+	if op != "in" && left.kind != right.kind {
+		return nil, fmt.Errorf("operator %s at position %d compares a %s with a %s", op, t.pos, left.kind, right.kind)
+	}
+	return &comparison{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return operand{value: t.text, kind: KindString}, nil
+	case tokenWord:
+		if strings.Contains(t.text, ".") {
+			name := strings.ToLower(t.text)
+			kind, ok := p.schema[name]
+			if !ok {
+				return operand{}, fmt.Errorf("unknown attribute %q at position %d", t.text, t.pos)
+			}
+			return operand{attr: name, kind: kind}, nil
+		}
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return operand{value: n, kind: KindNumber}, nil
+		}
+		if word := strings.ToLower(t.text); word == "true" || word == "false" {
+			return operand{value: word == "true", kind: KindBool}, nil
+		}
+		return operand{}, fmt.Errorf("invalid value %s at position %d, strings must be quoted", t, t.pos)
+	}
+	return operand{}, fmt.Errorf("unexpected %s at position %d, expected an attribute or a value", t, t.pos)
+}
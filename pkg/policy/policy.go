@@ -0,0 +1,127 @@
+// Package policy evaluates attribute based access rules on a loaded
+// resource, complementing the route permissions with conditions such as
+// "a team lead may only edit the employees reporting to them".
+//
+// Each rule applies to some actions of the resource and states a condition
+// over the subject and resource attributes, every rule of an action must
+// hold for the action to be allowed.
+package policy
+
+import (
+	"backend_test/model"
+	"backend_test/pkg/config"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+var ErrDenied = errors.New("denied by policy")
+
+// DeniedError names the rule an action failed
+type DeniedError struct {
+	Rule   string
+	Action string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("%s %s on %s", ErrDenied, e.Rule, e.Action)
+}
+
+func (e *DeniedError) Unwrap() error {
+	return ErrDenied
+}
+
+// SubjectSchema are the attributes of the caller available to every rule
+var SubjectSchema = Schema{
+	"subject.id":          KindNumber,
+	"subject.email":       KindString,
+	"subject.superadmin":  KindBool,
+	"subject.roles":       KindList,
+	"subject.permissions": KindList,
+}
+
+// SubjectAttributes returns the attributes of the principal
+func SubjectAttributes(principal model.Principal) Attributes {
+	attrs := Attributes{
+		"subject.id":          int64(principal.UserID),
+		"subject.superadmin":  principal.Superadmin,
+		"subject.roles":       principal.Roles,
+		"subject.permissions": principal.Permissions,
+	}
+	if principal.Email != "" {
+		// the employee emails are stored in lower case
+		attrs["subject.email"] = strings.ToLower(principal.Email)
+	}
+	return attrs
+}
+
+// Resource declares the actions and the attributes of a resource type,
+// attribute names are prefixed with "resource."
+type Resource struct {
+	Actions    []string
+	Attributes Schema
+}
+
+type rule struct {
+	name    string
+	actions []string
+	cond    node
+}
+
+type Engine struct {
+	rules []rule
+}
+
+// NewEngine compiles the rules of the policies config, a rule referring to
+// an unknown action or attribute is an error
+func NewEngine(policies []config.Policy, resource Resource) (*Engine, error) {
+	schema := Schema{}
+	for name, kind := range SubjectSchema {
+		schema[name] = kind
+	}
+	for name, kind := range resource.Attributes {
+		schema[name] = kind
+	}
+	e := &Engine{}
+	names := map[string]bool{}
+	for _, p := range policies {
+		if p.Name == "" || len(p.Actions) == 0 || strings.TrimSpace(p.Condition) == "" {
+			return nil, fmt.Errorf("policy needs a name, actions and a condition: %+v", p)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("duplicated policy %s", p.Name)
+		}
+		names[p.Name] = true
+		for _, action := range p.Actions {
+			if !slices.Contains(resource.Actions, action) {
+				return nil, fmt.Errorf("policy %s: unknown action %s", p.Name, action)
+			}
+		}
+		cond, err := parse(p.Condition, schema)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+		e.rules = append(e.rules, rule{name: p.Name, actions: p.Actions, cond: cond})
+	}
+	return e, nil
+}
+
+// Authorize returns a *DeniedError naming the first rule of the action the
+// attributes fail, an action without rules is allowed
+func (e *Engine) Authorize(action string, subject, resource Attributes) error {
+	attrs := Attributes{}
+	for name, v := range subject {
+		attrs[name] = v
+	}
+	for name, v := range resource {
+		attrs[name] = v
+	}
+	for _, r := range e.rules {
+		if slices.Contains(r.actions, action) && !r.cond.eval(attrs) {
+			return &DeniedError{Rule: r.name, Action: action}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package policy
+
+import (
+	"backend_test/model"
+	"backend_test/pkg/config"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var employeeResource = Resource{
+	Actions: []string{"employees:read", "employees:update"},
+	Attributes: Schema{
+		"resource.id":            KindNumber,
+		"resource.email":         KindString,
+		"resource.manager_email": KindString,
+	},
+}
+
+func TestAuthorize(t *testing.T) {
+	e, err := NewEngine([]config.Policy{
+		{
+			Name:      "team_lead_edits_own_reports",
+			Actions:   []string{"employees:update"},
+			Condition: "'hr_admin' in subject.roles or resource.manager_email eq subject.email",
+		},
+		{
+			Name:      "read_own_record",
+			Actions:   []string{"employees:read"},
+			Condition: "resource.email eq subject.email or (resource.manager_email eq subject.email and not resource.id eq 1)",
+		},
+	}, employeeResource)
+	assert.Nil(t, err)
+
+	lead := SubjectAttributes(model.Principal{UserID: 7, Email: "lead@corp.id"})
+	admin := SubjectAttributes(model.Principal{UserID: 8, Email: "admin@corp.id", Roles: []string{"hr_admin"}})
+	noEmail := SubjectAttributes(model.Principal{UserID: 9})
+	report := Attributes{"resource.id": int64(2), "resource.email": "report@corp.id", "resource.manager_email": "lead@corp.id"}
+	other := Attributes{"resource.id": int64(3), "resource.email": "other@corp.id"}
+	testCases := []struct {
+		Name         string
+		Action       string
+		Subject      Attributes
+		Resource     Attributes
+		ExpectedRule string
+	}{
+		{Name: "LeadEditsReport", Action: "employees:update", Subject: lead, Resource: report},
+		{Name: "LeadEditsOther", Action: "employees:update", Subject: lead, Resource: other, ExpectedRule: "team_lead_edits_own_reports"},
+		{Name: "AdminEditsOther", Action: "employees:update", Subject: admin, Resource: other},
+		{Name: "UnsetNeverMatches", Action: "employees:update", Subject: noEmail, Resource: other, ExpectedRule: "team_lead_edits_own_reports"},
+		{Name: "ReadOwnRecord", Action: "employees:read", Subject: SubjectAttributes(model.Principal{Email: "other@corp.id"}), Resource: other},
+		{Name: "ReadOwnRecordAnyCase", Action: "employees:read", Subject: SubjectAttributes(model.Principal{Email: "Other@Corp.id"}), Resource: other},
+		{Name: "ReadReport", Action: "employees:read", Subject: lead, Resource: report},
+		{Name: "ReadOther", Action: "employees:read", Subject: lead, Resource: other, ExpectedRule: "read_own_record"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := e.Authorize(tc.Action, tc.Subject, tc.Resource)
+			if tc.ExpectedRule == "" {
+				assert.Nil(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrDenied)
+			var denied *DeniedError
+			if assert.True(t, errors.As(err, &denied)) {
+				assert.Equal(t, tc.ExpectedRule, denied.Rule)
+			}
+		})
+	}
+}
+
+func TestAuthorizeWithoutRules(t *testing.T) {
+	e, err := NewEngine(nil, employeeResource)
+	assert.Nil(t, err)
+	assert.Nil(t, e.Authorize("employees:update", Attributes{}, Attributes{}))
+}
+
+func TestNewEngineError(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Policy        config.Policy
+		ExpectedError string
+	}{
+		{"NoCondition", config.Policy{Name: "p", Actions: []string{"employees:read"}}, "needs a name"},
+		{"UnknownAction", config.Policy{Name: "p", Actions: []string{"employees:purge"}, Condition: "subject.id eq 1"}, "unknown action employees:purge"},
+		{"UnknownAttribute", config.Policy{Name: "p", Actions: []string{"employees:read"}, Condition: "resource.salary eq 1"}, `unknown attribute "resource.salary" at position 1`},
+		{"KindMismatch", config.Policy{Name: "p", Actions: []string{"employees:read"}, Condition: "resource.id eq subject.email"}, "compares a number with a string"},
+		{"InNeedsList", config.Policy{Name: "p", Actions: []string{"employees:read"}, Condition: "'a' in subject.email"}, "expects a list on its right"},
+		{"UnquotedString", config.Policy{Name: "p", Actions: []string{"employees:read"}, Condition: "subject.email eq lead"}, "strings must be quoted"},
+		{"Unbalanced", config.Policy{Name: "p", Actions: []string{"employees:read"}, Condition: "(subject.id eq 1"}, "expected ')'"},
+		{"Trailing", config.Policy{Name: "p", Actions: []string{"employees:read"}, Condition: "subject.id eq 1 subject.id"}, "expected 'and', 'or' or end of condition"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := NewEngine([]config.Policy{tc.Policy}, employeeResource)
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), tc.ExpectedError)
+			}
+		})
+	}
+}
+
+func TestScope(t *testing.T) {
+	e, err := NewEngine([]config.Policy{
+		{
+			Name:      "read_own_record_or_reports",
+			Actions:   []string{"employees:read"},
+			Condition: "'hr_staff' in subject.roles or resource.email eq subject.email or resource.manager_email eq subject.email",
+		},
+		{
+			Name:      "not_the_ceo",
+			Actions:   []string{"employees:read"},
+			Condition: "not resource.id eq 1",
+		},
+	}, employeeResource)
+	assert.Nil(t, err)
+	columns := map[string]string{"resource.id": "id", "resource.email": "email", "resource.manager_email": "nullif(manager_email, '')"}
+	testCases := []struct {
+		Name         string
+		Action       string
+		Subject      Attributes
+		ExpectedSQL  string
+		ExpectedArgs []interface{}
+	}{
+		{
+			Name:         "Lead",
+			Action:       "employees:read",
+			Subject:      SubjectAttributes(model.Principal{UserID: 7, Email: "lead@corp.id"}),
+			ExpectedSQL:  "((coalesce(email = ?, false) or coalesce(nullif(manager_email, '') = ?, false)) and not coalesce(id = ?, false))",
+			ExpectedArgs: []interface{}{"lead@corp.id", "lead@corp.id", int64(1)},
+		},
+		{
+			Name:         "RoleBypass",
+			Action:       "employees:read",
+			Subject:      SubjectAttributes(model.Principal{UserID: 8, Email: "hr@corp.id", Roles: []string{"hr_staff"}}),
+			ExpectedSQL:  "not coalesce(id = ?, false)",
+			ExpectedArgs: []interface{}{int64(1)},
+		},
+		{
+			Name:         "UnsetSubjectEmail",
+			Action:       "employees:read",
+			Subject:      SubjectAttributes(model.Principal{UserID: 9}),
+			ExpectedSQL:  "false",
+			ExpectedArgs: nil,
+		},
+		{
+			Name:    "WithoutRules",
+			Action:  "employees:update",
+			Subject: SubjectAttributes(model.Principal{UserID: 9}),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			scope, err := e.Scope(tc.Action, tc.Subject, columns)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.ExpectedSQL, scope.SQL)
+			assert.Equal(t, tc.ExpectedArgs, scope.Args)
+		})
+	}
+
+	_, err = e.Scope("employees:read", SubjectAttributes(model.Principal{Email: "lead@corp.id"}), map[string]string{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,161 @@
+package policy
+
+import (
+	"backend_test/model"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// condition is a rule partially evaluated for a subject, either a constant
+// or an SQL expression over the resource columns
+type condition struct {
+	sql   string
+	args  []interface{}
+	known bool
+	value bool
+}
+
+func constant(value bool) condition {
+	return condition{known: true, value: value}
+}
+
+// Scope renders the rules of an action for a subject as an SQL condition
+// on the rows of the resource, columns maps the resource attributes to
+// their SQL expressions and the subject attributes are bound as parameters.
+// A row matches the scope exactly when Authorize allows the action on it,
+// an unset attribute is a NULL column. The scope is empty when every row is
+// allowed.
+func (e *Engine) Scope(action string, subject Attributes, columns map[string]string) (model.PolicyScope, error) {
+	scope := constant(true)
+	for _, r := range e.rules {
+		if !slices.Contains(r.actions, action) {
+			continue
+		}
+		cond, err := scopeOf(r.cond, subject, columns)
+		if err != nil {
+			return model.PolicyScope{}, fmt.Errorf("policy %s: %w", r.name, err)
+		}
+		scope = and(scope, cond)
+	}
+	if !scope.known {
+		return model.PolicyScope{SQL: scope.sql, Args: scope.args}, nil
+	}
+	if !scope.value {
+		return model.PolicyScope{SQL: "false"}, nil
+	}
+	return model.PolicyScope{}, nil
+}
+
+func and(left, right condition) condition {
+	switch {
+	case left.known && !left.value, right.known && !right.value:
+		return constant(false)
+	case left.known:
+		return right
+	case right.known:
+		return left
+	}
+	return condition{sql: "(" + left.sql + " and " + right.sql + ")", args: append(left.args, right.args...)}
+}
+
+func or(left, right condition) condition {
+	switch {
+	case left.known && left.value, right.known && right.value:
+		return constant(true)
+	case left.known:
+		return right
+	case right.known:
+		return left
+	}
+	return condition{sql: "(" + left.sql + " or " + right.sql + ")", args: append(left.args, right.args...)}
+}
+
+// scopeOf partially evaluates a rule node, the subject attributes are
+// known and the resource attributes are columns
+func scopeOf(n node, subject Attributes, columns map[string]string) (condition, error) {
+	switch n := n.(type) {
+	case *logical:
+		left, err := scopeOf(n.left, subject, columns)
+		if err != nil {
+			return condition{}, err
+		}
+		right, err := scopeOf(n.right, subject, columns)
+		if err != nil {
+			return condition{}, err
+		}
+		if n.op == "and" {
+			return and(left, right), nil
+		}
+		return or(left, right), nil
+	case *not:
+		cond, err := scopeOf(n.expr, subject, columns)
+		if err != nil || cond.known {
+			return constant(!cond.value), err
+		}
+		return condition{sql: "not " + cond.sql, args: cond.args}, nil
+	case *comparison:
+		return n.scope(subject, columns)
+	}
+	return condition{}, fmt.Errorf("unexpected node %T", n)
+}
+
+// scope of a comparison is wrapped in coalesce so that a NULL column makes
+// it false, as an unset attribute does, and its negation true
+func (c *comparison) scope(subject Attributes, columns map[string]string) (condition, error) {
+	left, err := c.left.sqlOperand(subject, columns)
+	if err != nil {
+		return condition{}, err
+	}
+	right, err := c.right.sqlOperand(subject, columns)
+	if err != nil {
+		return condition{}, err
+	}
+	if left.column == "" && right.column == "" {
+		known := &comparison{op: c.op, left: operand{value: left.value}, right: operand{value: right.value}}
+		return constant(known.eval(nil)), nil
+	}
+	if (left.column == "" && left.value == nil) || (right.column == "" && right.value == nil) {
+		return constant(false), nil
+	}
+	if c.op == "in" {
+		// lists are subject attributes, the column is on the left
+		if len(right.value.([]string)) == 0 {
+			return constant(false), nil
+		}
+		return condition{sql: "coalesce(" + left.column + " in ?, false)", args: []interface{}{right.value}}, nil
+	}
+	sqlOp := map[string]string{"eq": "=", "ne": "<>"}[c.op]
+	args := []interface{}{}
+	sides := []string{}
+	for _, o := range []sqlOperand{left, right} {
+		if o.column != "" {
+			sides = append(sides, o.column)
+		} else {
+			sides = append(sides, "?")
+			args = append(args, o.value)
+		}
+	}
+	return condition{sql: "coalesce(" + strings.Join(sides, " "+sqlOp+" ") + ", false)", args: args}, nil
+}
+
+// sqlOperand is either a resource column or a known value, nil when unset
+type sqlOperand struct {
+	column string
+	value  interface{}
+}
+
+func (o operand) sqlOperand(subject Attributes, columns map[string]string) (sqlOperand, error) {
+	switch {
+	case o.attr == "":
+		return sqlOperand{value: o.value}, nil
+	case strings.HasPrefix(o.attr, "subject."):
+		return sqlOperand{value: subject[o.attr]}, nil
+	}
+	column, ok := columns[o.attr]
+	if !ok {
+		return sqlOperand{}, fmt.Errorf("no column for attribute %s", o.attr)
+	}
+	return sqlOperand{column: column}, nil
+}
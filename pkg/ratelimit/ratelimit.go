@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows up to limit events per key in fixed windows, keys are for
+// example an account or a client IP. The counters are kept in memory so
+// every instance of the service limits on its own.
+type Limiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	counters  map[string]counter
+	nextSweep time.Time
+}
+
+type counter struct {
+	start time.Time
+	count int
+}
+
+// New returns a limiter of limit events per window, a limit of 0 or less
+// allows everything
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:    limit,
+		window:   window,
+		now:      time.Now,
+		counters: map[string]counter{},
+	}
+}
+
+// Allow counts an event of the key and reports whether it is within the
+// limit of the current window
+func (l *Limiter) Allow(key string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	c, ok := l.counters[key]
+	if !ok || !now.Before(c.start.Add(l.window)) {
+		c = counter{start: now}
+	}
+	c.count++
+	l.counters[key] = c
+	return c.count <= l.limit
+}
+
+// Reset forgets the events of the key, for example the failed attempts
+// of an account once it succeeds
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.counters, key)
+}
+
+// sweep drops the counters of the ended windows, once per window
+func (l *Limiter) sweep(now time.Time) {
+	if now.Before(l.nextSweep) {
+		return
+	}
+	for key, c := range l.counters {
+		if !now.Before(c.start.Add(l.window)) {
+			delete(l.counters, key)
+		}
+	}
+	l.nextSweep = now.Add(l.window)
+}
@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	l := New(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	assert.True(t, l.Allow("a"))
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+	assert.True(t, l.Allow("b"))
+
+	now = now.Add(time.Minute)
+	assert.True(t, l.Allow("a"))
+	assert.Len(t, l.counters, 1)
+}
+
+func TestAllowUnlimited(t *testing.T) {
+	l := New(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		assert.True(t, l.Allow("a"))
+	}
+}
+
+func TestReset(t *testing.T) {
+	l := New(1, time.Minute)
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+	l.Reset("a")
+	assert.True(t, l.Allow("a"))
+}
@@ -0,0 +1,101 @@
+// Package responsesign signs the responses to the API clients and verifies
+// them. The signature is sent in X-SIGNATURE with the X-TIMESTAMP it covers,
+// it is the base64 HMAC-SHA512 with the client secret or SHA256withRSA with
+// the server key of the minified body and the timestamp. Partners can use
+// Verify or VerifyResponse in their tests.
+package responsesign
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"backend_test/pkg/util/encodeutil"
+)
+
+const (
+	HeaderSignature = "X-SIGNATURE"
+	HeaderTimestamp = "X-TIMESTAMP"
+)
+
+var (
+	ErrMissingSignature  = errors.New("response has no X-SIGNATURE or X-TIMESTAMP header")
+	ErrSignatureMismatch = errors.New("signature does not match the response")
+)
+
+// StringToSign returns the signed string of a response, its body minified
+// when it is JSON and as is otherwise, a colon and the timestamp
+func StringToSign(body []byte, timestamp string) string {
+	return minify(body) + ":" + timestamp
+}
+
+func minify(body []byte) (s string) {
+	defer func() {
+		// encodeutil.MinifyJson panics on a body that is not JSON
+		if r := recover(); r != nil {
+			s = string(body)
+		}
+	}()
+	return encodeutil.MinifyJson(string(body))
+}
+
+// SignHmac returns the HMAC-SHA512 signature of a response with the client
+// secret
+func SignHmac(secret string, body []byte, timestamp string) string {
+	return encodeutil.HmacSha512([]byte(secret), []byte(StringToSign(body, timestamp)))
+}
+
+// SignRsa returns the SHA256withRSA signature of a response
+func SignRsa(key *rsa.PrivateKey, body []byte, timestamp string) (string, error) {
+	return encodeutil.RsaSha256Sign(key, []byte(StringToSign(body, timestamp)))
+}
+
+// Verifier checks the signature of a response body at a timestamp
+type Verifier func(body []byte, timestamp, signature string) error
+
+// HmacVerifier verifies the HMAC-SHA512 signatures with the client secret
+func HmacVerifier(secret string) Verifier {
+	return func(body []byte, timestamp, signature string) error {
+		if !hmac.Equal([]byte(SignHmac(secret, body, timestamp)), []byte(signature)) {
+			return ErrSignatureMismatch
+		}
+		return nil
+	}
+}
+
+// RsaVerifier verifies the SHA256withRSA signatures with the public key of
+// the server
+func RsaVerifier(key *rsa.PublicKey) Verifier {
+	return func(body []byte, timestamp, signature string) error {
+		if err := encodeutil.RsaSha256Verify(key, []byte(StringToSign(body, timestamp)), signature); err != nil {
+			return fmt.Errorf("%w: %v", ErrSignatureMismatch, err)
+		}
+		return nil
+	}
+}
+
+// Verify checks the signature headers of a response against its body, such
+// as the ones of an httptest.ResponseRecorder
+func Verify(v Verifier, header http.Header, body []byte) error {
+	signature, timestamp := header.Get(HeaderSignature), header.Get(HeaderTimestamp)
+	if signature == "" || timestamp == "" {
+		return ErrMissingSignature
+	}
+	return v(body, timestamp, signature)
+}
+
+// VerifyResponse checks the signature of a client response, its body is
+// read and put back
+func VerifyResponse(v Verifier, res *http.Response) error {
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return Verify(v, res.Header, body)
+}
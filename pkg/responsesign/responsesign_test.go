@@ -0,0 +1,54 @@
+package responsesign
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTimestamp = "2026-10-18T12:00:00Z"
+
+func TestStringToSign(t *testing.T) {
+	assert.Equal(t, `{"a":1,"b":[1,2]}:`+testTimestamp, StringToSign([]byte("{\n  \"a\": 1,\n  \"b\": [1, 2]\n}"), testTimestamp))
+	assert.Equal(t, "not json:"+testTimestamp, StringToSign([]byte("not json"), testTimestamp))
+	assert.Equal(t, ":"+testTimestamp, StringToSign(nil, testTimestamp))
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"status": "SUCCESS", "code": "0000"}`)
+	header := http.Header{}
+	header.Set(HeaderTimestamp, testTimestamp)
+	header.Set(HeaderSignature, SignHmac("secret", body, testTimestamp))
+
+	assert.Nil(t, Verify(HmacVerifier("secret"), header, body))
+	assert.Nil(t, Verify(HmacVerifier("secret"), header, []byte(`{"status":"SUCCESS","code":"0000"}`)))
+	assert.ErrorIs(t, Verify(HmacVerifier("other"), header, body), ErrSignatureMismatch)
+	assert.ErrorIs(t, Verify(HmacVerifier("secret"), header, []byte(`{"status":"ERROR"}`)), ErrSignatureMismatch)
+	assert.ErrorIs(t, Verify(HmacVerifier("secret"), http.Header{}, body), ErrMissingSignature)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	signature, err := SignRsa(key, body, testTimestamp)
+	assert.Nil(t, err)
+	header.Set(HeaderSignature, signature)
+	assert.Nil(t, Verify(RsaVerifier(&key.PublicKey), header, body))
+	header.Set(HeaderTimestamp, "2026-10-18T12:00:01Z")
+	assert.ErrorIs(t, Verify(RsaVerifier(&key.PublicKey), header, body), ErrSignatureMismatch)
+}
+
+func TestVerifyResponse(t *testing.T) {
+	body := `{"status":"SUCCESS"}`
+	res := &http.Response{Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}
+	res.Header.Set(HeaderTimestamp, testTimestamp)
+	res.Header.Set(HeaderSignature, SignHmac("secret", []byte(body), testTimestamp))
+
+	assert.Nil(t, VerifyResponse(HmacVerifier("secret"), res))
+	read, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, body, string(read))
+}
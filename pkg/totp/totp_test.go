@@ -0,0 +1,60 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	testCases := []struct {
+		Unix     int64
+		Expected string
+	}{
+		{Unix: 59, Expected: "287082"},
+		{Unix: 1111111109, Expected: "081804"},
+		{Unix: 1234567890, Expected: "005924"},
+		{Unix: 2000000000, Expected: "279037"},
+	}
+	for _, tc := range testCases {
+		code, err := Code(rfcSecret, Step(time.Unix(tc.Unix, 0)))
+		assert.Nil(t, err)
+		assert.Equal(t, tc.Expected, code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, _ := Code(rfcSecret, Step(now))
+
+	step, ok := Validate(rfcSecret, code, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	_, ok = Validate(rfcSecret, code, now.Add(Period), 1)
+	assert.True(t, ok)
+	_, ok = Validate(rfcSecret, code, now.Add(2*Period), 1)
+	assert.False(t, ok)
+	_, ok = Validate(rfcSecret, "000000", now, 1)
+	assert.False(t, ok)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.Nil(t, err)
+	assert.Len(t, secret, 32)
+	_, err = Code(secret, 1)
+	assert.Nil(t, err)
+}
+
+func TestURI(t *testing.T) {
+	assert.Equal(t,
+		"otpauth://totp/Backend%20Test:user@gmail.com?algorithm=SHA1&digits=6&issuer=Backend+Test&period=30&secret=ABC",
+		URI("Backend Test", "user@gmail.com", "ABC"))
+}
@@ -2,8 +2,14 @@ package contextutil
 
 import (
 	"backend_test/model"
+	"backend_test/pkg/config"
+	"backend_test/pkg/jwtauth"
+	"backend_test/pkg/util/tokenutil"
+	"context"
+	"strings"
 
 	"github.com/labstack/echo/v4"
+	"golang.org/x/exp/slices"
 )
 
 func GetJwtClaims(ctx echo.Context) (claims *model.JwtClaims) {
@@ -22,14 +28,20 @@ func GetUserEmail(ctx echo.Context) *string {
 	return &claims.User.Email
 }
 
+// GetAppIDsFromJwt returns the apps of the JWT roles, once each as a user
+// may have several roles in an app
 func GetAppIDsFromJwt(ctx echo.Context) *[]int {
 	appIDs := []int{}
 	claims := GetJwtClaims(ctx)
 	if claims == nil {
 		return &appIDs
 	}
+	seen := map[int]bool{}
 	for _, role := range claims.User.Roles {
-		appIDs = append(appIDs, role.App.ID)
+		if !seen[role.App.ID] {
+			seen[role.App.ID] = true
+			appIDs = append(appIDs, role.App.ID)
+		}
 	}
 	return &appIDs
 }
@@ -54,3 +66,69 @@ func AppIDsContain(ctx echo.Context, appID int) bool {
 	}
 	return false
 }
+
+// GetPrincipal returns the caller of the request, the zero value for an
+// anonymous request. The roles and permissions of the token are merged with
+// the user_grants resolved from the database by the permission check.
+func GetPrincipal(ctx echo.Context) model.Principal {
+	claims := GetJwtClaims(ctx)
+	if claims == nil {
+		return model.Principal{}
+	}
+	principal := model.Principal{
+		Issuer:     claims.Iss,
+		UserID:     claims.User.ID,
+		Email:      claims.User.Email,
+		Superadmin: claims.User.Superadmin,
+		AppIDs:     *GetAppIDsFromJwt(ctx),
+	}
+	prefix := config.Data.AppCode + ":"
+	for _, role := range claims.User.Roles {
+		principal.Roles = appendMissing(principal.Roles, role.Code)
+		for _, p := range role.Permissions {
+			if strings.HasPrefix(p, prefix) {
+				principal.Permissions = appendMissing(principal.Permissions, strings.TrimPrefix(p, prefix))
+			}
+		}
+	}
+	if grants, ok := ctx.Get("user_grants").(model.UserGrants); ok {
+		principal.Roles = appendMissing(principal.Roles, grants.Roles...)
+		principal.Permissions = appendMissing(principal.Permissions, grants.Permissions...)
+	}
+	return principal
+}
+
+func appendMissing(list []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// GetSessionKey identifies the login session of the request token, the
+// session of a token issued by /auth/login or the hash of another token
+func GetSessionKey(ctx echo.Context) string {
+	claims := GetJwtClaims(ctx)
+	if claims == nil {
+		return ""
+	}
+	if claims.Sid != "" {
+		return claims.Sid
+	}
+	return tokenutil.Hash(jwtauth.BearerToken(ctx.Request().Header.Get(echo.HeaderAuthorization)))
+}
+
+type tenantScopeKey struct{}
+
+// WithTenantScope returns a copy of ctx carrying the tenant scope the
+// repository queries are limited to
+func WithTenantScope(ctx context.Context, scope model.TenantScope) context.Context {
+	return context.WithValue(ctx, tenantScopeKey{}, scope)
+}
+
+func GetTenantScope(ctx context.Context) (model.TenantScope, bool) {
+	scope, ok := ctx.Value(tenantScopeKey{}).(model.TenantScope)
+	return scope, ok
+}
@@ -0,0 +1,45 @@
+package cursorutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid or tampered cursor")
+
+// Encode serializes the payload into an opaque URL-safe cursor signed with
+// the given secret
+func Encode(payload interface{}, secret string) (string, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	data := base64.RawURLEncoding.EncodeToString(b)
+	return data + "." + sign(data, secret), nil
+}
+
+// Decode verifies the cursor signature and deserializes it into the payload
+func Decode(cursor string, secret string, payload interface{}) error {
+	data, signature, found := strings.Cut(cursor, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(sign(data, secret))) {
+		return ErrInvalidCursor
+	}
+	b, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, payload); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+func sign(data string, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -1,7 +1,10 @@
 package encodeutil
 
 import (
+	"crypto"
 	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
@@ -52,3 +55,34 @@ func HmacSha512(key []byte, data []byte) string {
 	h.Write(data)
 	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
+
+// SNAPStringToSign is the string of the symmetric signature of a service
+// request, method:path:token:bodyhash:timestamp
+func SNAPStringToSign(method, path, token, body, timestamp string) string {
+	return strings.Join([]string{strings.ToUpper(method), path, token, SNAPEncodingHex(body), timestamp}, ":")
+}
+
+// SNAPAsymmetricStringToSign is the string of the asymmetric signature of
+// an access token request, client_id|timestamp
+func SNAPAsymmetricStringToSign(clientKey, timestamp string) string {
+	return clientKey + "|" + timestamp
+}
+
+// RsaSha256Sign returns the base64 SHA256withRSA (PKCS #1 v1.5) signature
+// of data
+func RsaSha256Sign(key *rsa.PrivateKey, data []byte) (string, error) {
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, Sha256Encode(data))
+	if err != nil {
+		return "", err
+	}
+	return Base64(signature), nil
+}
+
+// RsaSha256Verify verifies a base64 SHA256withRSA signature of data
+func RsaSha256Verify(key *rsa.PublicKey, data []byte, signature string) error {
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, Sha256Encode(data), decoded)
+}
@@ -0,0 +1,36 @@
+package etagutil
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Version returns the strong entity tag of a resource version
+func Version(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// Match reports whether an If-Match header lists the entity tag using the
+// strong comparison, "*" matches any tag
+func Match(header string, etag string) bool {
+	return match(header, etag, false)
+}
+
+// MatchWeak reports whether an If-None-Match header lists the entity tag
+// using the weak comparison, "*" matches any tag
+func MatchWeak(header string, etag string) bool {
+	return match(header, etag, true)
+}
+
+func match(header string, etag string, weak bool) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if weak {
+			t = strings.TrimPrefix(t, "W/")
+		}
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
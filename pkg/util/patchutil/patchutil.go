@@ -0,0 +1,40 @@
+package patchutil
+
+import (
+	"errors"
+	"mime"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+const (
+	MIMEMergePatch = "application/merge-patch+json" // RFC 7396
+	MIMEJsonPatch  = "application/json-patch+json"  // RFC 6902
+)
+
+var ErrUnsupportedPatchType = errors.New("unsupported patch content type, use " + MIMEMergePatch + " or " + MIMEJsonPatch)
+
+// ParsePatchType returns the patch media type of a Content-Type header,
+// ignoring its parameters such as charset
+func ParsePatchType(contentType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != MIMEMergePatch && mediaType != MIMEJsonPatch) {
+		return "", ErrUnsupportedPatchType
+	}
+	return mediaType, nil
+}
+
+// Apply applies the patch of the given media type to the JSON document
+func Apply(patchType string, doc []byte, patch []byte) ([]byte, error) {
+	switch patchType {
+	case MIMEMergePatch:
+		return jsonpatch.MergePatch(doc, patch)
+	case MIMEJsonPatch:
+		p, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, err
+		}
+		return p.Apply(doc)
+	}
+	return nil, ErrUnsupportedPatchType
+}
@@ -3,7 +3,10 @@ package responseutil
 import (
 	"backend_test/model"
 	"backend_test/pkg/config"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	pkgerror "backend_test/pkg/error"
 
@@ -32,10 +35,124 @@ func CreateErrorResponse(err pkgerror.CustomError) model.ResponseBody {
 	return body
 }
 
+// CreateSnapResponse returns the SNAP envelope of a response, err is
+// pkgerror.NoError for a success
+func CreateSnapResponse(envelope model.ResponseEnvelope, err pkgerror.CustomError, data interface{}, pagination *model.Pagination) model.SnapResponseBody {
+	body := model.SnapResponseBody{
+		ResponseCode:    err.SnapResponseCode(envelope.ServiceCode),
+		ResponseMessage: "Successful",
+		Data:            data,
+		Pagination:      pagination,
+	}
+	if !err.IsNoError() {
+		body.ResponseMessage = err.Msg
+	}
+	if !config.Data.IsEnvProduction() && err.Err != nil {
+		e := err.Err.Error()
+		body.ErrorRemark = &e
+	}
+	return body
+}
+
+const envelopeKey = "response_envelope"
+
+// EnvelopeSelector chooses the envelope of the responses of a request, it
+// is called when a response is sent so it sees the claims of the request
+// once authenticated
+type EnvelopeSelector func(ctx echo.Context) model.ResponseEnvelope
+
+func SetEnvelopeSelector(ctx echo.Context, selector EnvelopeSelector) {
+	ctx.Set(envelopeKey, selector)
+}
+
+// GetEnvelope returns the envelope of the responses of the request, the
+// default one when no selector was set
+func GetEnvelope(ctx echo.Context) model.ResponseEnvelope {
+	selector, ok := ctx.Get(envelopeKey).(EnvelopeSelector)
+	if !ok {
+		return model.ResponseEnvelope{}
+	}
+	return selector(ctx)
+}
+
 func SendSuccessReponse(ctx echo.Context, data interface{}, pagination *model.Pagination) error {
+	if envelope := GetEnvelope(ctx); envelope.Snap {
+		return ctx.JSON(http.StatusOK, CreateSnapResponse(envelope, pkgerror.NoError, data, pagination))
+	}
 	return ctx.JSON(http.StatusOK, CreateSuccessResponse(data, pagination))
 }
 
 func SendErrorResponse(ctx echo.Context, err pkgerror.CustomError) error {
+	if envelope := GetEnvelope(ctx); envelope.Snap {
+		return ctx.JSON(err.HttpCode, CreateSnapResponse(envelope, err, nil, nil))
+	}
 	return ctx.JSON(err.HttpCode, CreateErrorResponse(err))
 }
+
+// SetPaginationHeaders sets the X-Total-Count and RFC 8288 Link headers so
+// generic clients can page through results without reading the body.
+func SetPaginationHeaders(ctx echo.Context, pagination *model.Pagination) {
+	if pagination == nil {
+		return
+	}
+	if pagination.NextCursor != nil || pagination.PrevCursor != nil {
+		setCursorLinkHeader(ctx, pagination)
+		return
+	}
+	if pagination.TotalData == nil {
+		return
+	}
+	ctx.Response().Header().Set("X-Total-Count", strconv.Itoa(*pagination.TotalData))
+	if pagination.PageNum == nil || pagination.TotalPage == nil {
+		return
+	}
+	pageNum, totalPage := *pagination.PageNum, *pagination.TotalPage
+	links := []string{}
+	addLink := func(page int, rel string) {
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, pageURL(ctx, page, pagination.PageSize), rel))
+	}
+	addLink(1, "first")
+	if pageNum > 1 && pageNum <= totalPage+1 {
+		addLink(pageNum-1, "prev")
+	}
+	if pageNum < totalPage {
+		addLink(pageNum+1, "next")
+	}
+	if totalPage > 0 {
+		addLink(totalPage, "last")
+	}
+	ctx.Response().Header().Set("Link", strings.Join(links, ", "))
+}
+
+func setCursorLinkHeader(ctx echo.Context, pagination *model.Pagination) {
+	links := []string{}
+	if pagination.PrevCursor != nil {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, requestURLWith(ctx, "cursor", *pagination.PrevCursor)))
+	}
+	if pagination.NextCursor != nil {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, requestURLWith(ctx, "cursor", *pagination.NextCursor)))
+	}
+	ctx.Response().Header().Set("Link", strings.Join(links, ", "))
+}
+
+// pageURL links a page of the request, a requested page_size is replaced
+// with the effective one the pages were counted with
+func pageURL(ctx echo.Context, page int, pageSize *int) string {
+	params := []string{"page_num", strconv.Itoa(page)}
+	if pageSize != nil && ctx.QueryParams().Has("page_size") {
+		params = append(params, "page_size", strconv.Itoa(*pageSize))
+	}
+	return requestURLWith(ctx, params...)
+}
+
+// requestURLWith returns the request URL with the params, pairs of name
+// and value, set in its query
+func requestURLWith(ctx echo.Context, params ...string) string {
+	u := *ctx.Request().URL
+	q := u.Query()
+	for i := 0; i+1 < len(params); i += 2 {
+		q.Set(params[i], params[i+1])
+	}
+	u.RawQuery = q.Encode()
+	return ctx.Scheme() + "://" + ctx.Request().Host + u.RequestURI()
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"backend_test/entity"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func preloadClientRole(db *gorm.DB) *gorm.DB {
+	return db.Preload("Role").Preload("Role.Permissions")
+}
+
+func (d DefaultRepository) FindClients(ctx context.Context) ([]entity.ApiClient, error) {
+	clients := []entity.ApiClient{}
+	err := d.conn(ctx).Scopes(preloadClientRole).Order("id asc").Find(&clients).Error
+	return clients, err
+}
+
+func (d DefaultRepository) FindClientByID(ctx context.Context, id uint) (entity.ApiClient, error) {
+	client := entity.ApiClient{}
+	err := d.conn(ctx).Scopes(preloadClientRole).Where("id=?", id).First(&client).Error
+	return client, err
+}
+
+func (d DefaultRepository) FindClientByKey(ctx context.Context, clientKey string) (entity.ApiClient, error) {
+	client := entity.ApiClient{}
+	err := d.conn(ctx).Scopes(preloadClientRole).Where("client_key=?", clientKey).First(&client).Error
+	return client, err
+}
+
+func (d DefaultRepository) CreateClient(ctx context.Context, client *entity.ApiClient) error {
+	return d.conn(ctx).Omit("Role").Create(client).Error
+}
+
+func (d DefaultRepository) DisableClient(ctx context.Context, id uint, at time.Time) error {
+	return rowAffected(d.conn(ctx).Model(&entity.ApiClient{}).
+		Where("id=? and disabled_at is null", id).
+		Updates(map[string]interface{}{"disabled_at": at, "updated_at": at}))
+}
+
+func (d DefaultRepository) UpdateClientPublicKey(ctx context.Context, id uint, publicKey string, at time.Time) error {
+	return rowAffected(d.conn(ctx).Model(&entity.ApiClient{}).
+		Where("id=?", id).
+		Updates(map[string]interface{}{"public_key": publicKey, "updated_at": at}))
+}
+
+func (d DefaultRepository) UpdateClientResponseMode(ctx context.Context, id uint, mode string, at time.Time) error {
+	return rowAffected(d.conn(ctx).Model(&entity.ApiClient{}).
+		Where("id=?", id).
+		Updates(map[string]interface{}{"response_mode": mode, "updated_at": at}))
+}
+
+func (d DefaultRepository) UpdateClientResponseSigning(ctx context.Context, id uint, signing string, at time.Time) error {
+	return rowAffected(d.conn(ctx).Model(&entity.ApiClient{}).
+		Where("id=?", id).
+		Updates(map[string]interface{}{"response_signing": signing, "updated_at": at}))
+}
+
+// UseClientNonce records the external ID of a request of the client, it
+// returns gorm.ErrRecordNotFound when the ID was used and has not expired
+func (d DefaultRepository) UseClientNonce(ctx context.Context, nonce *entity.ClientNonce, now time.Time) error {
+	return rowAffected(d.conn(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "client_id"}, {Name: "external_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expires_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "client_nonces.expires_at <= ?", Vars: []interface{}{now}},
+		}},
+	}).Create(nonce))
+}
+
+// PurgeClientNonces deletes the expired nonces and returns their number
+func (d DefaultRepository) PurgeClientNonces(ctx context.Context, now time.Time) (int, error) {
+	result := d.conn(ctx).Where("expires_at <= ?", now).Delete(&entity.ClientNonce{})
+	return int(result.RowsAffected), result.Error
+}
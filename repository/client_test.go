@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func resetClients() {
+	conn.Where("1=1").Delete(&entity.ApiClient{})
+	resetRoles()
+}
+
+func TestApiClient(t *testing.T) {
+	resetClients()
+	defer resetClients()
+	ctx := context.Background()
+	now := time.Now()
+
+	permission := entity.Permission{Code: "read_employees"}
+	assert.Nil(t, repo.CreatePermission(ctx, &permission))
+	role := entity.Role{Code: "payroll", Name: "Payroll", Permissions: []entity.Permission{permission}}
+	assert.Nil(t, repo.CreateRole(ctx, &role))
+
+	client := entity.ApiClient{ClientKey: "payroll-key", Name: "Payroll", Secret: "secret", AppID: 1, RoleID: role.ID, ResponseMode: model.ResponseModeDefault,
+		ResponseSigning: model.ResponseSigningNone}
+	assert.Nil(t, repo.CreateClient(ctx, &client))
+	found, err := repo.FindClientByKey(ctx, "payroll-key")
+	assert.Nil(t, err)
+	assert.Equal(t, client.ID, found.ID)
+	assert.Equal(t, model.ResponseModeDefault, found.ResponseMode)
+	assert.Equal(t, "payroll", found.Role.Code)
+	if assert.Len(t, found.Role.Permissions, 1) {
+		assert.Equal(t, "read_employees", found.Role.Permissions[0].Code)
+	}
+
+	assert.Nil(t, repo.UpdateClientPublicKey(ctx, client.ID, "PUBLIC KEY", now))
+	assert.ErrorIs(t, repo.UpdateClientPublicKey(ctx, client.ID+1, "PUBLIC KEY", now), gorm.ErrRecordNotFound)
+	assert.Nil(t, repo.UpdateClientResponseMode(ctx, client.ID, model.ResponseModeSnap, now))
+	assert.Nil(t, repo.UpdateClientResponseSigning(ctx, client.ID, model.ResponseSigningHmac, now))
+	assert.Nil(t, repo.DisableClient(ctx, client.ID, now))
+	assert.ErrorIs(t, repo.DisableClient(ctx, client.ID, now), gorm.ErrRecordNotFound)
+	found, err = repo.FindClientByID(ctx, client.ID)
+	assert.Nil(t, err)
+	assert.True(t, found.IsDisabled())
+	assert.Equal(t, "PUBLIC KEY", found.PublicKey)
+	assert.Equal(t, model.ResponseModeSnap, found.ResponseMode)
+	assert.Equal(t, model.ResponseSigningHmac, found.ResponseSigning)
+}
+
+func TestUseClientNonce(t *testing.T) {
+	resetClients()
+	defer resetClients()
+	ctx := context.Background()
+	now := time.Now()
+
+	role := entity.Role{Code: "attendance", Name: "Attendance"}
+	assert.Nil(t, repo.CreateRole(ctx, &role))
+	client := entity.ApiClient{ClientKey: "attendance-key", Name: "Attendance", Secret: "secret", AppID: 1, RoleID: role.ID, ResponseMode: model.ResponseModeDefault,
+		ResponseSigning: model.ResponseSigningNone}
+	assert.Nil(t, repo.CreateClient(ctx, &client))
+
+	nonce := func(expiresAt time.Time) *entity.ClientNonce {
+		return &entity.ClientNonce{ClientID: client.ID, ExternalID: "external-1", ExpiresAt: expiresAt}
+	}
+	assert.Nil(t, repo.UseClientNonce(ctx, nonce(now.Add(time.Hour)), now))
+	assert.ErrorIs(t, repo.UseClientNonce(ctx, nonce(now.Add(2*time.Hour)), now), gorm.ErrRecordNotFound)
+	// reusable once expired
+	assert.Nil(t, repo.UseClientNonce(ctx, nonce(now.Add(3*time.Hour)), now.Add(time.Hour)))
+
+	purged, err := repo.PurgeClientNonces(ctx, now.Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, purged)
+	purged, err = repo.PurgeClientNonces(ctx, now.Add(3*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+	assert.Nil(t, repo.UseClientNonce(ctx, nonce(now.Add(4*time.Hour)), now))
+}
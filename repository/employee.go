@@ -4,7 +4,10 @@ import (
 	"backend_test/constant"
 	"backend_test/entity"
 	"backend_test/model"
+	"backend_test/pkg/filterexpr"
 	"context"
+	"fmt"
+	"strings"
 
 	"gorm.io/gorm"
 )
@@ -28,6 +31,51 @@ func whereEmployeeLastNameContains(name string, alias string) func(db *gorm.DB)
 	}
 }
 
+func whereEmployeeEmailEquals(email string, alias string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if email == "" {
+			return db
+		}
+		sql := "lower(" + withAlias(string(constant.EmployeeColumnEmail), alias) + ") = lower(?)"
+		return db.Where(sql, email)
+	}
+}
+
+func whereEmployeeEmailStartsWith(prefix string, alias string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if prefix == "" {
+			return db
+		}
+		sql := withAlias(string(constant.EmployeeColumnEmail), alias) + " ilike ?"
+		return db.Where(sql, withPercentAfter(escapeLike(prefix)))
+	}
+}
+
+func whereEmployeeTimeFrom(column constant.EmployeeColumn, from *model.DateParam, alias string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if from == nil {
+			return db
+		}
+		sql := withAlias(string(column), alias) + " >= ?"
+		return db.Where(sql, from.Time)
+	}
+}
+
+// whereEmployeeTimeTo is inclusive, a plain date covers the whole day
+func whereEmployeeTimeTo(column constant.EmployeeColumn, to *model.DateParam, alias string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if to == nil {
+			return db
+		}
+		if to.DateOnly {
+			sql := withAlias(string(column), alias) + " < ?"
+			return db.Where(sql, to.AddDate(0, 0, 1))
+		}
+		sql := withAlias(string(column), alias) + " <= ?"
+		return db.Where(sql, to.Time)
+	}
+}
+
 func whereEmployeeIDIn(ids []int, alias string) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if len(ids) == 0 {
@@ -38,72 +86,322 @@ func whereEmployeeIDIn(ids []int, alias string) func(db *gorm.DB) *gorm.DB {
 	}
 }
 
-func (d DefaultRepository) FindEmployees(ctx context.Context, filter model.GetEmployeesFilter) ([]entity.Employee, error) {
-	employeeIDs := []int{}
-	if filter.ID != nil {
-		employeeIDs = append(employeeIDs, *filter.ID)
+func whereEmployeeMatches(expr filterexpr.Node, alias string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if expr == nil {
+			return db
+		}
+		sql, args := filterExprSQL(expr, alias)
+		return db.Where(sql, args...)
+	}
+}
+
+// filterExprSQL renders a parsed filter expression, field names are already
+// restricted to the employee columns and every value is passed as parameter
+func filterExprSQL(node filterexpr.Node, alias string) (string, []interface{}) {
+	switch n := node.(type) {
+	case *filterexpr.Logical:
+		left, leftArgs := filterExprSQL(n.Left, alias)
+		right, rightArgs := filterExprSQL(n.Right, alias)
+		return "(" + left + " " + n.Op + " " + right + ")", append(leftArgs, rightArgs...)
+	case *filterexpr.Not:
+		sql, args := filterExprSQL(n.Expr, alias)
+		return "not " + sql, args
+	case *filterexpr.Comparison:
+		column := withAlias(n.Field, alias)
+		switch n.Op {
+		case filterexpr.OpIn:
+			return "(" + column + " in ?)", []interface{}{n.Values}
+		case filterexpr.OpContains:
+			return "(" + column + " ilike ?)", []interface{}{withPercentAround(escapeLike(n.Values[0].(string)))}
+		case filterexpr.OpSw:
+			return "(" + column + " ilike ?)", []interface{}{withPercentAfter(escapeLike(n.Values[0].(string)))}
+		case filterexpr.OpEw:
+			return "(" + column + " ilike ?)", []interface{}{withPercentBefore(escapeLike(n.Values[0].(string)))}
+		}
+		return "(" + column + " " + comparisonOperators[n.Op] + " ?)", n.Values
+	}
+	return "true", nil
+}
+
+var comparisonOperators = map[filterexpr.Operator]string{
+	filterexpr.OpEq: "=",
+	filterexpr.OpNe: "<>",
+	filterexpr.OpGt: ">",
+	filterexpr.OpGe: ">=",
+	filterexpr.OpLt: "<",
+	filterexpr.OpLe: "<=",
+}
+
+// wherePolicyScope keeps the rows the read policies allow, the scope is
+// rendered on the bare employee columns
+func wherePolicyScope(scope model.PolicyScope) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if scope.SQL == "" {
+			return db
+		}
+		return db.Where(scope.SQL, scope.Args...)
+	}
+}
+
+// filterEmployees gathers every filter scope so the list and count queries
+// always select the same rows
+func filterEmployees(filter model.GetEmployeesFilter, alias string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(
+			whereEmployeeFirstNameContains(filter.FirstName, alias),
+			whereEmployeeLastNameContains(filter.LastName, alias),
+			whereEmployeeEmailEquals(filter.Email, alias),
+			whereEmployeeEmailStartsWith(filter.EmailPrefix, alias),
+			whereEmployeeIDIn(filter.IDs, alias),
+			whereEmployeeTimeFrom(constant.EmployeeColumnHireDate, filter.HireDateFrom, alias),
+			whereEmployeeTimeTo(constant.EmployeeColumnHireDate, filter.HireDateTo, alias),
+			whereEmployeeTimeFrom(constant.EmployeeColumnCreatedAt, filter.CreatedFrom, alias),
+			whereEmployeeTimeTo(constant.EmployeeColumnCreatedAt, filter.CreatedTo, alias),
+			whereEmployeeTimeFrom(constant.EmployeeColumnUpdatedAt, filter.UpdatedSince, alias),
+			whereEmployeeMatches(filter.FilterExpr, alias),
+			wherePolicyScope(filter.PolicyScope),
+		)
+	}
+}
+
+func orderEmployees(sorts []model.EmployeeSort, alias string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, k := range model.EmployeeSortKeys(sorts) {
+			db = db.Order(withAlias(string(k.Column), alias) + " " + getSortDir(k.Dir))
+		}
+		return db
+	}
+}
+
+// whereEmployeeAfterKeyset keeps the rows positioned strictly after the
+// keyset in the order given by keys, e.g. for keys (a asc, id desc):
+// (a > ?) or (a = ? and id < ?)
+func whereEmployeeAfterKeyset(keys []model.EmployeeSort, keyset model.Keyset, alias string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(keyset.Values) == 0 {
+			return db
+		}
+		conds := []string{}
+		args := []interface{}{}
+		for i, k := range keys {
+			parts := []string{}
+			for j := 0; j < i; j++ {
+				parts = append(parts, withAlias(string(keys[j].Column), alias)+" = ?")
+				args = append(args, keyset.Values[j])
+			}
+			op := ">"
+			if getSortDir(k.Dir) == "desc" {
+				op = "<"
+			}
+			parts = append(parts, withAlias(string(k.Column), alias)+" "+op+" ?")
+			args = append(args, keyset.Values[i])
+			conds = append(conds, "("+strings.Join(parts, " and ")+")")
+		}
+		return db.Where("("+strings.Join(conds, " or ")+")", args...)
 	}
+}
+
+func (d DefaultRepository) FindEmployees(ctx context.Context, filter model.GetEmployeesFilter) ([]entity.Employee, error) {
 	shops := []entity.Employee{}
-	err := d.handler.Tx.WithContext(ctx).
+	err := d.employees(ctx).
 		Scopes(
-			whereEmployeeFirstNameContains(filter.FirstName, ""),
-			whereEmployeeLastNameContains(filter.LastName, ""),
-			whereEmployeeIDIn(employeeIDs, ""),
+			filterEmployees(filter, ""),
+			orderEmployees(filter.Sorts, ""),
 			paginate(filter.PageRequest.PageNum, filter.PageRequest.PageSize)).
-		Order("created_at desc").Find(&shops).Error
+		Find(&shops).Error
 	return shops, err
 }
 
-func (d DefaultRepository) FindAllEmployees(ctx context.Context, filter model.GetEmployeesFilter) ([]entity.Employee, error) {
-	employeeIDs := []int{}
-	if filter.ID != nil {
-		employeeIDs = append(employeeIDs, *filter.ID)
+func (d DefaultRepository) FindEmployeesByKeyset(ctx context.Context, filter model.GetEmployeesFilter, keyset model.Keyset, limit int) ([]entity.Employee, error) {
+	keys := model.EmployeeSortKeys(filter.Sorts)
+	if keyset.Backward {
+		keys = model.ReverseEmployeeSortKeys(keys)
 	}
+	if len(keyset.Values) != 0 && len(keyset.Values) != len(keys) {
+		return nil, fmt.Errorf("keyset has %d values, expected %d", len(keyset.Values), len(keys))
+	}
+	shops := []entity.Employee{}
+	err := d.employees(ctx).
+		Scopes(
+			filterEmployees(filter, ""),
+			whereEmployeeAfterKeyset(keys, keyset, ""),
+			orderEmployees(keys, "")).
+		Limit(limit).Find(&shops).Error
+	return shops, err
+}
+
+func (d DefaultRepository) FindAllEmployees(ctx context.Context, filter model.GetEmployeesFilter) ([]entity.Employee, error) {
 	shops := []entity.Employee{}
-	err := d.handler.Tx.WithContext(ctx).
+	err := d.employees(ctx).
 		Scopes(
-			whereEmployeeFirstNameContains(filter.FirstName, ""),
-			whereEmployeeLastNameContains(filter.LastName, ""),
-			whereEmployeeIDIn(employeeIDs, "")).
-		Order("created_at desc").Find(&shops).Error
+			filterEmployees(filter, ""),
+			orderEmployees(filter.Sorts, "")).
+		Find(&shops).Error
 	return shops, err
 }
 
 func (d DefaultRepository) CountEmployees(ctx context.Context, filter model.GetEmployeesFilter) (int, error) {
-	employeeIDs := []int{}
-	if filter.ID != nil {
-		employeeIDs = append(employeeIDs, *filter.ID)
-	}
 	var count int64
-	err := d.handler.Tx.WithContext(ctx).Model(&entity.Employee{}).
+	err := d.employees(ctx).Model(&entity.Employee{}).
 		Scopes(
-			whereEmployeeFirstNameContains(filter.FirstName, ""),
-			whereEmployeeLastNameContains(filter.LastName, ""),
-			whereEmployeeIDIn(employeeIDs, "")).
+			filterEmployees(filter, "")).
 		Count(&count).Error
 	return int(count), err
 }
 
 func (d DefaultRepository) CreateEmployee(ctx context.Context, employee *entity.Employee) error {
-	return d.handler.Tx.Create(employee).Error
+	if err := checkTenant(ctx, employee.AppID); err != nil {
+		return err
+	}
+	return employeeEmailTaken(d.conn(ctx).Create(employee).Error)
 }
 
 func (d DefaultRepository) FindEmployeeByID(ctx context.Context, id uint) (entity.Employee, error) {
 	employee := entity.Employee{}
-	err := d.handler.Tx.WithContext(ctx).Where("id=?", id).First(&employee).Error
+	err := d.employees(ctx).Where("id=?", id).First(&employee).Error
 	return employee, err
 }
 
-func (d DefaultRepository) FindEmployeeByEmail(ctx context.Context, email string) (entity.Employee, error) {
+// FindEmployeeByEmail finds the employee of the app with the email, emails
+// are unique per app
+func (d DefaultRepository) FindEmployeeByEmail(ctx context.Context, appID int, email string) (entity.Employee, error) {
 	employee := entity.Employee{}
-	err := d.handler.Tx.WithContext(ctx).Where("email=?", email).First(&employee).Error
+	err := d.employees(ctx).Where("app_id=? and lower(email)=lower(?)", appID, email).First(&employee).Error
 	return employee, err
 }
 
+// UpdateEmployee saves the employee only if it still has the version it
+// was loaded with and increments that version, otherwise ErrVersionConflict
 func (d DefaultRepository) UpdateEmployee(ctx context.Context, employee *entity.Employee) error {
-	return d.handler.Tx.WithContext(ctx).Save(employee).Error
+	version := employee.Version
+	employee.Version++
+	err := versioned(d.employees(ctx).Model(employee).
+		Where("version = ?", version).
+		Select("*").Omit("id", "app_id", "created_at", "deleted_at").
+		Updates(employee))
+	if err != nil {
+		employee.Version = version
+	}
+	return employeeEmailTaken(err)
+}
+
+func (d DefaultRepository) DeleteEmployee(ctx context.Context, id uint, version int) error {
+	return versioned(d.employees(ctx).Where("version = ?", version).Delete(&entity.Employee{}, id))
+}
+
+func whereDeleted(alias string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped().Where(withAlias("deleted_at", alias) + " is not null")
+	}
+}
+
+func (d DefaultRepository) FindDeletedEmployees(ctx context.Context, filter model.GetEmployeesFilter) ([]entity.Employee, error) {
+	db := d.employees(ctx).Scopes(whereDeleted(""), filterEmployees(filter, ""))
+	if len(filter.Sorts) == 0 {
+		db = db.Order("deleted_at desc")
+	}
+	employees := []entity.Employee{}
+	err := db.Scopes(
+		orderEmployees(filter.Sorts, ""),
+		paginate(filter.PageRequest.PageNum, filter.PageRequest.PageSize)).
+		Find(&employees).Error
+	return employees, err
+}
+
+func (d DefaultRepository) CountDeletedEmployees(ctx context.Context, filter model.GetEmployeesFilter) (int, error) {
+	var count int64
+	err := d.employees(ctx).Model(&entity.Employee{}).
+		Scopes(whereDeleted(""), filterEmployees(filter, "")).
+		Count(&count).Error
+	return int(count), err
+}
+
+func (d DefaultRepository) FindDeletedEmployeeByID(ctx context.Context, id uint) (entity.Employee, error) {
+	employee := entity.Employee{}
+	err := d.employees(ctx).Scopes(whereDeleted("")).Where("id=?", id).First(&employee).Error
+	return employee, err
+}
+
+func (d DefaultRepository) RestoreEmployee(ctx context.Context, id uint) error {
+	return employeeEmailTaken(rowAffected(d.employees(ctx).Model(&entity.Employee{}).
+		Scopes(whereDeleted("")).Where("id=?", id).
+		Update("deleted_at", nil)))
+}
+
+func (d DefaultRepository) PurgeEmployee(ctx context.Context, id uint, version int) error {
+	return versioned(d.employees(ctx).Unscoped().Where("version = ?", version).Delete(&entity.Employee{}, id))
+}
+
+// AssignEmployeesWithoutApp moves the employees of app 0, the ones created
+// before the tenants, deleted ones included, to the app and returns their
+// number. It is not scoped to a tenant.
+func (d DefaultRepository) AssignEmployeesWithoutApp(ctx context.Context, appID int) (int, error) {
+	result := d.conn(ctx).Unscoped().Model(&entity.Employee{}).Where("app_id = 0").Update("app_id", appID)
+	return int(result.RowsAffected), employeeEmailTaken(result.Error)
 }
 
-func (d DefaultRepository) DeleteEmployee(ctx context.Context, id uint) error {
-	return d.handler.Tx.WithContext(ctx).Delete(&entity.Employee{}, id).Error
+// employeeSearchDocument is the text indexed by the trigram index, it must
+// match the index expression to be used by the planner
+const employeeSearchDocument = "(first_name || ' ' || last_name || ' ' || email)"
+
+// employeeHeadlineDocument is the search document with its HTML special
+// characters escaped, the highlight is an HTML fragment so its <mark> tags
+// must be the only markup
+const employeeHeadlineDocument = "replace(replace(replace(replace(replace(" + employeeSearchDocument +
+	", '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '\"', '&quot;'), '''', '&#39;')"
+
+// employeeHeadline marks the words of the document matching the tsquery
+func employeeHeadline(query string) string {
+	return "ts_headline('simple', " + employeeHeadlineDocument + ", " + query + ", 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')"
+}
+
+// fuzzyHeadlineQuery matches the words of the document similar to the
+// query, a fuzzy hit has no word matching the query as typed
+const fuzzyHeadlineQuery = "(select websearch_to_tsquery('simple', coalesce(string_agg(lexeme, ' or '), '')) " +
+	"from unnest(tsvector_to_array(search_vector)) as lexeme where ? <% lexeme)"
+
+func (d DefaultRepository) SearchEmployees(ctx context.Context, req model.SearchEmployeesRequest) ([]entity.EmployeeSearchHit, int, error) {
+	query := "websearch_to_tsquery('simple', ?)"
+	hits := []entity.EmployeeSearchHit{}
+	var count int64
+	err := d.employees(ctx).Model(&entity.Employee{}).
+		Where("search_vector @@ "+query, req.Query).
+		Scopes(wherePolicyScope(req.PolicyScope)).
+		Count(&count).Error
+	if err != nil || count == 0 {
+		return hits, int(count), err
+	}
+	err = d.employees(ctx).Model(&entity.Employee{}).
+		Select("employees.*, ts_rank_cd(search_vector, "+query+") as rank, "+
+			employeeHeadline(query)+" as highlight",
+			req.Query, req.Query).
+		Where("search_vector @@ "+query, req.Query).
+		Scopes(wherePolicyScope(req.PolicyScope), paginate(req.PageRequest.PageNum, req.PageRequest.PageSize)).
+		Order("rank desc, id asc").
+		Find(&hits).Error
+	return hits, int(count), err
+}
+
+// SearchEmployeesFuzzy matches the query against the employee names and
+// email by trigram word similarity, so it tolerates typos
+func (d DefaultRepository) SearchEmployeesFuzzy(ctx context.Context, req model.SearchEmployeesRequest) ([]entity.EmployeeSearchHit, int, error) {
+	hits := []entity.EmployeeSearchHit{}
+	var count int64
+	err := d.employees(ctx).Model(&entity.Employee{}).
+		Where("? <% "+employeeSearchDocument, req.Query).
+		Scopes(wherePolicyScope(req.PolicyScope)).
+		Count(&count).Error
+	if err != nil || count == 0 {
+		return hits, int(count), err
+	}
+	err = d.employees(ctx).Model(&entity.Employee{}).
+		Select("employees.*, word_similarity(?, "+employeeSearchDocument+") as rank, "+
+			employeeHeadline(fuzzyHeadlineQuery)+" as highlight",
+			req.Query, req.Query).
+		Where("? <% "+employeeSearchDocument, req.Query).
+		Scopes(wherePolicyScope(req.PolicyScope), paginate(req.PageRequest.PageNum, req.PageRequest.PageSize)).
+		Order("rank desc, id asc").
+		Find(&hits).Error
+	return hits, int(count), err
 }
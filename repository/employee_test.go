@@ -1,21 +1,26 @@
 package repository
 
 import (
+	"backend_test/constant"
 	"backend_test/entity"
 	"backend_test/model"
+	"backend_test/pkg/util/contextutil"
 	"context"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFindEmployees(t *testing.T) {
-	shops, err := repo.FindEmployees(context.Background(), model.GetEmployeesFilter{})
+	shops, err := repo.FindEmployees(tenantCtx, model.GetEmployeesFilter{})
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(shops))
 }
 
 func TestFindEmployeeByID(t *testing.T) {
-	person, err := repo.FindEmployeeByID(context.Background(), uint(1))
+	person, err := repo.FindEmployeeByID(tenantCtx, uint(1))
 	assert.Nil(t, err)
 	assert.Equal(t, uint(1), person.ID)
 	assert.Equal(t, "First Employee 1", person.FirstName)
@@ -27,13 +32,278 @@ func TestUpdateEmployee(t *testing.T) {
 		ID:        1,
 		FirstName: "First name",
 		LastName:  "Last name",
+		Version:   1,
 	}
-	err := repo.UpdateEmployee(context.Background(), &person)
+	err := repo.UpdateEmployee(tenantCtx, &person)
 	assert.Nil(t, err)
-	result, err := repo.FindEmployeeByID(context.Background(), 1)
+	assert.Equal(t, 2, person.Version)
+	result, err := repo.FindEmployeeByID(tenantCtx, 1)
 	assert.Nil(t, err)
 	assert.Equal(t, person.ID, result.ID)
 	assert.Equal(t, person.FirstName, result.FirstName)
 	assert.Equal(t, person.LastName, result.LastName)
+	assert.Equal(t, 2, result.Version)
 	resetData()
 }
+
+func TestUpdateEmployeeVersionConflict(t *testing.T) {
+	stale := entity.Employee{ID: 1, FirstName: "Stale", LastName: "Stale", Version: 1}
+	fresh := stale
+	err := repo.UpdateEmployee(tenantCtx, &fresh)
+	assert.Nil(t, err)
+	err = repo.UpdateEmployee(tenantCtx, &stale)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.Equal(t, 1, stale.Version)
+	err = repo.DeleteEmployee(tenantCtx, 1, 1)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	resetData()
+}
+
+func TestFindEmployeesPaginated(t *testing.T) {
+	filter := model.GetEmployeesFilter{PageRequest: model.PageRequest{PageNum: 2, PageSize: 1}}
+	employees, err := repo.FindEmployees(tenantCtx, filter)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(employees))
+}
+
+func TestCountEmployees(t *testing.T) {
+	filter := model.GetEmployeesFilter{PageRequest: model.PageRequest{PageNum: 2, PageSize: 1}}
+	count, err := repo.CountEmployees(tenantCtx, filter)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestFindEmployeesSorted(t *testing.T) {
+	filter := model.GetEmployeesFilter{
+		Sorts: []model.EmployeeSort{{Column: constant.EmployeeColumnLastName, Dir: "desc"}},
+	}
+	employees, err := repo.FindEmployees(tenantCtx, filter)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(employees))
+	assert.Equal(t, "Last 2", employees[0].LastName)
+	assert.Equal(t, "Last 1", employees[1].LastName)
+}
+
+func TestFindEmployeesByKeyset(t *testing.T) {
+	filter := model.GetEmployeesFilter{
+		Sorts: []model.EmployeeSort{{Column: constant.EmployeeColumnLastName, Dir: "asc"}},
+	}
+	first, err := repo.FindEmployeesByKeyset(tenantCtx, filter, model.Keyset{}, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(first))
+	assert.Equal(t, "Last 1", first[0].LastName)
+
+	after := model.Keyset{Values: []interface{}{first[0].LastName, first[0].ID}}
+	next, err := repo.FindEmployeesByKeyset(tenantCtx, filter, after, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(next))
+	assert.Equal(t, "Last 2", next[0].LastName)
+
+	before := model.Keyset{Values: []interface{}{next[0].LastName, next[0].ID}, Backward: true}
+	prev, err := repo.FindEmployeesByKeyset(tenantCtx, filter, before, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, first[0].ID, prev[0].ID)
+}
+
+func TestFindEmployeesFiltered(t *testing.T) {
+	employees, err := repo.FindEmployees(tenantCtx, model.GetEmployeesFilter{IDs: []int{1, 2}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(employees))
+
+	tomorrow := model.DateParam{Time: time.Now().Add(24 * time.Hour)}
+	filter := model.GetEmployeesFilter{UpdatedSince: &tomorrow}
+	employees, err = repo.FindEmployees(tenantCtx, filter)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(employees))
+	count, err := repo.CountEmployees(tenantCtx, filter)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	hireDate := model.DateParam{Time: time.Time{}, DateOnly: true}
+	filter = model.GetEmployeesFilter{HireDateTo: &hireDate, IDs: []int{2}}
+	employees, err = repo.FindEmployees(tenantCtx, filter)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(employees))
+}
+
+func TestFindEmployeesByEmailPrefix(t *testing.T) {
+	conn.Model(&entity.Employee{}).Where("id = ?", 1).Update("email", "a_b@example.com")
+	conn.Model(&entity.Employee{}).Where("id = ?", 2).Update("email", "axb@example.com")
+	defer resetData()
+
+	// the wildcards of the prefix are literal
+	employees, err := repo.FindEmployees(tenantCtx, model.GetEmployeesFilter{EmailPrefix: "A_b"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(employees))
+	assert.Equal(t, uint(1), employees[0].ID)
+	employees, err = repo.FindEmployees(tenantCtx, model.GetEmployeesFilter{EmailPrefix: "%@"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(employees))
+}
+
+func TestFilterExprSQL(t *testing.T) {
+	expr, err := model.ParseEmployeeFilterExpr("id in (1, 2) and not (last_name contains '50%' or email ew '@corp.id')")
+	assert.Nil(t, err)
+	sql, args := filterExprSQL(expr, "e")
+	assert.Equal(t, "((e.id in ?) and not ((e.last_name ilike ?) or (e.email ilike ?)))", sql)
+	assert.Equal(t, []interface{}{[]interface{}{int64(1), int64(2)}, `%50\%%`, "%@corp.id"}, args)
+}
+
+func TestFindEmployeesByFilterExpr(t *testing.T) {
+	expr, err := model.ParseEmployeeFilterExpr("first_name sw 'first' and (last_name eq 'Last 2' or id eq 1)")
+	assert.Nil(t, err)
+	employees, err := repo.FindEmployees(tenantCtx, model.GetEmployeesFilter{FilterExpr: expr})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(employees))
+}
+
+func TestSearchEmployees(t *testing.T) {
+	req := model.SearchEmployeesRequest{Query: "employee 2", PageRequest: model.PageRequest{PageNum: 1, PageSize: 10}}
+	hits, total, err := repo.SearchEmployees(tenantCtx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, uint(2), hits[0].ID)
+	assert.Contains(t, hits[0].Highlight, "<mark>2</mark>")
+}
+
+func TestSearchEmployeesFuzzy(t *testing.T) {
+	req := model.SearchEmployeesRequest{Query: "Emplyee", PageRequest: model.PageRequest{PageNum: 1, PageSize: 10}}
+	hits, total, err := repo.SearchEmployees(tenantCtx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, total)
+	hits, total, err = repo.SearchEmployeesFuzzy(tenantCtx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, 2, len(hits))
+	assert.Greater(t, hits[0].Rank, 0.0)
+	assert.Contains(t, hits[0].Highlight, "<mark>Employee</mark>")
+}
+
+func TestSearchEmployeesHighlightEscaped(t *testing.T) {
+	conn.Model(&entity.Employee{}).Where("id = ?", 1).Update("first_name", `<img src=x onerror="alert('x')"> Employee & Co`)
+	defer resetData()
+	req := model.SearchEmployeesRequest{Query: "co", PageRequest: model.PageRequest{PageNum: 1, PageSize: 10}}
+	hits, total, err := repo.SearchEmployees(tenantCtx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+	assert.Contains(t, hits[0].Highlight, "&lt;img src=x onerror=&quot;alert(&#39;x&#39;)&quot;&gt;")
+	assert.Contains(t, hits[0].Highlight, "Employee &amp; <mark>Co</mark>")
+	assert.NotContains(t, hits[0].Highlight, "<img")
+
+	req.Query = "Emplyee"
+	hits, total, err = repo.SearchEmployeesFuzzy(tenantCtx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, total)
+	for _, hit := range hits {
+		assert.Contains(t, hit.Highlight, "<mark>Employee</mark>")
+		assert.NotContains(t, hit.Highlight, "<img")
+	}
+}
+
+func TestSoftDeleteAndRestoreEmployee(t *testing.T) {
+	ctx := tenantCtx
+	err := repo.DeleteEmployee(ctx, 1, 1)
+	assert.Nil(t, err)
+	_, err = repo.FindEmployeeByID(ctx, 1)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	deleted, err := repo.FindDeletedEmployees(ctx, model.GetEmployeesFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deleted))
+	assert.True(t, deleted[0].DeletedAt.Valid)
+	count, err := repo.CountDeletedEmployees(ctx, model.GetEmployeesFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	err = repo.RestoreEmployee(ctx, 1)
+	assert.Nil(t, err)
+	err = repo.RestoreEmployee(ctx, 1)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repo.FindEmployeeByID(ctx, 1)
+	assert.Nil(t, err)
+	resetData()
+}
+
+func TestEmployeeEmailUniqueness(t *testing.T) {
+	resetData()
+	defer resetData()
+	otherCtx := contextutil.WithTenantScope(context.Background(), model.TenantScope{AppIDs: []int{2}})
+	email := initialData.persons[0].Email
+
+	// unique per app whatever the case
+	err := repo.CreateEmployee(tenantCtx, &entity.Employee{ID: 31, AppID: testAppID, FirstName: "Same", Email: strings.ToUpper(email)})
+	assert.ErrorIs(t, err, ErrEmployeeEmailTaken)
+	assert.Nil(t, repo.CreateEmployee(otherCtx, &entity.Employee{ID: 32, AppID: 2, FirstName: "Same", Email: email}))
+	employee, err := repo.FindEmployeeByID(tenantCtx, 2)
+	assert.Nil(t, err)
+	employee.Email = email
+	assert.ErrorIs(t, repo.UpdateEmployee(tenantCtx, &employee), ErrEmployeeEmailTaken)
+
+	// a deleted employee does not hold its email, restoring it once the
+	// email is taken again is refused
+	assert.Nil(t, repo.DeleteEmployee(tenantCtx, 1, 1))
+	assert.Nil(t, repo.CreateEmployee(tenantCtx, &entity.Employee{ID: 33, AppID: testAppID, FirstName: "New", Email: email}))
+	assert.ErrorIs(t, repo.RestoreEmployee(tenantCtx, 1), ErrEmployeeEmailTaken)
+	_, err = repo.FindDeletedEmployeeByID(tenantCtx, 1)
+	assert.Nil(t, err)
+}
+
+func TestAssignEmployeesWithoutApp(t *testing.T) {
+	resetData()
+	defer resetData()
+	conn.Model(&entity.Employee{}).Where("id = ?", 2).Update("app_id", 0)
+	_, err := repo.FindEmployeeByID(tenantCtx, 2)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	assigned, err := repo.AssignEmployeesWithoutApp(context.Background(), testAppID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, assigned)
+	_, err = repo.FindEmployeeByID(tenantCtx, 2)
+	assert.Nil(t, err)
+	assigned, err = repo.AssignEmployeesWithoutApp(context.Background(), testAppID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, assigned)
+}
+
+func TestPurgeEmployee(t *testing.T) {
+	ctx := tenantCtx
+	err := repo.DeleteEmployee(ctx, 2, 1)
+	assert.Nil(t, err)
+	err = repo.PurgeEmployee(ctx, 2, 1)
+	assert.Nil(t, err)
+	_, err = repo.FindDeletedEmployeeByID(ctx, 2)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	err = repo.DeleteEmployee(ctx, 2, 1)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	resetData()
+}
+
+func TestFindEmployeesPolicyScope(t *testing.T) {
+	ctx := tenantCtx
+	conn.Model(&entity.Employee{}).Where("id = ?", 1).Update("email", "lead@corp.id")
+	conn.Model(&entity.Employee{}).Where("id = ?", 2).Updates(map[string]interface{}{"email": "report@corp.id", "manager_email": "lead@corp.id"})
+	defer resetData()
+	scope := func(email string) model.PolicyScope {
+		return model.PolicyScope{
+			SQL:  "(coalesce(email = ?, false) or coalesce(nullif(manager_email, '') = ?, false))",
+			Args: []interface{}{email, email},
+		}
+	}
+
+	employees, err := repo.FindEmployees(ctx, model.GetEmployeesFilter{PolicyScope: scope("lead@corp.id")})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(employees))
+	employees, err = repo.FindEmployees(ctx, model.GetEmployeesFilter{PolicyScope: scope("report@corp.id")})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(employees))
+	assert.Equal(t, uint(2), employees[0].ID)
+	count, err := repo.CountEmployees(ctx, model.GetEmployeesFilter{PolicyScope: scope("other@corp.id")})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	req := model.SearchEmployeesRequest{Query: "employee", PageRequest: model.PageRequest{PageNum: 1, PageSize: 10}, PolicyScope: scope("report@corp.id")}
+	hits, total, err := repo.SearchEmployees(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, uint(2), hits[0].ID)
+}
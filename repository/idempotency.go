@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"backend_test/entity"
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// ReserveIdempotencyKey records a key in progress, it returns
+// gorm.ErrRecordNotFound when the key of the owner exists and has not
+// expired, unless it is in progress and its lease is over
+func (d DefaultRepository) ReserveIdempotencyKey(ctx context.Context, key *entity.IdempotencyKey, now time.Time) error {
+	return rowAffected(d.conn(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "owner"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"fingerprint", "status_code", "response_header", "response_body",
+			"created_at", "expires_at", "locked_until"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "idempotency_keys.expires_at <= ? or (idempotency_keys.status_code is null and idempotency_keys.locked_until <= ?)",
+				Vars: []interface{}{now, now}},
+		}},
+	}).Create(key))
+}
+
+func (d DefaultRepository) FindIdempotencyKey(ctx context.Context, owner, key string) (entity.IdempotencyKey, error) {
+	found := entity.IdempotencyKey{}
+	err := d.conn(ctx).Where("owner=? and key=?", owner, key).First(&found).Error
+	return found, err
+}
+
+// CompleteIdempotencyKey stores the response of a key in progress with
+// the fingerprint of the request, a key taken over by another request is
+// left to it
+func (d DefaultRepository) CompleteIdempotencyKey(ctx context.Context, key *entity.IdempotencyKey) error {
+	return rowAffected(d.conn(ctx).Model(&entity.IdempotencyKey{}).
+		Where("owner=? and key=? and fingerprint=? and status_code is null", key.Owner, key.Key, key.Fingerprint).
+		Updates(map[string]interface{}{
+			"status_code":     key.StatusCode,
+			"response_header": key.ResponseHeader,
+			"response_body":   key.ResponseBody,
+			"locked_until":    nil,
+		}))
+}
+
+// DeleteIdempotencyKey releases a key in progress with the fingerprint of
+// the request so that the request can be retried
+func (d DefaultRepository) DeleteIdempotencyKey(ctx context.Context, owner, key, fingerprint string) error {
+	return d.conn(ctx).Where("owner=? and key=? and fingerprint=? and status_code is null", owner, key, fingerprint).
+		Delete(&entity.IdempotencyKey{}).Error
+}
+
+// PurgeIdempotencyKeys deletes the expired keys and returns their number
+func (d DefaultRepository) PurgeIdempotencyKeys(ctx context.Context, now time.Time) (int, error) {
+	result := d.conn(ctx).Where("expires_at <= ?", now).Delete(&entity.IdempotencyKey{})
+	return int(result.RowsAffected), result.Error
+}
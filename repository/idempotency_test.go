@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"backend_test/entity"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func resetIdempotencyKeys() {
+	conn.Where("1=1").Delete(&entity.IdempotencyKey{})
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	resetIdempotencyKeys()
+	defer resetIdempotencyKeys()
+	ctx := context.Background()
+	now := time.Now()
+
+	key := func(fingerprint string, expiresAt time.Time) *entity.IdempotencyKey {
+		lockedUntil := now.Add(time.Minute)
+		return &entity.IdempotencyKey{Owner: "user:1", Key: "key-1", Fingerprint: fingerprint, CreatedAt: now, ExpiresAt: expiresAt,
+			LockedUntil: &lockedUntil}
+	}
+	assert.Nil(t, repo.ReserveIdempotencyKey(ctx, key("fingerprint-1", now.Add(time.Hour)), now))
+	assert.ErrorIs(t, repo.ReserveIdempotencyKey(ctx, key("fingerprint-2", now.Add(time.Hour)), now), gorm.ErrRecordNotFound)
+	// another owner has its own keys
+	other := key("fingerprint-1", now.Add(time.Hour))
+	other.Owner = "client:payroll-key"
+	assert.Nil(t, repo.ReserveIdempotencyKey(ctx, other, now))
+
+	found, err := repo.FindIdempotencyKey(ctx, "user:1", "key-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "fingerprint-1", found.Fingerprint)
+	assert.False(t, found.IsCompleted())
+
+	status := http.StatusCreated
+	completed := key("fingerprint-1", now.Add(time.Hour))
+	completed.StatusCode, completed.ResponseHeader, completed.ResponseBody = &status, `{"Content-Type":["application/json"]}`, []byte(`{"id":1}`)
+	// only the request holding the key completes it
+	otherRequest := *completed
+	otherRequest.Fingerprint = "fingerprint-2"
+	assert.ErrorIs(t, repo.CompleteIdempotencyKey(ctx, &otherRequest), gorm.ErrRecordNotFound)
+	assert.Nil(t, repo.CompleteIdempotencyKey(ctx, completed))
+	assert.ErrorIs(t, repo.CompleteIdempotencyKey(ctx, completed), gorm.ErrRecordNotFound)
+	// a completed key is kept, past its lease too
+	assert.Nil(t, repo.DeleteIdempotencyKey(ctx, "user:1", "key-1", "fingerprint-1"))
+	assert.ErrorIs(t, repo.ReserveIdempotencyKey(ctx, key("fingerprint-2", now.Add(time.Hour)), now.Add(2*time.Minute)), gorm.ErrRecordNotFound)
+	found, err = repo.FindIdempotencyKey(ctx, "user:1", "key-1")
+	assert.Nil(t, err)
+	assert.True(t, found.IsCompleted())
+	assert.Nil(t, found.LockedUntil)
+	assert.Equal(t, http.StatusCreated, *found.StatusCode)
+	assert.Equal(t, `{"id":1}`, string(found.ResponseBody))
+
+	// reusable once expired
+	assert.Nil(t, repo.ReserveIdempotencyKey(ctx, key("fingerprint-2", now.Add(2*time.Hour)), now.Add(time.Hour)))
+	found, err = repo.FindIdempotencyKey(ctx, "user:1", "key-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "fingerprint-2", found.Fingerprint)
+	assert.False(t, found.IsCompleted())
+	assert.Empty(t, found.ResponseBody)
+
+	assert.Nil(t, repo.DeleteIdempotencyKey(ctx, "user:1", "key-1", "fingerprint-2"))
+	_, err = repo.FindIdempotencyKey(ctx, "user:1", "key-1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestIdempotencyKeyLease(t *testing.T) {
+	resetIdempotencyKeys()
+	defer resetIdempotencyKeys()
+	ctx := context.Background()
+	now := time.Now()
+
+	key := func(fingerprint string, reservedAt time.Time) *entity.IdempotencyKey {
+		lockedUntil := reservedAt.Add(time.Minute)
+		return &entity.IdempotencyKey{Owner: "user:1", Key: "key-1", Fingerprint: fingerprint, CreatedAt: reservedAt,
+			ExpiresAt: reservedAt.Add(time.Hour), LockedUntil: &lockedUntil}
+	}
+	assert.Nil(t, repo.ReserveIdempotencyKey(ctx, key("fingerprint-1", now), now))
+	// held while the lease lasts
+	assert.ErrorIs(t, repo.ReserveIdempotencyKey(ctx, key("fingerprint-1", now.Add(30*time.Second)), now.Add(30*time.Second)),
+		gorm.ErrRecordNotFound)
+
+	// taken over by a retry once the lease is over
+	retry := key("fingerprint-2", now.Add(2*time.Minute))
+	assert.Nil(t, repo.ReserveIdempotencyKey(ctx, retry, now.Add(2*time.Minute)))
+	found, err := repo.FindIdempotencyKey(ctx, "user:1", "key-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "fingerprint-2", found.Fingerprint)
+	assert.True(t, found.LockedUntil.Equal(*retry.LockedUntil))
+
+	// the late request neither releases nor completes the key of the retry
+	assert.Nil(t, repo.DeleteIdempotencyKey(ctx, "user:1", "key-1", "fingerprint-1"))
+	status := http.StatusCreated
+	late := key("fingerprint-1", now)
+	late.StatusCode = &status
+	assert.ErrorIs(t, repo.CompleteIdempotencyKey(ctx, late), gorm.ErrRecordNotFound)
+	found, err = repo.FindIdempotencyKey(ctx, "user:1", "key-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "fingerprint-2", found.Fingerprint)
+	assert.False(t, found.IsCompleted())
+}
+
+func TestPurgeIdempotencyKeys(t *testing.T) {
+	resetIdempotencyKeys()
+	defer resetIdempotencyKeys()
+	ctx := context.Background()
+	now := time.Now()
+
+	expired := &entity.IdempotencyKey{Owner: "user:1", Key: "key-1", Fingerprint: "fingerprint-1", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+	live := &entity.IdempotencyKey{Owner: "user:1", Key: "key-2", Fingerprint: "fingerprint-2", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	assert.Nil(t, repo.ReserveIdempotencyKey(ctx, expired, now))
+	assert.Nil(t, repo.ReserveIdempotencyKey(ctx, live, now))
+
+	purged, err := repo.PurgeIdempotencyKeys(ctx, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = repo.FindIdempotencyKey(ctx, "user:1", "key-1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repo.FindIdempotencyKey(ctx, "user:1", "key-2")
+	assert.Nil(t, err)
+}
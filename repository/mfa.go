@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func whereMfaUser(user model.UserRef) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("issuer=? and user_id=?", user.Issuer, user.ID)
+	}
+}
+
+func (d DefaultRepository) FindMfaEnrolment(ctx context.Context, user model.UserRef) (entity.MfaEnrolment, error) {
+	enrolment := entity.MfaEnrolment{}
+	err := d.conn(ctx).Scopes(whereMfaUser(user)).First(&enrolment).Error
+	return enrolment, err
+}
+
+// SaveMfaEnrolment creates the enrolment or replaces the pending one of the
+// user, its recovery codes and verifications are removed
+func (d DefaultRepository) SaveMfaEnrolment(ctx context.Context, enrolment *entity.MfaEnrolment) error {
+	db := d.conn(ctx)
+	user := model.UserRef{Issuer: enrolment.Issuer, ID: enrolment.UserID}
+	if err := db.Scopes(whereMfaUser(user)).Delete(&entity.MfaEnrolment{}).Error; err != nil {
+		return err
+	}
+	return db.Create(enrolment).Error
+}
+
+func (d DefaultRepository) EnableMfaEnrolment(ctx context.Context, user model.UserRef, at time.Time) error {
+	return rowAffected(d.conn(ctx).Model(&entity.MfaEnrolment{}).
+		Scopes(whereMfaUser(user)).
+		Updates(map[string]interface{}{"enabled_at": at, "updated_at": at}))
+}
+
+// UseMfaStep records the time step of an accepted code, it returns
+// gorm.ErrRecordNotFound when a code of that step or a later one was
+// already accepted
+func (d DefaultRepository) UseMfaStep(ctx context.Context, user model.UserRef, step int64) error {
+	return rowAffected(d.conn(ctx).Model(&entity.MfaEnrolment{}).
+		Scopes(whereMfaUser(user)).
+		Where("last_used_step < ?", step).
+		Update("last_used_step", step))
+}
+
+func (d DefaultRepository) DeleteMfaEnrolment(ctx context.Context, user model.UserRef) error {
+	return rowAffected(d.conn(ctx).Scopes(whereMfaUser(user)).Delete(&entity.MfaEnrolment{}))
+}
+
+func (d DefaultRepository) CreateMfaRecoveryCodes(ctx context.Context, codes []entity.MfaRecoveryCode) error {
+	return d.conn(ctx).Create(&codes).Error
+}
+
+// UseMfaRecoveryCode marks the unused code used, it returns
+// gorm.ErrRecordNotFound when the user has no such unused code
+func (d DefaultRepository) UseMfaRecoveryCode(ctx context.Context, user model.UserRef, codeHash string, at time.Time) error {
+	return rowAffected(d.conn(ctx).Model(&entity.MfaRecoveryCode{}).
+		Scopes(whereMfaUser(user)).
+		Where("code_hash=? and used_at is null", codeHash).
+		Update("used_at", at))
+}
+
+func (d DefaultRepository) SaveMfaVerification(ctx context.Context, verification *entity.MfaVerification) error {
+	return d.conn(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(verification).Error
+}
+
+func (d DefaultRepository) IsMfaVerified(ctx context.Context, user model.UserRef, sessionKey string, now time.Time) (bool, error) {
+	var count int64
+	err := d.conn(ctx).Model(&entity.MfaVerification{}).
+		Scopes(whereMfaUser(user)).
+		Where("session_key=? and expires_at > ?", sessionKey, now).
+		Count(&count).Error
+	return count > 0, err
+}
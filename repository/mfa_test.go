@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func resetMfa() {
+	conn.Where("1=1").Delete(&entity.MfaEnrolment{})
+}
+
+func TestMfaEnrolment(t *testing.T) {
+	resetMfa()
+	defer resetMfa()
+	ctx := context.Background()
+	now := time.Now()
+	user := model.UserRef{Issuer: model.LocalIssuer, ID: 7}
+	other := model.UserRef{Issuer: "https://idp.example.com", ID: 7}
+
+	enrolment := entity.MfaEnrolment{Issuer: user.Issuer, UserID: 7, Email: "user@gmail.com", Secret: "SECRET"}
+	assert.Nil(t, repo.SaveMfaEnrolment(ctx, &enrolment))
+	enrolment.Secret = "OTHER"
+	assert.Nil(t, repo.SaveMfaEnrolment(ctx, &enrolment))
+	found, err := repo.FindMfaEnrolment(ctx, user)
+	assert.Nil(t, err)
+	assert.Equal(t, "OTHER", found.Secret)
+	assert.False(t, found.IsEnabled())
+	// the user 7 of another issuer is another user
+	_, err = repo.FindMfaEnrolment(ctx, other)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repo.DeleteMfaEnrolment(ctx, other), gorm.ErrRecordNotFound)
+
+	assert.Nil(t, repo.EnableMfaEnrolment(ctx, user, now))
+	assert.Nil(t, repo.UseMfaStep(ctx, user, 100))
+	assert.ErrorIs(t, repo.UseMfaStep(ctx, user, 100), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repo.UseMfaStep(ctx, user, 99), gorm.ErrRecordNotFound)
+
+	assert.Nil(t, repo.CreateMfaRecoveryCodes(ctx, []entity.MfaRecoveryCode{{Issuer: user.Issuer, UserID: 7, CodeHash: "hash-1"}}))
+	assert.Nil(t, repo.UseMfaRecoveryCode(ctx, user, "hash-1", now))
+	assert.ErrorIs(t, repo.UseMfaRecoveryCode(ctx, user, "hash-1", now), gorm.ErrRecordNotFound)
+
+	assert.Nil(t, repo.SaveMfaVerification(ctx, &entity.MfaVerification{SessionKey: "session-1", Issuer: user.Issuer, UserID: 7, ExpiresAt: now.Add(time.Hour)}))
+	verified, err := repo.IsMfaVerified(ctx, user, "session-1", now)
+	assert.Nil(t, err)
+	assert.True(t, verified)
+	verified, err = repo.IsMfaVerified(ctx, other, "session-1", now)
+	assert.Nil(t, err)
+	assert.False(t, verified)
+	verified, err = repo.IsMfaVerified(ctx, user, "session-1", now.Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.False(t, verified)
+
+	assert.Nil(t, repo.DeleteMfaEnrolment(ctx, user))
+	verified, err = repo.IsMfaVerified(ctx, user, "session-1", now)
+	assert.Nil(t, err)
+	assert.False(t, verified)
+}
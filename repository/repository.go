@@ -5,29 +5,139 @@ import (
 	"backend_test/model"
 	"backend_test/pkg/db"
 	"context"
-	"github.com/labstack/gommon/log"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 	"strings"
+	"time"
 )
 
 type Repository interface {
-	TxBegin() error
-	TxCommit() error
-	TxRollback() error
+	// WithTx runs fn in a database transaction, txRepo runs every query in
+	// that transaction. The transaction is rolled back when fn returns an
+	// error or panics and committed otherwise. Calling WithTx on txRepo
+	// creates a savepoint so only the nested work is rolled back.
+	WithTx(ctx context.Context, fn func(txRepo Repository) error) error
 
 	// Employee
 	FindEmployees(ctx context.Context, filter model.GetEmployeesFilter) ([]entity.Employee, error)
+	FindEmployeesByKeyset(ctx context.Context, filter model.GetEmployeesFilter, keyset model.Keyset, limit int) ([]entity.Employee, error)
 	FindAllEmployees(ctx context.Context, filter model.GetEmployeesFilter) ([]entity.Employee, error)
 	CountEmployees(ctx context.Context, filter model.GetEmployeesFilter) (int, error)
+	SearchEmployees(ctx context.Context, req model.SearchEmployeesRequest) ([]entity.EmployeeSearchHit, int, error)
+	SearchEmployeesFuzzy(ctx context.Context, req model.SearchEmployeesRequest) ([]entity.EmployeeSearchHit, int, error)
 	CreateEmployee(ctx context.Context, merchant *entity.Employee) error
 	FindEmployeeByID(ctx context.Context, id uint) (entity.Employee, error)
-	FindEmployeeByEmail(ctx context.Context, email string) (entity.Employee, error)
+	FindEmployeeByEmail(ctx context.Context, appID int, email string) (entity.Employee, error)
 	UpdateEmployee(ctx context.Context, merchant *entity.Employee) error
-	DeleteEmployee(ctx context.Context, id uint) error
+	DeleteEmployee(ctx context.Context, id uint, version int) error
+	FindDeletedEmployees(ctx context.Context, filter model.GetEmployeesFilter) ([]entity.Employee, error)
+	CountDeletedEmployees(ctx context.Context, filter model.GetEmployeesFilter) (int, error)
+	FindDeletedEmployeeByID(ctx context.Context, id uint) (entity.Employee, error)
+	RestoreEmployee(ctx context.Context, id uint) error
+	PurgeEmployee(ctx context.Context, id uint, version int) error
+	AssignEmployeesWithoutApp(ctx context.Context, appID int) (int, error)
+
+	// Role
+	FindRoles(ctx context.Context) ([]entity.Role, error)
+	FindRoleByID(ctx context.Context, id uint) (entity.Role, error)
+	FindRoleByCode(ctx context.Context, code string) (entity.Role, error)
+	CreateRole(ctx context.Context, role *entity.Role) error
+	UpdateRole(ctx context.Context, role *entity.Role) error
+	DeleteRole(ctx context.Context, id uint) error
+	FindPermissions(ctx context.Context) ([]entity.Permission, error)
+	FindPermissionsByCodes(ctx context.Context, codes []string) ([]entity.Permission, error)
+	FindPermissionByCode(ctx context.Context, code string) (entity.Permission, error)
+	CreatePermission(ctx context.Context, permission *entity.Permission) error
+	DeletePermission(ctx context.Context, id uint) error
+	FindUserRoles(ctx context.Context, user model.UserRef) ([]entity.Role, error)
+	AssignUserRole(ctx context.Context, user model.UserRef, roleID uint) error
+	RevokeUserRole(ctx context.Context, user model.UserRef, roleID uint) error
+	FindUserRoleCodes(ctx context.Context, user model.UserRef) ([]string, error)
+	FindUserPermissionCodes(ctx context.Context, user model.UserRef) ([]string, error)
+
+	// User
+	FindUserByID(ctx context.Context, id uint) (entity.User, error)
+	FindUserByEmail(ctx context.Context, email string) (entity.User, error)
+	CreateUser(ctx context.Context, user *entity.User) error
+	CreateSession(ctx context.Context, session *entity.Session) error
+	FindSessionByID(ctx context.Context, id string) (entity.Session, error)
+	RevokeSession(ctx context.Context, id string, at time.Time) error
+	CreateRefreshToken(ctx context.Context, token *entity.RefreshToken) error
+	FindRefreshTokenByHash(ctx context.Context, hash string) (entity.RefreshToken, error)
+	UseRefreshToken(ctx context.Context, id uint, at time.Time) error
+	DenyToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti, sessionID string) (bool, error)
+	RevokeUserSessions(ctx context.Context, userID uint, at time.Time) error
+	UpdateUserPassword(ctx context.Context, id uint, passwordHash string) error
+	VerifyUserEmail(ctx context.Context, id uint, at time.Time) error
+	CreateUserToken(ctx context.Context, token *entity.UserToken) error
+	DeleteUserTokens(ctx context.Context, userID uint, purpose string) error
+	FindUserTokenByHash(ctx context.Context, purpose, hash string) (entity.UserToken, error)
+	UseUserToken(ctx context.Context, id uint, at time.Time) error
+
+	// MFA
+	FindMfaEnrolment(ctx context.Context, user model.UserRef) (entity.MfaEnrolment, error)
+	SaveMfaEnrolment(ctx context.Context, enrolment *entity.MfaEnrolment) error
+	EnableMfaEnrolment(ctx context.Context, user model.UserRef, at time.Time) error
+	UseMfaStep(ctx context.Context, user model.UserRef, step int64) error
+	DeleteMfaEnrolment(ctx context.Context, user model.UserRef) error
+	CreateMfaRecoveryCodes(ctx context.Context, codes []entity.MfaRecoveryCode) error
+	UseMfaRecoveryCode(ctx context.Context, user model.UserRef, codeHash string, at time.Time) error
+	SaveMfaVerification(ctx context.Context, verification *entity.MfaVerification) error
+	IsMfaVerified(ctx context.Context, user model.UserRef, sessionKey string, now time.Time) (bool, error)
+
+	// API client
+	FindClients(ctx context.Context) ([]entity.ApiClient, error)
+	FindClientByID(ctx context.Context, id uint) (entity.ApiClient, error)
+	FindClientByKey(ctx context.Context, clientKey string) (entity.ApiClient, error)
+	CreateClient(ctx context.Context, client *entity.ApiClient) error
+	DisableClient(ctx context.Context, id uint, at time.Time) error
+	UpdateClientPublicKey(ctx context.Context, id uint, publicKey string, at time.Time) error
+	UpdateClientResponseMode(ctx context.Context, id uint, mode string, at time.Time) error
+	UpdateClientResponseSigning(ctx context.Context, id uint, signing string, at time.Time) error
+	UseClientNonce(ctx context.Context, nonce *entity.ClientNonce, now time.Time) error
+	PurgeClientNonces(ctx context.Context, now time.Time) (int, error)
+
+	// Idempotency
+	ReserveIdempotencyKey(ctx context.Context, key *entity.IdempotencyKey, now time.Time) error
+	FindIdempotencyKey(ctx context.Context, owner, key string) (entity.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, key *entity.IdempotencyKey) error
+	DeleteIdempotencyKey(ctx context.Context, owner, key, fingerprint string) error
+	PurgeIdempotencyKeys(ctx context.Context, now time.Time) (int, error)
+}
+
+// ErrVersionConflict is returned when a versioned write matched no row
+// because the record was modified or deleted since it was loaded
+var ErrVersionConflict = errors.New("record was modified or deleted by another request")
+
+// ErrEmployeeEmailTaken is returned when a write would give two active
+// employees of an app the same email, which a concurrent request can do
+// between the email check of the service and the write
+var ErrEmployeeEmailTaken = errors.New("email is already used by another active employee of the app")
+
+const (
+	// employeeEmailKey is the unique index of the active employee emails
+	employeeEmailKey = "employees_app_id_lower_email_active_key"
+	// uniqueViolation is the SQLSTATE of a unique constraint violation
+	uniqueViolation = "23505"
+)
+
+// employeeEmailTaken turns a violation of employeeEmailKey into
+// ErrEmployeeEmailTaken
+func employeeEmailTaken(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == employeeEmailKey {
+		return fmt.Errorf("%w: %v", ErrEmployeeEmailTaken, err)
+	}
+	return err
 }
 
 type DefaultRepository struct {
 	handler *db.Handler
+	// tx is set on the repository handed to a WithTx callback
+	tx *gorm.DB
 }
 
 func Default(handler *db.Handler) *DefaultRepository {
@@ -36,24 +146,19 @@ func Default(handler *db.Handler) *DefaultRepository {
 	}
 }
 
-func (d DefaultRepository) TxBegin() error {
-	log.Debug("Start db transaction")
-	d.handler.Tx = d.handler.DB.Begin()
-	return d.handler.Tx.Error
+func (d DefaultRepository) WithTx(ctx context.Context, fn func(txRepo Repository) error) error {
+	return d.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(DefaultRepository{handler: d.handler, tx: tx})
+	})
 }
 
-func (d DefaultRepository) TxCommit() error {
-	log.Debug("Commit db transaction")
-	err := d.handler.Tx.Commit().Error
-	d.handler.Tx = d.handler.DB
-	return err
-}
-
-func (d DefaultRepository) TxRollback() error {
-	log.Debug("Rollback db transaction")
-	err := d.handler.Tx.Rollback().Error
-	d.handler.Tx = d.handler.DB
-	return err
+// conn returns the connection the queries of ctx run on, the transaction
+// of a WithTx callback or the shared connection pool
+func (d DefaultRepository) conn(ctx context.Context) *gorm.DB {
+	if d.tx != nil {
+		return d.tx.WithContext(ctx)
+	}
+	return d.handler.DB.WithContext(ctx)
 }
 
 func paginate(pageNum, pageSize int) func(db *gorm.DB) *gorm.DB {
@@ -69,6 +174,28 @@ func paginate(pageNum, pageSize int) func(db *gorm.DB) *gorm.DB {
 	}
 }
 
+// rowAffected turns a statement that matched no row into gorm.ErrRecordNotFound
+func rowAffected(db *gorm.DB) error {
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// versioned turns a versioned write that matched no row into ErrVersionConflict
+func versioned(db *gorm.DB) error {
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
 func withAlias(column, alias string) string {
 	if alias == "" {
 		return column
@@ -88,6 +215,13 @@ func withPercentBefore(val string) string {
 	return "%" + val
 }
 
+// escapeLike escapes the LIKE wildcards so the value is matched literally
+func escapeLike(val string) string {
+	return likeEscaper.Replace(val)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 func getSortDir(sortDir string) string {
 	if strings.ToLower(sortDir) == "asc" {
 		return strings.ToLower(sortDir)
@@ -2,10 +2,17 @@ package repository
 
 import (
 	"backend_test/entity"
+	"backend_test/model"
 	"backend_test/pkg/config"
 	"backend_test/pkg/db"
+	"backend_test/pkg/util/contextutil"
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -21,6 +28,11 @@ type InitialData struct {
 	persons []entity.Employee
 }
 
+// testAppID is the tenant of the initial data, tenantCtx is scoped to it
+const testAppID = 1
+
+var tenantCtx = contextutil.WithTenantScope(context.Background(), model.TenantScope{AppIDs: []int{testAppID}})
+
 var (
 	conn        *gorm.DB
 	repo        Repository
@@ -33,8 +45,10 @@ func getInitialData() InitialData {
 	for i := 0; i < 2; i++ {
 		data.persons = append(data.persons, entity.Employee{
 			ID:        uint(i) + 1,
+			AppID:     testAppID,
 			FirstName: fmt.Sprintf("First Employee %d", i+1),
 			LastName:  fmt.Sprintf("Last %d", i+1),
+			Email:     fmt.Sprintf("employee%d@email.com", i+1),
 			CreatedAt: now.Add(time.Duration(i) * time.Hour),
 			UpdatedAt: now.Add(time.Duration(i) * time.Hour),
 		})
@@ -44,7 +58,7 @@ func getInitialData() InitialData {
 }
 
 func resetData() {
-	conn.Where("1=1").Delete(&entity.Employee{})
+	conn.Unscoped().Where("1=1").Delete(&entity.Employee{})
 	insertData()
 }
 
@@ -52,12 +66,22 @@ func insertData() {
 	conn.Create(initialData.persons)
 }
 
+// migrateDatabase runs every up migration in order, like the app does at
+// startup, so the tests see the production schema with its constraints
 func migrateDatabase() {
-	err := conn.AutoMigrate(
-		&entity.Employee{},
-	)
+	files, err := filepath.Glob("../migrations/*.up.sql")
 	if err != nil {
-		log.Fatal("Auto migrate error: ", err)
+		log.Fatal("List migrations error: ", err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		sql, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatal("Read migration error: ", err)
+		}
+		if err := conn.Exec(string(sql)).Error; err != nil {
+			log.Fatal("Run migration ", file, " error: ", err)
+		}
 	}
 	insertData()
 }
@@ -121,3 +145,119 @@ func TestWithPercentBefore(t *testing.T) {
 	val := "1"
 	assert.Equal(t, "%1", withPercentBefore(val))
 }
+
+// countAllEmployees counts the employees including the soft deleted ones,
+// the new rows get explicit ids as the initial data bypasses the sequence
+func countAllEmployees(t *testing.T) int64 {
+	var count int64
+	assert.Nil(t, conn.Unscoped().Model(&entity.Employee{}).Count(&count).Error)
+	return count
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := tenantCtx
+	errRollback := errors.New("rollback")
+	testCases := []struct {
+		Name          string
+		Fn            func(txRepo Repository) error
+		ExpectedError error
+		ExpectedCount int64
+	}{
+		{
+			Name: "Commit",
+			Fn: func(txRepo Repository) error {
+				return txRepo.CreateEmployee(ctx, &entity.Employee{AppID: testAppID, ID: 11, FirstName: "Tx", Email: "commit@email.com"})
+			},
+			ExpectedCount: 3,
+		},
+		{
+			Name: "RollbackOnError",
+			Fn: func(txRepo Repository) error {
+				if err := txRepo.CreateEmployee(ctx, &entity.Employee{AppID: testAppID, ID: 12, FirstName: "Tx", Email: "error@email.com"}); err != nil {
+					return err
+				}
+				return errRollback
+			},
+			ExpectedError: errRollback,
+			ExpectedCount: 2,
+		},
+		{
+			Name: "NestedSavepoint",
+			Fn: func(txRepo Repository) error {
+				if err := txRepo.CreateEmployee(ctx, &entity.Employee{AppID: testAppID, ID: 13, FirstName: "Outer", Email: "outer@email.com"}); err != nil {
+					return err
+				}
+				err := txRepo.WithTx(ctx, func(nestedRepo Repository) error {
+					if err := nestedRepo.CreateEmployee(ctx, &entity.Employee{AppID: testAppID, ID: 14, FirstName: "Inner", Email: "inner@email.com"}); err != nil {
+						return err
+					}
+					return errRollback
+				})
+				if !errors.Is(err, errRollback) {
+					return fmt.Errorf("unexpected nested error: %w", err)
+				}
+				return nil
+			},
+			ExpectedCount: 3,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := repo.WithTx(ctx, tc.Fn)
+			assert.ErrorIs(t, err, tc.ExpectedError)
+			assert.Equal(t, tc.ExpectedCount, countAllEmployees(t))
+			resetData()
+		})
+	}
+}
+
+func TestWithTxRollbackOnPanic(t *testing.T) {
+	ctx := tenantCtx
+	assert.Panics(t, func() {
+		_ = repo.WithTx(ctx, func(txRepo Repository) error {
+			if err := txRepo.CreateEmployee(ctx, &entity.Employee{AppID: testAppID, ID: 15, FirstName: "Tx", Email: "panic@email.com"}); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	})
+	assert.Equal(t, int64(2), countAllEmployees(t))
+	resetData()
+}
+
+// TestWithTxConcurrent runs with -race to check that concurrent
+// transactions neither share state nor see each other's rollbacks
+func TestWithTxConcurrent(t *testing.T) {
+	ctx := tenantCtx
+	const workers = 20
+	errRollback := errors.New("rollback")
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := repo.WithTx(ctx, func(txRepo Repository) error {
+				employee := entity.Employee{AppID: testAppID, ID: uint(100 + i), FirstName: "Concurrent", Email: fmt.Sprintf("concurrent%d@email.com", i)}
+				if err := txRepo.CreateEmployee(ctx, &employee); err != nil {
+					return err
+				}
+				// a read in the transaction sees its own write
+				if _, err := txRepo.FindEmployeeByID(ctx, employee.ID); err != nil {
+					return err
+				}
+				if i%2 == 1 {
+					return errRollback
+				}
+				return nil
+			})
+			if i%2 == 1 {
+				assert.ErrorIs(t, err, errRollback)
+			} else {
+				assert.Nil(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int64(2+workers/2), countAllEmployees(t))
+	resetData()
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func preloadPermissions(db *gorm.DB) *gorm.DB {
+	return db.Preload("Permissions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("code asc")
+	})
+}
+
+func (d DefaultRepository) FindRoles(ctx context.Context) ([]entity.Role, error) {
+	roles := []entity.Role{}
+	err := d.conn(ctx).Scopes(preloadPermissions).Order("code asc").Find(&roles).Error
+	return roles, err
+}
+
+func (d DefaultRepository) FindRoleByID(ctx context.Context, id uint) (entity.Role, error) {
+	role := entity.Role{}
+	err := d.conn(ctx).Scopes(preloadPermissions).Where("id=?", id).First(&role).Error
+	return role, err
+}
+
+func (d DefaultRepository) FindRoleByCode(ctx context.Context, code string) (entity.Role, error) {
+	role := entity.Role{}
+	err := d.conn(ctx).Scopes(preloadPermissions).Where("code=?", code).First(&role).Error
+	return role, err
+}
+
+func (d DefaultRepository) CreateRole(ctx context.Context, role *entity.Role) error {
+	return d.conn(ctx).Omit("Permissions.*").Create(role).Error
+}
+
+// UpdateRole saves the role name and replaces its permissions
+func (d DefaultRepository) UpdateRole(ctx context.Context, role *entity.Role) error {
+	db := d.conn(ctx)
+	err := rowAffected(db.Model(role).Select("name", "updated_at").Updates(role))
+	if err != nil {
+		return err
+	}
+	return db.Model(role).Association("Permissions").Replace(role.Permissions)
+}
+
+func (d DefaultRepository) DeleteRole(ctx context.Context, id uint) error {
+	return rowAffected(d.conn(ctx).Delete(&entity.Role{}, id))
+}
+
+func (d DefaultRepository) FindPermissions(ctx context.Context) ([]entity.Permission, error) {
+	permissions := []entity.Permission{}
+	err := d.conn(ctx).Order("code asc").Find(&permissions).Error
+	return permissions, err
+}
+
+func (d DefaultRepository) FindPermissionsByCodes(ctx context.Context, codes []string) ([]entity.Permission, error) {
+	permissions := []entity.Permission{}
+	if len(codes) == 0 {
+		return permissions, nil
+	}
+	err := d.conn(ctx).Where("code in ?", codes).Order("code asc").Find(&permissions).Error
+	return permissions, err
+}
+
+func (d DefaultRepository) FindPermissionByCode(ctx context.Context, code string) (entity.Permission, error) {
+	permission := entity.Permission{}
+	err := d.conn(ctx).Where("code=?", code).First(&permission).Error
+	return permission, err
+}
+
+func (d DefaultRepository) CreatePermission(ctx context.Context, permission *entity.Permission) error {
+	return d.conn(ctx).Create(permission).Error
+}
+
+func (d DefaultRepository) DeletePermission(ctx context.Context, id uint) error {
+	return rowAffected(d.conn(ctx).Delete(&entity.Permission{}, id))
+}
+
+func (d DefaultRepository) FindUserRoles(ctx context.Context, user model.UserRef) ([]entity.Role, error) {
+	roles := []entity.Role{}
+	err := d.conn(ctx).Scopes(preloadPermissions).
+		Joins("join user_roles ur on ur.role_id = roles.id").
+		Where("ur.issuer=? and ur.user_id=?", user.Issuer, user.ID).
+		Order("roles.code asc").
+		Find(&roles).Error
+	return roles, err
+}
+
+// AssignUserRole is idempotent, assigning a role twice is not an error
+func (d DefaultRepository) AssignUserRole(ctx context.Context, user model.UserRef, roleID uint) error {
+	return d.conn(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entity.UserRole{Issuer: user.Issuer, UserID: user.ID, RoleID: roleID}).Error
+}
+
+func (d DefaultRepository) RevokeUserRole(ctx context.Context, user model.UserRef, roleID uint) error {
+	return rowAffected(d.conn(ctx).Where("issuer=? and user_id=? and role_id=?", user.Issuer, user.ID, roleID).Delete(&entity.UserRole{}))
+}
+
+// FindUserRoleCodes returns the codes of the roles assigned to the user
+func (d DefaultRepository) FindUserRoleCodes(ctx context.Context, user model.UserRef) ([]string, error) {
+	codes := []string{}
+	err := d.conn(ctx).Model(&entity.Role{}).
+		Joins("join user_roles ur on ur.role_id = roles.id").
+		Where("ur.issuer=? and ur.user_id=?", user.Issuer, user.ID).
+		Order("roles.code asc").
+		Pluck("roles.code", &codes).Error
+	return codes, err
+}
+
+// FindUserPermissionCodes returns the codes of the permissions granted to
+// the user by all of its roles
+func (d DefaultRepository) FindUserPermissionCodes(ctx context.Context, user model.UserRef) ([]string, error) {
+	codes := []string{}
+	err := d.conn(ctx).Model(&entity.Permission{}).
+		Distinct("permissions.code").
+		Joins("join role_permissions rp on rp.permission_id = permissions.id").
+		Joins("join user_roles ur on ur.role_id = rp.role_id").
+		Where("ur.issuer=? and ur.user_id=?", user.Issuer, user.ID).
+		Order("permissions.code asc").
+		Pluck("permissions.code", &codes).Error
+	return codes, err
+}
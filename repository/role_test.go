@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func resetRoles() {
+	conn.Where("1=1").Delete(&entity.UserRole{})
+	conn.Where("1=1").Delete(&entity.Role{})
+	conn.Where("1=1").Delete(&entity.Permission{})
+}
+
+func createPermissions(t *testing.T, codes ...string) []entity.Permission {
+	permissions := []entity.Permission{}
+	for _, code := range codes {
+		p := entity.Permission{Code: code}
+		assert.Nil(t, repo.CreatePermission(context.Background(), &p))
+		permissions = append(permissions, p)
+	}
+	return permissions
+}
+
+func TestRoleCRUD(t *testing.T) {
+	resetRoles()
+	defer resetRoles()
+	ctx := context.Background()
+	permissions := createPermissions(t, "read_employees", "update_employees", "delete_employees")
+
+	role := entity.Role{Code: "hr_staff", Name: "HR Staff", Permissions: permissions[:2]}
+	assert.Nil(t, repo.CreateRole(ctx, &role))
+	found, err := repo.FindRoleByCode(ctx, "hr_staff")
+	assert.Nil(t, err)
+	assert.Equal(t, role.ID, found.ID)
+	assert.Len(t, found.Permissions, 2)
+
+	found.Name = "HR"
+	found.Permissions = permissions[2:]
+	assert.Nil(t, repo.UpdateRole(ctx, &found))
+	found, err = repo.FindRoleByID(ctx, role.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "HR", found.Name)
+	if assert.Len(t, found.Permissions, 1) {
+		assert.Equal(t, "delete_employees", found.Permissions[0].Code)
+	}
+
+	assert.Nil(t, repo.DeleteRole(ctx, role.ID))
+	_, err = repo.FindRoleByID(ctx, role.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repo.DeleteRole(ctx, role.ID), gorm.ErrRecordNotFound)
+}
+
+func TestUserPermissionCodes(t *testing.T) {
+	resetRoles()
+	defer resetRoles()
+	ctx := context.Background()
+	permissions := createPermissions(t, "read_employees", "update_employees", "delete_employees")
+	staff := entity.Role{Code: "hr_staff", Name: "HR Staff", Permissions: permissions[:2]}
+	assert.Nil(t, repo.CreateRole(ctx, &staff))
+	admin := entity.Role{Code: "hr_admin", Name: "HR Admin", Permissions: permissions[1:]}
+	assert.Nil(t, repo.CreateRole(ctx, &admin))
+
+	local := model.UserRef{Issuer: model.LocalIssuer, ID: 7}
+	assert.Nil(t, repo.AssignUserRole(ctx, local, staff.ID))
+	// assigning twice is not an error
+	assert.Nil(t, repo.AssignUserRole(ctx, local, staff.ID))
+	assert.Nil(t, repo.AssignUserRole(ctx, local, admin.ID))
+	assert.Nil(t, repo.AssignUserRole(ctx, model.UserRef{ID: 8}, staff.ID))
+
+	codes, err := repo.FindUserPermissionCodes(ctx, local)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"delete_employees", "read_employees", "update_employees"}, codes)
+	roles, err := repo.FindUserRoles(ctx, local)
+	assert.Nil(t, err)
+	assert.Len(t, roles, 2)
+	codes, err = repo.FindUserRoleCodes(ctx, local)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hr_admin", "hr_staff"}, codes)
+
+	// the user 7 of another issuer is another user
+	external := model.UserRef{Issuer: "https://idp.example.com", ID: 7}
+	codes, err = repo.FindUserPermissionCodes(ctx, external)
+	assert.Nil(t, err)
+	assert.Empty(t, codes)
+	codes, err = repo.FindUserRoleCodes(ctx, external)
+	assert.Nil(t, err)
+	assert.Empty(t, codes)
+	assert.ErrorIs(t, repo.RevokeUserRole(ctx, external, admin.ID), gorm.ErrRecordNotFound)
+
+	assert.Nil(t, repo.RevokeUserRole(ctx, local, admin.ID))
+	assert.ErrorIs(t, repo.RevokeUserRole(ctx, local, admin.ID), gorm.ErrRecordNotFound)
+	codes, err = repo.FindUserPermissionCodes(ctx, local)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"read_employees", "update_employees"}, codes)
+
+	// deleting a permission removes it from the roles
+	assert.Nil(t, repo.DeletePermission(ctx, permissions[0].ID))
+	codes, err = repo.FindUserPermissionCodes(ctx, model.UserRef{ID: 8})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"update_employees"}, codes)
+}
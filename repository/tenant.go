@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"backend_test/pkg/util/contextutil"
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrMissingTenantScope is returned by the employee queries of a context
+// without tenant scope, so a forgotten scope never exposes every tenant
+var ErrMissingTenantScope = errors.New("no tenant scope in context")
+
+// ErrOutsideTenantScope is returned when writing an employee of an app
+// outside of the tenant scope
+var ErrOutsideTenantScope = errors.New("app is outside of the tenant scope")
+
+// whereTenant limits the query to the apps of the tenant scope of ctx
+func whereTenant(ctx context.Context, alias string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		scope, ok := contextutil.GetTenantScope(ctx)
+		if !ok {
+			_ = db.AddError(ErrMissingTenantScope)
+			return db
+		}
+		if scope.All {
+			return db
+		}
+		if len(scope.AppIDs) == 0 {
+			return db.Where("false")
+		}
+		return db.Where(withAlias("app_id", alias)+" in ?", scope.AppIDs)
+	}
+}
+
+// employees returns the connection of ctx scoped to its tenants
+func (d DefaultRepository) employees(ctx context.Context) *gorm.DB {
+	return d.conn(ctx).Scopes(whereTenant(ctx, ""))
+}
+
+func checkTenant(ctx context.Context, appID int) error {
+	scope, ok := contextutil.GetTenantScope(ctx)
+	if !ok {
+		return ErrMissingTenantScope
+	}
+	if !scope.Contains(appID) {
+		return fmt.Errorf("%w: %d", ErrOutsideTenantScope, appID)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"backend_test/pkg/util/contextutil"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// TestTenantIsolation checks that a tenant can neither read nor change the
+// employees of another tenant
+func TestTenantIsolation(t *testing.T) {
+	resetData()
+	defer resetData()
+	otherCtx := contextutil.WithTenantScope(context.Background(), model.TenantScope{AppIDs: []int{2}})
+	other := entity.Employee{ID: 21, AppID: 2, FirstName: "Other", LastName: "Tenant", Email: "other@email.com"}
+	assert.Nil(t, repo.CreateEmployee(otherCtx, &other))
+
+	employees, err := repo.FindEmployees(otherCtx, model.GetEmployeesFilter{})
+	assert.Nil(t, err)
+	if assert.Len(t, employees, 1) {
+		assert.Equal(t, other.ID, employees[0].ID)
+	}
+	count, err := repo.CountEmployees(tenantCtx, model.GetEmployeesFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	all, err := repo.FindAllEmployees(tenantCtx, model.GetEmployeesFilter{})
+	assert.Nil(t, err)
+	assert.Len(t, all, 2)
+	keyset, err := repo.FindEmployeesByKeyset(otherCtx, model.GetEmployeesFilter{}, model.Keyset{}, 10)
+	assert.Nil(t, err)
+	assert.Len(t, keyset, 1)
+	_, total, err := repo.SearchEmployeesFuzzy(tenantCtx, model.SearchEmployeesRequest{Query: "Other Tenant"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, total)
+
+	// tenant 2 cannot read, change or delete the employee 1 of tenant 1
+	_, err = repo.FindEmployeeByID(otherCtx, 1)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repo.FindEmployeeByEmail(otherCtx, testAppID, initialData.persons[0].Email)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repo.FindEmployeeByEmail(otherCtx, 2, other.Email)
+	assert.Nil(t, err)
+	stolen := initialData.persons[0]
+	stolen.Version = 1
+	stolen.FirstName = "Stolen"
+	assert.ErrorIs(t, repo.UpdateEmployee(otherCtx, &stolen), ErrVersionConflict)
+	assert.ErrorIs(t, repo.DeleteEmployee(otherCtx, 1, 1), ErrVersionConflict)
+	assert.ErrorIs(t, repo.PurgeEmployee(otherCtx, 1, 1), ErrVersionConflict)
+	// nor an employee it deleted
+	assert.Nil(t, repo.DeleteEmployee(tenantCtx, 2, 1))
+	_, err = repo.FindDeletedEmployeeByID(otherCtx, 2)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	deleted, err := repo.FindDeletedEmployees(otherCtx, model.GetEmployeesFilter{})
+	assert.Nil(t, err)
+	assert.Len(t, deleted, 0)
+	assert.ErrorIs(t, repo.RestoreEmployee(otherCtx, 2), gorm.ErrRecordNotFound)
+	employee, err := repo.FindEmployeeByID(tenantCtx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, initialData.persons[0].FirstName, employee.FirstName)
+
+	// an update cannot move an employee to another tenant
+	employee.AppID = 2
+	assert.Nil(t, repo.UpdateEmployee(tenantCtx, &employee))
+	_, err = repo.FindEmployeeByID(tenantCtx, 1)
+	assert.Nil(t, err)
+
+	// nor can tenant 2 insert into tenant 1
+	err = repo.CreateEmployee(otherCtx, &entity.Employee{ID: 22, AppID: testAppID, FirstName: "Other", Email: "new@email.com"})
+	assert.ErrorIs(t, err, ErrOutsideTenantScope)
+}
+
+func TestTenantEmailPerApp(t *testing.T) {
+	resetData()
+	defer resetData()
+	otherCtx := contextutil.WithTenantScope(context.Background(), model.TenantScope{AppIDs: []int{2}})
+	email := "shared@email.com"
+	assert.Nil(t, repo.CreateEmployee(tenantCtx, &entity.Employee{ID: 23, AppID: testAppID, FirstName: "Same", Email: email}))
+	assert.Nil(t, repo.CreateEmployee(otherCtx, &entity.Employee{ID: 24, AppID: 2, FirstName: "Same", Email: email}))
+	found, err := repo.FindEmployeeByEmail(otherCtx, 2, email)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(24), found.ID)
+	found, err = repo.FindEmployeeByEmail(tenantCtx, testAppID, email)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(23), found.ID)
+	found, err = repo.FindEmployeeByEmail(tenantCtx, testAppID, "Shared@Email.com")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(23), found.ID)
+}
+
+func TestTenantScopeRequired(t *testing.T) {
+	_, err := repo.FindEmployees(context.Background(), model.GetEmployeesFilter{})
+	assert.ErrorIs(t, err, ErrMissingTenantScope)
+	_, err = repo.FindEmployeeByID(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrMissingTenantScope)
+	err = repo.CreateEmployee(context.Background(), &entity.Employee{ID: 25, AppID: testAppID, Email: "none@email.com"})
+	assert.ErrorIs(t, err, ErrMissingTenantScope)
+
+	// a superadmin crossing tenants sees every tenant
+	allCtx := contextutil.WithTenantScope(context.Background(), model.TenantScope{All: true})
+	count, err := repo.CountEmployees(allCtx, model.GetEmployeesFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"backend_test/entity"
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+func (d DefaultRepository) FindUserByID(ctx context.Context, id uint) (entity.User, error) {
+	user := entity.User{}
+	err := d.conn(ctx).Where("id=?", id).First(&user).Error
+	return user, err
+}
+
+// FindUserByEmail matches the email case insensitively
+func (d DefaultRepository) FindUserByEmail(ctx context.Context, email string) (entity.User, error) {
+	user := entity.User{}
+	err := d.conn(ctx).Where("lower(email)=lower(?)", email).First(&user).Error
+	return user, err
+}
+
+func (d DefaultRepository) CreateUser(ctx context.Context, user *entity.User) error {
+	return d.conn(ctx).Create(user).Error
+}
+
+func (d DefaultRepository) CreateSession(ctx context.Context, session *entity.Session) error {
+	return d.conn(ctx).Create(session).Error
+}
+
+func (d DefaultRepository) FindSessionByID(ctx context.Context, id string) (entity.Session, error) {
+	session := entity.Session{}
+	err := d.conn(ctx).Where("id=?", id).First(&session).Error
+	return session, err
+}
+
+// RevokeSession is idempotent, revoking a revoked session keeps its first
+// revocation time
+func (d DefaultRepository) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	return d.conn(ctx).Model(&entity.Session{}).
+		Where("id=? and revoked_at is null", id).
+		Update("revoked_at", at).Error
+}
+
+func (d DefaultRepository) CreateRefreshToken(ctx context.Context, token *entity.RefreshToken) error {
+	return d.conn(ctx).Create(token).Error
+}
+
+func (d DefaultRepository) FindRefreshTokenByHash(ctx context.Context, hash string) (entity.RefreshToken, error) {
+	token := entity.RefreshToken{}
+	err := d.conn(ctx).Where("token_hash=?", hash).First(&token).Error
+	return token, err
+}
+
+// UseRefreshToken marks the token used, it returns gorm.ErrRecordNotFound
+// when the token was already used so that two concurrent refreshes cannot
+// both succeed
+func (d DefaultRepository) UseRefreshToken(ctx context.Context, id uint, at time.Time) error {
+	return rowAffected(d.conn(ctx).Model(&entity.RefreshToken{}).
+		Where("id=? and used_at is null", id).
+		Update("used_at", at))
+}
+
+// DenyToken is idempotent, denying a token twice is not an error
+func (d DefaultRepository) DenyToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return d.conn(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entity.DeniedToken{Jti: jti, ExpiresAt: expiresAt}).Error
+}
+
+// IsTokenRevoked reports whether the access token jti was denied or its
+// session revoked
+func (d DefaultRepository) IsTokenRevoked(ctx context.Context, jti, sessionID string) (bool, error) {
+	revoked := false
+	err := d.conn(ctx).Raw(`select exists(select 1 from denied_tokens where jti = ?)
+		or exists(select 1 from sessions where id = ? and revoked_at is not null)`, jti, sessionID).
+		Scan(&revoked).Error
+	return revoked, err
+}
+
+// RevokeUserSessions revokes every active session of the user
+func (d DefaultRepository) RevokeUserSessions(ctx context.Context, userID uint, at time.Time) error {
+	return d.conn(ctx).Model(&entity.Session{}).
+		Where("user_id=? and revoked_at is null", userID).
+		Update("revoked_at", at).Error
+}
+
+func (d DefaultRepository) UpdateUserPassword(ctx context.Context, id uint, passwordHash string) error {
+	return rowAffected(d.conn(ctx).Model(&entity.User{}).
+		Where("id=?", id).
+		Updates(map[string]interface{}{"password_hash": passwordHash, "updated_at": time.Now()}))
+}
+
+func (d DefaultRepository) VerifyUserEmail(ctx context.Context, id uint, at time.Time) error {
+	return rowAffected(d.conn(ctx).Model(&entity.User{}).
+		Where("id=?", id).
+		Updates(map[string]interface{}{"email_verified_at": at, "updated_at": at}))
+}
+
+func (d DefaultRepository) CreateUserToken(ctx context.Context, token *entity.UserToken) error {
+	return d.conn(ctx).Create(token).Error
+}
+
+// DeleteUserTokens deletes the unused tokens of the user for the purpose,
+// issuing a new token invalidates the previous ones
+func (d DefaultRepository) DeleteUserTokens(ctx context.Context, userID uint, purpose string) error {
+	return d.conn(ctx).Where("user_id=? and purpose=? and used_at is null", userID, purpose).
+		Delete(&entity.UserToken{}).Error
+}
+
+func (d DefaultRepository) FindUserTokenByHash(ctx context.Context, purpose, hash string) (entity.UserToken, error) {
+	token := entity.UserToken{}
+	err := d.conn(ctx).Where("purpose=? and token_hash=?", purpose, hash).First(&token).Error
+	return token, err
+}
+
+// UseUserToken marks the token used, it returns gorm.ErrRecordNotFound when
+// it was already used
+func (d DefaultRepository) UseUserToken(ctx context.Context, id uint, at time.Time) error {
+	return rowAffected(d.conn(ctx).Model(&entity.UserToken{}).
+		Where("id=? and used_at is null", id).
+		Update("used_at", at))
+}
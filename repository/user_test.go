@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"backend_test/entity"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func resetUsers() {
+	conn.Where("1=1").Delete(&entity.DeniedToken{})
+	conn.Where("1=1").Delete(&entity.User{})
+}
+
+func TestRefreshTokenSingleUse(t *testing.T) {
+	resetUsers()
+	defer resetUsers()
+	ctx := context.Background()
+	now := time.Now()
+
+	user := entity.User{Email: "User@gmail.com", Name: "User", PasswordHash: "hash"}
+	assert.Nil(t, repo.CreateUser(ctx, &user))
+	found, err := repo.FindUserByEmail(ctx, "user@GMAIL.com")
+	assert.Nil(t, err)
+	assert.Equal(t, user.ID, found.ID)
+
+	session := entity.Session{ID: "session-1", UserID: user.ID, ExpiresAt: now.Add(time.Hour)}
+	assert.Nil(t, repo.CreateSession(ctx, &session))
+	token := entity.RefreshToken{SessionID: session.ID, TokenHash: "token-hash", ExpiresAt: session.ExpiresAt}
+	assert.Nil(t, repo.CreateRefreshToken(ctx, &token))
+
+	found2, err := repo.FindRefreshTokenByHash(ctx, "token-hash")
+	assert.Nil(t, err)
+	assert.Equal(t, token.ID, found2.ID)
+	assert.Nil(t, repo.UseRefreshToken(ctx, token.ID, now))
+	assert.ErrorIs(t, repo.UseRefreshToken(ctx, token.ID, now), gorm.ErrRecordNotFound)
+}
+
+func TestIsTokenRevoked(t *testing.T) {
+	resetUsers()
+	defer resetUsers()
+	ctx := context.Background()
+	now := time.Now()
+
+	user := entity.User{Email: "user@gmail.com", Name: "User", PasswordHash: "hash"}
+	assert.Nil(t, repo.CreateUser(ctx, &user))
+	session := entity.Session{ID: "session-1", UserID: user.ID, ExpiresAt: now.Add(time.Hour)}
+	assert.Nil(t, repo.CreateSession(ctx, &session))
+
+	revoked, err := repo.IsTokenRevoked(ctx, "jti-1", session.ID)
+	assert.Nil(t, err)
+	assert.False(t, revoked)
+
+	assert.Nil(t, repo.DenyToken(ctx, "jti-1", now.Add(time.Minute)))
+	assert.Nil(t, repo.DenyToken(ctx, "jti-1", now.Add(time.Minute)))
+	revoked, err = repo.IsTokenRevoked(ctx, "jti-1", session.ID)
+	assert.Nil(t, err)
+	assert.True(t, revoked)
+
+	assert.Nil(t, repo.RevokeSession(ctx, session.ID, now))
+	revoked, err = repo.IsTokenRevoked(ctx, "jti-2", session.ID)
+	assert.Nil(t, err)
+	assert.True(t, revoked)
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"backend_test/repository"
+	"context"
+	"errors"
+	"time"
+
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/jwtauth"
+	"backend_test/pkg/password"
+	"backend_test/pkg/util/tokenutil"
+
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, the session is revoked")
+	ErrRefreshTokenExpired = errors.New("refresh token is expired")
+	ErrSessionRevoked      = errors.New("session is revoked")
+	ErrNotLocalToken       = errors.New("access token was not issued by /auth/login")
+)
+
+// bcryptDummyPasswordHash is the dummy password hash when the configured
+// algorithm cannot hash one
+const bcryptDummyPasswordHash = "$2a$10$tOgVCcHcxT2qbwuGpoRFDenEfm/Qo5y5/Pu2bNBRxkRZI78DTwy7a"
+
+type AuthService interface {
+	Login(ctx context.Context, req model.LoginRequest) (*model.TokenResult, pkgerror.CustomError)
+	Refresh(ctx context.Context, req model.RefreshTokenRequest) (*model.TokenResult, pkgerror.CustomError)
+	Logout(ctx context.Context, principal model.Principal, req model.LogoutRequest) pkgerror.CustomError
+	IsTokenRevoked(ctx context.Context, claims *model.JwtClaims) (bool, pkgerror.CustomError)
+}
+
+type AuthOptions struct {
+	// RefreshTokenTTL is the lifetime of a session, refreshing does not
+	// extend it
+	RefreshTokenTTL time.Duration
+	// AppID and AppCode are the app of the roles in the issued tokens
+	AppID   int
+	AppCode string
+	// RequireVerifiedEmail denies the login of the users that did not
+	// verify their email
+	RequireVerifiedEmail bool
+	// PasswordHash is the algorithm of the new password hashes
+	PasswordHash string
+}
+
+type AuthServiceImpl struct {
+	repo   repository.Repository
+	signer *jwtauth.Signer
+	opts   AuthOptions
+	// dummyPasswordHash is verified when the email of a login is unknown,
+	// it is hashed with the algorithm of the new hashes so that the
+	// response time does not tell whether the user exists
+	dummyPasswordHash string
+	now               func() time.Time
+}
+
+func NewAuthService(repo repository.Repository, signer *jwtauth.Signer, opts AuthOptions) *AuthServiceImpl {
+	dummy, err := password.Hash("dummy-password", opts.PasswordHash)
+	if err != nil {
+		log.Error("Hash dummy password error: ", err)
+		dummy = bcryptDummyPasswordHash
+	}
+	return &AuthServiceImpl{
+		repo:              repo,
+		signer:            signer,
+		opts:              opts,
+		dummyPasswordHash: dummy,
+		now:               time.Now,
+	}
+}
+
+func (s *AuthServiceImpl) Login(ctx context.Context, req model.LoginRequest) (*model.TokenResult, pkgerror.CustomError) {
+	user, err := s.repo.FindUserByEmail(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			password.Verify(s.dummyPasswordHash, req.Password)
+			return nil, pkgerror.ErrInvalidCredentials
+		}
+		log.Error("Find user by email error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	ok, err := password.Verify(user.PasswordHash, req.Password)
+	if err != nil {
+		log.Error("Verify password error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	if !ok {
+		return nil, pkgerror.ErrInvalidCredentials
+	}
+	if s.opts.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return nil, pkgerror.ErrEmailNotVerified
+	}
+
+	sessionID, err := tokenutil.Generate(16)
+	if err != nil {
+		log.Error("Generate session ID error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	session := entity.Session{ID: sessionID, UserID: user.ID, ExpiresAt: s.now().Add(s.opts.RefreshTokenTTL)}
+	var refreshToken string
+	err = s.repo.WithTx(ctx, func(txRepo repository.Repository) error {
+		if err := txRepo.CreateSession(ctx, &session); err != nil {
+			return err
+		}
+		refreshToken, err = s.createRefreshToken(ctx, txRepo, session)
+		return err
+	})
+	if err != nil {
+		log.Error("Create session error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	return s.tokenResult(ctx, user, session.ID, refreshToken)
+}
+
+func (s *AuthServiceImpl) Refresh(ctx context.Context, req model.RefreshTokenRequest) (*model.TokenResult, pkgerror.CustomError) {
+	token, err := s.repo.FindRefreshTokenByHash(ctx, tokenutil.Hash(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerror.ErrInvalidRefreshToken.WithError(err)
+		}
+		log.Error("Find refresh token error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	if token.UsedAt != nil {
+		return nil, s.revokeReusedSession(ctx, token.SessionID)
+	}
+	now := s.now()
+	if now.After(token.ExpiresAt) {
+		return nil, pkgerror.ErrInvalidRefreshToken.WithError(ErrRefreshTokenExpired)
+	}
+	session, err := s.repo.FindSessionByID(ctx, token.SessionID)
+	if err != nil {
+		log.Error("Find session by ID error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	if session.RevokedAt != nil {
+		return nil, pkgerror.ErrInvalidRefreshToken.WithError(ErrSessionRevoked)
+	}
+	user, err := s.repo.FindUserByID(ctx, session.UserID)
+	if err != nil {
+		log.Error("Find user by ID error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerror.ErrInvalidRefreshToken.WithError(err)
+		}
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+
+	var refreshToken string
+	err = s.repo.WithTx(ctx, func(txRepo repository.Repository) error {
+		if err := txRepo.UseRefreshToken(ctx, token.ID, now); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// used by a concurrent refresh since it was loaded
+				return ErrRefreshTokenReused
+			}
+			return err
+		}
+		refreshToken, err = s.createRefreshToken(ctx, txRepo, session)
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		return nil, s.revokeReusedSession(ctx, session.ID)
+	}
+	if err != nil {
+		log.Error("Rotate refresh token error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	return s.tokenResult(ctx, user, session.ID, refreshToken)
+}
+
+// revokeReusedSession revokes the session of a refresh token presented a
+// second time, it may have been stolen so neither its legitimate user nor
+// the attacker can keep using the session
+func (s *AuthServiceImpl) revokeReusedSession(ctx context.Context, sessionID string) pkgerror.CustomError {
+	log.Warnf("Refresh token reuse detected, revoking session %s", sessionID)
+	if err := s.repo.RevokeSession(ctx, sessionID, s.now()); err != nil {
+		log.Error("Revoke session error: ", err)
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	return pkgerror.ErrInvalidRefreshToken.WithError(ErrRefreshTokenReused)
+}
+
+func (s *AuthServiceImpl) Logout(ctx context.Context, principal model.Principal, req model.LogoutRequest) pkgerror.CustomError {
+	if req.TokenID == "" || req.SessionID == "" {
+		return pkgerror.ErrInvalidParams.WithError(ErrNotLocalToken)
+	}
+	err := s.repo.WithTx(ctx, func(txRepo repository.Repository) error {
+		if err := txRepo.RevokeSession(ctx, req.SessionID, s.now()); err != nil {
+			return err
+		}
+		return txRepo.DenyToken(ctx, req.TokenID, req.ExpiresAt)
+	})
+	if err != nil {
+		log.Error("Revoke session error: ", err)
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	return pkgerror.NoError
+}
+
+// IsTokenRevoked reports whether an access token issued by Login or Refresh
+// was revoked or the API client of a B2B token was disabled, the tokens of
+// other issuers are never revoked
+func (s *AuthServiceImpl) IsTokenRevoked(ctx context.Context, claims *model.JwtClaims) (bool, pkgerror.CustomError) {
+	if claims.IsClient() {
+		client, err := s.repo.FindClientByKey(ctx, claims.Client)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return true, pkgerror.NoError
+			}
+			log.Error("Find client by key error: ", err)
+			return false, pkgerror.ErrSystemError.WithError(err)
+		}
+		return client.IsDisabled(), pkgerror.NoError
+	}
+	if claims.Jti == "" && claims.Sid == "" {
+		return false, pkgerror.NoError
+	}
+	revoked, err := s.repo.IsTokenRevoked(ctx, claims.Jti, claims.Sid)
+	if err != nil {
+		log.Error("Check token revocation error: ", err)
+		return false, pkgerror.ErrSystemError.WithError(err)
+	}
+	return revoked, pkgerror.NoError
+}
+
+// createRefreshToken stores the hash of a new refresh token of the session
+// and returns the token
+func (s *AuthServiceImpl) createRefreshToken(ctx context.Context, repo repository.Repository, session entity.Session) (string, error) {
+	token, err := tokenutil.Generate(32)
+	if err != nil {
+		return "", err
+	}
+	err = repo.CreateRefreshToken(ctx, &entity.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: tokenutil.Hash(token),
+		ExpiresAt: session.ExpiresAt,
+	})
+	return token, err
+}
+
+// tokenResult issues an access token of the session carrying the roles
+// currently assigned to the user
+func (s *AuthServiceImpl) tokenResult(ctx context.Context, user entity.User, sessionID, refreshToken string) (*model.TokenResult, pkgerror.CustomError) {
+	roles, err := s.repo.FindUserRoles(ctx, model.UserRef{Issuer: model.LocalIssuer, ID: int(user.ID)})
+	if err != nil {
+		log.Error("Find user roles error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	jti, err := tokenutil.Generate(16)
+	if err != nil {
+		log.Error("Generate token ID error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	claims := model.JwtClaims{
+		User: model.JwtUser{
+			ID:         int(user.ID),
+			Name:       user.Name,
+			Email:      user.Email,
+			Superadmin: user.Superadmin,
+			Roles:      []model.JwtRole{},
+		},
+		Jti: jti,
+		Sid: sessionID,
+	}
+	for _, role := range roles {
+		jwtRole := model.JwtRole{
+			ID:          int(role.ID),
+			Name:        role.Name,
+			Code:        role.Code,
+			Permissions: []string{},
+			App:         model.JwtApp{ID: s.opts.AppID, Code: s.opts.AppCode},
+		}
+		for _, p := range role.Permissions {
+			jwtRole.Permissions = append(jwtRole.Permissions, s.opts.AppCode+":"+p.Code)
+		}
+		claims.User.Roles = append(claims.User.Roles, jwtRole)
+	}
+	accessToken, err := s.signer.Sign(&claims)
+	if err != nil {
+		log.Error("Sign access token error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	return &model.TokenResult{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.signer.TTL().Seconds()),
+		RefreshToken: refreshToken,
+	}, pkgerror.NoError
+}
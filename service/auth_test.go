@@ -0,0 +1,292 @@
+package service
+
+import (
+	"backend_test/entity"
+	mocks "backend_test/mocks/repository"
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/jwtauth"
+	"backend_test/pkg/password"
+	"backend_test/pkg/util/tokenutil"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+var (
+	testSecret          = []byte("jwt-secret-test")
+	testPasswordHash, _ = password.Hash("s3cret-password", password.Bcrypt)
+	testUser            = entity.User{ID: 7, Email: "user@gmail.com", Name: "User", PasswordHash: testPasswordHash}
+	testNow             = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+)
+
+func newTestAuthService(r *mocks.Repository) *AuthServiceImpl {
+	s := NewAuthService(r, jwtauth.NewSigner(testSecret, "backend_testing_t", 15*time.Minute), AuthOptions{
+		RefreshTokenTTL: 24 * time.Hour,
+		AppID:           1,
+		AppCode:         "backend_testing_t",
+	})
+	s.now = func() time.Time { return testNow }
+	return s
+}
+
+func TestDummyPasswordHash(t *testing.T) {
+	// an unknown email costs the hash of the configured algorithm
+	for algorithm, prefix := range map[string]string{"": "$2a$", password.Bcrypt: "$2a$", password.Argon2id: "$argon2id$"} {
+		s := NewAuthService(new(mocks.Repository), jwtauth.NewSigner(testSecret, "backend_testing_t", 15*time.Minute), AuthOptions{PasswordHash: algorithm})
+		assert.True(t, strings.HasPrefix(s.dummyPasswordHash, prefix), algorithm)
+	}
+	s := NewAuthService(new(mocks.Repository), jwtauth.NewSigner(testSecret, "backend_testing_t", 15*time.Minute), AuthOptions{PasswordHash: "md5"})
+	assert.Equal(t, bcryptDummyPasswordHash, s.dummyPasswordHash)
+}
+
+func verifyAccessToken(t *testing.T, token string) *model.JwtClaims {
+	claims, err := jwtauth.NewVerifier(jwtauth.Keys{HmacSecret: testSecret}, "backend_testing_t", 0).
+		Verify(context.Background(), token)
+	assert.Nil(t, err)
+	return claims
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	roles := []entity.Role{{ID: 3, Code: "hr_staff", Name: "HR Staff", Permissions: []entity.Permission{{Code: "read_employees"}}}}
+	testCases := []struct {
+		Name                 string
+		InitRepo             func(r *mocks.Repository)
+		RequireVerifiedEmail bool
+		Request              model.LoginRequest
+		ExpectedError        pkgerror.CustomError
+	}{
+		{
+			Name: "UnknownEmail",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindUserByEmail", ctx, "other@gmail.com").Return(entity.User{}, gorm.ErrRecordNotFound)
+			},
+			Request:       model.LoginRequest{Email: "other@gmail.com", Password: "s3cret-password"},
+			ExpectedError: pkgerror.ErrInvalidCredentials,
+		},
+		{
+			Name: "WrongPassword",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindUserByEmail", ctx, "user@gmail.com").Return(testUser, nil)
+			},
+			Request:       model.LoginRequest{Email: "user@gmail.com", Password: "wrong-password"},
+			ExpectedError: pkgerror.ErrInvalidCredentials,
+		},
+		{
+			Name: "EmailNotVerified",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindUserByEmail", ctx, "user@gmail.com").Return(testUser, nil)
+			},
+			RequireVerifiedEmail: true,
+			Request:              model.LoginRequest{Email: "user@gmail.com", Password: "s3cret-password"},
+			ExpectedError:        pkgerror.ErrEmailNotVerified,
+		},
+		{
+			Name: "Success",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindUserByEmail", ctx, "user@gmail.com").Return(testUser, nil)
+				onWithTx(r)
+				r.On("CreateSession", ctx, mock.MatchedBy(func(s *entity.Session) bool {
+					return s.UserID == 7 && s.ExpiresAt.Equal(testNow.Add(24*time.Hour))
+				})).Return(nil)
+				r.On("CreateRefreshToken", ctx, mock.Anything).Return(nil)
+				r.On("FindUserRoles", ctx, model.UserRef{Issuer: model.LocalIssuer, ID: 7}).Return(roles, nil)
+			},
+			Request:       model.LoginRequest{Email: "user@gmail.com", Password: "s3cret-password"},
+			ExpectedError: pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			tc.InitRepo(r)
+			s := newTestAuthService(r)
+			s.opts.RequireVerifiedEmail = tc.RequireVerifiedEmail
+			result, err := s.Login(ctx, tc.Request)
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			if tc.ExpectedError.IsNoError() {
+				assert.Equal(t, "Bearer", result.TokenType)
+				assert.Equal(t, 900, result.ExpiresIn)
+				assert.NotEmpty(t, result.RefreshToken)
+				claims := verifyAccessToken(t, result.AccessToken)
+				assert.Equal(t, 7, claims.User.ID)
+				assert.NotEmpty(t, claims.Jti)
+				assert.NotEmpty(t, claims.Sid)
+				if assert.Len(t, claims.User.Roles, 1) {
+					assert.Equal(t, "hr_staff", claims.User.Roles[0].Code)
+					assert.Equal(t, 1, claims.User.Roles[0].App.ID)
+					assert.Equal(t, []string{"backend_testing_t:read_employees"}, claims.User.Roles[0].Permissions)
+				}
+			}
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	usedAt := testNow.Add(-time.Minute)
+	session := entity.Session{ID: "session-1", UserID: 7, ExpiresAt: testNow.Add(time.Hour)}
+	token := entity.RefreshToken{ID: 5, SessionID: "session-1", TokenHash: tokenutil.Hash("refresh-1"), ExpiresAt: session.ExpiresAt}
+	testCases := []struct {
+		Name          string
+		InitRepo      func(r *mocks.Repository)
+		ExpectedError pkgerror.CustomError
+	}{
+		{
+			Name: "Unknown",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindRefreshTokenByHash", ctx, token.TokenHash).Return(entity.RefreshToken{}, gorm.ErrRecordNotFound)
+			},
+			ExpectedError: pkgerror.ErrInvalidRefreshToken,
+		},
+		{
+			Name: "ReuseRevokesSession",
+			InitRepo: func(r *mocks.Repository) {
+				used := token
+				used.UsedAt = &usedAt
+				r.On("FindRefreshTokenByHash", ctx, token.TokenHash).Return(used, nil)
+				r.On("RevokeSession", ctx, "session-1", testNow).Return(nil)
+			},
+			ExpectedError: pkgerror.ErrInvalidRefreshToken,
+		},
+		{
+			Name: "Expired",
+			InitRepo: func(r *mocks.Repository) {
+				expired := token
+				expired.ExpiresAt = testNow.Add(-time.Second)
+				r.On("FindRefreshTokenByHash", ctx, token.TokenHash).Return(expired, nil)
+			},
+			ExpectedError: pkgerror.ErrInvalidRefreshToken,
+		},
+		{
+			Name: "SessionRevoked",
+			InitRepo: func(r *mocks.Repository) {
+				revoked := session
+				revoked.RevokedAt = &usedAt
+				r.On("FindRefreshTokenByHash", ctx, token.TokenHash).Return(token, nil)
+				r.On("FindSessionByID", ctx, "session-1").Return(revoked, nil)
+			},
+			ExpectedError: pkgerror.ErrInvalidRefreshToken,
+		},
+		{
+			Name: "ConcurrentReuse",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindRefreshTokenByHash", ctx, token.TokenHash).Return(token, nil)
+				r.On("FindSessionByID", ctx, "session-1").Return(session, nil)
+				r.On("FindUserByID", ctx, uint(7)).Return(testUser, nil)
+				onWithTx(r)
+				r.On("UseRefreshToken", ctx, uint(5), testNow).Return(gorm.ErrRecordNotFound)
+				r.On("RevokeSession", ctx, "session-1", testNow).Return(nil)
+			},
+			ExpectedError: pkgerror.ErrInvalidRefreshToken,
+		},
+		{
+			Name: "UseError",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindRefreshTokenByHash", ctx, token.TokenHash).Return(token, nil)
+				r.On("FindSessionByID", ctx, "session-1").Return(session, nil)
+				r.On("FindUserByID", ctx, uint(7)).Return(testUser, nil)
+				onWithTx(r)
+				r.On("UseRefreshToken", ctx, uint(5), testNow).Return(errors.New("database error"))
+			},
+			ExpectedError: pkgerror.ErrSystemError,
+		},
+		{
+			Name: "Success",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindRefreshTokenByHash", ctx, token.TokenHash).Return(token, nil)
+				r.On("FindSessionByID", ctx, "session-1").Return(session, nil)
+				r.On("FindUserByID", ctx, uint(7)).Return(testUser, nil)
+				onWithTx(r)
+				r.On("UseRefreshToken", ctx, uint(5), testNow).Return(nil)
+				r.On("CreateRefreshToken", ctx, mock.MatchedBy(func(t *entity.RefreshToken) bool {
+					return t.SessionID == "session-1" && t.ExpiresAt.Equal(session.ExpiresAt) && t.TokenHash != token.TokenHash
+				})).Return(nil)
+				r.On("FindUserRoles", ctx, model.UserRef{Issuer: model.LocalIssuer, ID: 7}).Return([]entity.Role{}, nil)
+			},
+			ExpectedError: pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			tc.InitRepo(r)
+			result, err := newTestAuthService(r).Refresh(ctx, model.RefreshTokenRequest{RefreshToken: "refresh-1"})
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			if tc.ExpectedError.IsNoError() {
+				assert.NotEqual(t, "refresh-1", result.RefreshToken)
+				assert.Equal(t, "session-1", verifyAccessToken(t, result.AccessToken).Sid)
+			}
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+	expiresAt := testNow.Add(10 * time.Minute)
+	testCases := []struct {
+		Name          string
+		InitRepo      func(r *mocks.Repository)
+		Request       model.LogoutRequest
+		ExpectedError pkgerror.CustomError
+	}{
+		{
+			Name:          "ExternalToken",
+			InitRepo:      func(r *mocks.Repository) {},
+			Request:       model.LogoutRequest{ExpiresAt: expiresAt},
+			ExpectedError: pkgerror.ErrInvalidParams,
+		},
+		{
+			Name: "Success",
+			InitRepo: func(r *mocks.Repository) {
+				onWithTx(r)
+				r.On("RevokeSession", ctx, "session-1", testNow).Return(nil)
+				r.On("DenyToken", ctx, "token-1", expiresAt).Return(nil)
+			},
+			Request:       model.LogoutRequest{TokenID: "token-1", SessionID: "session-1", ExpiresAt: expiresAt},
+			ExpectedError: pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			tc.InitRepo(r)
+			err := newTestAuthService(r).Logout(ctx, createPrincipal(false), tc.Request)
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestIsTokenRevoked(t *testing.T) {
+	ctx := context.Background()
+	r := new(mocks.Repository)
+	r.On("IsTokenRevoked", ctx, "token-1", "session-1").Return(true, nil)
+	r.On("FindClientByKey", ctx, "payroll-key").Return(entity.ApiClient{DisabledAt: &testNow}, nil)
+	r.On("FindClientByKey", ctx, "removed-key").Return(entity.ApiClient{}, gorm.ErrRecordNotFound)
+	s := newTestAuthService(r)
+
+	revoked, err := s.IsTokenRevoked(ctx, &model.JwtClaims{})
+	assert.True(t, err.IsNoError())
+	assert.False(t, revoked)
+
+	revoked, err = s.IsTokenRevoked(ctx, &model.JwtClaims{Jti: "token-1", Sid: "session-1"})
+	assert.True(t, err.IsNoError())
+	assert.True(t, revoked)
+
+	for _, client := range []string{"payroll-key", "removed-key"} {
+		revoked, err = s.IsTokenRevoked(ctx, &model.JwtClaims{Jti: "b2b-token", Client: client, Typ: model.TokenTypeB2B})
+		assert.True(t, err.IsNoError())
+		assert.True(t, revoked, client)
+	}
+	r.AssertExpectations(t)
+}
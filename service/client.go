@@ -0,0 +1,417 @@
+package service
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"backend_test/repository"
+	"context"
+	"crypto/hmac"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/jwtauth"
+	"backend_test/pkg/responsesign"
+	"backend_test/pkg/util/copyutil"
+	"backend_test/pkg/util/encodeutil"
+	"backend_test/pkg/util/tokenutil"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSignatureMismatch = errors.New("signature does not match the request")
+	ErrClockSkew         = errors.New("timestamp is out of the allowed clock skew")
+	ErrClientDisabled    = errors.New("client is disabled")
+	ErrNoPublicKey       = errors.New("client has no registered public key")
+	ErrSignatureReused   = errors.New("signature was already used")
+	ErrNoSigningKey      = errors.New("no rsa key is configured to sign the responses")
+)
+
+type ClientService interface {
+	GetClients(ctx context.Context, principal model.Principal) (*[]model.ClientResult, pkgerror.CustomError)
+	CreateClient(ctx context.Context, principal model.Principal, req model.CreateClientRequest) (*model.CreateClientResult, pkgerror.CustomError)
+	DisableClient(ctx context.Context, principal model.Principal, req model.DisableClientRequest) pkgerror.CustomError
+	SetClientPublicKey(ctx context.Context, principal model.Principal, req model.SetClientPublicKeyRequest) pkgerror.CustomError
+	SetClientResponseMode(ctx context.Context, principal model.Principal, req model.SetClientResponseModeRequest) pkgerror.CustomError
+	GetResponseMode(ctx context.Context, clientKey string) (string, pkgerror.CustomError)
+	SetClientResponseSigning(ctx context.Context, principal model.Principal, req model.SetClientResponseSigningRequest) pkgerror.CustomError
+	GetResponseSigning(ctx context.Context, clientKey string) (string, pkgerror.CustomError)
+	SignResponse(ctx context.Context, clientKey string, body []byte) (*model.ResponseSignature, pkgerror.CustomError)
+	IssueB2BToken(ctx context.Context, req model.B2BTokenRequest) (*model.B2BTokenResult, pkgerror.CustomError)
+	AuthenticateClient(ctx context.Context, req model.ClientSignatureRequest) (*model.JwtClaims, pkgerror.CustomError)
+}
+
+type ClientOptions struct {
+	// AppCode prefixes the permissions of the client role in its claims
+	AppCode string
+	// MaxClockSkew is how far X-TIMESTAMP may be from the server clock
+	MaxClockSkew time.Duration
+	// NonceTTL is how long an X-EXTERNAL-ID cannot be reused, at least
+	// twice MaxClockSkew so that a request cannot be replayed while its
+	// timestamp is accepted
+	NonceTTL time.Duration
+	// ResponseSigningKey signs the responses of the clients in rsa
+	// response signing, they are refused when it is nil
+	ResponseSigningKey *rsa.PrivateKey
+}
+
+type ClientServiceImpl struct {
+	repo repository.Repository
+	// signer issues the B2B access tokens, its TTL is their lifetime
+	signer *jwtauth.Signer
+	opts   ClientOptions
+	purge  purgeSchedule
+	now    func() time.Time
+}
+
+func NewClientService(repo repository.Repository, signer *jwtauth.Signer, opts ClientOptions) *ClientServiceImpl {
+	if opts.NonceTTL < 2*opts.MaxClockSkew {
+		opts.NonceTTL = 2 * opts.MaxClockSkew
+	}
+	return &ClientServiceImpl{
+		repo:   repo,
+		signer: signer,
+		opts:   opts,
+		now:    time.Now,
+	}
+}
+
+func newClientResult(client entity.ApiClient) model.ClientResult {
+	result := model.ClientResult{}
+	copyutil.Copy(&client, &result)
+	result.Role = client.Role.Code
+	return result
+}
+
+func (s *ClientServiceImpl) GetClients(ctx context.Context, principal model.Principal) (*[]model.ClientResult, pkgerror.CustomError) {
+	clients, err := s.repo.FindClients(ctx)
+	if err != nil {
+		log.Error("Find clients error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	results := []model.ClientResult{}
+	for _, client := range clients {
+		results = append(results, newClientResult(client))
+	}
+	return &results, pkgerror.NoError
+}
+
+// CreateClient registers a client with a generated key and secret, the
+// secret is only returned here
+func (s *ClientServiceImpl) CreateClient(ctx context.Context, principal model.Principal, req model.CreateClientRequest) (*model.CreateClientResult, pkgerror.CustomError) {
+	if cerr := s.checkResponseSigning(req.ResponseSigning); !cerr.IsNoError() {
+		return nil, cerr
+	}
+	role, err := s.repo.FindRoleByCode(ctx, req.Role)
+	if err != nil {
+		log.Error("Find role by code error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerror.ErrRoleNotFound.WithError(fmt.Errorf("Role `%s` does not exist.", req.Role))
+		}
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	clientKey, err := tokenutil.Generate(16)
+	if err != nil {
+		log.Error("Generate client key error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	secret, err := tokenutil.Generate(32)
+	if err != nil {
+		log.Error("Generate client secret error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	client := entity.ApiClient{ClientKey: clientKey, Name: req.Name, Secret: secret, AppID: req.AppID, RoleID: role.ID, Role: role,
+		ResponseMode: req.ResponseMode, ResponseSigning: req.ResponseSigning}
+	if client.ResponseMode == "" {
+		client.ResponseMode = model.ResponseModeDefault
+	}
+	if client.ResponseSigning == "" {
+		client.ResponseSigning = model.ResponseSigningNone
+	}
+	if err := s.repo.CreateClient(ctx, &client); err != nil {
+		log.Error("Create client error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	return &model.CreateClientResult{ClientResult: newClientResult(client), Secret: secret}, pkgerror.NoError
+}
+
+func (s *ClientServiceImpl) DisableClient(ctx context.Context, principal model.Principal, req model.DisableClientRequest) pkgerror.CustomError {
+	if err := s.repo.DisableClient(ctx, uint(req.ClientID), s.now()); err != nil {
+		log.Error("Disable client error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrClientNotFound.WithError(err)
+		}
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	return pkgerror.NoError
+}
+
+func (s *ClientServiceImpl) SetClientPublicKey(ctx context.Context, principal model.Principal, req model.SetClientPublicKeyRequest) pkgerror.CustomError {
+	if _, err := jwt.ParseRSAPublicKeyFromPEM([]byte(req.PublicKey)); err != nil {
+		return pkgerror.ErrInvalidParams.WithError(fmt.Errorf("public_key must be a PEM encoded RSA public key: %w", err))
+	}
+	if err := s.repo.UpdateClientPublicKey(ctx, uint(req.ClientID), req.PublicKey, s.now()); err != nil {
+		log.Error("Update client public key error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrClientNotFound.WithError(err)
+		}
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	return pkgerror.NoError
+}
+
+func (s *ClientServiceImpl) SetClientResponseMode(ctx context.Context, principal model.Principal, req model.SetClientResponseModeRequest) pkgerror.CustomError {
+	if err := s.repo.UpdateClientResponseMode(ctx, uint(req.ClientID), req.ResponseMode, s.now()); err != nil {
+		log.Error("Update client response mode error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrClientNotFound.WithError(err)
+		}
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	return pkgerror.NoError
+}
+
+// GetResponseMode returns the response mode of a client, the default one
+// for an unknown client
+func (s *ClientServiceImpl) GetResponseMode(ctx context.Context, clientKey string) (string, pkgerror.CustomError) {
+	client, err := s.repo.FindClientByKey(ctx, clientKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.ResponseModeDefault, pkgerror.NoError
+		}
+		log.Error("Find client by key error: ", err)
+		return model.ResponseModeDefault, pkgerror.ErrSystemError.WithError(err)
+	}
+	return client.ResponseMode, pkgerror.NoError
+}
+
+// GetResponseSigning returns how the responses to an API client are signed,
+// none for unknown or disabled clients
+func (s *ClientServiceImpl) GetResponseSigning(ctx context.Context, clientKey string) (string, pkgerror.CustomError) {
+	client, err := s.repo.FindClientByKey(ctx, clientKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.ResponseSigningNone, pkgerror.NoError
+		}
+		log.Error("Find client by key error: ", err)
+		return model.ResponseSigningNone, pkgerror.ErrSystemError.WithError(err)
+	}
+	if client.IsDisabled() {
+		return model.ResponseSigningNone, pkgerror.NoError
+	}
+	return client.ResponseSigning, pkgerror.NoError
+}
+
+func (s *ClientServiceImpl) SetClientResponseSigning(ctx context.Context, principal model.Principal, req model.SetClientResponseSigningRequest) pkgerror.CustomError {
+	if cerr := s.checkResponseSigning(req.ResponseSigning); !cerr.IsNoError() {
+		return cerr
+	}
+	if err := s.repo.UpdateClientResponseSigning(ctx, uint(req.ClientID), req.ResponseSigning, s.now()); err != nil {
+		log.Error("Update client response signing error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrClientNotFound.WithError(err)
+		}
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	return pkgerror.NoError
+}
+
+// checkResponseSigning refuses the rsa response signing without a key
+func (s *ClientServiceImpl) checkResponseSigning(signing string) pkgerror.CustomError {
+	if signing == model.ResponseSigningRsa && s.opts.ResponseSigningKey == nil {
+		return pkgerror.ErrInvalidParams.WithError(ErrNoSigningKey)
+	}
+	return pkgerror.NoError
+}
+
+// SignResponse signs a response body to a client with its response
+// signing, it returns nil for the unknown and disabled clients and the
+// ones that are not signed
+func (s *ClientServiceImpl) SignResponse(ctx context.Context, clientKey string, body []byte) (*model.ResponseSignature, pkgerror.CustomError) {
+	client, err := s.repo.FindClientByKey(ctx, clientKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerror.NoError
+		}
+		log.Error("Find client by key error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	if client.IsDisabled() {
+		return nil, pkgerror.NoError
+	}
+	timestamp := s.now().Format(time.RFC3339)
+	switch client.ResponseSigning {
+	case model.ResponseSigningHmac:
+		return &model.ResponseSignature{Signature: responsesign.SignHmac(client.Secret, body, timestamp), Timestamp: timestamp}, pkgerror.NoError
+	case model.ResponseSigningRsa:
+		if s.opts.ResponseSigningKey == nil {
+			log.Error("Sign response error: ", ErrNoSigningKey)
+			return nil, pkgerror.ErrSystemError.WithError(ErrNoSigningKey)
+		}
+		signature, err := responsesign.SignRsa(s.opts.ResponseSigningKey, body, timestamp)
+		if err != nil {
+			log.Error("Sign response error: ", err)
+			return nil, pkgerror.ErrSystemError.WithError(err)
+		}
+		return &model.ResponseSignature{Signature: signature, Timestamp: timestamp}, pkgerror.NoError
+	}
+	return nil, pkgerror.NoError
+}
+
+// IssueB2BToken verifies the SHA256withRSA signature of client_id|timestamp
+// with the public key of the client and issues an access token carrying
+// its claims. A signature is accepted once.
+func (s *ClientServiceImpl) IssueB2BToken(ctx context.Context, req model.B2BTokenRequest) (*model.B2BTokenResult, pkgerror.CustomError) {
+	if req.ClientKey == "" || req.Timestamp == "" || req.Signature == "" {
+		return nil, pkgerror.ErrInvalidParams.WithError(errors.New("X-CLIENT-KEY, X-TIMESTAMP and X-SIGNATURE are required"))
+	}
+	client, now, cerr := s.findSigningClient(ctx, req.ClientKey, req.Timestamp)
+	if !cerr.IsNoError() {
+		return nil, cerr
+	}
+	if client.PublicKey == "" {
+		return nil, pkgerror.ErrInvalidSignature.WithError(ErrNoPublicKey)
+	}
+	publicKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(client.PublicKey))
+	if err != nil {
+		log.Error("Parse client public key error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	stringToSign := encodeutil.SNAPAsymmetricStringToSign(req.ClientKey, req.Timestamp)
+	if err := encodeutil.RsaSha256Verify(publicKey, []byte(stringToSign), req.Signature); err != nil {
+		return nil, pkgerror.ErrInvalidSignature.WithError(fmt.Errorf("%w: %v", ErrSignatureMismatch, err))
+	}
+	if cerr := s.useNonce(ctx, client, "b2b:"+tokenutil.Hash(req.Signature), now); !cerr.IsNoError() {
+		if cerr.Code == pkgerror.ErrDuplicateExternalID.Code {
+			return nil, pkgerror.ErrInvalidSignature.WithError(ErrSignatureReused)
+		}
+		return nil, cerr
+	}
+	jti, err := tokenutil.Generate(16)
+	if err != nil {
+		log.Error("Generate token ID error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	claims := s.clientClaims(client)
+	claims.Jti = jti
+	accessToken, err := s.signer.Sign(claims)
+	if err != nil {
+		log.Error("Sign B2B access token error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	return &model.B2BTokenResult{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   strconv.Itoa(int(s.signer.TTL().Seconds())),
+	}, pkgerror.NoError
+}
+
+// AuthenticateClient verifies the HMAC-SHA512 signature of a request with
+// the secret of its client and records its external ID, it returns the
+// claims the request is authorized with
+func (s *ClientServiceImpl) AuthenticateClient(ctx context.Context, req model.ClientSignatureRequest) (*model.JwtClaims, pkgerror.CustomError) {
+	if req.ClientKey == "" || req.Timestamp == "" || req.Signature == "" || req.ExternalID == "" {
+		return nil, pkgerror.ErrInvalidParams.WithError(errors.New("X-CLIENT-KEY, X-TIMESTAMP, X-SIGNATURE and X-EXTERNAL-ID are required"))
+	}
+	client, now, cerr := s.findSigningClient(ctx, req.ClientKey, req.Timestamp)
+	if !cerr.IsNoError() {
+		return nil, cerr
+	}
+	stringToSign, err := stringToSign(req)
+	if err != nil {
+		return nil, pkgerror.ErrInvalidParams.WithError(err)
+	}
+	expected := encodeutil.HmacSha512([]byte(client.Secret), []byte(stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(req.Signature)) {
+		return nil, pkgerror.ErrInvalidSignature.WithError(ErrSignatureMismatch)
+	}
+	if cerr := s.useNonce(ctx, client, req.ExternalID, now); !cerr.IsNoError() {
+		return nil, cerr
+	}
+	return s.clientClaims(client), pkgerror.NoError
+}
+
+// findSigningClient loads the enabled client of a signed request whose
+// timestamp is within the clock skew, it returns the current time
+func (s *ClientServiceImpl) findSigningClient(ctx context.Context, clientKey, timestamp string) (entity.ApiClient, time.Time, pkgerror.CustomError) {
+	now := s.now()
+	signedAt, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return entity.ApiClient{}, now, pkgerror.ErrInvalidParams.WithError(fmt.Errorf("X-TIMESTAMP must be in ISO 8601 format: %w", err))
+	}
+	if skew := now.Sub(signedAt); skew > s.opts.MaxClockSkew || skew < -s.opts.MaxClockSkew {
+		return entity.ApiClient{}, now, pkgerror.ErrInvalidSignature.WithError(ErrClockSkew)
+	}
+	client, err := s.repo.FindClientByKey(ctx, clientKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return client, now, pkgerror.ErrInvalidSignature.WithError(fmt.Errorf("unknown client %s", clientKey))
+		}
+		log.Error("Find client by key error: ", err)
+		return client, now, pkgerror.ErrSystemError.WithError(err)
+	}
+	if client.IsDisabled() {
+		return client, now, pkgerror.ErrInvalidSignature.WithError(ErrClientDisabled)
+	}
+	return client, now, pkgerror.NoError
+}
+
+// useNonce records a nonce of the client, a nonce used within NonceTTL is
+// a replay. The expired nonces of every client are purged when due.
+func (s *ClientServiceImpl) useNonce(ctx context.Context, client entity.ApiClient, nonce string, now time.Time) pkgerror.CustomError {
+	if s.purge.due(now) {
+		if _, err := s.repo.PurgeClientNonces(ctx, now); err != nil {
+			log.Error("Purge client nonces error: ", err)
+		}
+	}
+	err := s.repo.UseClientNonce(ctx, &entity.ClientNonce{
+		ClientID:   client.ID,
+		ExternalID: nonce,
+		ExpiresAt:  now.Add(s.opts.NonceTTL),
+	}, now)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrDuplicateExternalID
+		}
+		log.Error("Use client nonce error: ", err)
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	return pkgerror.NoError
+}
+
+// stringToSign returns the signed string of the request, an error when
+// its body is not JSON
+func stringToSign(req model.ClientSignatureRequest) (s string, err error) {
+	defer func() {
+		// encodeutil.MinifyJson panics on a malformed body
+		if r := recover(); r != nil {
+			err = fmt.Errorf("request body is not valid JSON: %v", r)
+		}
+	}()
+	return encodeutil.SNAPStringToSign(req.Method, req.Path, req.Token, req.Body, req.Timestamp), nil
+}
+
+// clientClaims grants the role of the client on its app
+func (s *ClientServiceImpl) clientClaims(client entity.ApiClient) *model.JwtClaims {
+	role := model.JwtRole{
+		ID:          int(client.Role.ID),
+		Name:        client.Role.Name,
+		Code:        client.Role.Code,
+		Permissions: []string{},
+		App:         model.JwtApp{ID: client.AppID},
+	}
+	for _, p := range client.Role.Permissions {
+		role.Permissions = append(role.Permissions, s.opts.AppCode+":"+p.Code)
+	}
+	return &model.JwtClaims{
+		User:   model.JwtUser{Name: client.Name, Roles: []model.JwtRole{role}},
+		Client: client.ClientKey,
+		Typ:    model.TokenTypeB2B,
+	}
+}
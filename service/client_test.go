@@ -0,0 +1,428 @@
+package service
+
+import (
+	"backend_test/entity"
+	mocks "backend_test/mocks/repository"
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/jwtauth"
+	"backend_test/pkg/responsesign"
+	"backend_test/pkg/util/encodeutil"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+var testClient = entity.ApiClient{
+	ID:        2,
+	ClientKey: "payroll-key",
+	Name:      "Payroll",
+	Secret:    "payroll-secret",
+	AppID:     1,
+	RoleID:    3,
+	Role:      entity.Role{ID: 3, Code: "payroll", Name: "Payroll", Permissions: []entity.Permission{{Code: "read_employees"}}},
+}
+
+var testClientKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+func testClientPublicKey(t *testing.T) string {
+	der, err := x509.MarshalPKIXPublicKey(&testClientKey.PublicKey)
+	assert.Nil(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func newTestClientService(r *mocks.Repository) *ClientServiceImpl {
+	signer := jwtauth.NewSigner(testSecret, "backend_testing_t", 15*time.Minute)
+	s := NewClientService(r, signer, ClientOptions{AppCode: "backend_testing_t", MaxClockSkew: 5 * time.Minute, NonceTTL: time.Hour})
+	s.now = func() time.Time { return testNow }
+	// the purges are tested on their own
+	s.purge.next = testNow.Add(purgeInterval)
+	return s
+}
+
+// signedRequest returns a request signed with the secret of testClient
+func signedRequest(timestamp time.Time, body string) model.ClientSignatureRequest {
+	req := model.ClientSignatureRequest{
+		ClientKey:  "payroll-key",
+		Timestamp:  timestamp.Format(time.RFC3339),
+		ExternalID: "external-1",
+		Method:     "POST",
+		Path:       "/employees",
+		Body:       body,
+	}
+	req.Signature = encodeutil.HmacSha512([]byte("payroll-secret"),
+		[]byte(encodeutil.SNAPStringToSign(req.Method, req.Path, req.Token, req.Body, req.Timestamp)))
+	return req
+}
+
+func TestCreateClient(t *testing.T) {
+	ctx := context.Background()
+	r := new(mocks.Repository)
+	r.On("FindRoleByCode", ctx, "unknown").Return(entity.Role{}, gorm.ErrRecordNotFound)
+	r.On("FindRoleByCode", ctx, "payroll").Return(testClient.Role, nil)
+	r.On("CreateClient", ctx, mock.MatchedBy(func(c *entity.ApiClient) bool {
+		return c.Name == "Payroll" && c.AppID == 1 && c.RoleID == 3 && c.ClientKey != "" && c.Secret != "" &&
+			c.ResponseMode == model.ResponseModeDefault && c.ResponseSigning == model.ResponseSigningNone
+	})).Return(nil)
+	s := newTestClientService(r)
+
+	_, err := s.CreateClient(ctx, createPrincipal(true), model.CreateClientRequest{Name: "Payroll", AppID: 1, Role: "unknown"})
+	assert.Equal(t, pkgerror.ErrRoleNotFound.Code, err.Code)
+	_, err = s.CreateClient(ctx, createPrincipal(true), model.CreateClientRequest{Name: "Payroll", AppID: 1, Role: "payroll", ResponseSigning: model.ResponseSigningRsa})
+	assert.Equal(t, pkgerror.ErrInvalidParams.Code, err.Code)
+
+	result, err := s.CreateClient(ctx, createPrincipal(true), model.CreateClientRequest{Name: "Payroll", AppID: 1, Role: "payroll"})
+	assert.True(t, err.IsNoError())
+	assert.Equal(t, "payroll", result.Role)
+	assert.NotEmpty(t, result.ClientKey)
+	assert.NotEmpty(t, result.Secret)
+	r.AssertExpectations(t)
+}
+
+func TestAuthenticateClient(t *testing.T) {
+	ctx := context.Background()
+	body := `{
+		"first_name": "John",
+		"email": "john@gmail.com"
+	}`
+	disabled := testClient
+	disabled.DisabledAt = &testNow
+	tampered := signedRequest(testNow, body)
+	tampered.Body = `{"first_name": "Jane", "email": "john@gmail.com"}`
+	malformed := signedRequest(testNow, body)
+	malformed.Body = "{first_name"
+	missing := signedRequest(testNow, body)
+	missing.ExternalID = ""
+	testCases := []struct {
+		Name          string
+		InitRepo      func(r *mocks.Repository)
+		Request       model.ClientSignatureRequest
+		ExpectedError pkgerror.CustomError
+	}{
+		{
+			Name:          "MissingHeader",
+			InitRepo:      func(r *mocks.Repository) {},
+			Request:       missing,
+			ExpectedError: pkgerror.ErrInvalidParams,
+		},
+		{
+			Name:          "ClockSkew",
+			InitRepo:      func(r *mocks.Repository) {},
+			Request:       signedRequest(testNow.Add(-6*time.Minute), body),
+			ExpectedError: pkgerror.ErrInvalidSignature,
+		},
+		{
+			Name: "UnknownClient",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindClientByKey", ctx, "payroll-key").Return(entity.ApiClient{}, gorm.ErrRecordNotFound)
+			},
+			Request:       signedRequest(testNow, body),
+			ExpectedError: pkgerror.ErrInvalidSignature,
+		},
+		{
+			Name: "DisabledClient",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindClientByKey", ctx, "payroll-key").Return(disabled, nil)
+			},
+			Request:       signedRequest(testNow, body),
+			ExpectedError: pkgerror.ErrInvalidSignature,
+		},
+		{
+			Name: "TamperedBody",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindClientByKey", ctx, "payroll-key").Return(testClient, nil)
+			},
+			Request:       tampered,
+			ExpectedError: pkgerror.ErrInvalidSignature,
+		},
+		{
+			Name: "MalformedBody",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindClientByKey", ctx, "payroll-key").Return(testClient, nil)
+			},
+			Request:       malformed,
+			ExpectedError: pkgerror.ErrInvalidParams,
+		},
+		{
+			Name: "Replayed",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindClientByKey", ctx, "payroll-key").Return(testClient, nil)
+				r.On("UseClientNonce", ctx, mock.Anything, testNow).Return(gorm.ErrRecordNotFound)
+			},
+			Request:       signedRequest(testNow, body),
+			ExpectedError: pkgerror.ErrDuplicateExternalID,
+		},
+		{
+			Name: "NonceError",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindClientByKey", ctx, "payroll-key").Return(testClient, nil)
+				r.On("UseClientNonce", ctx, mock.Anything, testNow).Return(errors.New("database error"))
+			},
+			Request:       signedRequest(testNow, body),
+			ExpectedError: pkgerror.ErrSystemError,
+		},
+		{
+			Name: "Success",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindClientByKey", ctx, "payroll-key").Return(testClient, nil)
+				r.On("UseClientNonce", ctx, &entity.ClientNonce{ClientID: 2, ExternalID: "external-1", ExpiresAt: testNow.Add(time.Hour)}, testNow).Return(nil)
+			},
+			// the clock of the client is 4 minutes ahead
+			Request:       signedRequest(testNow.Add(4*time.Minute).In(time.FixedZone("WIB", 7*3600)), body),
+			ExpectedError: pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			tc.InitRepo(r)
+			claims, err := newTestClientService(r).AuthenticateClient(ctx, tc.Request)
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			if tc.ExpectedError.IsNoError() {
+				assert.Equal(t, "payroll-key", claims.Client)
+				assert.Equal(t, model.TokenTypeB2B, claims.Typ)
+				assert.Equal(t, 0, claims.User.ID)
+				if assert.Len(t, claims.User.Roles, 1) {
+					assert.Equal(t, 1, claims.User.Roles[0].App.ID)
+					assert.Equal(t, []string{"backend_testing_t:read_employees"}, claims.User.Roles[0].Permissions)
+				}
+			}
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPurgeExpiredClientNonces(t *testing.T) {
+	ctx := context.Background()
+	body := `{"employee_id": 1}`
+	r := new(mocks.Repository)
+	r.On("FindClientByKey", ctx, "payroll-key").Return(testClient, nil)
+	r.On("PurgeClientNonces", ctx, testNow).Return(0, errors.New("database error")).Once()
+	r.On("UseClientNonce", ctx, mock.Anything, testNow).Return(nil)
+	s := newTestClientService(r)
+	s.purge.next = time.Time{}
+
+	// a failed purge does not fail the request, the next one is not due yet
+	for i := 0; i < 2; i++ {
+		_, err := s.AuthenticateClient(ctx, signedRequest(testNow, body))
+		assert.True(t, err.IsNoError())
+	}
+	r.AssertExpectations(t)
+}
+
+func TestSetClientPublicKey(t *testing.T) {
+	ctx := context.Background()
+	r := new(mocks.Repository)
+	publicKey := testClientPublicKey(t)
+	r.On("UpdateClientPublicKey", ctx, uint(9), publicKey, testNow).Return(gorm.ErrRecordNotFound)
+	r.On("UpdateClientPublicKey", ctx, uint(2), publicKey, testNow).Return(nil)
+	s := newTestClientService(r)
+
+	err := s.SetClientPublicKey(ctx, createPrincipal(true), model.SetClientPublicKeyRequest{ClientID: 2, PublicKey: "not a key"})
+	assert.Equal(t, pkgerror.ErrInvalidParams.Code, err.Code)
+	err = s.SetClientPublicKey(ctx, createPrincipal(true), model.SetClientPublicKeyRequest{ClientID: 9, PublicKey: publicKey})
+	assert.Equal(t, pkgerror.ErrClientNotFound.Code, err.Code)
+	err = s.SetClientPublicKey(ctx, createPrincipal(true), model.SetClientPublicKeyRequest{ClientID: 2, PublicKey: publicKey})
+	assert.True(t, err.IsNoError())
+	r.AssertExpectations(t)
+}
+
+// b2bTokenRequest returns a token request signed with testClientKey
+func b2bTokenRequest(t *testing.T, timestamp time.Time) model.B2BTokenRequest {
+	req := model.B2BTokenRequest{GrantType: "client_credentials", ClientKey: "payroll-key", Timestamp: timestamp.Format(time.RFC3339)}
+	signature, err := encodeutil.RsaSha256Sign(testClientKey, []byte(encodeutil.SNAPAsymmetricStringToSign(req.ClientKey, req.Timestamp)))
+	assert.Nil(t, err)
+	req.Signature = signature
+	return req
+}
+
+func TestIssueB2BToken(t *testing.T) {
+	ctx := context.Background()
+	registered := testClient
+	registered.PublicKey = testClientPublicKey(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Nil(t, err)
+	forged := b2bTokenRequest(t, testNow)
+	forged.Signature, _ = encodeutil.RsaSha256Sign(otherKey, []byte(encodeutil.SNAPAsymmetricStringToSign(forged.ClientKey, forged.Timestamp)))
+	testCases := []struct {
+		Name          string
+		InitRepo      func(r *mocks.Repository)
+		Request       model.B2BTokenRequest
+		ExpectedError pkgerror.CustomError
+	}{
+		{
+			Name:          "ClockSkew",
+			InitRepo:      func(r *mocks.Repository) {},
+			Request:       b2bTokenRequest(t, testNow.Add(10*time.Minute)),
+			ExpectedError: pkgerror.ErrInvalidSignature,
+		},
+		{
+			Name: "NoPublicKey",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindClientByKey", ctx, "payroll-key").Return(testClient, nil)
+			},
+			Request:       b2bTokenRequest(t, testNow),
+			ExpectedError: pkgerror.ErrInvalidSignature,
+		},
+		{
+			Name: "ForgedSignature",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindClientByKey", ctx, "payroll-key").Return(registered, nil)
+			},
+			Request:       forged,
+			ExpectedError: pkgerror.ErrInvalidSignature,
+		},
+		{
+			Name: "ReusedSignature",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindClientByKey", ctx, "payroll-key").Return(registered, nil)
+				r.On("UseClientNonce", ctx, mock.Anything, testNow).Return(gorm.ErrRecordNotFound)
+			},
+			Request:       b2bTokenRequest(t, testNow),
+			ExpectedError: pkgerror.ErrInvalidSignature,
+		},
+		{
+			Name: "Success",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindClientByKey", ctx, "payroll-key").Return(registered, nil)
+				r.On("UseClientNonce", ctx, mock.MatchedBy(func(n *entity.ClientNonce) bool {
+					return n.ClientID == 2 && strings.HasPrefix(n.ExternalID, "b2b:")
+				}), testNow).Return(nil)
+			},
+			Request:       b2bTokenRequest(t, testNow),
+			ExpectedError: pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			tc.InitRepo(r)
+			result, err := newTestClientService(r).IssueB2BToken(ctx, tc.Request)
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			if tc.ExpectedError.IsNoError() {
+				assert.Equal(t, "Bearer", result.TokenType)
+				assert.Equal(t, "900", result.ExpiresIn)
+				claims := verifyAccessToken(t, result.AccessToken)
+				assert.Equal(t, "payroll-key", claims.Client)
+				assert.Equal(t, model.TokenTypeB2B, claims.Typ)
+				assert.NotEmpty(t, claims.Jti)
+				if assert.Len(t, claims.User.Roles, 1) {
+					assert.Equal(t, []string{"backend_testing_t:read_employees"}, claims.User.Roles[0].Permissions)
+				}
+			}
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetResponseMode(t *testing.T) {
+	ctx := context.Background()
+	snap := testClient
+	snap.ResponseMode = model.ResponseModeSnap
+	r := new(mocks.Repository)
+	r.On("FindClientByKey", ctx, "payroll-key").Return(snap, nil)
+	r.On("FindClientByKey", ctx, "unknown-key").Return(entity.ApiClient{}, gorm.ErrRecordNotFound)
+	s := newTestClientService(r)
+
+	mode, err := s.GetResponseMode(ctx, "payroll-key")
+	assert.True(t, err.IsNoError())
+	assert.Equal(t, model.ResponseModeSnap, mode)
+	mode, err = s.GetResponseMode(ctx, "unknown-key")
+	assert.True(t, err.IsNoError())
+	assert.Equal(t, model.ResponseModeDefault, mode)
+	r.AssertExpectations(t)
+}
+
+func TestGetResponseSigning(t *testing.T) {
+	ctx := context.Background()
+	hmac := testClient
+	hmac.ResponseSigning = model.ResponseSigningHmac
+	disabled := hmac
+	disabled.DisabledAt = &testNow
+	r := new(mocks.Repository)
+	r.On("FindClientByKey", ctx, "payroll-key").Return(hmac, nil)
+	r.On("FindClientByKey", ctx, "disabled-key").Return(disabled, nil)
+	r.On("FindClientByKey", ctx, "unknown-key").Return(entity.ApiClient{}, gorm.ErrRecordNotFound)
+	s := newTestClientService(r)
+
+	signing, err := s.GetResponseSigning(ctx, "payroll-key")
+	assert.True(t, err.IsNoError())
+	assert.Equal(t, model.ResponseSigningHmac, signing)
+	signing, err = s.GetResponseSigning(ctx, "disabled-key")
+	assert.True(t, err.IsNoError())
+	assert.Equal(t, model.ResponseSigningNone, signing)
+	signing, err = s.GetResponseSigning(ctx, "unknown-key")
+	assert.True(t, err.IsNoError())
+	assert.Equal(t, model.ResponseSigningNone, signing)
+	r.AssertExpectations(t)
+}
+
+func TestSetClientResponseSigning(t *testing.T) {
+	ctx := context.Background()
+	r := new(mocks.Repository)
+	r.On("UpdateClientResponseSigning", ctx, uint(2), model.ResponseSigningHmac, testNow).Return(nil)
+	r.On("UpdateClientResponseSigning", ctx, uint(9), model.ResponseSigningHmac, testNow).Return(gorm.ErrRecordNotFound)
+	s := newTestClientService(r)
+
+	err := s.SetClientResponseSigning(ctx, createPrincipal(true), model.SetClientResponseSigningRequest{ClientID: 2, ResponseSigning: model.ResponseSigningRsa})
+	assert.Equal(t, pkgerror.ErrInvalidParams.Code, err.Code)
+	err = s.SetClientResponseSigning(ctx, createPrincipal(true), model.SetClientResponseSigningRequest{ClientID: 9, ResponseSigning: model.ResponseSigningHmac})
+	assert.Equal(t, pkgerror.ErrClientNotFound.Code, err.Code)
+	err = s.SetClientResponseSigning(ctx, createPrincipal(true), model.SetClientResponseSigningRequest{ClientID: 2, ResponseSigning: model.ResponseSigningHmac})
+	assert.True(t, err.IsNoError())
+	r.AssertExpectations(t)
+}
+
+func TestSignResponse(t *testing.T) {
+	ctx := context.Background()
+	body := []byte(`{"status": "SUCCESS", "code": "0000"}`)
+	client := func(signing string, disabled bool) entity.ApiClient {
+		c := testClient
+		c.ResponseSigning = signing
+		if disabled {
+			c.DisabledAt = &testNow
+		}
+		return c
+	}
+	testCases := []struct {
+		Name          string
+		Client        entity.ApiClient
+		FindError     error
+		Verifier      responsesign.Verifier
+		ExpectedError pkgerror.CustomError
+	}{
+		{Name: "Hmac", Client: client(model.ResponseSigningHmac, false), Verifier: responsesign.HmacVerifier("payroll-secret"), ExpectedError: pkgerror.NoError},
+		{Name: "Rsa", Client: client(model.ResponseSigningRsa, false), Verifier: responsesign.RsaVerifier(&testClientKey.PublicKey), ExpectedError: pkgerror.NoError},
+		{Name: "None", Client: client(model.ResponseSigningNone, false), ExpectedError: pkgerror.NoError},
+		{Name: "Disabled", Client: client(model.ResponseSigningHmac, true), ExpectedError: pkgerror.NoError},
+		{Name: "UnknownClient", FindError: gorm.ErrRecordNotFound, ExpectedError: pkgerror.NoError},
+		{Name: "FindError", FindError: errors.New("connection refused"), ExpectedError: pkgerror.ErrSystemError},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			r.On("FindClientByKey", ctx, "payroll-key").Return(tc.Client, tc.FindError)
+			s := newTestClientService(r)
+			s.opts.ResponseSigningKey = testClientKey
+
+			signature, err := s.SignResponse(ctx, "payroll-key", body)
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			if tc.Verifier == nil {
+				assert.Nil(t, signature)
+				return
+			}
+			assert.Equal(t, testNow.Format(time.RFC3339), signature.Timestamp)
+			assert.Nil(t, tc.Verifier(body, signature.Timestamp, signature.Signature))
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"backend_test/repository"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/mailer"
+	"backend_test/pkg/password"
+	"backend_test/pkg/ratelimit"
+	"backend_test/pkg/util/copyutil"
+	"backend_test/pkg/util/tokenutil"
+
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+)
+
+var ErrTokenExpired = errors.New("token is expired")
+
+type CredentialService interface {
+	CreateUser(ctx context.Context, principal model.Principal, req model.CreateUserRequest) (*model.UserResult, pkgerror.CustomError)
+	ForgotPassword(ctx context.Context, req model.ForgotPasswordRequest) pkgerror.CustomError
+	ResetPassword(ctx context.Context, req model.ResetPasswordRequest) pkgerror.CustomError
+	VerifyEmail(ctx context.Context, req model.VerifyEmailRequest) pkgerror.CustomError
+	ResendEmailVerification(ctx context.Context, req model.ResendEmailVerificationRequest) pkgerror.CustomError
+}
+
+type CredentialOptions struct {
+	// PasswordHash is the algorithm of the new password hashes
+	PasswordHash         string
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+	// PasswordResetURL and EmailVerificationURL are the links mailed to
+	// the users, the token is appended to them
+	PasswordResetURL     string
+	EmailVerificationURL string
+	// RateLimitPerAccount and RateLimitPerIP are the number of requests
+	// allowed per RateLimitWindow, 0 disables the limit
+	RateLimitPerAccount int
+	RateLimitPerIP      int
+	RateLimitWindow     time.Duration
+}
+
+type CredentialServiceImpl struct {
+	repo           repository.Repository
+	mailer         mailer.Mailer
+	opts           CredentialOptions
+	accountLimiter *ratelimit.Limiter
+	ipLimiter      *ratelimit.Limiter
+	now            func() time.Time
+	// background runs the work done only for existing accounts after the
+	// response, so that its time does not tell which emails exist
+	background func(task func())
+}
+
+func NewCredentialService(repo repository.Repository, m mailer.Mailer, opts CredentialOptions) *CredentialServiceImpl {
+	return &CredentialServiceImpl{
+		repo:           repo,
+		mailer:         m,
+		opts:           opts,
+		accountLimiter: ratelimit.New(opts.RateLimitPerAccount, opts.RateLimitWindow),
+		ipLimiter:      ratelimit.New(opts.RateLimitPerIP, opts.RateLimitWindow),
+		now:            time.Now,
+		background:     func(task func()) { go task() },
+	}
+}
+
+// allow counts the request of the client IP and, when set, of the account
+func (s *CredentialServiceImpl) allow(clientIP, email string) pkgerror.CustomError {
+	if !s.ipLimiter.Allow(clientIP) {
+		return pkgerror.ErrTooManyRequests.WithError(fmt.Errorf("rate limit of IP %s exceeded", clientIP))
+	}
+	if email != "" && !s.accountLimiter.Allow(strings.ToLower(email)) {
+		return pkgerror.ErrTooManyRequests.WithError(fmt.Errorf("rate limit of account %s exceeded", email))
+	}
+	return pkgerror.NoError
+}
+
+// CreateUser creates a local user and mails them an email verification link
+func (s *CredentialServiceImpl) CreateUser(ctx context.Context, principal model.Principal, req model.CreateUserRequest) (*model.UserResult, pkgerror.CustomError) {
+	_, err := s.repo.FindUserByEmail(ctx, req.Email)
+	if err == nil {
+		return nil, pkgerror.ErrUserIsExist.WithError(errors.New("User `email` is already created."))
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Error("Find user by email error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	hash, err := password.Hash(req.Password, s.opts.PasswordHash)
+	if err != nil {
+		log.Error("Hash password error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	user := entity.User{Email: req.Email, Name: req.Name, PasswordHash: hash}
+	if err := s.repo.CreateUser(ctx, &user); err != nil {
+		log.Error("Create user error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	// the user is created, a failed mail is resent with /auth/email/resend
+	if err := s.sendEmailVerification(ctx, user); err != nil {
+		log.Error("Send email verification error: ", err)
+	}
+	result := model.UserResult{}
+	copyutil.Copy(&user, &result)
+	return &result, pkgerror.NoError
+}
+
+// ForgotPassword mails a password reset link to the user of the email. It
+// succeeds for unknown emails too and mails in the background so that
+// neither its response nor its duration tells which exist.
+func (s *CredentialServiceImpl) ForgotPassword(ctx context.Context, req model.ForgotPasswordRequest) pkgerror.CustomError {
+	if cerr := s.allow(req.ClientIP, req.Email); !cerr.IsNoError() {
+		return cerr
+	}
+	// the request context ends with the response
+	s.background(func() { s.sendPasswordReset(context.Background(), req.Email) })
+	return pkgerror.NoError
+}
+
+func (s *CredentialServiceImpl) sendPasswordReset(ctx context.Context, email string) {
+	user, cerr := s.findUser(ctx, email)
+	if !cerr.IsNoError() || user == nil {
+		return
+	}
+	token, err := s.issueToken(ctx, *user, entity.TokenPurposePasswordReset, s.opts.PasswordResetTTL)
+	if err != nil {
+		log.Error("Issue password reset token error: ", err)
+		return
+	}
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nFollow the link below to choose a new password, it can be used once within %s:\n\n%s%s\n\n"+
+			"If you did not ask to reset your password you can ignore this email.\n",
+			user.Name, s.opts.PasswordResetTTL, s.opts.PasswordResetURL, token),
+	})
+	if err != nil {
+		log.Error("Send password reset error: ", err)
+	}
+}
+
+// ResetPassword sets the password of the user of a reset token and revokes
+// their sessions
+func (s *CredentialServiceImpl) ResetPassword(ctx context.Context, req model.ResetPasswordRequest) pkgerror.CustomError {
+	if cerr := s.allow(req.ClientIP, ""); !cerr.IsNoError() {
+		return cerr
+	}
+	token, cerr := s.findToken(ctx, entity.TokenPurposePasswordReset, req.Token)
+	if !cerr.IsNoError() {
+		return cerr
+	}
+	hash, err := password.Hash(req.Password, s.opts.PasswordHash)
+	if err != nil {
+		log.Error("Hash password error: ", err)
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	now := s.now()
+	err = s.repo.WithTx(ctx, func(txRepo repository.Repository) error {
+		if err := txRepo.UseUserToken(ctx, token.ID, now); err != nil {
+			return err
+		}
+		if err := txRepo.UpdateUserPassword(ctx, token.UserID, hash); err != nil {
+			return err
+		}
+		if err := txRepo.DeleteUserTokens(ctx, token.UserID, entity.TokenPurposePasswordReset); err != nil {
+			return err
+		}
+		return txRepo.RevokeUserSessions(ctx, token.UserID, now)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrInvalidToken.WithError(err)
+		}
+		log.Error("Reset password error: ", err)
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	return pkgerror.NoError
+}
+
+func (s *CredentialServiceImpl) VerifyEmail(ctx context.Context, req model.VerifyEmailRequest) pkgerror.CustomError {
+	if cerr := s.allow(req.ClientIP, ""); !cerr.IsNoError() {
+		return cerr
+	}
+	token, cerr := s.findToken(ctx, entity.TokenPurposeEmailVerification, req.Token)
+	if !cerr.IsNoError() {
+		return cerr
+	}
+	now := s.now()
+	err := s.repo.WithTx(ctx, func(txRepo repository.Repository) error {
+		if err := txRepo.UseUserToken(ctx, token.ID, now); err != nil {
+			return err
+		}
+		return txRepo.VerifyUserEmail(ctx, token.UserID, now)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrInvalidToken.WithError(err)
+		}
+		log.Error("Verify email error: ", err)
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	return pkgerror.NoError
+}
+
+// ResendEmailVerification mails a new verification link, like
+// ForgotPassword it succeeds for unknown and verified emails and mails in
+// the background
+func (s *CredentialServiceImpl) ResendEmailVerification(ctx context.Context, req model.ResendEmailVerificationRequest) pkgerror.CustomError {
+	if cerr := s.allow(req.ClientIP, req.Email); !cerr.IsNoError() {
+		return cerr
+	}
+	s.background(func() {
+		ctx := context.Background()
+		user, cerr := s.findUser(ctx, req.Email)
+		if !cerr.IsNoError() || user == nil || user.EmailVerifiedAt != nil {
+			return
+		}
+		if err := s.sendEmailVerification(ctx, *user); err != nil {
+			log.Error("Send email verification error: ", err)
+		}
+	})
+	return pkgerror.NoError
+}
+
+// findUser returns nil when no user has the email
+func (s *CredentialServiceImpl) findUser(ctx context.Context, email string) (*entity.User, pkgerror.CustomError) {
+	user, err := s.repo.FindUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerror.NoError
+		}
+		log.Error("Find user by email error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	return &user, pkgerror.NoError
+}
+
+// findToken loads an unused and unexpired token of the purpose
+func (s *CredentialServiceImpl) findToken(ctx context.Context, purpose, token string) (entity.UserToken, pkgerror.CustomError) {
+	found, err := s.repo.FindUserTokenByHash(ctx, purpose, tokenutil.Hash(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return found, pkgerror.ErrInvalidToken.WithError(err)
+		}
+		log.Error("Find user token error: ", err)
+		return found, pkgerror.ErrSystemError.WithError(err)
+	}
+	if found.UsedAt != nil {
+		return found, pkgerror.ErrInvalidToken
+	}
+	if s.now().After(found.ExpiresAt) {
+		return found, pkgerror.ErrInvalidToken.WithError(ErrTokenExpired)
+	}
+	return found, pkgerror.NoError
+}
+
+// issueToken stores the hash of a new token of the purpose, replacing the
+// unused ones of the user, and returns the token
+func (s *CredentialServiceImpl) issueToken(ctx context.Context, user entity.User, purpose string, ttl time.Duration) (string, error) {
+	token, err := tokenutil.Generate(32)
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.WithTx(ctx, func(txRepo repository.Repository) error {
+		if err := txRepo.DeleteUserTokens(ctx, user.ID, purpose); err != nil {
+			return err
+		}
+		return txRepo.CreateUserToken(ctx, &entity.UserToken{
+			UserID:    user.ID,
+			Purpose:   purpose,
+			TokenHash: tokenutil.Hash(token),
+			ExpiresAt: s.now().Add(ttl),
+		})
+	})
+	return token, err
+}
+
+func (s *CredentialServiceImpl) sendEmailVerification(ctx context.Context, user entity.User) error {
+	token, err := s.issueToken(ctx, user, entity.TokenPurposeEmailVerification, s.opts.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hello %s,\n\nFollow the link below within %s to verify your email:\n\n%s%s\n",
+			user.Name, s.opts.EmailVerificationTTL, s.opts.EmailVerificationURL, token),
+	})
+}
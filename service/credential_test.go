@@ -0,0 +1,254 @@
+package service
+
+import (
+	"backend_test/entity"
+	mocks "backend_test/mocks/repository"
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/mailer"
+	"backend_test/pkg/password"
+	"backend_test/pkg/util/tokenutil"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func newTestCredentialService(r *mocks.Repository, m mailer.Mailer) *CredentialServiceImpl {
+	s := NewCredentialService(r, m, CredentialOptions{
+		PasswordResetTTL:     time.Hour,
+		EmailVerificationTTL: 24 * time.Hour,
+		PasswordResetURL:     "http://localhost/reset-password?token=",
+		EmailVerificationURL: "http://localhost/verify-email?token=",
+		RateLimitPerAccount:  2,
+		RateLimitPerIP:       3,
+		RateLimitWindow:      time.Hour,
+	})
+	s.now = func() time.Time { return testNow }
+	s.background = func(task func()) { task() }
+	return s
+}
+
+// mailedToken returns the token of the link in the last mail
+func mailedToken(m *mailer.MemoryMailer, url string) string {
+	messages := m.Messages()
+	if len(messages) == 0 {
+		return ""
+	}
+	body := messages[len(messages)-1].Body
+	i := strings.Index(body, url)
+	if i < 0 {
+		return ""
+	}
+	return strings.Fields(body[i+len(url):])[0]
+}
+
+func TestCreateUser(t *testing.T) {
+	ctx := context.Background()
+	request := model.CreateUserRequest{Email: "user@gmail.com", Name: "User", Password: "s3cret-password"}
+
+	r := new(mocks.Repository)
+	m := mailer.NewMemoryMailer()
+	r.On("FindUserByEmail", ctx, "user@gmail.com").Return(testUser, nil).Once()
+	_, err := newTestCredentialService(r, m).CreateUser(ctx, createPrincipal(false), request)
+	assert.Equal(t, pkgerror.ErrUserIsExist.Code, err.Code)
+
+	r.On("FindUserByEmail", ctx, "user@gmail.com").Return(entity.User{}, gorm.ErrRecordNotFound)
+	r.On("CreateUser", ctx, mock.MatchedBy(func(u *entity.User) bool {
+		ok, _ := password.Verify(u.PasswordHash, "s3cret-password")
+		return u.Email == "user@gmail.com" && ok
+	})).Return(nil)
+	onWithTx(r)
+	r.On("DeleteUserTokens", ctx, uint(0), entity.TokenPurposeEmailVerification).Return(nil)
+	var stored *entity.UserToken
+	r.On("CreateUserToken", ctx, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(*entity.UserToken)
+	}).Return(nil)
+	result, err := newTestCredentialService(r, m).CreateUser(ctx, createPrincipal(false), request)
+	assert.True(t, err.IsNoError())
+	assert.Equal(t, "user@gmail.com", result.Email)
+	assert.Nil(t, result.EmailVerifiedAt)
+
+	token := mailedToken(m, "http://localhost/verify-email?token=")
+	assert.NotEmpty(t, token)
+	if assert.NotNil(t, stored) {
+		assert.Equal(t, tokenutil.Hash(token), stored.TokenHash)
+		assert.Equal(t, testNow.Add(24*time.Hour), stored.ExpiresAt)
+	}
+	r.AssertExpectations(t)
+}
+
+func TestForgotPassword(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("UnknownEmail", func(t *testing.T) {
+		r := new(mocks.Repository)
+		m := mailer.NewMemoryMailer()
+		r.On("FindUserByEmail", ctx, "other@gmail.com").Return(entity.User{}, gorm.ErrRecordNotFound)
+		err := newTestCredentialService(r, m).ForgotPassword(ctx, model.ForgotPasswordRequest{Email: "other@gmail.com", ClientIP: "10.0.0.1"})
+		assert.True(t, err.IsNoError())
+		assert.Empty(t, m.Messages())
+		r.AssertExpectations(t)
+	})
+
+	t.Run("MailsSingleUseToken", func(t *testing.T) {
+		r := new(mocks.Repository)
+		m := mailer.NewMemoryMailer()
+		r.On("FindUserByEmail", ctx, "user@gmail.com").Return(testUser, nil)
+		onWithTx(r)
+		r.On("DeleteUserTokens", ctx, uint(7), entity.TokenPurposePasswordReset).Return(nil)
+		r.On("CreateUserToken", ctx, mock.MatchedBy(func(token *entity.UserToken) bool {
+			return token.UserID == 7 && token.Purpose == entity.TokenPurposePasswordReset && token.ExpiresAt.Equal(testNow.Add(time.Hour))
+		})).Return(nil)
+		err := newTestCredentialService(r, m).ForgotPassword(ctx, model.ForgotPasswordRequest{Email: "user@gmail.com", ClientIP: "10.0.0.1"})
+		assert.True(t, err.IsNoError())
+		if assert.Len(t, m.Messages(), 1) {
+			assert.Equal(t, []string{"user@gmail.com"}, m.Messages()[0].To)
+			assert.NotEmpty(t, mailedToken(m, "http://localhost/reset-password?token="))
+		}
+		r.AssertExpectations(t)
+	})
+
+	t.Run("LooksUpAfterResponse", func(t *testing.T) {
+		r := new(mocks.Repository)
+		s := newTestCredentialService(r, mailer.NewMemoryMailer())
+		tasks := []func(){}
+		s.background = func(task func()) { tasks = append(tasks, task) }
+		err := s.ForgotPassword(ctx, model.ForgotPasswordRequest{Email: "user@gmail.com", ClientIP: "10.0.0.1"})
+		assert.True(t, err.IsNoError())
+		// nothing done for the account before responding
+		r.AssertNotCalled(t, "FindUserByEmail", mock.Anything, mock.Anything)
+		if assert.Len(t, tasks, 1) {
+			r.On("FindUserByEmail", ctx, "user@gmail.com").Return(entity.User{}, errors.New("connection refused"))
+			tasks[0]()
+		}
+		r.AssertExpectations(t)
+	})
+
+	t.Run("RateLimitPerAccount", func(t *testing.T) {
+		r := new(mocks.Repository)
+		r.On("FindUserByEmail", ctx, "other@gmail.com").Return(entity.User{}, gorm.ErrRecordNotFound)
+		s := newTestCredentialService(r, mailer.NewMemoryMailer())
+		for i, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+			err := s.ForgotPassword(ctx, model.ForgotPasswordRequest{Email: "other@gmail.com", ClientIP: ip})
+			assert.True(t, err.IsNoError(), "request %d", i)
+		}
+		err := s.ForgotPassword(ctx, model.ForgotPasswordRequest{Email: "OTHER@gmail.com", ClientIP: "10.0.0.3"})
+		assert.Equal(t, pkgerror.ErrTooManyRequests.Code, err.Code)
+	})
+
+	t.Run("RateLimitPerIP", func(t *testing.T) {
+		r := new(mocks.Repository)
+		r.On("FindUserByEmail", ctx, mock.Anything).Return(entity.User{}, gorm.ErrRecordNotFound)
+		s := newTestCredentialService(r, mailer.NewMemoryMailer())
+		for _, email := range []string{"a@gmail.com", "b@gmail.com", "c@gmail.com"} {
+			assert.True(t, s.ForgotPassword(ctx, model.ForgotPasswordRequest{Email: email, ClientIP: "10.0.0.1"}).IsNoError())
+		}
+		err := s.ForgotPassword(ctx, model.ForgotPasswordRequest{Email: "d@gmail.com", ClientIP: "10.0.0.1"})
+		assert.Equal(t, pkgerror.ErrTooManyRequests.Code, err.Code)
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+	usedAt := testNow.Add(-time.Minute)
+	token := entity.UserToken{ID: 3, UserID: 7, Purpose: entity.TokenPurposePasswordReset, TokenHash: tokenutil.Hash("reset-1"), ExpiresAt: testNow.Add(time.Hour)}
+	testCases := []struct {
+		Name          string
+		InitRepo      func(r *mocks.Repository)
+		ExpectedError pkgerror.CustomError
+	}{
+		{
+			Name: "Unknown",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindUserTokenByHash", ctx, entity.TokenPurposePasswordReset, token.TokenHash).Return(entity.UserToken{}, gorm.ErrRecordNotFound)
+			},
+			ExpectedError: pkgerror.ErrInvalidToken,
+		},
+		{
+			Name: "Used",
+			InitRepo: func(r *mocks.Repository) {
+				used := token
+				used.UsedAt = &usedAt
+				r.On("FindUserTokenByHash", ctx, entity.TokenPurposePasswordReset, token.TokenHash).Return(used, nil)
+			},
+			ExpectedError: pkgerror.ErrInvalidToken,
+		},
+		{
+			Name: "Expired",
+			InitRepo: func(r *mocks.Repository) {
+				expired := token
+				expired.ExpiresAt = testNow.Add(-time.Second)
+				r.On("FindUserTokenByHash", ctx, entity.TokenPurposePasswordReset, token.TokenHash).Return(expired, nil)
+			},
+			ExpectedError: pkgerror.ErrInvalidToken,
+		},
+		{
+			Name: "UsedConcurrently",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindUserTokenByHash", ctx, entity.TokenPurposePasswordReset, token.TokenHash).Return(token, nil)
+				onWithTx(r)
+				r.On("UseUserToken", ctx, uint(3), testNow).Return(gorm.ErrRecordNotFound)
+			},
+			ExpectedError: pkgerror.ErrInvalidToken,
+		},
+		{
+			Name: "Success",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindUserTokenByHash", ctx, entity.TokenPurposePasswordReset, token.TokenHash).Return(token, nil)
+				onWithTx(r)
+				r.On("UseUserToken", ctx, uint(3), testNow).Return(nil)
+				r.On("UpdateUserPassword", ctx, uint(7), mock.MatchedBy(func(hash string) bool {
+					ok, _ := password.Verify(hash, "n3w-password")
+					return ok
+				})).Return(nil)
+				r.On("DeleteUserTokens", ctx, uint(7), entity.TokenPurposePasswordReset).Return(nil)
+				r.On("RevokeUserSessions", ctx, uint(7), testNow).Return(nil)
+			},
+			ExpectedError: pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			tc.InitRepo(r)
+			err := newTestCredentialService(r, mailer.NewMemoryMailer()).
+				ResetPassword(ctx, model.ResetPasswordRequest{Token: "reset-1", Password: "n3w-password", ClientIP: "10.0.0.1"})
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	ctx := context.Background()
+	token := entity.UserToken{ID: 4, UserID: 7, Purpose: entity.TokenPurposeEmailVerification, TokenHash: tokenutil.Hash("verify-1"), ExpiresAt: testNow.Add(time.Hour)}
+
+	r := new(mocks.Repository)
+	r.On("FindUserTokenByHash", ctx, entity.TokenPurposeEmailVerification, token.TokenHash).Return(token, nil)
+	onWithTx(r)
+	r.On("UseUserToken", ctx, uint(4), testNow).Return(nil)
+	r.On("VerifyUserEmail", ctx, uint(7), testNow).Return(nil)
+	err := newTestCredentialService(r, mailer.NewMemoryMailer()).VerifyEmail(ctx, model.VerifyEmailRequest{Token: "verify-1", ClientIP: "10.0.0.1"})
+	assert.True(t, err.IsNoError())
+	r.AssertExpectations(t)
+}
+
+func TestResendEmailVerification(t *testing.T) {
+	ctx := context.Background()
+	verified := testUser
+	verified.EmailVerifiedAt = &testNow
+
+	r := new(mocks.Repository)
+	m := mailer.NewMemoryMailer()
+	r.On("FindUserByEmail", ctx, "user@gmail.com").Return(verified, nil)
+	err := newTestCredentialService(r, m).ResendEmailVerification(ctx, model.ResendEmailVerificationRequest{Email: "user@gmail.com", ClientIP: "10.0.0.1"})
+	assert.True(t, err.IsNoError())
+	assert.Empty(t, m.Messages())
+	r.AssertExpectations(t)
+}
@@ -1,53 +1,121 @@
 package service
 
 import (
+	"backend_test/constant"
 	"backend_test/entity"
 	"backend_test/model"
+	"backend_test/pkg/policy"
 	"backend_test/repository"
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 
 	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/contextutil"
 	"backend_test/pkg/util/copyutil"
+	"backend_test/pkg/util/etagutil"
+	"backend_test/pkg/util/jsonutil"
+	"backend_test/pkg/util/patchutil"
 
-	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 	"gorm.io/gorm"
 )
 
 type EmployeeService interface {
-	GetEmployees(ctx echo.Context, filter model.GetEmployeesFilter) (*[]model.GetEmployeesResult, pkgerror.CustomError)
-	CreateEmployee(ctx echo.Context, req model.CreateEmployeeRequest) (*model.CreateEmployeeResult, pkgerror.CustomError)
-	GetEmployeeByID(ctx echo.Context, req model.GetEmployeeByIDRequest) (*model.GetEmployeeByIDResult, pkgerror.CustomError)
-	EditEmployee(ctx echo.Context, req model.EditEmployeeRequest) (*model.EditEmployeeResult, pkgerror.CustomError)
-	DeleteEmployeeByID(ctx echo.Context, req model.DeleteEmployeeByIDRequest) pkgerror.CustomError
+	GetEmployees(ctx context.Context, principal model.Principal, filter model.GetEmployeesFilter) (*[]model.GetEmployeesResult, *model.Pagination, pkgerror.CustomError)
+	SearchEmployees(ctx context.Context, principal model.Principal, req model.SearchEmployeesRequest) (*[]model.SearchEmployeesResult, *model.Pagination, pkgerror.CustomError)
+	CreateEmployee(ctx context.Context, principal model.Principal, req model.CreateEmployeeRequest) (*model.CreateEmployeeResult, pkgerror.CustomError)
+	GetDeletedEmployees(ctx context.Context, principal model.Principal, filter model.GetEmployeesFilter) (*[]model.GetDeletedEmployeesResult, *model.Pagination, pkgerror.CustomError)
+	RestoreEmployee(ctx context.Context, principal model.Principal, req model.RestoreEmployeeRequest) (*model.GetEmployeeByIDResult, pkgerror.CustomError)
+	GetEmployeeByID(ctx context.Context, principal model.Principal, req model.GetEmployeeByIDRequest) (*model.GetEmployeeByIDResult, pkgerror.CustomError)
+	EditEmployee(ctx context.Context, principal model.Principal, req model.EditEmployeeRequest) (*model.EditEmployeeResult, pkgerror.CustomError)
+	PatchEmployee(ctx context.Context, principal model.Principal, req model.PatchEmployeeRequest) (*model.EditEmployeeResult, pkgerror.CustomError)
+	DeleteEmployeeByID(ctx context.Context, principal model.Principal, req model.DeleteEmployeeByIDRequest) pkgerror.CustomError
+}
+
+// Validator validates a request against its `validate` tags
+type Validator interface {
+	Validate(i interface{}) error
 }
 
 type EmployeeServiceImpl struct {
-	repo repository.Repository
+	repo      repository.Repository
+	validator Validator
+	policies  *policy.Engine
 }
 
 func NewEmployeeService(
-	repo repository.Repository) *EmployeeServiceImpl {
+	repo repository.Repository,
+	validator Validator,
+	policies *policy.Engine) *EmployeeServiceImpl {
 	return &EmployeeServiceImpl{
-		repo: repo,
+		repo:      repo,
+		validator: validator,
+		policies:  policies,
 	}
 }
 
-func (s EmployeeServiceImpl) GetEmployees(ctx echo.Context, filter model.GetEmployeesFilter) (*[]model.GetEmployeesResult, pkgerror.CustomError) {
-	rctx := ctx.Request().Context()
+func (s EmployeeServiceImpl) GetEmployees(ctx context.Context, principal model.Principal, filter model.GetEmployeesFilter) (*[]model.GetEmployeesResult, *model.Pagination, pkgerror.CustomError) {
+	var customErr pkgerror.CustomError
+	if filter.PolicyScope, customErr = s.readScope(principal); !customErr.IsNoError() {
+		return nil, nil, customErr
+	}
+	if filter.CursorRequest.IsCursorMode() {
+		return s.getEmployeesByCursor(ctx, filter)
+	}
 	results := []model.GetEmployeesResult{}
-	employees, err := s.repo.FindAllEmployees(rctx, filter)
+	employees, err := s.repo.FindEmployees(ctx, filter)
 	if err != nil {
 		log.Error("Find employees error: ", err)
-		return nil, pkgerror.ErrSystemError
+		return nil, nil, pkgerror.ErrSystemError
+	}
+	total, err := s.repo.CountEmployees(ctx, filter)
+	if err != nil {
+		log.Error("Count employees error: ", err)
+		return nil, nil, pkgerror.ErrSystemError
 	}
 	copyutil.Copy(&employees, &results)
-	return &results, pkgerror.NoError
+	return &results, model.NewPagination(filter.PageRequest, total), pkgerror.NoError
+}
+
+func (s EmployeeServiceImpl) SearchEmployees(ctx context.Context, principal model.Principal, req model.SearchEmployeesRequest) (*[]model.SearchEmployeesResult, *model.Pagination, pkgerror.CustomError) {
+	var customErr pkgerror.CustomError
+	if req.PolicyScope, customErr = s.readScope(principal); !customErr.IsNoError() {
+		return nil, nil, customErr
+	}
+	matchType := constant.SearchMatchTypeFullText
+	hits, total, err := s.repo.SearchEmployees(ctx, req)
+	if err != nil {
+		log.Error("Search employees error: ", err)
+		return nil, nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	if total == 0 {
+		// Nothing matched the words as typed, fall back to a typo tolerant search
+		matchType = constant.SearchMatchTypeFuzzy
+		hits, total, err = s.repo.SearchEmployeesFuzzy(ctx, req)
+		if err != nil {
+			log.Error("Fuzzy search employees error: ", err)
+			return nil, nil, pkgerror.ErrSystemError.WithError(err)
+		}
+	}
+	results := []model.SearchEmployeesResult{}
+	for _, hit := range hits {
+		result := model.SearchEmployeesResult{Rank: hit.Rank, MatchType: matchType}
+		copyutil.Copy(&hit.Employee, &result.GetEmployeesResult)
+		if hit.Highlight != "" {
+			highlight := hit.Highlight
+			result.Highlight = &highlight
+		}
+		results = append(results, result)
+	}
+	return &results, model.NewPagination(req.PageRequest, total), pkgerror.NoError
 }
 
-func (s *EmployeeServiceImpl) GetEmployeeByID(ctx echo.Context, req model.GetEmployeeByIDRequest) (*model.GetEmployeeByIDResult, pkgerror.CustomError) {
-	rctx := ctx.Request().Context()
-	employee, err := s.repo.FindEmployeeByID(rctx, uint(req.EmployeeID))
+func (s *EmployeeServiceImpl) GetEmployeeByID(ctx context.Context, principal model.Principal, req model.GetEmployeeByIDRequest) (*model.GetEmployeeByIDResult, pkgerror.CustomError) {
+	employee, err := s.repo.FindEmployeeByID(ctx, uint(req.EmployeeID))
 	if err != nil {
 		log.Error("Find employee by ID error: ", err)
 		if errors.Is(gorm.ErrRecordNotFound, err) {
@@ -55,15 +123,23 @@ func (s *EmployeeServiceImpl) GetEmployeeByID(ctx echo.Context, req model.GetEmp
 		}
 		return nil, pkgerror.ErrSystemError.WithError(err)
 	}
+	if ce := s.authorize(principal, ActionReadEmployee, employee); !ce.IsNoError() {
+		return nil, ce
+	}
 	result := model.GetEmployeeByIDResult{}
 	copyutil.Copy(&employee, &result)
 	return &result, pkgerror.NoError
 }
 
-func (s *EmployeeServiceImpl) CreateEmployee(ctx echo.Context, req model.CreateEmployeeRequest) (*model.CreateEmployeeResult, pkgerror.CustomError) {
-	rctx := ctx.Request().Context()
+func (s *EmployeeServiceImpl) CreateEmployee(ctx context.Context, principal model.Principal, req model.CreateEmployeeRequest) (*model.CreateEmployeeResult, pkgerror.CustomError) {
+	appID, ce := createAppID(ctx, req.AppID)
+	if !ce.IsNoError() {
+		return nil, ce
+	}
+	req.Email = normalizeEmail(req.Email)
+	req.ManagerEmail = normalizeEmail(req.ManagerEmail)
 
-	employeeFound, err := s.repo.FindEmployeeByEmail(rctx, req.Email)
+	employeeFound, err := s.repo.FindEmployeeByEmail(ctx, appID, req.Email)
 	if err != nil {
 		log.Error("Find user by Email error: ", err)
 		if !errors.Is(gorm.ErrRecordNotFound, err) {
@@ -74,41 +150,46 @@ func (s *EmployeeServiceImpl) CreateEmployee(ctx echo.Context, req model.CreateE
 		return nil, pkgerror.ErrEmployeeIsExist.WithError(errors.New("Employee `email` is already created."))
 	}
 
-	txSuccess := false
-	err = s.repo.TxBegin()
-	if err != nil {
-		log.Error("Start db transaction error: ", err)
-		return nil, pkgerror.ErrSystemError.WithError(err)
-	}
-	defer func() {
-		if r := recover(); r != nil || !txSuccess {
-			err = s.repo.TxRollback()
-			if err != nil {
-				log.Error("Rollback db transaction error: ", err)
-			}
-		}
-	}()
-
 	var employee entity.Employee
 	copyutil.Copy(&req, &employee)
-	err = s.repo.CreateEmployee(rctx, &employee)
+	employee.AppID = appID
+	err = s.repo.WithTx(ctx, func(txRepo repository.Repository) error {
+		return txRepo.CreateEmployee(ctx, &employee)
+	})
 	if err != nil {
 		log.Error("Create employee error: ", err)
+		if errors.Is(err, repository.ErrEmployeeEmailTaken) {
+			return nil, pkgerror.ErrEmployeeIsExist.WithError(err)
+		}
 		return nil, pkgerror.ErrSystemError.WithError(err)
 	}
-	err = s.repo.TxCommit()
-	if err != nil {
-		log.Error("Commit db transaction error: ", err)
-	}
 	var result model.CreateEmployeeResult
 	copyutil.Copy(&employee, &result)
-	txSuccess = true
 	return &result, pkgerror.NoError
 }
 
-func (s *EmployeeServiceImpl) EditEmployee(ctx echo.Context, req model.EditEmployeeRequest) (*model.EditEmployeeResult, pkgerror.CustomError) {
-	rctx := ctx.Request().Context()
-	employee, err := s.repo.FindEmployeeByID(rctx, uint(req.EmployeeID))
+func (s *EmployeeServiceImpl) EditEmployee(ctx context.Context, principal model.Principal, req model.EditEmployeeRequest) (*model.EditEmployeeResult, pkgerror.CustomError) {
+	employee, err := s.repo.FindEmployeeByID(ctx, uint(req.EmployeeID))
+	if err != nil {
+		log.Error("Find employee by ID error: ", err)
+		if errors.Is(gorm.ErrRecordNotFound, err) {
+			return nil, pkgerror.ErrEmployeeNotFound.WithError(err)
+		}
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	if ce := s.authorize(principal, ActionUpdateEmployee, employee); !ce.IsNoError() {
+		return nil, ce
+	}
+	if ce := checkEmployeeVersion(req.IfMatch, employee); !ce.IsNoError() {
+		return nil, ce
+	}
+	return s.updateEmployee(ctx, employee, req)
+}
+
+// PatchEmployee applies a merge patch or JSON patch to the current employee
+// document, then validates and saves the result as a full edit
+func (s *EmployeeServiceImpl) PatchEmployee(ctx context.Context, principal model.Principal, req model.PatchEmployeeRequest) (*model.EditEmployeeResult, pkgerror.CustomError) {
+	employee, err := s.repo.FindEmployeeByID(ctx, uint(req.EmployeeID))
 	if err != nil {
 		log.Error("Find employee by ID error: ", err)
 		if errors.Is(gorm.ErrRecordNotFound, err) {
@@ -116,9 +197,53 @@ func (s *EmployeeServiceImpl) EditEmployee(ctx echo.Context, req model.EditEmplo
 		}
 		return nil, pkgerror.ErrSystemError.WithError(err)
 	}
+	if ce := s.authorize(principal, ActionUpdateEmployee, employee); !ce.IsNoError() {
+		return nil, ce
+	}
+	if ce := checkEmployeeVersion(req.IfMatch, employee); !ce.IsNoError() {
+		return nil, ce
+	}
 
+	doc := model.EmployeePatchDocument{
+		FirstName:    employee.FirstName,
+		LastName:     employee.LastName,
+		Email:        employee.Email,
+		HireDate:     employee.HireDate.Format(model.DateLayout),
+		ManagerEmail: employee.ManagerEmail,
+	}
+	patched, err := patchutil.Apply(req.PatchType, []byte(jsonutil.Stringify(doc)), req.Patch)
+	if err != nil {
+		if errors.Is(err, patchutil.ErrUnsupportedPatchType) {
+			return nil, pkgerror.ErrUnsupportedMediaType.WithError(err)
+		}
+		return nil, pkgerror.ErrInvalidParams.WithError(err)
+	}
+	patchedDoc := model.EmployeePatchDocument{}
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patchedDoc); err != nil {
+		return nil, pkgerror.ErrInvalidParams.WithError(err)
+	}
+	editReq := model.EditEmployeeRequest{
+		EmployeeID:   req.EmployeeID,
+		FirstName:    patchedDoc.FirstName,
+		LastName:     patchedDoc.LastName,
+		Email:        patchedDoc.Email,
+		HireDate:     patchedDoc.HireDate,
+		ManagerEmail: patchedDoc.ManagerEmail,
+		IfMatch:      req.IfMatch,
+	}
+	if err := s.validator.Validate(&editReq); err != nil {
+		return nil, pkgerror.ErrInvalidParams.WithError(err)
+	}
+	return s.updateEmployee(ctx, employee, editReq)
+}
+
+func (s *EmployeeServiceImpl) updateEmployee(ctx context.Context, employee entity.Employee, req model.EditEmployeeRequest) (*model.EditEmployeeResult, pkgerror.CustomError) {
+	req.Email = normalizeEmail(req.Email)
+	req.ManagerEmail = normalizeEmail(req.ManagerEmail)
 	// validate unique email on other employees
-	employeeByEmail, err := s.repo.FindEmployeeByEmail(rctx, req.Email)
+	employeeByEmail, err := s.repo.FindEmployeeByEmail(ctx, employee.AppID, req.Email)
 	if err != nil {
 		log.Error("Find user by Email error: ", err)
 		if !errors.Is(gorm.ErrRecordNotFound, err) {
@@ -129,47 +254,164 @@ func (s *EmployeeServiceImpl) EditEmployee(ctx echo.Context, req model.EditEmplo
 		return nil, pkgerror.ErrEmployeeIsExist.WithError(errors.New("Employee `email` is already created."))
 	}
 
-	txSuccess := false
-	err = s.repo.TxBegin()
-	if err != nil {
-		log.Error("Start db transaction error: ", err)
-		return nil, pkgerror.ErrSystemError.WithError(err)
-	}
-	defer func() {
-		if r := recover(); r != nil || !txSuccess {
-			err = s.repo.TxRollback()
-			if err != nil {
-				log.Error("Rollback db transaction error: ", err)
-			}
-		}
-	}()
-
 	copyutil.Copy(&req, &employee)
-	err = s.repo.UpdateEmployee(rctx, &employee)
-	if err != nil {
-		return nil, pkgerror.ErrSystemError.WithError(err)
+	hireDate := model.DateParam{}
+	if err := hireDate.UnmarshalParam(req.HireDate); err != nil {
+		return nil, pkgerror.ErrInvalidParams.WithError(err)
 	}
-	// Commit transaction
-	err = s.repo.TxCommit()
+	employee.HireDate = hireDate.Time
+	err = s.repo.WithTx(ctx, func(txRepo repository.Repository) error {
+		return txRepo.UpdateEmployee(ctx, &employee)
+	})
 	if err != nil {
-		log.Error("Commit db transaction error: ", err)
+		log.Error("Update employee error: ", err)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return nil, pkgerror.ErrPreconditionFailed.WithError(err)
+		}
+		if errors.Is(err, repository.ErrEmployeeEmailTaken) {
+			return nil, pkgerror.ErrEmployeeIsExist.WithError(err)
+		}
+		return nil, pkgerror.ErrSystemError.WithError(err)
 	}
 	result := model.EditEmployeeResult{}
 	copyutil.Copy(&employee, &result)
-	txSuccess = true
 	return &result, pkgerror.NoError
 }
 
-func (s *EmployeeServiceImpl) DeleteEmployeeByID(ctx echo.Context, req model.DeleteEmployeeByIDRequest) pkgerror.CustomError {
-	rctx := ctx.Request().Context()
-	err := s.repo.DeleteEmployee(rctx, uint(req.EmployeeID))
+func (s *EmployeeServiceImpl) DeleteEmployeeByID(ctx context.Context, principal model.Principal, req model.DeleteEmployeeByIDRequest) pkgerror.CustomError {
+	if req.Purge && !principal.Superadmin {
+		return pkgerror.ErrForbiddenRequest.WithError(errors.New("only superadmin can permanently delete employees"))
+	}
+	employee, err := s.repo.FindEmployeeByID(ctx, uint(req.EmployeeID))
+	if req.Purge && errors.Is(gorm.ErrRecordNotFound, err) {
+		// Employees in the trash can be purged too
+		employee, err = s.repo.FindDeletedEmployeeByID(ctx, uint(req.EmployeeID))
+	}
 	if err != nil {
-		log.Error("Delete employee by ID error: ", err)
+		log.Error("Find employee by ID error: ", err)
 		if errors.Is(gorm.ErrRecordNotFound, err) {
 			return pkgerror.ErrEmployeeNotFound.WithError(err)
 		}
 		return pkgerror.ErrSystemError.WithError(err)
 	}
+	if ce := s.authorize(principal, ActionDeleteEmployee, employee); !ce.IsNoError() {
+		return ce
+	}
+	if ce := checkEmployeeVersion(req.IfMatch, employee); !ce.IsNoError() {
+		return ce
+	}
+
+	if req.Purge {
+		err = s.repo.PurgeEmployee(ctx, employee.ID, employee.Version)
+	} else {
+		err = s.repo.DeleteEmployee(ctx, employee.ID, employee.Version)
+	}
+	if err != nil {
+		log.Error("Delete employee by ID error: ", err)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return pkgerror.ErrPreconditionFailed.WithError(err)
+		}
+		return pkgerror.ErrSystemError.WithError(err)
+	}
 
 	return pkgerror.NoError
 }
+
+// createAppID returns the app a new employee is created in, the requested
+// one or else the only app of the tenant scope of ctx
+func createAppID(ctx context.Context, requested int) (int, pkgerror.CustomError) {
+	scope, _ := contextutil.GetTenantScope(ctx)
+	if requested == 0 {
+		if !scope.All && len(scope.AppIDs) == 1 {
+			return scope.AppIDs[0], pkgerror.NoError
+		}
+		return 0, pkgerror.ErrInvalidParams.WithError(errors.New("Employee `app_id` is required when the caller has several apps."))
+	}
+	if !scope.Contains(requested) {
+		return 0, pkgerror.ErrForbiddenRequest.WithError(fmt.Errorf("app %d is outside of the caller apps", requested))
+	}
+	return requested, pkgerror.NoError
+}
+
+// normalizeEmail stores the emails in lower case, they are unique per app
+// whatever their case
+func normalizeEmail(email string) string {
+	return strings.ToLower(email)
+}
+
+// checkEmployeeVersion compares the If-Match header sent by the client with
+// the current version of the employee
+func checkEmployeeVersion(ifMatch string, employee entity.Employee) pkgerror.CustomError {
+	if ifMatch == "" {
+		return pkgerror.ErrPreconditionRequired
+	}
+	if !etagutil.Match(ifMatch, etagutil.Version(employee.Version)) {
+		return pkgerror.ErrPreconditionFailed.WithError(fmt.Errorf("current ETag is %s", etagutil.Version(employee.Version)))
+	}
+	return pkgerror.NoError
+}
+
+func (s EmployeeServiceImpl) GetDeletedEmployees(ctx context.Context, principal model.Principal, filter model.GetEmployeesFilter) (*[]model.GetDeletedEmployeesResult, *model.Pagination, pkgerror.CustomError) {
+	var customErr pkgerror.CustomError
+	if filter.PolicyScope, customErr = s.readScope(principal); !customErr.IsNoError() {
+		return nil, nil, customErr
+	}
+	employees, err := s.repo.FindDeletedEmployees(ctx, filter)
+	if err != nil {
+		log.Error("Find deleted employees error: ", err)
+		return nil, nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	total, err := s.repo.CountDeletedEmployees(ctx, filter)
+	if err != nil {
+		log.Error("Count deleted employees error: ", err)
+		return nil, nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	results := []model.GetDeletedEmployeesResult{}
+	for _, employee := range employees {
+		result := model.GetDeletedEmployeesResult{}
+		copyutil.Copy(&employee, &result)
+		result.DeletedAt = employee.DeletedAt.Time
+		results = append(results, result)
+	}
+	return &results, model.NewPagination(filter.PageRequest, total), pkgerror.NoError
+}
+
+func (s *EmployeeServiceImpl) RestoreEmployee(ctx context.Context, principal model.Principal, req model.RestoreEmployeeRequest) (*model.GetEmployeeByIDResult, pkgerror.CustomError) {
+	employee, err := s.repo.FindDeletedEmployeeByID(ctx, uint(req.EmployeeID))
+	if err != nil {
+		log.Error("Find deleted employee by ID error: ", err)
+		if errors.Is(gorm.ErrRecordNotFound, err) {
+			return nil, pkgerror.ErrEmployeeNotFound.WithError(err)
+		}
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	if ce := s.authorize(principal, ActionRestoreEmployee, employee); !ce.IsNoError() {
+		return nil, ce
+	}
+
+	// The email may have been taken by another employee since the deletion
+	employeeByEmail, err := s.repo.FindEmployeeByEmail(ctx, employee.AppID, employee.Email)
+	if err != nil && !errors.Is(gorm.ErrRecordNotFound, err) {
+		log.Error("Find user by Email error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	if employeeByEmail.Email != "" {
+		return nil, pkgerror.ErrEmployeeIsExist.WithError(errors.New("Employee `email` is already used by another employee."))
+	}
+
+	err = s.repo.RestoreEmployee(ctx, employee.ID)
+	if err != nil {
+		log.Error("Restore employee error: ", err)
+		if errors.Is(gorm.ErrRecordNotFound, err) {
+			return nil, pkgerror.ErrEmployeeNotFound.WithError(err)
+		}
+		// taken by an employee created or restored since the email check
+		if errors.Is(err, repository.ErrEmployeeEmailTaken) {
+			return nil, pkgerror.ErrEmployeeIsExist.WithError(err)
+		}
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	result := model.GetEmployeeByIDResult{}
+	copyutil.Copy(&employee, &result)
+	return &result, pkgerror.NoError
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"backend_test/constant"
+	"backend_test/entity"
+	"backend_test/model"
+	"backend_test/pkg/config"
+	"backend_test/pkg/util/cursorutil"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/copyutil"
+
+	"github.com/labstack/gommon/log"
+)
+
+// employeeCursor is the signed payload behind the opaque cursors returned by
+// the employee listing. It carries the sort it was issued for, so a cursor
+// cannot silently be reused with a different ordering.
+type employeeCursor struct {
+	Sort     string            `json:"s"`
+	Values   []json.RawMessage `json:"v"`
+	Backward bool              `json:"b,omitempty"`
+}
+
+func (s EmployeeServiceImpl) getEmployeesByCursor(ctx context.Context, filter model.GetEmployeesFilter) (*[]model.GetEmployeesResult, *model.Pagination, pkgerror.CustomError) {
+	limit := filter.CursorRequest.Limit
+	keyset := model.Keyset{}
+	if filter.CursorRequest.Cursor != "" {
+		cursor := employeeCursor{}
+		err := cursorutil.Decode(filter.CursorRequest.Cursor, config.Data.Pagination.CursorSecret, &cursor)
+		if err != nil {
+			return nil, nil, pkgerror.ErrInvalidParams.WithError(err)
+		}
+		if len(filter.Sorts) == 0 {
+			filter.Sorts, err = model.ParseEmployeeSort(cursor.Sort)
+			if err != nil {
+				return nil, nil, pkgerror.ErrInvalidParams.WithError(cursorutil.ErrInvalidCursor)
+			}
+		}
+		if cursor.Sort != model.FormatEmployeeSort(filter.Sorts) {
+			return nil, nil, pkgerror.ErrInvalidParams.WithError(errors.New("cursor was issued for a different sort"))
+		}
+		keyset.Values, err = decodeEmployeeKeysetValues(model.EmployeeSortKeys(filter.Sorts), cursor.Values)
+		if err != nil {
+			return nil, nil, pkgerror.ErrInvalidParams.WithError(err)
+		}
+		keyset.Backward = cursor.Backward
+	}
+
+	// Fetch one extra row to know whether there is another page
+	employees, err := s.repo.FindEmployeesByKeyset(ctx, filter, keyset, limit+1)
+	if err != nil {
+		log.Error("Find employees by keyset error: ", err)
+		return nil, nil, pkgerror.ErrSystemError
+	}
+	hasMore := len(employees) > limit
+	if hasMore {
+		employees = employees[:limit]
+	}
+	if keyset.Backward {
+		for i, j := 0, len(employees)-1; i < j; i, j = i+1, j-1 {
+			employees[i], employees[j] = employees[j], employees[i]
+		}
+	}
+
+	pagination := &model.Pagination{PageSize: &limit}
+	if len(employees) > 0 {
+		hasPrev := hasMore
+		hasNext := len(keyset.Values) > 0
+		if !keyset.Backward {
+			hasPrev, hasNext = hasNext, hasMore
+		}
+		if hasPrev {
+			pagination.PrevCursor, err = encodeEmployeeCursor(filter.Sorts, employees[0], true)
+		}
+		if err == nil && hasNext {
+			pagination.NextCursor, err = encodeEmployeeCursor(filter.Sorts, employees[len(employees)-1], false)
+		}
+		if err != nil {
+			log.Error("Encode employee cursor error: ", err)
+			return nil, nil, pkgerror.ErrSystemError.WithError(err)
+		}
+	}
+
+	results := []model.GetEmployeesResult{}
+	copyutil.Copy(&employees, &results)
+	return &results, pagination, pkgerror.NoError
+}
+
+func encodeEmployeeCursor(sorts []model.EmployeeSort, employee entity.Employee, backward bool) (*string, error) {
+	cursor := employeeCursor{
+		Sort:     model.FormatEmployeeSort(sorts),
+		Backward: backward,
+	}
+	for _, k := range model.EmployeeSortKeys(sorts) {
+		b, err := json.Marshal(employeeColumnValue(employee, k.Column))
+		if err != nil {
+			return nil, err
+		}
+		cursor.Values = append(cursor.Values, b)
+	}
+	str, err := cursorutil.Encode(cursor, config.Data.Pagination.CursorSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &str, nil
+}
+
+func decodeEmployeeKeysetValues(keys []model.EmployeeSort, raws []json.RawMessage) ([]interface{}, error) {
+	if len(keys) != len(raws) {
+		return nil, cursorutil.ErrInvalidCursor
+	}
+	values := []interface{}{}
+	for i, k := range keys {
+		var err error
+		switch k.Column {
+		case constant.EmployeeColumnID:
+			var v uint
+			err = json.Unmarshal(raws[i], &v)
+			values = append(values, v)
+		case constant.EmployeeColumnHireDate, constant.EmployeeColumnCreatedAt, constant.EmployeeColumnUpdatedAt:
+			var v time.Time
+			err = json.Unmarshal(raws[i], &v)
+			values = append(values, v)
+		default:
+			var v string
+			err = json.Unmarshal(raws[i], &v)
+			values = append(values, v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad %s value", cursorutil.ErrInvalidCursor, k.Column)
+		}
+	}
+	return values, nil
+}
+
+func employeeColumnValue(employee entity.Employee, column constant.EmployeeColumn) interface{} {
+	switch column {
+	case constant.EmployeeColumnID:
+		return employee.ID
+	case constant.EmployeeColumnFirstName:
+		return employee.FirstName
+	case constant.EmployeeColumnLastName:
+		return employee.LastName
+	case constant.EmployeeColumnEmail:
+		return employee.Email
+	case constant.EmployeeColumnHireDate:
+		return employee.HireDate
+	case constant.EmployeeColumnCreatedAt:
+		return employee.CreatedAt
+	case constant.EmployeeColumnUpdatedAt:
+		return employee.UpdatedAt
+	}
+	return nil
+}
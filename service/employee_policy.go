@@ -0,0 +1,85 @@
+package service
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"backend_test/pkg/policy"
+
+	pkgerror "backend_test/pkg/error"
+
+	"github.com/labstack/gommon/log"
+)
+
+// Actions on an employee the policies can be written for
+const (
+	ActionReadEmployee    = "employees:read"
+	ActionUpdateEmployee  = "employees:update"
+	ActionDeleteEmployee  = "employees:delete"
+	ActionRestoreEmployee = "employees:restore"
+)
+
+// EmployeePolicyResource declares the employee attributes available to the
+// policy conditions
+var EmployeePolicyResource = policy.Resource{
+	Actions: []string{ActionReadEmployee, ActionUpdateEmployee, ActionDeleteEmployee, ActionRestoreEmployee},
+	Attributes: policy.Schema{
+		"resource.id":            policy.KindNumber,
+		"resource.email":         policy.KindString,
+		"resource.first_name":    policy.KindString,
+		"resource.last_name":     policy.KindString,
+		"resource.manager_email": policy.KindString,
+	},
+}
+
+// employeePolicyColumns maps the policy attributes to the employee columns
+// so the read policies can scope the list queries, an employee without a
+// team lead has a NULL manager email like the unset attribute
+var employeePolicyColumns = map[string]string{
+	"resource.id":            "id",
+	"resource.email":         "email",
+	"resource.first_name":    "first_name",
+	"resource.last_name":     "last_name",
+	"resource.manager_email": "nullif(manager_email, '')",
+}
+
+func employeeAttributes(employee entity.Employee) policy.Attributes {
+	attrs := policy.Attributes{
+		"resource.id":         int64(employee.ID),
+		"resource.email":      employee.Email,
+		"resource.first_name": employee.FirstName,
+		"resource.last_name":  employee.LastName,
+	}
+	// an employee without a team lead must not match a subject without email
+	if employee.ManagerEmail != "" {
+		attrs["resource.manager_email"] = employee.ManagerEmail
+	}
+	return attrs
+}
+
+// authorize evaluates the policies of the action on the loaded employee,
+// superadmins are not subject to policies
+func (s *EmployeeServiceImpl) authorize(principal model.Principal, action string, employee entity.Employee) pkgerror.CustomError {
+	if principal.Superadmin {
+		return pkgerror.NoError
+	}
+	if err := s.policies.Authorize(action, policy.SubjectAttributes(principal), employeeAttributes(employee)); err != nil {
+		log.Errorf("User %d %s employee %d error: %v", principal.UserID, action, employee.ID, err)
+		return pkgerror.ErrForbiddenRequest.WithError(err)
+	}
+	return pkgerror.NoError
+}
+
+// readScope renders the read policies for the principal as a condition on
+// the employee rows, so listing and searching return only the employees
+// the principal could read one by one
+func (s *EmployeeServiceImpl) readScope(principal model.Principal) (model.PolicyScope, pkgerror.CustomError) {
+	if principal.Superadmin {
+		return model.PolicyScope{}, pkgerror.NoError
+	}
+	scope, err := s.policies.Scope(ActionReadEmployee, policy.SubjectAttributes(principal), employeePolicyColumns)
+	if err != nil {
+		log.Errorf("User %d %s scope error: %v", principal.UserID, ActionReadEmployee, err)
+		return model.PolicyScope{}, pkgerror.ErrSystemError.WithError(err)
+	}
+	return scope, pkgerror.NoError
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"backend_test/entity"
+	mocks "backend_test/mocks/repository"
+	"backend_test/model"
+	"backend_test/pkg/config"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/policy"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newConfigPolicies(t *testing.T) *policy.Engine {
+	policies, err := policy.NewEngine(config.Data.Policies, EmployeePolicyResource)
+	assert.Nil(t, err)
+	return policies
+}
+
+func TestEmployeePolicies(t *testing.T) {
+	report := entity.Employee{
+		ID:           2,
+		FirstName:    "Report",
+		LastName:     "Employee",
+		Email:        "report@corp.id",
+		HireDate:     time.Date(2023, 6, 27, 0, 0, 0, 0, time.UTC),
+		ManagerEmail: "lead@corp.id",
+		Version:      1,
+	}
+	lead := model.Principal{UserID: 7, Email: "lead@corp.id"}
+	other := model.Principal{UserID: 8, Email: "other@corp.id"}
+	admin := model.Principal{UserID: 9, Email: "admin@corp.id", Roles: []string{"hr_admin"}}
+	self := model.Principal{UserID: 10, Email: "report@corp.id"}
+	edit := model.EditEmployeeRequest{
+		EmployeeID:   2,
+		FirstName:    "Report",
+		LastName:     "Renamed",
+		Email:        "report@corp.id",
+		HireDate:     "2023-06-27",
+		ManagerEmail: "lead@corp.id",
+		IfMatch:      `"1"`,
+	}
+	testCases := []struct {
+		Name          string
+		Principal     model.Principal
+		Edit          bool
+		ExpectedRule  string
+		ExpectedError pkgerror.CustomError
+	}{
+		{Name: "LeadReadsReport", Principal: lead, ExpectedError: pkgerror.NoError},
+		{Name: "SelfRead", Principal: self, ExpectedError: pkgerror.NoError},
+		{Name: "OtherRead", Principal: other, ExpectedRule: "read_own_record_or_reports", ExpectedError: pkgerror.ErrForbiddenRequest},
+		{Name: "LeadEditsReport", Principal: lead, Edit: true, ExpectedError: pkgerror.NoError},
+		{Name: "AdminEdits", Principal: admin, Edit: true, ExpectedError: pkgerror.NoError},
+		{Name: "SelfEdit", Principal: self, Edit: true, ExpectedRule: "team_lead_edits_own_reports", ExpectedError: pkgerror.ErrForbiddenRequest},
+		{Name: "SuperadminEdits", Principal: createPrincipal(true), Edit: true, ExpectedError: pkgerror.NoError},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			r.On("FindEmployeeByID", context.Background(), uint(2)).Return(report, nil)
+			s := NewEmployeeService(r, testValidator, newConfigPolicies(t))
+			var err pkgerror.CustomError
+			if tc.Edit {
+				if tc.ExpectedError.IsNoError() {
+					r.On("FindEmployeeByEmail", context.Background(), 0, "report@corp.id").Return(report, nil)
+					onWithTx(r)
+					r.On("UpdateEmployee", context.Background(), mock.Anything).Return(nil)
+				}
+				_, err = s.EditEmployee(context.Background(), tc.Principal, edit)
+			} else {
+				_, err = s.GetEmployeeByID(context.Background(), tc.Principal, model.GetEmployeeByIDRequest{EmployeeID: 2})
+			}
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			if tc.ExpectedRule != "" && assert.NotNil(t, err.Err) {
+				assert.Contains(t, err.Err.Error(), tc.ExpectedRule)
+			}
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestEmployeeReadScope(t *testing.T) {
+	ownOrReports := model.PolicyScope{
+		SQL:  "(coalesce(email = ?, false) or coalesce(nullif(manager_email, '') = ?, false))",
+		Args: []interface{}{"lead@corp.id", "lead@corp.id"},
+	}
+	testCases := []struct {
+		Name          string
+		Principal     model.Principal
+		ExpectedScope model.PolicyScope
+	}{
+		{Name: "Lead", Principal: model.Principal{UserID: 7, Email: "lead@corp.id"}, ExpectedScope: ownOrReports},
+		{Name: "WithoutEmail", Principal: model.Principal{UserID: 8}, ExpectedScope: model.PolicyScope{SQL: "false"}},
+		{Name: "HrStaff", Principal: model.Principal{UserID: 9, Email: "hr@corp.id", Roles: []string{"hr_staff"}}},
+		{Name: "Superadmin", Principal: createPrincipal(true)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			filter := model.GetEmployeesFilter{PageRequest: model.PageRequest{PageNum: 1, PageSize: 10}, PolicyScope: tc.ExpectedScope}
+			search := model.SearchEmployeesRequest{Query: "jon", PageRequest: filter.PageRequest, PolicyScope: tc.ExpectedScope}
+			r := new(mocks.Repository)
+			r.On("FindEmployees", context.Background(), filter).Return([]entity.Employee{}, nil)
+			r.On("CountEmployees", context.Background(), filter).Return(0, nil)
+			r.On("FindDeletedEmployees", context.Background(), filter).Return([]entity.Employee{}, nil)
+			r.On("CountDeletedEmployees", context.Background(), filter).Return(0, nil)
+			r.On("SearchEmployees", context.Background(), search).Return([]entity.EmployeeSearchHit{}, 0, nil)
+			r.On("SearchEmployeesFuzzy", context.Background(), search).Return([]entity.EmployeeSearchHit{}, 0, nil)
+			s := NewEmployeeService(r, testValidator, newConfigPolicies(t))
+
+			filter.PolicyScope = model.PolicyScope{}
+			search.PolicyScope = model.PolicyScope{}
+			_, _, err := s.GetEmployees(context.Background(), tc.Principal, filter)
+			assert.True(t, err.IsNoError())
+			_, _, err = s.GetDeletedEmployees(context.Background(), tc.Principal, filter)
+			assert.True(t, err.IsNoError())
+			_, _, err = s.SearchEmployees(context.Background(), tc.Principal, search)
+			assert.True(t, err.IsNoError())
+			r.AssertExpectations(t)
+		})
+	}
+}
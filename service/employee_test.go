@@ -1,18 +1,22 @@
 package service
 
 import (
+	"backend_test/constant"
 	"backend_test/entity"
 	mocks "backend_test/mocks/repository"
 	"backend_test/model"
 	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/contextutil"
 	"backend_test/pkg/util/copyutil"
+	"backend_test/pkg/util/patchutil"
+	"backend_test/repository"
 	"context"
 	"errors"
-	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"gorm.io/gorm"
 	"testing"
+	"time"
 )
 
 func getExpectedEmployeesResult() *[]model.GetEmployeesResult {
@@ -26,29 +30,41 @@ func getExpectedEmployeesResult() *[]model.GetEmployeesResult {
 }
 
 func TestGetEmployees(t *testing.T) {
+	filter := model.GetEmployeesFilter{PageRequest: model.PageRequest{PageNum: 1, PageSize: 10}}
 	testCases := []struct {
-		Name           string
-		InitService    func(r *mocks.Repository) EmployeeService
-		Context        echo.Context
-		RequestParam   model.GetEmployeesFilter
-		ExpectedCount  int
-		ExpectedResult *[]model.GetEmployeesResult
-		ExpectedError  pkgerror.CustomError
+		Name               string
+		InitService        func(r *mocks.Repository) EmployeeService
+		Principal          model.Principal
+		RequestParam       model.GetEmployeesFilter
+		ExpectedResult     *[]model.GetEmployeesResult
+		ExpectedPagination *model.Pagination
+		ExpectedError      pkgerror.CustomError
 	}{
 		{
-			Name: "FindAllEmployeesError",
+			Name: "FindEmployeesError",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployees", context.Background(), filter).Return([]entity.Employee{}, errors.New("database error"))
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Principal:      createPrincipal(false),
+			RequestParam:   filter,
+			ExpectedResult: nil,
+			ExpectedError:  pkgerror.ErrSystemError,
+		},
+		{
+			Name: "CountEmployeesError",
 			InitService: func(r *mocks.Repository) EmployeeService {
-				r.On("FindAllEmployees", context.Background(), model.GetEmployeesFilter{}).Return([]entity.Employee{}, errors.New("database error"))
-				return NewEmployeeService(r)
+				r.On("FindEmployees", context.Background(), filter).Return([]entity.Employee{}, nil)
+				r.On("CountEmployees", context.Background(), filter).Return(0, errors.New("database error"))
+				return NewEmployeeService(r, testValidator, testPolicies)
 			},
-			Context:        createEchoContext(false),
-			RequestParam:   model.GetEmployeesFilter{},
-			ExpectedCount:  len(*getExpectedEmployeesResult()),
+			Principal:      createPrincipal(false),
+			RequestParam:   filter,
 			ExpectedResult: nil,
 			ExpectedError:  pkgerror.ErrSystemError,
 		},
 		{
-			Name: "FindAllEmployeesSuccess",
+			Name: "FindEmployeesSuccess",
 			InitService: func(r *mocks.Repository) EmployeeService {
 				employee := entity.Employee{
 					ID:        1,
@@ -57,28 +73,29 @@ func TestGetEmployees(t *testing.T) {
 					Email:     "employee@email.com",
 				}
 				expectedReturn := []entity.Employee{employee}
-				r.On("FindAllEmployees", context.Background(), model.GetEmployeesFilter{}).Return(expectedReturn, nil)
-				return NewEmployeeService(r)
+				r.On("FindEmployees", context.Background(), filter).Return(expectedReturn, nil)
+				r.On("CountEmployees", context.Background(), filter).Return(21, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
 			},
-			Context:        createEchoContext(false),
-			RequestParam:   model.GetEmployeesFilter{},
-			ExpectedCount:  len(*getExpectedEmployeesResult()),
-			ExpectedResult: getExpectedEmployeesResult(),
-			ExpectedError:  pkgerror.NoError,
+			Principal:          createPrincipal(false),
+			RequestParam:       filter,
+			ExpectedResult:     getExpectedEmployeesResult(),
+			ExpectedPagination: model.NewPagination(filter.PageRequest, 21),
+			ExpectedError:      pkgerror.NoError,
 		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
 			r := new(mocks.Repository)
 			s := tc.InitService(r)
-			results, err := s.GetEmployees(tc.Context, tc.RequestParam)
+			results, pagination, err := s.GetEmployees(context.Background(), tc.Principal, tc.RequestParam)
 			assert.Equal(t, tc.ExpectedResult, results)
+			assert.Equal(t, tc.ExpectedPagination, pagination)
 			assert.Equal(t, tc.ExpectedError.Code, err.Code)
 			assert.Equal(t, tc.ExpectedError.HttpCode, err.HttpCode)
 			assert.Equal(t, tc.ExpectedError.Msg, err.Msg)
-			if tc.ExpectedResult != nil {
-				assert.NotNil(t, results)
-				assert.Equal(t, tc.ExpectedResult, results)
+			if tc.ExpectedPagination != nil {
+				assert.Equal(t, 3, *pagination.TotalPage)
 			}
 			r.AssertExpectations(t)
 		})
@@ -94,7 +111,7 @@ func TestGetEmployeeByID(t *testing.T) {
 	testCases := []struct {
 		Name           string
 		InitService    func(r *mocks.Repository) EmployeeService
-		Context        echo.Context
+		Principal      model.Principal
 		ExpectedResult *model.GetEmployeeByIDResult
 		ExpectedError  pkgerror.CustomError
 	}{
@@ -102,27 +119,27 @@ func TestGetEmployeeByID(t *testing.T) {
 			Name: "SystemError",
 			InitService: func(r *mocks.Repository) EmployeeService {
 				r.On("FindEmployeeByID", mock.Anything, mock.Anything).Return(entity.Employee{}, errors.New("database error"))
-				return NewEmployeeService(r)
+				return NewEmployeeService(r, testValidator, testPolicies)
 			},
-			Context:       createEchoContext(true),
+			Principal:     createPrincipal(true),
 			ExpectedError: pkgerror.ErrSystemError,
 		},
 		{
 			Name: "EmployeeNotFound",
 			InitService: func(r *mocks.Repository) EmployeeService {
 				r.On("FindEmployeeByID", mock.Anything, mock.Anything).Return(entity.Employee{}, gorm.ErrRecordNotFound)
-				return NewEmployeeService(r)
+				return NewEmployeeService(r, testValidator, testPolicies)
 			},
-			Context:       createEchoContext(true),
+			Principal:     createPrincipal(true),
 			ExpectedError: pkgerror.ErrEmployeeNotFound,
 		},
 		{
 			Name: "Success",
 			InitService: func(r *mocks.Repository) EmployeeService {
 				r.On("FindEmployeeByID", mock.Anything, mock.Anything).Return(employee, nil)
-				return NewEmployeeService(r)
+				return NewEmployeeService(r, testValidator, testPolicies)
 			},
-			Context:        createEchoContext(true),
+			Principal:      createPrincipal(true),
 			ExpectedError:  pkgerror.NoError,
 			ExpectedResult: &result,
 		},
@@ -131,7 +148,7 @@ func TestGetEmployeeByID(t *testing.T) {
 		t.Run(tc.Name, func(t *testing.T) {
 			r := new(mocks.Repository)
 			s := tc.InitService(r)
-			result, err := s.GetEmployeeByID(tc.Context, model.GetEmployeeByIDRequest{})
+			result, err := s.GetEmployeeByID(context.Background(), tc.Principal, model.GetEmployeeByIDRequest{})
 			assert.Equal(t, tc.ExpectedError.Code, err.Code)
 			assert.Equal(t, tc.ExpectedError.HttpCode, err.HttpCode)
 			assert.Equal(t, tc.ExpectedError.Msg, err.Msg)
@@ -148,7 +165,7 @@ func TestCreateEmployee(t *testing.T) {
 	testCases := []struct {
 		Name           string
 		InitService    func(r *mocks.Repository) EmployeeService
-		Context        echo.Context
+		Principal      model.Principal
 		Request        model.CreateEmployeeRequest
 		ExpectedResult *model.CreateEmployeeResult
 		ExpectedError  pkgerror.CustomError
@@ -156,10 +173,10 @@ func TestCreateEmployee(t *testing.T) {
 		{
 			Name: "FindEmployeeByEmailErrorSystem",
 			InitService: func(r *mocks.Repository) EmployeeService {
-				r.On("FindEmployeeByEmail", context.Background(), "employee@email.com").Return(entity.Employee{}, errors.New("database error"))
-				return NewEmployeeService(r)
+				r.On("FindEmployeeByEmail", tenantCtx, 1, "employee@email.com").Return(entity.Employee{}, errors.New("database error"))
+				return NewEmployeeService(r, testValidator, testPolicies)
 			},
-			Context: createEchoContext(false),
+			Principal: createPrincipal(false),
 			Request: model.CreateEmployeeRequest{
 				Email: "employee@email.com",
 			},
@@ -169,10 +186,10 @@ func TestCreateEmployee(t *testing.T) {
 		{
 			Name: "FindEmployeeByEmailErrorExisted",
 			InitService: func(r *mocks.Repository) EmployeeService {
-				r.On("FindEmployeeByEmail", context.Background(), "employee@email.com").Return(entity.Employee{ID: uint(1), Email: "employee@email.com"}, nil)
-				return NewEmployeeService(r)
+				r.On("FindEmployeeByEmail", tenantCtx, 1, "employee@email.com").Return(entity.Employee{ID: uint(1), Email: "employee@email.com"}, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
 			},
-			Context: createEchoContext(false),
+			Principal: createPrincipal(false),
 			Request: model.CreateEmployeeRequest{
 				Email: "employee@email.com",
 			},
@@ -182,13 +199,12 @@ func TestCreateEmployee(t *testing.T) {
 		{
 			Name: "CreateEmployeeError",
 			InitService: func(r *mocks.Repository) EmployeeService {
-				r.On("FindEmployeeByEmail", context.Background(), "employee@email.com").Return(entity.Employee{}, nil)
-				r.On("TxBegin").Return(nil)
-				r.On("CreateEmployee", context.Background(), mock.Anything).Return(errors.New("database error"))
-				r.On("TxRollback").Return(nil)
-				return NewEmployeeService(r)
+				r.On("FindEmployeeByEmail", tenantCtx, 1, "employee@email.com").Return(entity.Employee{}, nil)
+				onWithTx(r)
+				r.On("CreateEmployee", tenantCtx, mock.Anything).Return(errors.New("database error"))
+				return NewEmployeeService(r, testValidator, testPolicies)
 			},
-			Context: createEchoContext(true),
+			Principal: createPrincipal(true),
 			Request: model.CreateEmployeeRequest{
 				FirstName: "First Employee 0",
 				LastName:  "Last Name 0",
@@ -201,31 +217,50 @@ func TestCreateEmployee(t *testing.T) {
 		{
 			Name: "CreateEmployeeSuccess",
 			InitService: func(r *mocks.Repository) EmployeeService {
-				r.On("FindEmployeeByEmail", context.Background(), "employee@email.com").Return(entity.Employee{}, nil)
-				r.On("TxBegin").Return(nil)
-				r.On("CreateEmployee", context.Background(), mock.Anything).Return(nil)
-				r.On("TxCommit").Return(nil)
-				return NewEmployeeService(r)
+				r.On("FindEmployeeByEmail", tenantCtx, 1, "employee@email.com").Return(entity.Employee{}, nil)
+				onWithTx(r)
+				r.On("CreateEmployee", tenantCtx, mock.Anything).Return(nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
 			},
-			Context: createEchoContext(true),
+			Principal: createPrincipal(true),
 			Request: model.CreateEmployeeRequest{
 				FirstName: "First Employee 0",
 				LastName:  "Last Name 0",
 				Email:     "employee@email.com",
 			},
 			ExpectedResult: &model.CreateEmployeeResult{
+				AppID:     1,
 				FirstName: "First Employee 0",
 				LastName:  "Last Name 0",
 				Email:     "employee@email.com",
 			},
 			ExpectedError: pkgerror.NoError,
 		},
+		{
+			Name: "EmailsInLowerCase",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByEmail", tenantCtx, 1, "employee@email.com").Return(entity.Employee{}, gorm.ErrRecordNotFound)
+				onWithTx(r)
+				r.On("CreateEmployee", tenantCtx, mock.MatchedBy(func(e *entity.Employee) bool {
+					return e.Email == "employee@email.com" && e.ManagerEmail == "lead@email.com"
+				})).Return(nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Principal: createPrincipal(true),
+			Request: model.CreateEmployeeRequest{
+				FirstName:    "First Employee 0",
+				LastName:     "Last Name 0",
+				Email:        "Employee@Email.com",
+				ManagerEmail: "LEAD@email.com",
+			},
+			ExpectedError: pkgerror.NoError,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
 			r := new(mocks.Repository)
 			s := tc.InitService(r)
-			result, err := s.CreateEmployee(tc.Context, tc.Request)
+			result, err := s.CreateEmployee(tenantCtx, tc.Principal, tc.Request)
 			assert.Equal(t, tc.ExpectedError.Code, err.Code)
 			assert.Equal(t, tc.ExpectedError.HttpCode, err.HttpCode)
 			assert.Equal(t, tc.ExpectedError.Msg, err.Msg)
@@ -237,3 +272,460 @@ func TestCreateEmployee(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateEmployeeAppID(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Scope         model.TenantScope
+		AppID         int
+		ExpectedAppID int
+		ExpectedError pkgerror.CustomError
+	}{
+		{Name: "OnlyApp", Scope: model.TenantScope{AppIDs: []int{3}}, ExpectedAppID: 3, ExpectedError: pkgerror.NoError},
+		{Name: "Requested", Scope: model.TenantScope{AppIDs: []int{3, 4}}, AppID: 4, ExpectedAppID: 4, ExpectedError: pkgerror.NoError},
+		{Name: "Required", Scope: model.TenantScope{AppIDs: []int{3, 4}}, ExpectedError: pkgerror.ErrInvalidParams},
+		{Name: "OutsideScope", Scope: model.TenantScope{AppIDs: []int{3}}, AppID: 4, ExpectedError: pkgerror.ErrForbiddenRequest},
+		{Name: "CrossTenant", Scope: model.TenantScope{All: true}, AppID: 4, ExpectedAppID: 4, ExpectedError: pkgerror.NoError},
+		{Name: "NoScope", ExpectedError: pkgerror.ErrInvalidParams},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.Name != "NoScope" {
+				ctx = contextutil.WithTenantScope(ctx, tc.Scope)
+			}
+			r := new(mocks.Repository)
+			if tc.ExpectedError.IsNoError() {
+				r.On("FindEmployeeByEmail", ctx, tc.ExpectedAppID, "employee@email.com").Return(entity.Employee{}, gorm.ErrRecordNotFound)
+				onWithTx(r)
+				r.On("CreateEmployee", ctx, mock.MatchedBy(func(e *entity.Employee) bool { return e.AppID == tc.ExpectedAppID })).Return(nil)
+			}
+			s := NewEmployeeService(r, testValidator, testPolicies)
+			result, err := s.CreateEmployee(ctx, createPrincipal(false), model.CreateEmployeeRequest{AppID: tc.AppID, Email: "employee@email.com"})
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			if tc.ExpectedError.IsNoError() {
+				assert.Equal(t, tc.ExpectedAppID, result.AppID)
+			}
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetEmployeesByCursor(t *testing.T) {
+	hireDate := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	employees := []entity.Employee{
+		{ID: 1, FirstName: "First Employee 0", HireDate: hireDate},
+		{ID: 2, FirstName: "First Employee 1", HireDate: hireDate},
+	}
+	sorts := []model.EmployeeSort{{Column: constant.EmployeeColumnHireDate, Dir: "asc"}}
+	firstPage := model.GetEmployeesFilter{Sorts: sorts, CursorRequest: model.CursorRequest{Limit: 1}}
+
+	r := new(mocks.Repository)
+	s := NewEmployeeService(r, testValidator, testPolicies)
+	r.On("FindEmployeesByKeyset", context.Background(), firstPage, model.Keyset{}, 2).Return(employees, nil).Once()
+	results, pagination, err := s.GetEmployees(context.Background(), createPrincipal(false), firstPage)
+	assert.True(t, err.IsNoError())
+	assert.Equal(t, 1, len(*results))
+	assert.Nil(t, pagination.PrevCursor)
+	if !assert.NotNil(t, pagination.NextCursor) {
+		return
+	}
+
+	// The next cursor points right after the last returned row
+	secondPage := model.GetEmployeesFilter{Sorts: sorts, CursorRequest: model.CursorRequest{Limit: 1, Cursor: *pagination.NextCursor}}
+	expectedKeyset := model.Keyset{Values: []interface{}{hireDate, uint(1)}}
+	r.On("FindEmployeesByKeyset", context.Background(), secondPage, mock.MatchedBy(func(k model.Keyset) bool {
+		return !k.Backward && k.Values[0].(time.Time).Equal(hireDate) && k.Values[1] == expectedKeyset.Values[1]
+	}), 2).Return(employees[1:], nil).Once()
+	results, pagination, err = s.GetEmployees(context.Background(), createPrincipal(false), secondPage)
+	assert.True(t, err.IsNoError())
+	assert.Equal(t, 2, (*results)[0].ID)
+	assert.Nil(t, pagination.NextCursor)
+	assert.NotNil(t, pagination.PrevCursor)
+
+	// A cursor cannot be reused with another sort or tampered with
+	otherSort := secondPage
+	otherSort.Sorts = []model.EmployeeSort{{Column: constant.EmployeeColumnEmail, Dir: "asc"}}
+	_, _, err = s.GetEmployees(context.Background(), createPrincipal(false), otherSort)
+	assert.Equal(t, pkgerror.ErrInvalidParams.Code, err.Code)
+	tampered := secondPage
+	tampered.CursorRequest.Cursor = "x" + tampered.CursorRequest.Cursor
+	_, _, err = s.GetEmployees(context.Background(), createPrincipal(false), tampered)
+	assert.Equal(t, pkgerror.ErrInvalidParams.Code, err.Code)
+	r.AssertExpectations(t)
+}
+
+func TestSearchEmployees(t *testing.T) {
+	req := model.SearchEmployeesRequest{Query: "jon", PageRequest: model.PageRequest{PageNum: 1, PageSize: 10}}
+	hit := entity.EmployeeSearchHit{
+		Employee:  entity.Employee{ID: 1, FirstName: "John", LastName: "Doe"},
+		Rank:      0.5,
+		Highlight: "<mark>John</mark> Doe",
+	}
+	testCases := []struct {
+		Name              string
+		InitService       func(r *mocks.Repository) EmployeeService
+		ExpectedMatchType constant.SearchMatchType
+		ExpectedHighlight bool
+		ExpectedError     pkgerror.CustomError
+	}{
+		{
+			Name: "SearchError",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("SearchEmployees", context.Background(), req).Return(nil, 0, errors.New("database error"))
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			ExpectedError: pkgerror.ErrSystemError,
+		},
+		{
+			Name: "FullTextMatch",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("SearchEmployees", context.Background(), req).Return([]entity.EmployeeSearchHit{hit}, 1, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			ExpectedMatchType: constant.SearchMatchTypeFullText,
+			ExpectedHighlight: true,
+			ExpectedError:     pkgerror.NoError,
+		},
+		{
+			Name: "FuzzyFallback",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				fuzzyHit := hit
+				fuzzyHit.Highlight = ""
+				r.On("SearchEmployees", context.Background(), req).Return([]entity.EmployeeSearchHit{}, 0, nil)
+				r.On("SearchEmployeesFuzzy", context.Background(), req).Return([]entity.EmployeeSearchHit{fuzzyHit}, 1, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			ExpectedMatchType: constant.SearchMatchTypeFuzzy,
+			ExpectedError:     pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			s := tc.InitService(r)
+			results, pagination, err := s.SearchEmployees(context.Background(), createPrincipal(false), req)
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			if tc.ExpectedError.IsNoError() {
+				assert.Equal(t, 1, len(*results))
+				assert.Equal(t, 1, (*results)[0].ID)
+				assert.Equal(t, "John", (*results)[0].FirstName)
+				assert.Equal(t, tc.ExpectedMatchType, (*results)[0].MatchType)
+				assert.Equal(t, tc.ExpectedHighlight, (*results)[0].Highlight != nil)
+				assert.Equal(t, 1, *pagination.TotalData)
+			}
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeleteEmployeeByID(t *testing.T) {
+	employee := entity.Employee{ID: 1, Email: "employee@email.com", Version: 1}
+	testCases := []struct {
+		Name          string
+		InitService   func(r *mocks.Repository) EmployeeService
+		Principal     model.Principal
+		Request       model.DeleteEmployeeByIDRequest
+		ExpectedError pkgerror.CustomError
+	}{
+		{
+			Name: "EmployeeNotFound",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(entity.Employee{}, gorm.ErrRecordNotFound)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Principal:     createPrincipal(false),
+			Request:       model.DeleteEmployeeByIDRequest{EmployeeID: 1, IfMatch: `"1"`},
+			ExpectedError: pkgerror.ErrEmployeeNotFound,
+		},
+		{
+			Name: "PreconditionRequired",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Principal:     createPrincipal(false),
+			Request:       model.DeleteEmployeeByIDRequest{EmployeeID: 1},
+			ExpectedError: pkgerror.ErrPreconditionRequired,
+		},
+		{
+			Name: "PreconditionFailed",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Principal:     createPrincipal(false),
+			Request:       model.DeleteEmployeeByIDRequest{EmployeeID: 1, IfMatch: `"2"`},
+			ExpectedError: pkgerror.ErrPreconditionFailed,
+		},
+		{
+			Name: "VersionConflict",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				r.On("DeleteEmployee", context.Background(), uint(1), 1).Return(repository.ErrVersionConflict)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Principal:     createPrincipal(false),
+			Request:       model.DeleteEmployeeByIDRequest{EmployeeID: 1, IfMatch: `"1"`},
+			ExpectedError: pkgerror.ErrPreconditionFailed,
+		},
+		{
+			Name: "SoftDeleteSuccess",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				r.On("DeleteEmployee", context.Background(), uint(1), 1).Return(nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Principal:     createPrincipal(false),
+			Request:       model.DeleteEmployeeByIDRequest{EmployeeID: 1, IfMatch: `"1"`},
+			ExpectedError: pkgerror.NoError,
+		},
+		{
+			Name: "PurgeForbidden",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Principal:     createPrincipal(false),
+			Request:       model.DeleteEmployeeByIDRequest{EmployeeID: 1, Purge: true, IfMatch: `"1"`},
+			ExpectedError: pkgerror.ErrForbiddenRequest,
+		},
+		{
+			Name: "PurgeDeletedSuccess",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(entity.Employee{}, gorm.ErrRecordNotFound)
+				r.On("FindDeletedEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				r.On("PurgeEmployee", context.Background(), uint(1), 1).Return(nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Principal:     createPrincipal(true),
+			Request:       model.DeleteEmployeeByIDRequest{EmployeeID: 1, Purge: true, IfMatch: "*"},
+			ExpectedError: pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			s := tc.InitService(r)
+			err := s.DeleteEmployeeByID(context.Background(), tc.Principal, tc.Request)
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			assert.Equal(t, tc.ExpectedError.HttpCode, err.HttpCode)
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetDeletedEmployees(t *testing.T) {
+	filter := model.GetEmployeesFilter{PageRequest: model.PageRequest{PageNum: 1, PageSize: 10}}
+	deletedAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := new(mocks.Repository)
+	r.On("FindDeletedEmployees", context.Background(), filter).Return([]entity.Employee{
+		{ID: 1, FirstName: "First Employee 0", DeletedAt: gorm.DeletedAt{Time: deletedAt, Valid: true}},
+	}, nil)
+	r.On("CountDeletedEmployees", context.Background(), filter).Return(1, nil)
+	results, pagination, err := NewEmployeeService(r, testValidator, testPolicies).GetDeletedEmployees(context.Background(), createPrincipal(false), filter)
+	assert.True(t, err.IsNoError())
+	assert.Equal(t, 1, (*results)[0].ID)
+	assert.Equal(t, deletedAt, (*results)[0].DeletedAt)
+	assert.Equal(t, 1, *pagination.TotalData)
+	r.AssertExpectations(t)
+}
+
+func TestRestoreEmployee(t *testing.T) {
+	deleted := entity.Employee{ID: 1, Email: "employee@email.com"}
+	testCases := []struct {
+		Name          string
+		InitService   func(r *mocks.Repository) EmployeeService
+		ExpectedError pkgerror.CustomError
+	}{
+		{
+			Name: "EmployeeNotDeleted",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindDeletedEmployeeByID", context.Background(), uint(1)).Return(entity.Employee{}, gorm.ErrRecordNotFound)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			ExpectedError: pkgerror.ErrEmployeeNotFound,
+		},
+		{
+			Name: "EmailTaken",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindDeletedEmployeeByID", context.Background(), uint(1)).Return(deleted, nil)
+				r.On("FindEmployeeByEmail", context.Background(), 0, deleted.Email).Return(entity.Employee{ID: 2, Email: deleted.Email}, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			ExpectedError: pkgerror.ErrEmployeeIsExist,
+		},
+		{
+			Name: "EmailTakenConcurrently",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindDeletedEmployeeByID", context.Background(), uint(1)).Return(deleted, nil)
+				r.On("FindEmployeeByEmail", context.Background(), 0, deleted.Email).Return(entity.Employee{}, gorm.ErrRecordNotFound)
+				r.On("RestoreEmployee", context.Background(), uint(1)).Return(repository.ErrEmployeeEmailTaken)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			ExpectedError: pkgerror.ErrEmployeeIsExist,
+		},
+		{
+			Name: "Success",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindDeletedEmployeeByID", context.Background(), uint(1)).Return(deleted, nil)
+				r.On("FindEmployeeByEmail", context.Background(), 0, deleted.Email).Return(entity.Employee{}, gorm.ErrRecordNotFound)
+				r.On("RestoreEmployee", context.Background(), uint(1)).Return(nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			ExpectedError: pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			s := tc.InitService(r)
+			result, err := s.RestoreEmployee(context.Background(), createPrincipal(false), model.RestoreEmployeeRequest{EmployeeID: 1})
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			if tc.ExpectedError.IsNoError() {
+				assert.Equal(t, 1, result.ID)
+			}
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPatchEmployee(t *testing.T) {
+	employee := entity.Employee{
+		ID:        1,
+		FirstName: "First Employee 0",
+		LastName:  "Last Name 0",
+		Email:     "employee@email.com",
+		HireDate:  time.Date(2023, 6, 27, 0, 0, 0, 0, time.UTC),
+		Version:   1,
+	}
+	testCases := []struct {
+		Name           string
+		InitService    func(r *mocks.Repository) EmployeeService
+		Request        model.PatchEmployeeRequest
+		ExpectedResult *model.EditEmployeeResult
+		ExpectedError  pkgerror.CustomError
+	}{
+		{
+			Name: "EmployeeNotFound",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(entity.Employee{}, gorm.ErrRecordNotFound)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Request:       model.PatchEmployeeRequest{EmployeeID: 1, IfMatch: `"1"`, PatchType: patchutil.MIMEMergePatch, Patch: []byte(`{}`)},
+			ExpectedError: pkgerror.ErrEmployeeNotFound,
+		},
+		{
+			Name: "PreconditionFailed",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Request:       model.PatchEmployeeRequest{EmployeeID: 1, IfMatch: `"0"`, PatchType: patchutil.MIMEMergePatch, Patch: []byte(`{}`)},
+			ExpectedError: pkgerror.ErrPreconditionFailed,
+		},
+		{
+			Name: "UnknownField",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Request:       model.PatchEmployeeRequest{EmployeeID: 1, IfMatch: `"1"`, PatchType: patchutil.MIMEMergePatch, Patch: []byte(`{"salary": 100}`)},
+			ExpectedError: pkgerror.ErrInvalidParams,
+		},
+		{
+			Name: "MergePatchNotEditableField",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Request:       model.PatchEmployeeRequest{EmployeeID: 1, IfMatch: `"1"`, PatchType: patchutil.MIMEMergePatch, Patch: []byte(`{"EmployeeID": 2, "IfMatch": "\"2\""}`)},
+			ExpectedError: pkgerror.ErrInvalidParams,
+		},
+		{
+			Name: "JsonPatchNotEditableField",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Request:       model.PatchEmployeeRequest{EmployeeID: 1, IfMatch: `"1"`, PatchType: patchutil.MIMEJsonPatch, Patch: []byte(`[{"op": "replace", "path": "/EmployeeID", "value": 2}]`)},
+			ExpectedError: pkgerror.ErrInvalidParams,
+		},
+		{
+			Name: "ValidationError",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Request:       model.PatchEmployeeRequest{EmployeeID: 1, IfMatch: `"1"`, PatchType: patchutil.MIMEMergePatch, Patch: []byte(`{"email": null}`)},
+			ExpectedError: pkgerror.ErrInvalidParams,
+		},
+		{
+			Name: "JsonPatchTestFailed",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Request: model.PatchEmployeeRequest{EmployeeID: 1, IfMatch: `"1"`, PatchType: patchutil.MIMEJsonPatch, Patch: []byte(`[
+				{"op": "test", "path": "/email", "value": "other@email.com"},
+				{"op": "replace", "path": "/email", "value": "new@email.com"}
+			]`)},
+			ExpectedError: pkgerror.ErrInvalidParams,
+		},
+		{
+			Name: "MergePatchSuccess",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				r.On("FindEmployeeByEmail", context.Background(), 0, "new@email.com").Return(entity.Employee{}, gorm.ErrRecordNotFound)
+				onWithTx(r)
+				r.On("UpdateEmployee", context.Background(), mock.MatchedBy(func(e *entity.Employee) bool {
+					return e.Email == "new@email.com" && e.FirstName == employee.FirstName && e.HireDate.Equal(employee.HireDate)
+				})).Return(nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Request: model.PatchEmployeeRequest{EmployeeID: 1, IfMatch: `"1"`, PatchType: patchutil.MIMEMergePatch, Patch: []byte(`{"email": "new@email.com"}`)},
+			ExpectedResult: &model.EditEmployeeResult{
+				ID:        1,
+				FirstName: employee.FirstName,
+				LastName:  employee.LastName,
+				Email:     "new@email.com",
+				HireDate:  employee.HireDate,
+				Version:   1,
+			},
+			ExpectedError: pkgerror.NoError,
+		},
+		{
+			Name: "JsonPatchSuccess",
+			InitService: func(r *mocks.Repository) EmployeeService {
+				r.On("FindEmployeeByID", context.Background(), uint(1)).Return(employee, nil)
+				r.On("FindEmployeeByEmail", context.Background(), 0, employee.Email).Return(employee, nil)
+				onWithTx(r)
+				r.On("UpdateEmployee", context.Background(), mock.Anything).Return(nil)
+				return NewEmployeeService(r, testValidator, testPolicies)
+			},
+			Request: model.PatchEmployeeRequest{EmployeeID: 1, IfMatch: `"1"`, PatchType: patchutil.MIMEJsonPatch, Patch: []byte(`[
+				{"op": "test", "path": "/email", "value": "employee@email.com"},
+				{"op": "replace", "path": "/hire_date", "value": "2024-01-15"}
+			]`)},
+			ExpectedResult: &model.EditEmployeeResult{
+				ID:        1,
+				FirstName: employee.FirstName,
+				LastName:  employee.LastName,
+				Email:     employee.Email,
+				HireDate:  time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+				Version:   1,
+			},
+			ExpectedError: pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			s := tc.InitService(r)
+			result, err := s.PatchEmployee(context.Background(), createPrincipal(false), tc.Request)
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			assert.Equal(t, tc.ExpectedError.HttpCode, err.HttpCode)
+			assert.Equal(t, tc.ExpectedResult, result)
+			r.AssertExpectations(t)
+		})
+	}
+}
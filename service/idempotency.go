@@ -0,0 +1,140 @@
+package service
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"backend_test/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	pkgerror "backend_test/pkg/error"
+
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+)
+
+type IdempotencyService interface {
+	BeginRequest(ctx context.Context, req model.IdempotentRequest) (*model.IdempotentResponse, pkgerror.CustomError)
+	CompleteRequest(ctx context.Context, req model.IdempotentRequest, res model.IdempotentResponse) pkgerror.CustomError
+	ReleaseRequest(ctx context.Context, req model.IdempotentRequest) pkgerror.CustomError
+}
+
+// defaultIdempotencyLease is the lease of a key in progress when none is
+// configured
+const defaultIdempotencyLease = time.Minute
+
+type IdempotencyServiceImpl struct {
+	repo repository.Repository
+	// ttl is how long a key is kept, its repeats are replayed until then
+	ttl time.Duration
+	// lease is how long a request holds its key in progress, a retry takes
+	// over the key of a request that did not complete it by then
+	lease time.Duration
+	purge purgeSchedule
+	now   func() time.Time
+}
+
+func NewIdempotencyService(repo repository.Repository, ttl, lease time.Duration) *IdempotencyServiceImpl {
+	if lease <= 0 {
+		lease = defaultIdempotencyLease
+	}
+	return &IdempotencyServiceImpl{
+		repo:  repo,
+		ttl:   ttl,
+		lease: lease,
+		now:   time.Now,
+	}
+}
+
+// purgeExpired deletes the expired keys when a purge is due, a failure
+// only delays it to the next one
+func (s *IdempotencyServiceImpl) purgeExpired(ctx context.Context, now time.Time) {
+	if !s.purge.due(now) {
+		return
+	}
+	if _, err := s.repo.PurgeIdempotencyKeys(ctx, now); err != nil {
+		log.Error("Purge idempotency keys error: ", err)
+	}
+}
+
+// BeginRequest reserves the key of a request, it returns the stored
+// response when the request is a repeat of a completed one. A key reused
+// with another request or while its request is in progress is a conflict,
+// the key of a request in progress past its lease is taken over.
+func (s *IdempotencyServiceImpl) BeginRequest(ctx context.Context, req model.IdempotentRequest) (*model.IdempotentResponse, pkgerror.CustomError) {
+	now := s.now()
+	s.purgeExpired(ctx, now)
+	lockedUntil := now.Add(s.lease)
+	err := s.repo.ReserveIdempotencyKey(ctx, &entity.IdempotencyKey{
+		Owner:       req.Owner,
+		Key:         req.Key,
+		Fingerprint: req.Fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+		LockedUntil: &lockedUntil,
+	}, now)
+	if err == nil {
+		return nil, pkgerror.NoError
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Error("Reserve idempotency key error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	key, err := s.repo.FindIdempotencyKey(ctx, req.Owner, req.Key)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// released by its request in the meantime
+			return nil, pkgerror.ErrIdempotencyInProgress.WithError(err)
+		}
+		log.Error("Find idempotency key error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	if key.Fingerprint != req.Fingerprint {
+		return nil, pkgerror.ErrIdempotencyKeyReused
+	}
+	if !key.IsCompleted() {
+		return nil, pkgerror.ErrIdempotencyInProgress
+	}
+	res := &model.IdempotentResponse{StatusCode: *key.StatusCode, Body: key.ResponseBody}
+	if key.ResponseHeader != "" {
+		if err := json.Unmarshal([]byte(key.ResponseHeader), &res.Header); err != nil {
+			log.Error("Unmarshal idempotent response header error: ", err)
+			return nil, pkgerror.ErrSystemError.WithError(err)
+		}
+	}
+	return res, pkgerror.NoError
+}
+
+// CompleteRequest stores the first response of a request
+func (s *IdempotencyServiceImpl) CompleteRequest(ctx context.Context, req model.IdempotentRequest, res model.IdempotentResponse) pkgerror.CustomError {
+	header, err := json.Marshal(res.Header)
+	if err != nil {
+		log.Error("Marshal idempotent response header error: ", err)
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	err = s.repo.CompleteIdempotencyKey(ctx, &entity.IdempotencyKey{
+		Owner:          req.Owner,
+		Key:            req.Key,
+		Fingerprint:    req.Fingerprint,
+		StatusCode:     &res.StatusCode,
+		ResponseHeader: string(header),
+		ResponseBody:   res.Body,
+	})
+	if err != nil {
+		log.Error("Complete idempotency key error: ", err)
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	return pkgerror.NoError
+}
+
+// ReleaseRequest deletes the key of a request that failed without a
+// response worth replaying, so that it can be retried
+func (s *IdempotencyServiceImpl) ReleaseRequest(ctx context.Context, req model.IdempotentRequest) pkgerror.CustomError {
+	if err := s.repo.DeleteIdempotencyKey(ctx, req.Owner, req.Key, req.Fingerprint); err != nil {
+		log.Error("Delete idempotency key error: ", err)
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	return pkgerror.NoError
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"backend_test/entity"
+	mocks "backend_test/mocks/repository"
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func newTestIdempotencyService(r *mocks.Repository) *IdempotencyServiceImpl {
+	s := NewIdempotencyService(r, 24*time.Hour, time.Minute)
+	s.now = func() time.Time { return testNow }
+	// the purges are tested on their own
+	s.purge.next = testNow.Add(purgeInterval)
+	return s
+}
+
+var testIdempotentRequest = model.IdempotentRequest{Owner: "user:1@", Key: "key-1", Fingerprint: "fingerprint-1"}
+
+func TestBeginIdempotentRequest(t *testing.T) {
+	ctx := context.Background()
+	created := http.StatusCreated
+	completed := entity.IdempotencyKey{Owner: "user:1@", Key: "key-1", Fingerprint: "fingerprint-1", StatusCode: &created,
+		ResponseHeader: `{"Content-Type":["application/json"]}`, ResponseBody: []byte(`{"id":1}`)}
+	inProgress := entity.IdempotencyKey{Owner: "user:1@", Key: "key-1", Fingerprint: "fingerprint-1"}
+	otherRequest := completed
+	otherRequest.Fingerprint = "fingerprint-2"
+	testCases := []struct {
+		Name             string
+		ReserveError     error
+		Found            entity.IdempotencyKey
+		FindError        error
+		ExpectedError    pkgerror.CustomError
+		ExpectedResponse *model.IdempotentResponse
+	}{
+		{
+			Name:          "Reserved",
+			ExpectedError: pkgerror.NoError,
+		},
+		{
+			Name:          "Replay",
+			ReserveError:  gorm.ErrRecordNotFound,
+			Found:         completed,
+			ExpectedError: pkgerror.NoError,
+			ExpectedResponse: &model.IdempotentResponse{
+				StatusCode: http.StatusCreated,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       []byte(`{"id":1}`),
+			},
+		},
+		{
+			Name:          "KeyReused",
+			ReserveError:  gorm.ErrRecordNotFound,
+			Found:         otherRequest,
+			ExpectedError: pkgerror.ErrIdempotencyKeyReused,
+		},
+		{
+			Name:          "InProgress",
+			ReserveError:  gorm.ErrRecordNotFound,
+			Found:         inProgress,
+			ExpectedError: pkgerror.ErrIdempotencyInProgress,
+		},
+		{
+			Name:          "Released",
+			ReserveError:  gorm.ErrRecordNotFound,
+			FindError:     gorm.ErrRecordNotFound,
+			ExpectedError: pkgerror.ErrIdempotencyInProgress,
+		},
+		{
+			Name:          "ReserveError",
+			ReserveError:  errors.New("connection refused"),
+			ExpectedError: pkgerror.ErrSystemError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			r.On("ReserveIdempotencyKey", ctx, mock.MatchedBy(func(k *entity.IdempotencyKey) bool {
+				return k.Owner == "user:1@" && k.Key == "key-1" && k.Fingerprint == "fingerprint-1" &&
+					k.StatusCode == nil && k.ExpiresAt.Equal(testNow.Add(24*time.Hour)) && k.LockedUntil.Equal(testNow.Add(time.Minute))
+			}), testNow).Return(tc.ReserveError)
+			r.On("FindIdempotencyKey", ctx, "user:1@", "key-1").Return(tc.Found, tc.FindError)
+
+			res, err := newTestIdempotencyService(r).BeginRequest(ctx, testIdempotentRequest)
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			assert.Equal(t, tc.ExpectedResponse, res)
+		})
+	}
+}
+
+func TestCompleteIdempotentRequest(t *testing.T) {
+	ctx := context.Background()
+	r := new(mocks.Repository)
+	r.On("CompleteIdempotencyKey", ctx, mock.MatchedBy(func(k *entity.IdempotencyKey) bool {
+		return k.Owner == "user:1@" && k.Key == "key-1" && k.Fingerprint == "fingerprint-1" && *k.StatusCode == http.StatusCreated &&
+			k.ResponseHeader == `{"Content-Type":["application/json"]}` && string(k.ResponseBody) == `{"id":1}`
+	})).Return(nil)
+	s := newTestIdempotencyService(r)
+
+	err := s.CompleteRequest(ctx, testIdempotentRequest, model.IdempotentResponse{
+		StatusCode: http.StatusCreated,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       []byte(`{"id":1}`),
+	})
+	assert.True(t, err.IsNoError())
+	r.AssertExpectations(t)
+}
+
+func TestReleaseIdempotentRequest(t *testing.T) {
+	ctx := context.Background()
+	r := new(mocks.Repository)
+	r.On("DeleteIdempotencyKey", ctx, "user:1@", "key-1", "fingerprint-1").Return(nil)
+
+	err := newTestIdempotencyService(r).ReleaseRequest(ctx, testIdempotentRequest)
+	assert.True(t, err.IsNoError())
+	r.AssertExpectations(t)
+}
+
+func TestPurgeExpiredIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	r := new(mocks.Repository)
+	r.On("PurgeIdempotencyKeys", ctx, testNow).Return(0, errors.New("database error")).Once()
+	r.On("PurgeIdempotencyKeys", ctx, testNow.Add(purgeInterval)).Return(3, nil).Once()
+	r.On("ReserveIdempotencyKey", ctx, mock.Anything, mock.Anything).Return(nil)
+	s := newTestIdempotencyService(r)
+	s.purge.next = time.Time{}
+
+	// a failed purge does not fail the request
+	for _, now := range []time.Time{testNow, testNow.Add(time.Minute), testNow.Add(purgeInterval)} {
+		s.now = func() time.Time { return now }
+		_, err := s.BeginRequest(ctx, testIdempotentRequest)
+		assert.True(t, err.IsNoError())
+	}
+	r.AssertExpectations(t)
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"backend_test/repository"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/ratelimit"
+	"backend_test/pkg/totp"
+	"backend_test/pkg/util/tokenutil"
+
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+)
+
+const (
+	recoveryCodeCount = 10
+	// totpSkew is the number of time steps a code may drift
+	totpSkew = 1
+)
+
+var errMfaCodeReplayed = errors.New("code of an already used time step")
+
+type MfaService interface {
+	Enroll(ctx context.Context, principal model.Principal) (*model.MfaEnrolmentResult, pkgerror.CustomError)
+	Confirm(ctx context.Context, principal model.Principal, req model.ConfirmMfaRequest) (*model.MfaRecoveryCodesResult, pkgerror.CustomError)
+	Verify(ctx context.Context, principal model.Principal, req model.VerifyMfaRequest) pkgerror.CustomError
+	Reset(ctx context.Context, principal model.Principal, req model.ResetMfaRequest) pkgerror.CustomError
+	IsMfaVerified(ctx context.Context, user model.UserRef, sessionKey string) (bool, pkgerror.CustomError)
+}
+
+type MfaOptions struct {
+	// Issuer is the account issuer shown by authenticator apps
+	Issuer string
+	// VerificationTTL is how long a verified session may reach the routes
+	// requiring MFA
+	VerificationTTL time.Duration
+	// RequireEnrolment denies the routes requiring MFA to the users that
+	// did not enrol, otherwise only the enrolled users are challenged
+	RequireEnrolment bool
+	// MaxAttempts is the number of codes a user may try per AttemptWindow
+	// until one is accepted, 0 disables the limit
+	MaxAttempts   int
+	AttemptWindow time.Duration
+}
+
+type MfaServiceImpl struct {
+	repo     repository.Repository
+	opts     MfaOptions
+	attempts *ratelimit.Limiter
+	now      func() time.Time
+}
+
+func NewMfaService(repo repository.Repository, opts MfaOptions) *MfaServiceImpl {
+	return &MfaServiceImpl{
+		repo:     repo,
+		opts:     opts,
+		attempts: ratelimit.New(opts.MaxAttempts, opts.AttemptWindow),
+		now:      time.Now,
+	}
+}
+
+// allowAttempt counts a code tried by the user, the attempts are reset
+// when a code is accepted so that only the failures lock the user out
+func (s *MfaServiceImpl) allowAttempt(user model.UserRef) pkgerror.CustomError {
+	if !s.attempts.Allow(user.String()) {
+		return pkgerror.ErrTooManyRequests.WithError(fmt.Errorf("MFA attempts of user %s exceeded", user))
+	}
+	return pkgerror.NoError
+}
+
+func (s *MfaServiceImpl) findEnrolment(ctx context.Context, user model.UserRef) (entity.MfaEnrolment, pkgerror.CustomError) {
+	enrolment, err := s.repo.FindMfaEnrolment(ctx, user)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return enrolment, pkgerror.ErrMfaNotEnrolled.WithError(err)
+		}
+		log.Error("Find MFA enrolment error: ", err)
+		return enrolment, pkgerror.ErrSystemError.WithError(err)
+	}
+	return enrolment, pkgerror.NoError
+}
+
+// Enroll starts an enrolment with a new secret, replacing the pending one
+func (s *MfaServiceImpl) Enroll(ctx context.Context, principal model.Principal) (*model.MfaEnrolmentResult, pkgerror.CustomError) {
+	enrolment, cerr := s.findEnrolment(ctx, principal.UserRef())
+	if cerr.IsNoError() && enrolment.IsEnabled() {
+		return nil, pkgerror.ErrMfaIsEnrolled
+	}
+	if !cerr.IsNoError() && cerr.Code != pkgerror.ErrMfaNotEnrolled.Code {
+		return nil, cerr
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Error("Generate TOTP secret error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	enrolment = entity.MfaEnrolment{Issuer: principal.Issuer, UserID: principal.UserID, Email: principal.Email, Secret: secret}
+	if err := s.repo.SaveMfaEnrolment(ctx, &enrolment); err != nil {
+		log.Error("Save MFA enrolment error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	return &model.MfaEnrolmentResult{
+		Secret:     secret,
+		OtpauthURI: totp.URI(s.opts.Issuer, principal.Email, secret),
+	}, pkgerror.NoError
+}
+
+// Confirm enables the pending enrolment and returns its recovery codes, the
+// session of the confirmation is verified
+func (s *MfaServiceImpl) Confirm(ctx context.Context, principal model.Principal, req model.ConfirmMfaRequest) (*model.MfaRecoveryCodesResult, pkgerror.CustomError) {
+	enrolment, cerr := s.findEnrolment(ctx, principal.UserRef())
+	if !cerr.IsNoError() {
+		return nil, cerr
+	}
+	if enrolment.IsEnabled() {
+		return nil, pkgerror.ErrMfaIsEnrolled
+	}
+	if cerr := s.allowAttempt(principal.UserRef()); !cerr.IsNoError() {
+		return nil, cerr
+	}
+	now := s.now()
+	step, ok := totp.Validate(enrolment.Secret, req.Code, now, totpSkew)
+	if !ok {
+		return nil, pkgerror.ErrInvalidMfaCode
+	}
+	codes, hashes, err := generateRecoveryCodes(principal.UserRef())
+	if err != nil {
+		log.Error("Generate recovery codes error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	err = s.repo.WithTx(ctx, func(txRepo repository.Repository) error {
+		if err := txRepo.UseMfaStep(ctx, principal.UserRef(), step); err != nil {
+			return err
+		}
+		if err := txRepo.EnableMfaEnrolment(ctx, principal.UserRef(), now); err != nil {
+			return err
+		}
+		if err := txRepo.CreateMfaRecoveryCodes(ctx, hashes); err != nil {
+			return err
+		}
+		return s.saveVerification(ctx, txRepo, principal.UserRef(), req.SessionKey)
+	})
+	if err != nil {
+		log.Error("Enable MFA enrolment error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerror.ErrInvalidMfaCode.WithError(errMfaCodeReplayed)
+		}
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	s.attempts.Reset(principal.UserRef().String())
+	return &model.MfaRecoveryCodesResult{RecoveryCodes: codes}, pkgerror.NoError
+}
+
+// Verify passes the second factor for the session, a code is accepted once
+// and a recovery code is consumed
+func (s *MfaServiceImpl) Verify(ctx context.Context, principal model.Principal, req model.VerifyMfaRequest) pkgerror.CustomError {
+	enrolment, cerr := s.findEnrolment(ctx, principal.UserRef())
+	if !cerr.IsNoError() {
+		return cerr
+	}
+	if !enrolment.IsEnabled() {
+		return pkgerror.ErrMfaNotEnrolled
+	}
+	if cerr := s.allowAttempt(principal.UserRef()); !cerr.IsNoError() {
+		return cerr
+	}
+	now := s.now()
+	err := s.repo.WithTx(ctx, func(txRepo repository.Repository) error {
+		if req.Code != "" {
+			step, ok := totp.Validate(enrolment.Secret, req.Code, now, totpSkew)
+			if !ok {
+				return gorm.ErrRecordNotFound
+			}
+			if err := txRepo.UseMfaStep(ctx, principal.UserRef(), step); err != nil {
+				return err
+			}
+		} else {
+			hash := tokenutil.Hash(normalizeRecoveryCode(req.RecoveryCode))
+			if err := txRepo.UseMfaRecoveryCode(ctx, principal.UserRef(), hash, now); err != nil {
+				return err
+			}
+		}
+		return s.saveVerification(ctx, txRepo, principal.UserRef(), req.SessionKey)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrInvalidMfaCode
+		}
+		log.Error("Verify MFA code error: ", err)
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	s.attempts.Reset(principal.UserRef().String())
+	return pkgerror.NoError
+}
+
+// Reset removes the enrolment of a user who lost their authenticator and
+// recovery codes, they can enrol again
+func (s *MfaServiceImpl) Reset(ctx context.Context, principal model.Principal, req model.ResetMfaRequest) pkgerror.CustomError {
+	user := model.UserRef{Issuer: req.Issuer, ID: req.UserID}
+	if err := s.repo.DeleteMfaEnrolment(ctx, user); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrMfaNotEnrolled.WithError(err)
+		}
+		log.Error("Delete MFA enrolment error: ", err)
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	log.Infof("MFA of user %s reset by user %s", user, principal.UserRef())
+	return pkgerror.NoError
+}
+
+// IsMfaVerified reports whether the session passed the second factor, the
+// users without an enabled enrolment pass unless enrolment is required
+func (s *MfaServiceImpl) IsMfaVerified(ctx context.Context, user model.UserRef, sessionKey string) (bool, pkgerror.CustomError) {
+	enrolment, cerr := s.findEnrolment(ctx, user)
+	if cerr.Code == pkgerror.ErrMfaNotEnrolled.Code || (cerr.IsNoError() && !enrolment.IsEnabled()) {
+		return !s.opts.RequireEnrolment, pkgerror.NoError
+	}
+	if !cerr.IsNoError() {
+		return false, cerr
+	}
+	verified, err := s.repo.IsMfaVerified(ctx, user, sessionKey, s.now())
+	if err != nil {
+		log.Error("Find MFA verification error: ", err)
+		return false, pkgerror.ErrSystemError.WithError(err)
+	}
+	return verified, pkgerror.NoError
+}
+
+func (s *MfaServiceImpl) saveVerification(ctx context.Context, repo repository.Repository, user model.UserRef, sessionKey string) error {
+	return repo.SaveMfaVerification(ctx, &entity.MfaVerification{
+		SessionKey: sessionKey,
+		Issuer:     user.Issuer,
+		UserID:     user.ID,
+		ExpiresAt:  s.now().Add(s.opts.VerificationTTL),
+	})
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns the codes shown to the user, formatted as
+// xxxx-xxxx-xxxx-xxxx, and their hashes to store
+func generateRecoveryCodes(user model.UserRef) ([]string, []entity.MfaRecoveryCode, error) {
+	codes := []string{}
+	hashes := []entity.MfaRecoveryCode{}
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes = append(codes, raw[0:4]+"-"+raw[4:8]+"-"+raw[8:12]+"-"+raw[12:16])
+		hashes = append(hashes, entity.MfaRecoveryCode{Issuer: user.Issuer, UserID: user.ID, CodeHash: tokenutil.Hash(raw)})
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts a recovery code typed without dashes or in
+// upper case
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"backend_test/entity"
+	mocks "backend_test/mocks/repository"
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/totp"
+	"backend_test/pkg/util/tokenutil"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+const testTotpSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func newTestMfaService(r *mocks.Repository) *MfaServiceImpl {
+	s := NewMfaService(r, MfaOptions{Issuer: "Backend Test", VerificationTTL: time.Hour, MaxAttempts: 3, AttemptWindow: time.Hour})
+	s.now = func() time.Time { return testNow }
+	return s
+}
+
+func totpCode(t time.Time) string {
+	code, _ := totp.Code(testTotpSecret, totp.Step(t))
+	return code
+}
+
+func TestEnrollMfa(t *testing.T) {
+	ctx := context.Background()
+	enabledAt := testNow.Add(-time.Hour)
+
+	r := new(mocks.Repository)
+	r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(entity.MfaEnrolment{UserID: 1, EnabledAt: &enabledAt}, nil).Once()
+	_, err := newTestMfaService(r).Enroll(ctx, createPrincipal(false))
+	assert.Equal(t, pkgerror.ErrMfaIsEnrolled.Code, err.Code)
+
+	r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(entity.MfaEnrolment{}, gorm.ErrRecordNotFound)
+	r.On("SaveMfaEnrolment", ctx, mock.MatchedBy(func(e *entity.MfaEnrolment) bool {
+		return e.UserID == 1 && e.Email == "user@gmail.com" && e.Secret != "" && e.EnabledAt == nil
+	})).Return(nil)
+	result, err := newTestMfaService(r).Enroll(ctx, createPrincipal(false))
+	assert.True(t, err.IsNoError())
+	assert.True(t, strings.HasPrefix(result.OtpauthURI, "otpauth://totp/Backend%20Test:user@gmail.com?"))
+	assert.Contains(t, result.OtpauthURI, "secret="+result.Secret)
+	r.AssertExpectations(t)
+}
+
+func TestConfirmMfa(t *testing.T) {
+	ctx := context.Background()
+	pending := entity.MfaEnrolment{UserID: 1, Secret: testTotpSecret}
+	testCases := []struct {
+		Name          string
+		InitRepo      func(r *mocks.Repository)
+		Code          string
+		ExpectedError pkgerror.CustomError
+	}{
+		{
+			Name: "NotEnrolled",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(entity.MfaEnrolment{}, gorm.ErrRecordNotFound)
+			},
+			Code:          totpCode(testNow),
+			ExpectedError: pkgerror.ErrMfaNotEnrolled,
+		},
+		{
+			Name: "InvalidCode",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(pending, nil)
+			},
+			Code:          totpCode(testNow.Add(-2 * totp.Period)),
+			ExpectedError: pkgerror.ErrInvalidMfaCode,
+		},
+		{
+			Name: "Success",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(pending, nil)
+				onWithTx(r)
+				r.On("UseMfaStep", ctx, model.UserRef{ID: 1}, totp.Step(testNow)).Return(nil)
+				r.On("EnableMfaEnrolment", ctx, model.UserRef{ID: 1}, testNow).Return(nil)
+				r.On("CreateMfaRecoveryCodes", ctx, mock.MatchedBy(func(codes []entity.MfaRecoveryCode) bool {
+					return len(codes) == recoveryCodeCount && codes[0].UserID == 1
+				})).Return(nil)
+				r.On("SaveMfaVerification", ctx, &entity.MfaVerification{SessionKey: "session-1", UserID: 1, ExpiresAt: testNow.Add(time.Hour)}).Return(nil)
+			},
+			Code:          totpCode(testNow),
+			ExpectedError: pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			tc.InitRepo(r)
+			result, err := newTestMfaService(r).Confirm(ctx, createPrincipal(false), model.ConfirmMfaRequest{Code: tc.Code, SessionKey: "session-1"})
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			if tc.ExpectedError.IsNoError() {
+				assert.Len(t, result.RecoveryCodes, recoveryCodeCount)
+				assert.Len(t, result.RecoveryCodes[0], 19)
+			}
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestVerifyMfa(t *testing.T) {
+	ctx := context.Background()
+	enabledAt := testNow.Add(-time.Hour)
+	enabled := entity.MfaEnrolment{UserID: 1, Secret: testTotpSecret, EnabledAt: &enabledAt}
+	verification := &entity.MfaVerification{SessionKey: "session-1", UserID: 1, ExpiresAt: testNow.Add(time.Hour)}
+	testCases := []struct {
+		Name          string
+		InitRepo      func(r *mocks.Repository)
+		Request       model.VerifyMfaRequest
+		ExpectedError pkgerror.CustomError
+	}{
+		{
+			Name: "Pending",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(entity.MfaEnrolment{UserID: 1, Secret: testTotpSecret}, nil)
+			},
+			Request:       model.VerifyMfaRequest{Code: totpCode(testNow)},
+			ExpectedError: pkgerror.ErrMfaNotEnrolled,
+		},
+		{
+			Name: "WrongCode",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(enabled, nil)
+				onWithTx(r)
+			},
+			Request:       model.VerifyMfaRequest{Code: totpCode(testNow.Add(5 * totp.Period))},
+			ExpectedError: pkgerror.ErrInvalidMfaCode,
+		},
+		{
+			Name: "ReplayedCode",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(enabled, nil)
+				onWithTx(r)
+				r.On("UseMfaStep", ctx, model.UserRef{ID: 1}, totp.Step(testNow)).Return(gorm.ErrRecordNotFound)
+			},
+			Request:       model.VerifyMfaRequest{Code: totpCode(testNow)},
+			ExpectedError: pkgerror.ErrInvalidMfaCode,
+		},
+		{
+			Name: "DriftedCode",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(enabled, nil)
+				onWithTx(r)
+				r.On("UseMfaStep", ctx, model.UserRef{ID: 1}, totp.Step(testNow)-1).Return(nil)
+				r.On("SaveMfaVerification", ctx, verification).Return(nil)
+			},
+			Request:       model.VerifyMfaRequest{Code: totpCode(testNow.Add(-totp.Period))},
+			ExpectedError: pkgerror.NoError,
+		},
+		{
+			Name: "RecoveryCode",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(enabled, nil)
+				onWithTx(r)
+				r.On("UseMfaRecoveryCode", ctx, model.UserRef{ID: 1}, tokenutil.Hash("abcdefghijklmnop"), testNow).Return(nil)
+				r.On("SaveMfaVerification", ctx, verification).Return(nil)
+			},
+			Request:       model.VerifyMfaRequest{RecoveryCode: "ABCD-efgh-ijkl-mnop"},
+			ExpectedError: pkgerror.NoError,
+		},
+		{
+			Name: "UsedRecoveryCode",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(enabled, nil)
+				onWithTx(r)
+				r.On("UseMfaRecoveryCode", ctx, model.UserRef{ID: 1}, tokenutil.Hash("abcdefghijklmnop"), testNow).Return(gorm.ErrRecordNotFound)
+			},
+			Request:       model.VerifyMfaRequest{RecoveryCode: "abcd-efgh-ijkl-mnop"},
+			ExpectedError: pkgerror.ErrInvalidMfaCode,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			tc.InitRepo(r)
+			tc.Request.SessionKey = "session-1"
+			err := newTestMfaService(r).Verify(ctx, createPrincipal(false), tc.Request)
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestMfaLockout(t *testing.T) {
+	ctx := context.Background()
+	enabledAt := testNow.Add(-time.Hour)
+	enabled := entity.MfaEnrolment{UserID: 1, Secret: testTotpSecret, EnabledAt: &enabledAt}
+	wrongCode := model.VerifyMfaRequest{Code: totpCode(testNow.Add(5 * totp.Period)), SessionKey: "session-1"}
+	wrongRecoveryCode := model.VerifyMfaRequest{RecoveryCode: "abcd-efgh-ijkl-mnop", SessionKey: "session-2"}
+
+	t.Run("LocksOutAfterFailures", func(t *testing.T) {
+		r := new(mocks.Repository)
+		r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(enabled, nil)
+		onWithTx(r)
+		r.On("UseMfaRecoveryCode", ctx, model.UserRef{ID: 1}, tokenutil.Hash("abcdefghijklmnop"), testNow).Return(gorm.ErrRecordNotFound)
+		s := newTestMfaService(r)
+		// the failures of the codes and of the recovery codes of any
+		// session add up
+		for _, req := range []model.VerifyMfaRequest{wrongCode, wrongRecoveryCode, wrongCode} {
+			assert.Equal(t, pkgerror.ErrInvalidMfaCode.Code, s.Verify(ctx, createPrincipal(false), req).Code)
+		}
+		// even a valid code is refused until the attempt window ends
+		err := s.Verify(ctx, createPrincipal(false), model.VerifyMfaRequest{Code: totpCode(testNow), SessionKey: "session-1"})
+		assert.Equal(t, pkgerror.ErrTooManyRequests.Code, err.Code)
+		r.AssertNotCalled(t, "UseMfaStep", mock.Anything, mock.Anything, mock.Anything)
+		r.AssertExpectations(t)
+	})
+
+	t.Run("AcceptedCodeResets", func(t *testing.T) {
+		r := new(mocks.Repository)
+		r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(enabled, nil)
+		onWithTx(r)
+		r.On("UseMfaStep", ctx, model.UserRef{ID: 1}, totp.Step(testNow)).Return(nil)
+		r.On("SaveMfaVerification", ctx, mock.Anything).Return(nil)
+		s := newTestMfaService(r)
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, pkgerror.ErrInvalidMfaCode.Code, s.Verify(ctx, createPrincipal(false), wrongCode).Code)
+		}
+		assert.True(t, s.Verify(ctx, createPrincipal(false), model.VerifyMfaRequest{Code: totpCode(testNow), SessionKey: "session-1"}).IsNoError())
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, pkgerror.ErrInvalidMfaCode.Code, s.Verify(ctx, createPrincipal(false), wrongCode).Code, "attempt %d", i)
+		}
+		assert.Equal(t, pkgerror.ErrTooManyRequests.Code, s.Verify(ctx, createPrincipal(false), wrongCode).Code)
+	})
+
+	t.Run("Confirm", func(t *testing.T) {
+		r := new(mocks.Repository)
+		r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(entity.MfaEnrolment{UserID: 1, Secret: testTotpSecret}, nil)
+		s := newTestMfaService(r)
+		for i := 0; i < 3; i++ {
+			_, err := s.Confirm(ctx, createPrincipal(false), model.ConfirmMfaRequest{Code: wrongCode.Code, SessionKey: "session-1"})
+			assert.Equal(t, pkgerror.ErrInvalidMfaCode.Code, err.Code)
+		}
+		_, err := s.Confirm(ctx, createPrincipal(false), model.ConfirmMfaRequest{Code: totpCode(testNow), SessionKey: "session-1"})
+		assert.Equal(t, pkgerror.ErrTooManyRequests.Code, err.Code)
+		r.AssertExpectations(t)
+	})
+}
+
+func TestResetMfa(t *testing.T) {
+	ctx := context.Background()
+	r := new(mocks.Repository)
+	r.On("DeleteMfaEnrolment", ctx, model.UserRef{ID: 7}).Return(gorm.ErrRecordNotFound).Once()
+	r.On("DeleteMfaEnrolment", ctx, model.UserRef{ID: 7}).Return(nil).Once()
+	s := newTestMfaService(r)
+	assert.Equal(t, pkgerror.ErrMfaNotEnrolled.Code, s.Reset(ctx, createPrincipal(true), model.ResetMfaRequest{UserID: 7}).Code)
+	assert.True(t, s.Reset(ctx, createPrincipal(true), model.ResetMfaRequest{UserID: 7}).IsNoError())
+	r.AssertExpectations(t)
+}
+
+func TestIsMfaVerified(t *testing.T) {
+	ctx := context.Background()
+	enabledAt := testNow.Add(-time.Hour)
+	testCases := []struct {
+		Name             string
+		InitRepo         func(r *mocks.Repository)
+		RequireEnrolment bool
+		Expected         bool
+	}{
+		{
+			Name: "NotEnrolled",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(entity.MfaEnrolment{}, gorm.ErrRecordNotFound)
+			},
+			Expected: true,
+		},
+		{
+			Name: "NotEnrolledRequired",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(entity.MfaEnrolment{}, gorm.ErrRecordNotFound)
+			},
+			RequireEnrolment: true,
+			Expected:         false,
+		},
+		{
+			Name: "Pending",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(entity.MfaEnrolment{UserID: 1}, nil)
+			},
+			Expected: true,
+		},
+		{
+			Name: "EnabledNotVerified",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(entity.MfaEnrolment{UserID: 1, EnabledAt: &enabledAt}, nil)
+				r.On("IsMfaVerified", ctx, model.UserRef{ID: 1}, "session-1", testNow).Return(false, nil)
+			},
+			Expected: false,
+		},
+		{
+			Name: "EnabledVerified",
+			InitRepo: func(r *mocks.Repository) {
+				r.On("FindMfaEnrolment", ctx, model.UserRef{ID: 1}).Return(entity.MfaEnrolment{UserID: 1, EnabledAt: &enabledAt}, nil)
+				r.On("IsMfaVerified", ctx, model.UserRef{ID: 1}, "session-1", testNow).Return(true, nil)
+			},
+			Expected: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			tc.InitRepo(r)
+			s := newTestMfaService(r)
+			s.opts.RequireEnrolment = tc.RequireEnrolment
+			verified, err := s.IsMfaVerified(ctx, model.UserRef{ID: 1}, "session-1")
+			assert.True(t, err.IsNoError())
+			assert.Equal(t, tc.Expected, verified)
+			r.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"backend_test/model"
+	"sync"
+	"time"
+)
+
+// PermissionCache keeps the grants of a user for a TTL so that
+// the permission check does not hit the database on every request. It is
+// invalidated when the roles of a user or the roles themselves change.
+type PermissionCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.RWMutex
+	entries map[model.UserRef]permissionCacheEntry
+}
+
+type permissionCacheEntry struct {
+	grants    model.UserGrants
+	expiresAt time.Time
+}
+
+// NewPermissionCache creates the cache, a zero ttl disables caching
+func NewPermissionCache(ttl time.Duration) *PermissionCache {
+	return &PermissionCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[model.UserRef]permissionCacheEntry{},
+	}
+}
+
+func (c *PermissionCache) Get(user model.UserRef) (model.UserGrants, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.entries[user]
+	if !ok || !c.now().Before(e.expiresAt) {
+		return model.UserGrants{}, false
+	}
+	return e.grants, true
+}
+
+func (c *PermissionCache) Set(user model.UserRef, grants model.UserGrants) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[user] = permissionCacheEntry{grants: grants, expiresAt: c.now().Add(c.ttl)}
+}
+
+func (c *PermissionCache) Invalidate(user model.UserRef) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, user)
+}
+
+func (c *PermissionCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[model.UserRef]permissionCacheEntry{}
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// purgeInterval is how often the expired rows of a table are deleted
+const purgeInterval = 10 * time.Minute
+
+// purgeSchedule spreads the purges of expired rows over the requests, a
+// purge is due at most once per purgeInterval per instance of the service
+type purgeSchedule struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// due reports whether a purge is due and if so schedules the next one
+func (p *purgeSchedule) due(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if now.Before(p.next) {
+		return false
+	}
+	p.next = now.Add(purgeInterval)
+	return true
+}
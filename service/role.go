@@ -0,0 +1,272 @@
+package service
+
+import (
+	"backend_test/entity"
+	"backend_test/model"
+	"backend_test/repository"
+	"context"
+	"errors"
+	"fmt"
+
+	pkgerror "backend_test/pkg/error"
+	"backend_test/pkg/util/copyutil"
+
+	"github.com/labstack/gommon/log"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+)
+
+type RoleService interface {
+	GetRoles(ctx context.Context, principal model.Principal) (*[]model.RoleResult, pkgerror.CustomError)
+	GetRoleByID(ctx context.Context, principal model.Principal, req model.GetRoleByIDRequest) (*model.RoleResult, pkgerror.CustomError)
+	CreateRole(ctx context.Context, principal model.Principal, req model.CreateRoleRequest) (*model.RoleResult, pkgerror.CustomError)
+	EditRole(ctx context.Context, principal model.Principal, req model.EditRoleRequest) (*model.RoleResult, pkgerror.CustomError)
+	DeleteRole(ctx context.Context, principal model.Principal, req model.DeleteRoleRequest) pkgerror.CustomError
+	GetPermissions(ctx context.Context, principal model.Principal) (*[]model.PermissionResult, pkgerror.CustomError)
+	CreatePermission(ctx context.Context, principal model.Principal, req model.CreatePermissionRequest) (*model.PermissionResult, pkgerror.CustomError)
+	DeletePermission(ctx context.Context, principal model.Principal, req model.DeletePermissionRequest) pkgerror.CustomError
+	GetUserRoles(ctx context.Context, principal model.Principal, req model.GetUserRolesRequest) (*[]model.RoleResult, pkgerror.CustomError)
+	AssignUserRole(ctx context.Context, principal model.Principal, req model.UserRoleRequest) pkgerror.CustomError
+	RevokeUserRole(ctx context.Context, principal model.Principal, req model.UserRoleRequest) pkgerror.CustomError
+	GetUserGrants(ctx context.Context, user model.UserRef) (model.UserGrants, pkgerror.CustomError)
+}
+
+type RoleServiceImpl struct {
+	repo  repository.Repository
+	cache *PermissionCache
+}
+
+func NewRoleService(repo repository.Repository, cache *PermissionCache) *RoleServiceImpl {
+	return &RoleServiceImpl{
+		repo:  repo,
+		cache: cache,
+	}
+}
+
+func newRoleResult(role entity.Role) model.RoleResult {
+	result := model.RoleResult{}
+	copyutil.Copy(&role, &result)
+	result.Permissions = []string{}
+	for _, p := range role.Permissions {
+		result.Permissions = append(result.Permissions, p.Code)
+	}
+	return result
+}
+
+func newRoleResults(roles []entity.Role) []model.RoleResult {
+	results := []model.RoleResult{}
+	for _, role := range roles {
+		results = append(results, newRoleResult(role))
+	}
+	return results
+}
+
+func (s *RoleServiceImpl) GetRoles(ctx context.Context, principal model.Principal) (*[]model.RoleResult, pkgerror.CustomError) {
+	roles, err := s.repo.FindRoles(ctx)
+	if err != nil {
+		log.Error("Find roles error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	results := newRoleResults(roles)
+	return &results, pkgerror.NoError
+}
+
+func (s *RoleServiceImpl) GetRoleByID(ctx context.Context, principal model.Principal, req model.GetRoleByIDRequest) (*model.RoleResult, pkgerror.CustomError) {
+	role, err := s.repo.FindRoleByID(ctx, uint(req.RoleID))
+	if err != nil {
+		log.Error("Find role by ID error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerror.ErrRoleNotFound.WithError(err)
+		}
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	result := newRoleResult(role)
+	return &result, pkgerror.NoError
+}
+
+// findPermissions loads the permissions of codes, all of them must exist
+func findPermissions(ctx context.Context, repo repository.Repository, codes []string) ([]entity.Permission, pkgerror.CustomError) {
+	permissions, err := repo.FindPermissionsByCodes(ctx, codes)
+	if err != nil {
+		log.Error("Find permissions by codes error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	for _, code := range codes {
+		found := slices.IndexFunc(permissions, func(p entity.Permission) bool { return p.Code == code }) >= 0
+		if !found {
+			return nil, pkgerror.ErrPermissionNotFound.WithError(fmt.Errorf("Permission `%s` does not exist.", code))
+		}
+	}
+	return permissions, pkgerror.NoError
+}
+
+func (s *RoleServiceImpl) CreateRole(ctx context.Context, principal model.Principal, req model.CreateRoleRequest) (*model.RoleResult, pkgerror.CustomError) {
+	_, err := s.repo.FindRoleByCode(ctx, req.Code)
+	if err == nil {
+		return nil, pkgerror.ErrRoleIsExist.WithError(errors.New("Role `code` is already created."))
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Error("Find role by code error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	permissions, cerr := findPermissions(ctx, s.repo, req.Permissions)
+	if !cerr.IsNoError() {
+		return nil, cerr
+	}
+	role := entity.Role{Code: req.Code, Name: req.Name, Permissions: permissions}
+	err = s.repo.WithTx(ctx, func(txRepo repository.Repository) error {
+		return txRepo.CreateRole(ctx, &role)
+	})
+	if err != nil {
+		log.Error("Create role error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	result := newRoleResult(role)
+	return &result, pkgerror.NoError
+}
+
+func (s *RoleServiceImpl) EditRole(ctx context.Context, principal model.Principal, req model.EditRoleRequest) (*model.RoleResult, pkgerror.CustomError) {
+	role, err := s.repo.FindRoleByID(ctx, uint(req.RoleID))
+	if err != nil {
+		log.Error("Find role by ID error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerror.ErrRoleNotFound.WithError(err)
+		}
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	permissions, cerr := findPermissions(ctx, s.repo, req.Permissions)
+	if !cerr.IsNoError() {
+		return nil, cerr
+	}
+	role.Name = req.Name
+	role.Permissions = permissions
+	err = s.repo.WithTx(ctx, func(txRepo repository.Repository) error {
+		return txRepo.UpdateRole(ctx, &role)
+	})
+	if err != nil {
+		log.Error("Update role error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, pkgerror.ErrRoleNotFound.WithError(err)
+		}
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	// the role may be assigned to any user
+	s.cache.Clear()
+	result := newRoleResult(role)
+	return &result, pkgerror.NoError
+}
+
+func (s *RoleServiceImpl) DeleteRole(ctx context.Context, principal model.Principal, req model.DeleteRoleRequest) pkgerror.CustomError {
+	if err := s.repo.DeleteRole(ctx, uint(req.RoleID)); err != nil {
+		log.Error("Delete role error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrRoleNotFound.WithError(err)
+		}
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	s.cache.Clear()
+	return pkgerror.NoError
+}
+
+func (s *RoleServiceImpl) GetPermissions(ctx context.Context, principal model.Principal) (*[]model.PermissionResult, pkgerror.CustomError) {
+	permissions, err := s.repo.FindPermissions(ctx)
+	if err != nil {
+		log.Error("Find permissions error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	results := []model.PermissionResult{}
+	copyutil.Copy(&permissions, &results)
+	return &results, pkgerror.NoError
+}
+
+func (s *RoleServiceImpl) CreatePermission(ctx context.Context, principal model.Principal, req model.CreatePermissionRequest) (*model.PermissionResult, pkgerror.CustomError) {
+	_, err := s.repo.FindPermissionByCode(ctx, req.Code)
+	if err == nil {
+		return nil, pkgerror.ErrPermissionIsExist.WithError(errors.New("Permission `code` is already created."))
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Error("Find permission by code error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	permission := entity.Permission{Code: req.Code, Description: req.Description}
+	if err := s.repo.CreatePermission(ctx, &permission); err != nil {
+		log.Error("Create permission error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	result := model.PermissionResult{}
+	copyutil.Copy(&permission, &result)
+	return &result, pkgerror.NoError
+}
+
+func (s *RoleServiceImpl) DeletePermission(ctx context.Context, principal model.Principal, req model.DeletePermissionRequest) pkgerror.CustomError {
+	if err := s.repo.DeletePermission(ctx, uint(req.PermissionID)); err != nil {
+		log.Error("Delete permission error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrPermissionNotFound.WithError(err)
+		}
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	s.cache.Clear()
+	return pkgerror.NoError
+}
+
+func (s *RoleServiceImpl) GetUserRoles(ctx context.Context, principal model.Principal, req model.GetUserRolesRequest) (*[]model.RoleResult, pkgerror.CustomError) {
+	roles, err := s.repo.FindUserRoles(ctx, model.UserRef{Issuer: req.Issuer, ID: req.UserID})
+	if err != nil {
+		log.Error("Find user roles error: ", err)
+		return nil, pkgerror.ErrSystemError.WithError(err)
+	}
+	results := newRoleResults(roles)
+	return &results, pkgerror.NoError
+}
+
+func (s *RoleServiceImpl) AssignUserRole(ctx context.Context, principal model.Principal, req model.UserRoleRequest) pkgerror.CustomError {
+	if _, err := s.repo.FindRoleByID(ctx, uint(req.RoleID)); err != nil {
+		log.Error("Find role by ID error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrRoleNotFound.WithError(err)
+		}
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	user := model.UserRef{Issuer: req.Issuer, ID: req.UserID}
+	if err := s.repo.AssignUserRole(ctx, user, uint(req.RoleID)); err != nil {
+		log.Error("Assign user role error: ", err)
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	s.cache.Invalidate(user)
+	return pkgerror.NoError
+}
+
+func (s *RoleServiceImpl) RevokeUserRole(ctx context.Context, principal model.Principal, req model.UserRoleRequest) pkgerror.CustomError {
+	user := model.UserRef{Issuer: req.Issuer, ID: req.UserID}
+	if err := s.repo.RevokeUserRole(ctx, user, uint(req.RoleID)); err != nil {
+		log.Error("Revoke user role error: ", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return pkgerror.ErrRoleNotFound.WithError(err)
+		}
+		return pkgerror.ErrSystemError.WithError(err)
+	}
+	s.cache.Invalidate(user)
+	return pkgerror.NoError
+}
+
+// GetUserGrants returns the codes of the roles assigned to the user and of
+// the permissions they grant, cached for the cache TTL
+func (s *RoleServiceImpl) GetUserGrants(ctx context.Context, user model.UserRef) (model.UserGrants, pkgerror.CustomError) {
+	if grants, ok := s.cache.Get(user); ok {
+		return grants, pkgerror.NoError
+	}
+	roles, err := s.repo.FindUserRoleCodes(ctx, user)
+	if err != nil {
+		log.Error("Find user role codes error: ", err)
+		return model.UserGrants{}, pkgerror.ErrSystemError.WithError(err)
+	}
+	permissions, err := s.repo.FindUserPermissionCodes(ctx, user)
+	if err != nil {
+		log.Error("Find user permission codes error: ", err)
+		return model.UserGrants{}, pkgerror.ErrSystemError.WithError(err)
+	}
+	grants := model.UserGrants{Roles: roles, Permissions: permissions}
+	s.cache.Set(user, grants)
+	return grants, pkgerror.NoError
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"backend_test/entity"
+	mocks "backend_test/mocks/repository"
+	"backend_test/model"
+	pkgerror "backend_test/pkg/error"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestCreateRole(t *testing.T) {
+	permissions := []entity.Permission{{ID: 1, Code: "read_employees"}, {ID: 2, Code: "update_employees"}}
+	request := model.CreateRoleRequest{Code: "hr_staff", Name: "HR Staff", Permissions: []string{"read_employees", "update_employees"}}
+	testCases := []struct {
+		Name           string
+		InitService    func(r *mocks.Repository) RoleService
+		Request        model.CreateRoleRequest
+		ExpectedResult *model.RoleResult
+		ExpectedError  pkgerror.CustomError
+	}{
+		{
+			Name: "RoleIsExist",
+			InitService: func(r *mocks.Repository) RoleService {
+				r.On("FindRoleByCode", context.Background(), "hr_staff").Return(entity.Role{ID: 1, Code: "hr_staff"}, nil)
+				return NewRoleService(r, NewPermissionCache(time.Minute))
+			},
+			Request:       request,
+			ExpectedError: pkgerror.ErrRoleIsExist,
+		},
+		{
+			Name: "PermissionNotFound",
+			InitService: func(r *mocks.Repository) RoleService {
+				r.On("FindRoleByCode", context.Background(), "hr_staff").Return(entity.Role{}, gorm.ErrRecordNotFound)
+				r.On("FindPermissionsByCodes", context.Background(), request.Permissions).Return(permissions[:1], nil)
+				return NewRoleService(r, NewPermissionCache(time.Minute))
+			},
+			Request:       request,
+			ExpectedError: pkgerror.ErrPermissionNotFound,
+		},
+		{
+			Name: "CreateRoleError",
+			InitService: func(r *mocks.Repository) RoleService {
+				r.On("FindRoleByCode", context.Background(), "hr_staff").Return(entity.Role{}, gorm.ErrRecordNotFound)
+				r.On("FindPermissionsByCodes", context.Background(), request.Permissions).Return(permissions, nil)
+				onWithTx(r)
+				r.On("CreateRole", context.Background(), mock.Anything).Return(errors.New("database error"))
+				return NewRoleService(r, NewPermissionCache(time.Minute))
+			},
+			Request:       request,
+			ExpectedError: pkgerror.ErrSystemError,
+		},
+		{
+			Name: "Success",
+			InitService: func(r *mocks.Repository) RoleService {
+				r.On("FindRoleByCode", context.Background(), "hr_staff").Return(entity.Role{}, gorm.ErrRecordNotFound)
+				r.On("FindPermissionsByCodes", context.Background(), request.Permissions).Return(permissions, nil)
+				onWithTx(r)
+				r.On("CreateRole", context.Background(), &entity.Role{Code: "hr_staff", Name: "HR Staff", Permissions: permissions}).Return(nil)
+				return NewRoleService(r, NewPermissionCache(time.Minute))
+			},
+			Request: request,
+			ExpectedResult: &model.RoleResult{
+				Code:        "hr_staff",
+				Name:        "HR Staff",
+				Permissions: []string{"read_employees", "update_employees"},
+			},
+			ExpectedError: pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			s := tc.InitService(r)
+			result, err := s.CreateRole(context.Background(), createPrincipal(false), tc.Request)
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			if tc.ExpectedResult != nil {
+				assert.Equal(t, tc.ExpectedResult, result)
+			}
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAssignUserRole(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		InitService   func(r *mocks.Repository) RoleService
+		ExpectedError pkgerror.CustomError
+	}{
+		{
+			Name: "RoleNotFound",
+			InitService: func(r *mocks.Repository) RoleService {
+				r.On("FindRoleByID", context.Background(), uint(3)).Return(entity.Role{}, gorm.ErrRecordNotFound)
+				return NewRoleService(r, NewPermissionCache(time.Minute))
+			},
+			ExpectedError: pkgerror.ErrRoleNotFound,
+		},
+		{
+			Name: "Success",
+			InitService: func(r *mocks.Repository) RoleService {
+				r.On("FindRoleByID", context.Background(), uint(3)).Return(entity.Role{ID: 3}, nil)
+				r.On("AssignUserRole", context.Background(), model.UserRef{ID: 7}, uint(3)).Return(nil)
+				return NewRoleService(r, NewPermissionCache(time.Minute))
+			},
+			ExpectedError: pkgerror.NoError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := new(mocks.Repository)
+			s := tc.InitService(r)
+			err := s.AssignUserRole(context.Background(), createPrincipal(false), model.UserRoleRequest{UserID: 7, RoleID: 3})
+			assert.Equal(t, tc.ExpectedError.Code, err.Code)
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetUserGrantsCache(t *testing.T) {
+	clock := time.Date(2026, 10, 18, 14, 0, 0, 0, time.UTC)
+	cache := NewPermissionCache(time.Minute)
+	cache.now = func() time.Time { return clock }
+	r := new(mocks.Repository)
+	r.On("FindUserRoleCodes", context.Background(), model.UserRef{ID: 7}).Return([]string{"hr_staff"}, nil)
+	r.On("FindUserPermissionCodes", context.Background(), model.UserRef{ID: 7}).Return([]string{"read_employees"}, nil)
+	r.On("FindRoleByID", context.Background(), uint(3)).Return(entity.Role{ID: 3}, nil)
+	r.On("AssignUserRole", context.Background(), model.UserRef{ID: 7}, uint(3)).Return(nil)
+	s := NewRoleService(r, cache)
+
+	for i := 0; i < 3; i++ {
+		grants, err := s.GetUserGrants(context.Background(), model.UserRef{ID: 7})
+		assert.True(t, err.IsNoError())
+		assert.Equal(t, model.UserGrants{Roles: []string{"hr_staff"}, Permissions: []string{"read_employees"}}, grants)
+	}
+	r.AssertNumberOfCalls(t, "FindUserPermissionCodes", 1)
+
+	// expired
+	clock = clock.Add(time.Minute)
+	_, _ = s.GetUserGrants(context.Background(), model.UserRef{ID: 7})
+	r.AssertNumberOfCalls(t, "FindUserPermissionCodes", 2)
+
+	// a role assignment invalidates the user entry
+	assert.True(t, s.AssignUserRole(context.Background(), createPrincipal(false), model.UserRoleRequest{UserID: 7, RoleID: 3}).IsNoError())
+	_, _ = s.GetUserGrants(context.Background(), model.UserRef{ID: 7})
+	r.AssertNumberOfCalls(t, "FindUserPermissionCodes", 3)
+}
+
+func TestGetUserGrantsError(t *testing.T) {
+	r := new(mocks.Repository)
+	r.On("FindUserRoleCodes", context.Background(), model.UserRef{ID: 7}).Return([]string{"hr_staff"}, nil)
+	r.On("FindUserPermissionCodes", context.Background(), model.UserRef{ID: 7}).Return(nil, errors.New("database error"))
+	s := NewRoleService(r, NewPermissionCache(time.Minute))
+	_, err := s.GetUserGrants(context.Background(), model.UserRef{ID: 7})
+	assert.Equal(t, pkgerror.ErrSystemError.Code, err.Code)
+	// errors are not cached
+	_, _ = s.GetUserGrants(context.Background(), model.UserRef{ID: 7})
+	r.AssertNumberOfCalls(t, "FindUserPermissionCodes", 2)
+}
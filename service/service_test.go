@@ -1,12 +1,18 @@
 package service
 
 import (
+	mocks "backend_test/mocks/repository"
 	"backend_test/model"
 	"backend_test/pkg/config"
-	"github.com/labstack/echo/v4"
+	"backend_test/pkg/policy"
+	"backend_test/pkg/util/contextutil"
+	pkgvalidator "backend_test/pkg/validator"
+	"backend_test/repository"
+	"context"
+	"github.com/go-playground/validator/v10"
+	"github.com/go-playground/validator/v10/non-standard/validators"
 	"github.com/labstack/gommon/log"
-	"net/http"
-	"net/http/httptest"
+	"github.com/stretchr/testify/mock"
 	"testing"
 )
 
@@ -18,14 +24,32 @@ func TestMain(m *testing.M) {
 	m.Run()
 }
 
-func createEchoContext(superadmin bool) echo.Context {
-	claims := model.JwtClaims{}
-	claims.Aud = []string{"backend-test"}
-	claims.User.Superadmin = superadmin
-	claims.User.ID = 1
-	claims.User.Email = "user@gmail.com"
-	e := echo.New()
-	ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
-	ctx.Set("jwt_claims", &claims)
-	return ctx
+var testValidator = newTestValidator()
+
+func newTestValidator() Validator {
+	v := validator.New()
+	v.RegisterValidation("notblank", validators.NotBlank)
+	return pkgvalidator.New(v)
+}
+
+// testPolicies has no rule, every action is allowed
+var testPolicies, _ = policy.NewEngine(nil, EmployeePolicyResource)
+
+// tenantCtx is scoped to the only app of createPrincipal
+var tenantCtx = contextutil.WithTenantScope(context.Background(), model.TenantScope{AppIDs: []int{1}})
+
+func createPrincipal(superadmin bool) model.Principal {
+	return model.Principal{
+		UserID:     1,
+		Email:      "user@gmail.com",
+		Superadmin: superadmin,
+		AppIDs:     []int{1},
+	}
+}
+
+// onWithTx makes the mocked repository run WithTx callbacks on itself
+func onWithTx(r *mocks.Repository) {
+	r.On("WithTx", mock.Anything, mock.Anything).Return(func(ctx context.Context, fn func(txRepo repository.Repository) error) error {
+		return fn(r)
+	})
 }